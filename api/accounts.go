@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"ledger/pg"
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetAccountHandler returns an account with its metadata, balance and
+// status.
+func GetAccountHandler(w http.ResponseWriter, r *http.Request) {
+	account, err := service.GetAccount(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving account")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, account)
+}
+
+// UpdateAccountHandler changes an account's name, type, labels or interest
+// plan.
+func UpdateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var body UpdateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	account, err := service.UpdateAccount(r.Context(), chi.URLParam(r, "id"), pg.AccountUpdate(body))
+	if err != nil {
+		respondWithServiceError(w, err, "Error updating account")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, account)
+}
+
+// ListUserAccountsHandler lists the accounts a user holds.
+func ListUserAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	accounts, err := service.ListUserAccounts(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing accounts")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, accounts)
+}
+
+// OpenAccountHandler queues an additional account for a user and responds
+// 202 with its generated ID.
+func OpenAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var body OpenAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	id, err := service.OpenAccount(r.Context(), chi.URLParam(r, "id"), service.NewAccount(body))
+	if err != nil {
+		respondWithServiceError(w, err, "Error opening account")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusAccepted, OpenAccountResponse{AccountID: id})
+}
+
+// FreezeAccountHandler queues a freeze of the account. The optional JSON
+// body carries a reason, which is recorded on the AccountStatusChanged
+// event.
+func FreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	changeAccountStatus(w, r, service.FreezeAccount, "account freeze requested")
+}
+
+// UnfreezeAccountHandler queues an unfreeze of the account.
+func UnfreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	changeAccountStatus(w, r, service.UnfreezeAccount, "account unfreeze requested")
+}
+
+// CloseAccountHandler queues closing the account. The consumer rejects it
+// unless the balance is zero.
+func CloseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	changeAccountStatus(w, r, service.CloseAccount, "account close requested")
+}
+
+func changeAccountStatus(w http.ResponseWriter, r *http.Request,
+	change func(ctx context.Context, userID, reason string) error, message string) {
+	var body AccountStatusRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := change(r.Context(), chi.URLParam(r, "id"), body.Reason); err != nil {
+		respondWithServiceError(w, err, "Something went wrong")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, message)
+}
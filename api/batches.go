@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"ledger/service"
+	response "ledger/utils"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxBatchBody bounds the size of a batch upload.
+const maxBatchBody = 10 << 20
+
+// csvColumns are the columns a CSV batch must have, in any order.
+var csvColumns = []string{"operation", "user_id", "amount"}
+
+// SubmitBatchHandler accepts a batch as JSON, as a text/csv body, or as a
+// multipart upload with a "file" part. For CSV, all_or_nothing is a query
+// or form parameter. It responds 202 with the batch ID once every item is
+// validated and queued.
+func SubmitBatchHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBody)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var items []service.BatchItemRequest
+	var allOrNothing bool
+	var err error
+
+	switch mediaType {
+	case "text/csv":
+		allOrNothing, err = boolParam(r.URL.Query().Get("all_or_nothing"))
+		if err == nil {
+			items, err = parseBatchCSV(r.Body)
+		}
+	case "multipart/form-data":
+		allOrNothing, err = boolParam(r.FormValue("all_or_nothing"))
+		if err == nil {
+			var file io.ReadCloser
+			file, _, err = r.FormFile("file")
+			if err == nil {
+				defer file.Close()
+				items, err = parseBatchCSV(file)
+			}
+		}
+	default:
+		var body SubmitBatchRequest
+		if err = json.NewDecoder(r.Body).Decode(&body); err == nil {
+			allOrNothing = body.AllOrNothing
+			for _, item := range body.Items {
+				items = append(items, service.BatchItemRequest(item))
+			}
+		}
+	}
+	if err != nil {
+		respondWithBatchError(w, err)
+		return
+	}
+
+	id, err := service.SubmitBatch(r.Context(), items, allOrNothing)
+	if err != nil {
+		respondWithBatchError(w, err)
+		return
+	}
+	response.RespondWithJSON(w, http.StatusAccepted, SubmitBatchResponse{BatchID: id, StatusURL: "/batches/" + id})
+}
+
+// GetBatchHandler reports a batch's status with per-item results.
+func GetBatchHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := service.GetBatch(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving batch")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, status)
+}
+
+// parseBatchCSV reads items from CSV with a header row naming csvColumns.
+// Every malformed row is reported.
+func parseBatchCSV(r io.Reader) ([]service.BatchItemRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CSV header: %v", service.ErrInvalidArgument, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must include %s", service.ErrInvalidArgument, strings.Join(csvColumns, ", "))
+		}
+	}
+
+	var items []service.BatchItemRequest
+	var problems []service.BatchItemError
+	for index := 0; ; index++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("failed to read CSV: %w", err)
+			}
+			problems = append(problems, service.BatchItemError{Index: index, Error: err.Error()})
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(record[columns["amount"]]), 64)
+		if err != nil {
+			problems = append(problems, service.BatchItemError{Index: index, Error: "amount must be a number"})
+			continue
+		}
+		items = append(items, service.BatchItemRequest{
+			Operation: strings.ToLower(strings.TrimSpace(record[columns["operation"]])),
+			UserID:    strings.TrimSpace(record[columns["user_id"]]),
+			Amount:    amount,
+		})
+	}
+	if len(problems) > 0 {
+		return nil, &service.BatchValidationError{Items: problems}
+	}
+	return items, nil
+}
+
+func boolParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: all_or_nothing must be true or false", service.ErrInvalidArgument)
+	}
+	return b, nil
+}
+
+// respondWithBatchError reports item-level validation problems as JSON and
+// everything else like other service errors.
+func respondWithBatchError(w http.ResponseWriter, err error) {
+	var invalid *service.BatchValidationError
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &invalid):
+		response.RespondWithJSON(w, http.StatusBadRequest, BatchValidationResponse{Error: err.Error(), Items: invalid.Items})
+	case errors.As(err, &tooLarge):
+		response.RespondWithHTML(w, http.StatusRequestEntityTooLarge, "batch upload is too large")
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.EOF),
+		errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	default:
+		respondWithServiceError(w, err, "Error submitting batch")
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"ledger/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchCSV(t *testing.T) {
+	items, err := parseBatchCSV(strings.NewReader("user_id,operation,amount\nuser-1,Add,100\n user-2 ,deduct, 2.5\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, []service.BatchItemRequest{
+		{Operation: "add", UserID: "user-1", Amount: 100},
+		{Operation: "deduct", UserID: "user-2", Amount: 2.5},
+	}, items)
+}
+
+func TestParseBatchCSVReportsEveryBadRow(t *testing.T) {
+	_, err := parseBatchCSV(strings.NewReader("operation,user_id,amount\nadd,user-1,ten\nadd,user-2,1\nadd,user-3\n"))
+
+	var invalid *service.BatchValidationError
+	require.ErrorAs(t, err, &invalid)
+	require.Len(t, invalid.Items, 2)
+	assert.Equal(t, 0, invalid.Items[0].Index)
+	assert.Equal(t, 2, invalid.Items[1].Index)
+}
+
+func TestParseBatchCSVRequiresHeader(t *testing.T) {
+	_, err := parseBatchCSV(strings.NewReader("add,user-1,10\n"))
+
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
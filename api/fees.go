@@ -0,0 +1,30 @@
+package api
+
+import (
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+	"strconv"
+)
+
+// FeeScheduleHandler lists the configured fee rules.
+func FeeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	response.RespondWithJSON(w, http.StatusOK, service.GetFeeSchedule())
+}
+
+// FeeQuoteHandler previews the fee for an operation on an account, or on an
+// account type when no account_id is given.
+func FeeQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	amount, err := strconv.ParseFloat(query.Get("amount"), 64)
+	if err != nil {
+		http.Error(w, "amount must be a number", http.StatusBadRequest)
+		return
+	}
+	quote, err := service.QuoteFee(r.Context(), query.Get("operation"), query.Get("account_id"), query.Get("account_type"), amount)
+	if err != nil {
+		respondWithServiceError(w, err, "Error quoting fee")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, quote)
+}
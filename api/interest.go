@@ -0,0 +1,43 @@
+package api
+
+import (
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// InterestPlansHandler lists the savings rate plans.
+func InterestPlansHandler(w http.ResponseWriter, r *http.Request) {
+	response.RespondWithJSON(w, http.StatusOK, service.GetInterestPlans())
+}
+
+// InterestAccrualsHandler lists an account's daily interest accruals between
+// the from and to dates (YYYY-MM-DD, inclusive), by default for the
+// current month.
+func InterestAccrualsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, name+" must be a date such as 2024-01-31", http.StatusBadRequest)
+			return
+		}
+		*dst = day
+	}
+
+	accruals, err := service.ListInterestAccruals(r.Context(), chi.URLParam(r, "id"), from, to)
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing interest accruals")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, accruals)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ChartOfAccountsHandler lists the ledger codes accounts roll up to.
+func ChartOfAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	codes, err := service.GetChartOfAccounts(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving chart of accounts")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, codes)
+}
+
+// TrialBalanceHandler reports every ledger code's balance and whether
+// debits equal credits.
+func TrialBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := service.GetTrialBalance(r.Context())
+	if err != nil {
+		respondWithServiceError(w, err, "Error building trial balance")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, report)
+}
+
+// PostJournalEntryHandler validates a journal entry and queues it,
+// responding 202 with the entry ID.
+func PostJournalEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var body JournalEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	entry := service.JournalEntry{Description: body.Description}
+	for _, leg := range body.Legs {
+		entry.Legs = append(entry.Legs, service.JournalLeg(leg))
+	}
+	id, err := service.PostJournalEntry(r.Context(), entry)
+	if err != nil {
+		respondWithServiceError(w, err, "Error posting journal entry")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusAccepted, JournalEntryResponse{EntryID: id})
+}
+
+// ReverseJournalEntryHandler queues a compensating entry that undoes a
+// journal entry, responding 202 with the new entry's ID.
+func ReverseJournalEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := service.ReverseJournalEntry(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error reversing journal entry")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusAccepted, JournalEntryResponse{EntryID: id})
+}
+
+// VerifyLedgerChainHandler verifies an account's hash-chained ledger
+// records. A broken chain is still a 200; the report says where it broke.
+func VerifyLedgerChainHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := service.VerifyLedgerChain(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error verifying ledger chain")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LimitUsageHandler lists the velocity limits covering an account with its
+// current usage against each.
+func LimitUsageHandler(w http.ResponseWriter, r *http.Request) {
+	usage, err := service.GetLimitUsage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving limit usage")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, usage)
+}
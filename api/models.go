@@ -1,11 +1,108 @@
 package api
 
+import (
+	"ledger/pg"
+	"ledger/service"
+	"time"
+)
+
 type AmountOpRequestBody struct {
 	UserID string  `json:"user_id"`
 	Amount float64 `json:"amount"`
+	// ExpectedVersion makes the write conditional on the account version,
+	// like an If-Match header.
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+}
+
+type AccountStatusRequestBody struct {
+	Reason string `json:"reason"`
+}
+
+type OpenAccountRequest struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Labels         map[string]string `json:"labels"`
+	InitialBalance float64           `json:"initial_balance"`
+}
+
+type OpenAccountResponse struct {
+	AccountID string `json:"account_id"`
+}
+
+// UpdateAccountRequest is a partial update: omitted fields are kept, and a
+// null label value removes that label.
+type UpdateAccountRequest struct {
+	Name         *string            `json:"name"`
+	Type         *string            `json:"type"`
+	Labels       map[string]*string `json:"labels"`
+	InterestPlan *string            `json:"interest_plan"`
+}
+
+type JournalLegRequest struct {
+	AccountID string  `json:"account_id"`
+	Direction string  `json:"direction"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+}
+
+type JournalEntryRequest struct {
+	Description string              `json:"description"`
+	Legs        []JournalLegRequest `json:"legs"`
+}
+
+type JournalEntryResponse struct {
+	EntryID string `json:"entry_id"`
 }
 
 type GetBalanceResponse struct {
 	UserID  string  `json:"user_id"`
 	Balance float64 `json:"balance"`
+	Version int64   `json:"version"`
+}
+
+type RegisterWebhookRequest struct {
+	AccountID  string   `json:"account_id"`
+	ClientID   string   `json:"client_id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type WebhookDeliveryResponse struct {
+	pg.WebhookDelivery
+	AttemptLog []pg.WebhookAttempt `json:"attempt_log"`
+}
+
+type BatchItemRequestBody struct {
+	Operation string  `json:"operation"`
+	UserID    string  `json:"user_id"`
+	Amount    float64 `json:"amount"`
+}
+
+// CreateScheduleRequest mirrors service.ScheduleRequest so it can be
+// converted directly.
+type CreateScheduleRequest struct {
+	AccountID   string     `json:"account_id"`
+	Kind        string     `json:"kind"`
+	ToAccountID string     `json:"to_account_id"`
+	Amount      float64    `json:"amount"`
+	Description string     `json:"description"`
+	StartAt     *time.Time `json:"start_at"`
+	Cron        string     `json:"cron"`
+	EndAt       *time.Time `json:"end_at"`
+	CatchUp     string     `json:"catch_up"`
+}
+
+type SubmitBatchRequest struct {
+	AllOrNothing bool                   `json:"all_or_nothing"`
+	Items        []BatchItemRequestBody `json:"items"`
+}
+
+type SubmitBatchResponse struct {
+	BatchID   string `json:"batch_id"`
+	StatusURL string `json:"status_url"`
+}
+
+type BatchValidationResponse struct {
+	Error string                   `json:"error"`
+	Items []service.BatchItemError `json:"items"`
 }
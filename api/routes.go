@@ -1,6 +1,8 @@
 package api
 
 import (
+	"ledger/kafka"
+	"ledger/service"
 	response "ledger/utils"
 	"net/http"
 
@@ -12,13 +14,16 @@ func InitialiseRoutes() http.Handler {
 	route := chi.NewRouter()
 	route.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-KEY", "X-Api-Key"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-KEY", "X-Api-Key", "Last-Event-ID", "If-Match", CorrelationIDHeader},
+		ExposedHeaders:   []string{"Link", "ETag", CorrelationIDHeader},
 		AllowCredentials: true,
 	}))
+	route.Use(CorrelationID)
 
 	route.Get("/", HealthCheck)
+	route.Get("/healthz", LivenessHandler)
+	route.Get("/readyz", ReadinessHandler)
 
 	route.Get("/balance", GetBalanceHandler)
 	route.Post("/balance", CreateAccount)
@@ -26,9 +31,80 @@ func InitialiseRoutes() http.Handler {
 	route.Post("/balance/deduct", DeductAmountHandler)
 
 	route.Get("/logs", GetLogsHandler)
+
+	route.Post("/journal-entries", PostJournalEntryHandler)
+	route.Post("/journal-entries/{id}/reverse", ReverseJournalEntryHandler)
+	route.Get("/chart-of-accounts", ChartOfAccountsHandler)
+	route.Get("/reports/trial-balance", TrialBalanceHandler)
+	route.Get("/fees/schedule", FeeScheduleHandler)
+	route.Get("/fees/quote", FeeQuoteHandler)
+	route.Get("/interest/plans", InterestPlansHandler)
+
+	route.Get("/accounts/{id}", GetAccountHandler)
+	route.Patch("/accounts/{id}", UpdateAccountHandler)
+	route.Get("/accounts/{id}/stream", AccountStreamHandler)
+	route.Get("/accounts/{id}/interest-accruals", InterestAccrualsHandler)
+	route.Get("/accounts/{id}/limits", LimitUsageHandler)
+	route.Get("/accounts/{id}/ledger/verify", VerifyLedgerChainHandler)
+	route.Post("/accounts/{id}/freeze", FreezeAccountHandler)
+	route.Post("/accounts/{id}/unfreeze", UnfreezeAccountHandler)
+	route.Post("/accounts/{id}/close", CloseAccountHandler)
+	route.Get("/users/{id}/accounts", ListUserAccountsHandler)
+	route.Post("/users/{id}/accounts", OpenAccountHandler)
+
+	route.Post("/batches", SubmitBatchHandler)
+	route.Get("/batches/{id}", GetBatchHandler)
+
+	route.Post("/schedules", CreateScheduleHandler)
+	route.Get("/schedules/{id}", GetScheduleHandler)
+	route.Get("/schedules/{id}/runs", ListScheduleRunsHandler)
+	route.Post("/schedules/{id}/pause", PauseScheduleHandler)
+	route.Post("/schedules/{id}/resume", ResumeScheduleHandler)
+	route.Post("/schedules/{id}/cancel", CancelScheduleHandler)
+	route.Get("/accounts/{id}/schedules", ListAccountSchedulesHandler)
+
+	route.Post("/webhooks", RegisterWebhookHandler)
+	route.Get("/webhooks", ListWebhooksHandler)
+	route.Delete("/webhooks/{id}", DeleteWebhookHandler)
+	route.Get("/webhooks/{id}/deliveries", ListWebhookDeliveriesHandler)
+	route.Get("/webhooks/deliveries/{id}", GetWebhookDeliveryHandler)
+	route.Post("/webhooks/deliveries/{id}/resend", ResendWebhookDeliveryHandler)
 	return route
 }
 
+// CorrelationIDHeader lets callers tie the Kafka events produced by a request
+// back to their own request ID.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// CorrelationID stores the caller's correlation ID in the request context so
+// produced commands carry it, and echoes it on the response.
+func CorrelationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.Header.Get(CorrelationIDHeader); id != "" {
+			w.Header().Set(CorrelationIDHeader, id)
+			r = r.WithContext(kafka.WithCorrelationID(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func HealthCheck(res http.ResponseWriter, req *http.Request) {
 	response.RespondWithJSON(res, http.StatusOK, "I am working fine :)")
 }
+
+// LivenessHandler reports that the process is up and serving HTTP. It does
+// not touch any dependency so a slow database never gets the pod restarted.
+func LivenessHandler(res http.ResponseWriter, req *http.Request) {
+	response.RespondWithJSON(res, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// ReadinessHandler checks every dependency and returns a per-component report.
+// It responds with 503 when any component is down or shutdown has started.
+func ReadinessHandler(res http.ResponseWriter, req *http.Request) {
+	report := service.CheckReadiness(req.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	response.RespondWithJSON(res, code, report)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSAllowsConditionalWrites(t *testing.T) {
+	routes := InitialiseRoutes()
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/balance/deduct", nil)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	preflight.Header.Set("Access-Control-Request-Headers", "If-Match")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, preflight)
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	get.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, get)
+	// Header names are case-insensitive; the middleware canonicalizes them.
+	assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), http.CanonicalHeaderKey("ETag"))
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"ledger/pg"
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateScheduleHandler creates a one-off or recurring payment schedule and
+// responds 201 with it.
+func CreateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var body CreateScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	schedule, err := service.CreateSchedule(r.Context(), service.ScheduleRequest(body))
+	if err != nil {
+		respondWithServiceError(w, err, "Error creating payment schedule")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusCreated, schedule)
+}
+
+// GetScheduleHandler returns a payment schedule.
+func GetScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, err := service.GetSchedule(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving payment schedule")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, schedule)
+}
+
+// ListAccountSchedulesHandler lists the schedules paying from an account.
+func ListAccountSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := service.ListAccountSchedules(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing payment schedules")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, schedules)
+}
+
+// ListScheduleRunsHandler lists a schedule's most recent runs with their
+// outcomes.
+func ListScheduleRunsHandler(w http.ResponseWriter, r *http.Request) {
+	runs, err := service.ListScheduleRuns(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing schedule runs")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, runs)
+}
+
+// PauseScheduleHandler pauses an active schedule.
+func PauseScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	transitionSchedule(w, r, service.PauseSchedule, "Error pausing payment schedule")
+}
+
+// ResumeScheduleHandler resumes a paused schedule.
+func ResumeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	transitionSchedule(w, r, service.ResumeSchedule, "Error resuming payment schedule")
+}
+
+// CancelScheduleHandler cancels a schedule for good.
+func CancelScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	transitionSchedule(w, r, service.CancelSchedule, "Error cancelling payment schedule")
+}
+
+func transitionSchedule(w http.ResponseWriter, r *http.Request, transition func(context.Context, string) (pg.PaymentSchedule, error), message string) {
+	schedule, err := transition(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithServiceError(w, err, message)
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, schedule)
+}
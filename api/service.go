@@ -2,30 +2,40 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"ledger/service"
 	response "ledger/utils"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-// GetBalanceHandler retrieves the balance for a given user.
+// GetBalanceHandler retrieves the balance for a given user, with the
+// account version as its ETag.
 func GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		response.RespondWithHTML(w, http.StatusBadRequest, "user_id is required")
 		return
 	}
-	balance, err := service.GetUserBalance(userID)
+	balance, version, err := service.GetUserBalance(userID)
 	if err != nil {
 		response.RespondWithHTML(w, http.StatusInternalServerError, "Error retrieving balance")
 		return
 	}
+	if version > 0 {
+		w.Header().Set("ETag", versionETag(version))
+	}
 	response.RespondWithJSON(w, http.StatusOK, GetBalanceResponse{
 		UserID:  userID,
 		Balance: balance,
+		Version: version,
 	})
 }
 
-// AddAmountHandler adds funds to a user's account.
+// AddAmountHandler adds funds to a user's account. An If-Match header or
+// expected_version makes it conditional on the account version.
 func AddAmountHandler(w http.ResponseWriter, r *http.Request) {
 	var body AmountOpRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -33,24 +43,33 @@ func AddAmountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := service.AddAmount(body.UserID, body.Amount)
+	version, err := expectedVersion(r, body.ExpectedVersion)
 	if err != nil {
-		response.RespondWithHTML(w, http.StatusInternalServerError, "Something went wrong")
+		response.RespondWithHTML(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := service.AddAmount(r.Context(), body.UserID, body.Amount, version); err != nil {
+		respondWithServiceError(w, err, "Something went wrong")
 		return
 	}
 	response.RespondWithJSON(w, http.StatusOK, "amount added successfully")
 }
 
-// DeductAmountHandler deducts funds from a user's account.
+// DeductAmountHandler deducts funds from a user's account. An If-Match
+// header or expected_version makes it conditional on the account version.
 func DeductAmountHandler(w http.ResponseWriter, r *http.Request) {
 	var req AmountOpRequestBody
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	err := service.DeductAmount(req.UserID, req.Amount)
+	version, err := expectedVersion(r, req.ExpectedVersion)
 	if err != nil {
-		response.RespondWithHTML(w, http.StatusInternalServerError, "Something went wrong")
+		response.RespondWithHTML(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := service.DeductAmount(r.Context(), req.UserID, req.Amount, version); err != nil {
+		respondWithServiceError(w, err, "Something went wrong")
 		return
 	}
 	response.RespondWithJSON(w, http.StatusOK, "amount deducted successfully")
@@ -63,7 +82,11 @@ func CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := service.CreateAccount(req.UserID, req.Amount)
+	err := service.CreateAccount(r.Context(), req.UserID, req.Amount)
+	if errors.Is(err, service.ErrInvalidArgument) {
+		response.RespondWithHTML(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		response.RespondWithHTML(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -85,3 +108,26 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	response.RespondWithJSON(w, http.StatusOK, logs)
 }
+
+// versionETag formats an account version as a strong ETag.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// expectedVersion returns the account version a write expects, from the
+// If-Match header or the body's expected_version; zero means any. "*"
+// matches any version. Both may be given only if they agree.
+func expectedVersion(r *http.Request, fromBody int64) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return fromBody, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("If-Match must be an ETag returned by GET /balance, got %s", header)
+	}
+	if fromBody != 0 && fromBody != version {
+		return 0, errors.New("If-Match and expected_version disagree")
+	}
+	return version, nil
+}
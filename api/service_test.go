@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		ifMatch  string
+		fromBody int64
+		want     int64
+		wantErr  bool
+	}{
+		{"neither", "", 0, 0, false},
+		{"body only", "", 4, 4, false},
+		{"etag", `"7"`, 0, 7, false},
+		{"unquoted", "7", 0, 7, false},
+		{"any", "*", 3, 3, false},
+		{"agreeing", `"7"`, 7, 7, false},
+		{"disagreeing", `"7"`, 6, 0, true},
+		{"weak etag", `W/"7"`, 0, 0, true},
+		{"zero", `"0"`, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/balance/add", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			got, err := expectedVersion(r, tt.fromBody)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVersionETag(t *testing.T) {
+	assert.Equal(t, `"12"`, versionETag(12))
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ledger/service"
+	response "ledger/utils"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// streamKeepAlive is how often an idle stream gets a comment line, so
+// proxies do not time it out.
+const streamKeepAlive = 15 * time.Second
+
+var (
+	streamsClosed    = make(chan struct{})
+	closeStreamsOnce sync.Once
+)
+
+// CloseStreams ends every open account stream. Register it with
+// http.Server.RegisterOnShutdown: Shutdown otherwise waits for streaming
+// clients to disconnect on their own. Clients reconnect to another
+// instance with Last-Event-ID.
+func CloseStreams() {
+	closeStreamsOnce.Do(func() { close(streamsClosed) })
+}
+
+// AccountStreamHandler serves GET /accounts/{id}/stream as server-sent
+// events: a "balance" snapshot, then an "entry" event per new ledger entry
+// carrying the balance after it. Reconnecting with Last-Event-ID first
+// replays the entries missed since that ID.
+func AccountStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		response.RespondWithHTML(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-streamsClosed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Headers are sent with the first event, so errors before it can still
+	// be reported with a status code.
+	var mu sync.Mutex
+	started := false
+	write := func(format string, args ...any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			// The handler may already have returned.
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				open := started
+				mu.Unlock()
+				if open {
+					_ = write(": keep-alive\n\n")
+				}
+			}
+		}
+	}()
+
+	userID := chi.URLParam(r, "id")
+	err := service.StreamAccount(ctx, userID, r.Header.Get("Last-Event-ID"), func(event service.StreamEvent) error {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		if event.ID != "" {
+			return write("id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		return write("event: %s\ndata: %s\n\n", event.Type, data)
+	})
+
+	// Stop the keep-alive before writing the final response.
+	cancel()
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+	case started:
+		log.Printf("Stream for user %s ended: %v\n", userID, err)
+	case errors.Is(err, service.ErrInvalidArgument):
+		response.RespondWithHTML(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("Stream for user %s failed: %v\n", userID, err)
+		response.RespondWithHTML(w, http.StatusInternalServerError, "Error streaming account")
+	}
+}
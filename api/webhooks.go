@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"ledger/service"
+	response "ledger/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterWebhookHandler subscribes a URL to domain events. The response
+// carries the signing secret, which is not shown again.
+func RegisterWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegisterWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	endpoint, err := service.RegisterWebhook(r.Context(), service.WebhookRegistration{
+		AccountID:  req.AccountID,
+		ClientID:   req.ClientID,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+	})
+	if err != nil {
+		respondWithServiceError(w, err, "Error registering webhook")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusCreated, endpoint)
+}
+
+// ListWebhooksHandler lists endpoints by account_id and/or client_id.
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	endpoints, err := service.ListWebhooks(r.Context(), query.Get("account_id"), query.Get("client_id"))
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing webhooks")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, endpoints)
+}
+
+// DeleteWebhookHandler stops deliveries to an endpoint.
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	if err := service.DeleteWebhook(r.Context(), id); err != nil {
+		respondWithServiceError(w, err, "Error deleting webhook")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, "webhook deleted successfully")
+}
+
+// ListWebhookDeliveriesHandler returns an endpoint's recent deliveries.
+func ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := service.ListWebhookDeliveries(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, err, "Error listing webhook deliveries")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// GetWebhookDeliveryHandler returns a delivery and every attempt made.
+func GetWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	delivery, attempts, err := service.GetWebhookDelivery(r.Context(), id)
+	if err != nil {
+		respondWithServiceError(w, err, "Error retrieving webhook delivery")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusOK, WebhookDeliveryResponse{WebhookDelivery: delivery, AttemptLog: attempts})
+}
+
+// ResendWebhookDeliveryHandler queues a delivery to be sent again.
+func ResendWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := idParam(w, r)
+	if !ok {
+		return
+	}
+	if err := service.ResendWebhookDelivery(r.Context(), id); err != nil {
+		respondWithServiceError(w, err, "Error resending webhook delivery")
+		return
+	}
+	response.RespondWithJSON(w, http.StatusAccepted, "webhook delivery queued")
+}
+
+// idParam parses the {id} URL parameter, responding 400 if it is invalid.
+func idParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		response.RespondWithHTML(w, http.StatusBadRequest, "id must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// respondWithServiceError maps service errors to status codes, hiding the
+// details of unexpected ones behind message.
+func respondWithServiceError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument):
+		response.RespondWithHTML(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrAccountNotFound):
+		response.RespondWithHTML(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrAccountFrozen), errors.Is(err, service.ErrAccountClosed),
+		errors.Is(err, service.ErrNonZeroBalance), errors.Is(err, service.ErrInvalidStatusTransition),
+		errors.Is(err, service.ErrCurrencyMismatch), errors.Is(err, service.ErrInvalidScheduleTransition),
+		errors.Is(err, service.ErrAlreadyReversed):
+		response.RespondWithHTML(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrVersionConflict):
+		response.RespondWithHTML(w, http.StatusPreconditionFailed, err.Error())
+	default:
+		response.RespondWithHTML(w, http.StatusInternalServerError, message)
+	}
+}
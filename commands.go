@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ledger/config"
+	"ledger/kafka"
+	"ledger/mongo"
+	"ledger/pg"
+	"ledger/service"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	migrateUsage      = "usage: ledger migrate up | down [steps] | status"
+	mongoIndexesUsage = "usage: ledger mongo-indexes drift"
+	schemasUsage      = "usage: ledger schemas register"
+	interestUsage     = "usage: ledger interest accrue | post"
+	ledgerUsage       = "usage: ledger ledger backfill | project | rebuild"
+)
+
+// runCommand executes a one-off subcommand instead of starting the server.
+// It returns false if name is not a known subcommand.
+func runCommand(cfg *config.Config, name string, args []string) (bool, error) {
+	switch name {
+	case "migrate":
+		pg.InitPostgres(cfg.Postgres)
+		defer pg.DB.Close()
+		return true, runMigrate(args)
+	case "mongo-indexes":
+		mongo.InitMongo(cfg.Mongo)
+		defer mongo.Disconnect(context.Background())
+		return true, runMongoIndexes(args)
+	case "schemas":
+		return true, runSchemas(cfg, args)
+	case "verify":
+		mongo.InitMongo(cfg.Mongo)
+		defer mongo.Disconnect(context.Background())
+		return true, runVerify(args)
+	case "interest":
+		pg.InitPostgres(cfg.Postgres)
+		defer pg.DB.Close()
+		// Events only go to the outbox, so no Kafka connection is needed.
+		serializer, err := kafka.NewSerializer(cfg.Kafka)
+		if err != nil {
+			return true, err
+		}
+		kafka.MessageSerializer = serializer
+		service.SetInterestPlans(cfg.Interest)
+		return true, runInterest(args)
+	case "ledger":
+		pg.InitPostgres(cfg.Postgres)
+		defer pg.DB.Close()
+		mongo.InitMongo(cfg.Mongo)
+		defer mongo.Disconnect(context.Background())
+		return true, runLedger(args)
+	default:
+		return false, nil
+	}
+}
+
+// runMigrate implements the `migrate` subcommand.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := pg.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migration(s) applied", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive integer, got %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := pg.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d migration(s) reverted", reverted)
+	case "status":
+		states, err := pg.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+// runMongoIndexes implements the `mongo-indexes` subcommand. `drift` prints
+// how the live ledger indexes differ from the declared ones and fails if
+// they differ at all.
+func runMongoIndexes(args []string) error {
+	if len(args) != 1 || args[0] != "drift" {
+		return errors.New(mongoIndexesUsage)
+	}
+	drift, err := mongo.LedgerIndexDrift(context.Background())
+	if err != nil {
+		return err
+	}
+	if !drift.HasDrift() {
+		log.Println("Ledger indexes match their definitions")
+		return nil
+	}
+	for _, name := range drift.Missing {
+		fmt.Printf("missing:    %s\n", name)
+	}
+	for _, name := range drift.Unexpected {
+		fmt.Printf("unexpected: %s\n", name)
+	}
+	for _, desc := range drift.Mismatched {
+		fmt.Printf("mismatched: %s\n", desc)
+	}
+	return errors.New("ledger index drift detected")
+}
+
+// runSchemas implements the `schemas` subcommand. `register` records the
+// current Kafka message schemas in the file registry, failing if any change
+// is incompatible with an already registered version.
+func runSchemas(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "register" {
+		return errors.New(schemasUsage)
+	}
+	registry, err := kafka.NewFileRegistry(cfg.Kafka.SchemaRegistryPath)
+	if err != nil {
+		return err
+	}
+	for _, m := range kafka.Schemas {
+		p := m.ToProto()
+		version, err := kafka.RegisterSchemas(registry, p)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: version %d\n", kafka.SubjectOf(p), version)
+	}
+	return nil
+}
+
+// runInterest implements the `interest` subcommand. `accrue` catches up
+// every day that has ended since the last accrued one; `post` credits the
+// interest accrued in every month that has ended. The running service does
+// both on its own; the command is for catching up without it.
+func runInterest(args []string) error {
+	if len(args) != 1 {
+		return errors.New(interestUsage)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "accrue":
+		days, err := service.AccrueInterest(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("%d day(s) accrued", days)
+	case "post":
+		accounts, err := service.PostInterest(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("Interest posted to %d account(s)", accounts)
+	default:
+		return errors.New(interestUsage)
+	}
+	return nil
+}
+
+// runLedger implements the `ledger` subcommand. `backfill` copies ledger
+// records written to MongoDB before Postgres held the ledger into
+// ledger_entries; `project` projects every queued transaction into MongoDB;
+// `rebuild` queues every transaction for projection again, for rebuilding
+// the read model in an empty MongoDB database, and then projects them.
+func runLedger(args []string) error {
+	if len(args) != 1 {
+		return errors.New(ledgerUsage)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "backfill":
+		records, err := service.BackfillLedgerEntries(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d ledger record(s) backfilled", records)
+		return nil
+	case "rebuild":
+		queued, err := service.RebuildLedgerProjection(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("%d transaction(s) queued for projection", queued)
+	case "project":
+	default:
+		return errors.New(ledgerUsage)
+	}
+
+	total := 0
+	for {
+		n, err := service.ProjectLedger(ctx, 500)
+		total += n
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	log.Printf("%d transaction(s) projected", total)
+	return nil
+}
+
+// runVerify implements the `verify` subcommand. It verifies the ledger hash
+// chain of each account given, or of every account, prints each break and
+// fails if there is any.
+func runVerify(args []string) error {
+	ctx := context.Background()
+	var broken []pg.ChainReport
+	checked := len(args)
+	if len(args) == 0 {
+		var err error
+		if broken, checked, err = service.VerifyAllLedgerChains(ctx); err != nil {
+			return err
+		}
+	}
+	for _, id := range args {
+		report, err := service.VerifyLedgerChain(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !report.Valid {
+			broken = append(broken, report)
+		}
+	}
+
+	for _, r := range broken {
+		fmt.Printf("%s: broken at sequence %d (entry %d): %s\n", r.AccountID, r.Break.Sequence, r.Break.EntryID, r.Break.Reason)
+	}
+	if len(broken) > 0 {
+		return fmt.Errorf("%d of %d ledger chain(s) broken", len(broken), checked)
+	}
+	log.Printf("%d ledger chain(s) verified", checked)
+	return nil
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"ledger/fees"
+	"ledger/interest"
+	"ledger/limits"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the full application configuration. Values are resolved in order
+// of increasing precedence: defaults, the optional config file, then the
+// environment (including *_FILE secrets).
+type Config struct {
+	Port            int           `yaml:"port"`
+	GRPCPort        int           `yaml:"grpc_port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ShutdownDrainDelay is how long readiness reports not ready before the
+	// listeners close, so load balancers stop routing to this replica first.
+	// It counts towards ShutdownTimeout.
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay"`
+
+	Postgres PostgresConfig `yaml:"postgres"`
+	Mongo    MongoConfig    `yaml:"mongo"`
+	Kafka    KafkaConfig    `yaml:"kafka"`
+	Webhooks WebhookConfig  `yaml:"webhooks"`
+
+	// Fees is the fee schedule. It is only read from the config file.
+	Fees fees.Schedule `yaml:"fees"`
+
+	// Limits are the velocity limit rules. They are only read from the
+	// config file.
+	Limits limits.Rules `yaml:"limits"`
+
+	Interest InterestConfig `yaml:"interest"`
+
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+
+	Ledger LedgerConfig `yaml:"ledger"`
+}
+
+type PostgresConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DB       string `yaml:"db"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+}
+
+type MongoConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	DB   string `yaml:"db"`
+}
+
+type KafkaConfig struct {
+	Broker    string `yaml:"broker"`
+	ClusterID string `yaml:"cluster_id"`
+	// Serializer is "protobuf" (versioned, default) or "json" (legacy).
+	Serializer         string `yaml:"serializer"`
+	SchemaRegistryPath string `yaml:"schema_registry_path"`
+	// UnifiedCommandTopic routes all commands through the partitioned
+	// ledger-commands topic instead of one topic per operation.
+	UnifiedCommandTopic    bool `yaml:"unified_command_topic"`
+	CommandTopicPartitions int  `yaml:"command_topic_partitions"`
+}
+
+type WebhookConfig struct {
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed and left for a manual re-send.
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff is the delay after the first failure; it doubles on
+	// each further failure up to MaxRetryBackoff.
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
+	// AllowPrivateHosts lets endpoints be registered and called on
+	// loopback, link-local and private addresses, for local development.
+	AllowPrivateHosts bool `yaml:"allow_private_hosts"`
+}
+
+type InterestConfig struct {
+	// Plans are the savings rate plans. They are only read from the config
+	// file; without plans no interest accrues.
+	Plans interest.Plans `yaml:"plans"`
+	// DefaultPlan applies to savings accounts that have no plan of their
+	// own. Empty means such accounts earn nothing.
+	DefaultPlan string `yaml:"default_plan"`
+	// Interval is how often the scheduler checks for days to accrue and
+	// months to post.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type SchedulerConfig struct {
+	// PollInterval is how often the payment scheduler looks for due
+	// schedules.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// LeaseTTL is how long the replica firing schedules holds its lease
+	// without renewing it, and so how long a takeover can take after it
+	// dies. It must exceed PollInterval, which renews it.
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// MissedAfter is how late an occurrence must be to count as missed,
+	// which schedules with the skip catch-up policy do not fire. It must
+	// exceed LeaseTTL, so a takeover alone does not make one missed.
+	MissedAfter time.Duration `yaml:"missed_after"`
+}
+
+type LedgerConfig struct {
+	// LogsSource is the store GET /logs reads: "postgres", the
+	// authoritative ledger_entries table, or "mongo", the read model
+	// projected from it, which may lag behind.
+	LogsSource string `yaml:"logs_source"`
+	// ProjectionInterval is how often ledger entries are projected into
+	// MongoDB.
+	ProjectionInterval time.Duration `yaml:"projection_interval"`
+	// ProjectionLeaseTTL is how long the replica projecting entries holds
+	// its lease without renewing it. It must exceed ProjectionInterval.
+	ProjectionLeaseTTL time.Duration `yaml:"projection_lease_ttl"`
+}
+
+// Default returns the configuration used for local development.
+func Default() Config {
+	return Config{
+		Port:               8080,
+		GRPCPort:           9090,
+		ShutdownTimeout:    30 * time.Second,
+		ShutdownDrainDelay: 5 * time.Second,
+		Postgres: PostgresConfig{
+			User: "ledger_user",
+			DB:   "ledger_db",
+			Host: "localhost",
+			Port: 5432,
+		},
+		Mongo: MongoConfig{
+			Host: "localhost",
+			Port: 27017,
+			DB:   "ledger_tx_log",
+		},
+		Kafka: KafkaConfig{
+			Broker:             "localhost:9092",
+			ClusterID:          "kraft-cluster-1234",
+			Serializer:         "protobuf",
+			SchemaRegistryPath: "kafka/schemas/registry.json",
+			// Existing deployments keep their per-operation topics until
+			// they opt in.
+			UnifiedCommandTopic:    false,
+			CommandTopicPartitions: 6,
+		},
+		Webhooks: WebhookConfig{
+			Timeout:         10 * time.Second,
+			MaxAttempts:     8,
+			RetryBackoff:    30 * time.Second,
+			MaxRetryBackoff: time.Hour,
+		},
+		Interest: InterestConfig{
+			Interval: time.Hour,
+		},
+		Scheduler: SchedulerConfig{
+			PollInterval: time.Second,
+			LeaseTTL:     30 * time.Second,
+			MissedAfter:  5 * time.Minute,
+		},
+		Ledger: LedgerConfig{
+			LogsSource:         "mongo",
+			ProjectionInterval: time.Second,
+			ProjectionLeaseTTL: 30 * time.Second,
+		},
+	}
+}
+
+// Validate checks every field and reports all problems at once.
+func (c Config) Validate() error {
+	var problems []string
+	require := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+	port := func(name string, value int) {
+		if value < 1 || value > 65535 {
+			problems = append(problems, fmt.Sprintf("%s must be between 1 and 65535, got %d", name, value))
+		}
+	}
+
+	port(EnvPort, c.Port)
+	port(EnvGRPCPort, c.GRPCPort)
+	if c.Port == c.GRPCPort {
+		problems = append(problems, fmt.Sprintf("%s and %s must differ", EnvPort, EnvGRPCPort))
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("%s must be positive, got %s", EnvShutdownTimeout, c.ShutdownTimeout))
+	}
+	if c.ShutdownDrainDelay < 0 || c.ShutdownDrainDelay >= c.ShutdownTimeout {
+		problems = append(problems, fmt.Sprintf("%s must be at least zero and less than %s, got %s",
+			EnvShutdownDrainDelay, EnvShutdownTimeout, c.ShutdownDrainDelay))
+	}
+
+	require(EnvPostgresUser, c.Postgres.User)
+	require(EnvPostgresPassword, c.Postgres.Password)
+	require(EnvPostgresDB, c.Postgres.DB)
+	require(EnvPostgresHost, c.Postgres.Host)
+	port(EnvPostgresPort, c.Postgres.Port)
+
+	require(EnvMongoHost, c.Mongo.Host)
+	port(EnvMongoPort, c.Mongo.Port)
+	require(EnvMongoDB, c.Mongo.DB)
+
+	require(EnvKafkaBroker, c.Kafka.Broker)
+	require(EnvKafkaClusterID, c.Kafka.ClusterID)
+	if c.Kafka.CommandTopicPartitions < 1 {
+		problems = append(problems, fmt.Sprintf("%s must be at least 1, got %d", EnvCommandTopicPartitions, c.Kafka.CommandTopicPartitions))
+	}
+	switch c.Kafka.Serializer {
+	case "protobuf":
+		require(EnvSchemaRegistryPath, c.Kafka.SchemaRegistryPath)
+	case "json":
+	default:
+		problems = append(problems, fmt.Sprintf("%s must be protobuf or json, got %q", EnvKafkaSerializer, c.Kafka.Serializer))
+	}
+
+	positive := func(name string, value time.Duration) {
+		if value <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %s", name, value))
+		}
+	}
+	positive(EnvWebhookTimeout, c.Webhooks.Timeout)
+	positive(EnvWebhookRetryBackoff, c.Webhooks.RetryBackoff)
+	positive(EnvWebhookMaxRetryBackoff, c.Webhooks.MaxRetryBackoff)
+	if c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("%s must be at least 1, got %d", EnvWebhookMaxAttempts, c.Webhooks.MaxAttempts))
+	}
+
+	if err := c.Fees.Validate(); err != nil {
+		problems = append(problems, "fee schedule: "+err.Error())
+	}
+	if err := c.Limits.Validate(); err != nil {
+		problems = append(problems, "velocity limits: "+err.Error())
+	}
+	positive(EnvInterestInterval, c.Interest.Interval)
+	if err := c.Interest.Plans.Validate(c.Interest.DefaultPlan); err != nil {
+		problems = append(problems, "interest: "+err.Error())
+	}
+	positive(EnvSchedulerPollInterval, c.Scheduler.PollInterval)
+	if c.Scheduler.LeaseTTL <= c.Scheduler.PollInterval {
+		problems = append(problems, fmt.Sprintf("%s must exceed %s, got %s", EnvSchedulerLeaseTTL, EnvSchedulerPollInterval, c.Scheduler.LeaseTTL))
+	}
+	if c.Scheduler.MissedAfter <= c.Scheduler.LeaseTTL {
+		problems = append(problems, fmt.Sprintf("%s must exceed %s, got %s", EnvSchedulerMissedAfter, EnvSchedulerLeaseTTL, c.Scheduler.MissedAfter))
+	}
+	if c.Ledger.LogsSource != "postgres" && c.Ledger.LogsSource != "mongo" {
+		problems = append(problems, fmt.Sprintf("%s must be postgres or mongo, got %q", EnvLedgerLogsSource, c.Ledger.LogsSource))
+	}
+	positive(EnvLedgerProjectionInterval, c.Ledger.ProjectionInterval)
+	if c.Ledger.ProjectionLeaseTTL <= c.Ledger.ProjectionInterval {
+		problems = append(problems, fmt.Sprintf("%s must exceed %s, got %s", EnvLedgerProjectionLeaseTTL, EnvLedgerProjectionInterval, c.Ledger.ProjectionLeaseTTL))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// loadFile overlays the YAML or JSON file at path onto cfg. JSON is accepted
+// because it is a subset of YAML.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() Config {
+	cfg := Default()
+	cfg.Postgres.Password = "secret"
+	return cfg
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Port = 0
+	cfg.Postgres.Password = ""
+	cfg.Mongo.DB = " "
+	cfg.ShutdownTimeout = 0
+
+	err := cfg.Validate()
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), EnvPort)
+	assert.Contains(t, err.Error(), EnvPostgresPassword)
+	assert.Contains(t, err.Error(), EnvMongoDB)
+	assert.Contains(t, err.Error(), EnvShutdownTimeout)
+	assert.NoError(t, validConfig().Validate())
+}
+
+func TestValidateShutdownDrainDelay(t *testing.T) {
+	cfg := validConfig()
+	cfg.ShutdownDrainDelay = cfg.ShutdownTimeout
+	assert.ErrorContains(t, cfg.Validate(), EnvShutdownDrainDelay)
+
+	cfg.ShutdownDrainDelay = -time.Second
+	assert.ErrorContains(t, cfg.Validate(), EnvShutdownDrainDelay)
+
+	cfg.ShutdownDrainDelay = 0
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadFileThenEnvOverride(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ledger.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+port: 9000
+shutdown_timeout: 5s
+shutdown_drain_delay: 2s
+postgres:
+  password: from-file
+  host: db.internal
+`), 0o600))
+
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv(EnvPostgresHost, "db.override")
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, 9000, cfg.Port)
+	assert.Equal(t, 5*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, 2*time.Second, cfg.ShutdownDrainDelay)
+	assert.Equal(t, "from-file", cfg.Postgres.Password)
+	assert.Equal(t, "db.override", cfg.Postgres.Host)
+	assert.Equal(t, "ledger_db", cfg.Postgres.DB)
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"port": 7000, "postgres": {"password": "json"}}`), 0o600))
+	t.Setenv(EnvConfigFile, path)
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, 7000, cfg.Port)
+	assert.Equal(t, "json", cfg.Postgres.Password)
+}
+
+func TestSecretFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_password")
+	require.NoError(t, os.WriteFile(path, []byte("s3cret\n"), 0o600))
+	t.Setenv(EnvPostgresPassword+fileSuffix, path)
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Postgres.Password)
+}
+
+func TestApplyEnvReportsParseErrors(t *testing.T) {
+	t.Setenv(EnvPort, "eighty")
+	t.Setenv(EnvShutdownTimeout, "soon")
+
+	cfg := validConfig()
+	err := applyEnv(&cfg)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), EnvPort)
+	assert.Contains(t, err.Error(), EnvShutdownTimeout)
+}
+
+func TestLoadFeeSchedule(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ledger.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+postgres:
+  password: secret
+fees:
+  - operation: DeductBalance
+    percent: 1
+    min: 0.5
+  - operation: DeductBalance
+    account_type: savings
+    tiers:
+      - up_to: 1000
+        flat: 2
+      - percent: 0.5
+`), 0o600))
+	t.Setenv(EnvConfigFile, path)
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	require.Len(t, cfg.Fees, 2)
+	assert.Equal(t, 0.5, cfg.Fees[0].Min)
+	assert.Equal(t, 1000.0, cfg.Fees[1].Tiers[0].UpTo)
+
+	cfg.Fees[0].Operation = "Refund"
+	assert.ErrorContains(t, cfg.Validate(), "fee schedule")
+}
+
+func TestLoadInterestPlans(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ledger.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+postgres:
+  password: secret
+interest:
+  default_plan: standard
+  plans:
+    - name: standard
+      annual_rate: 2.5
+    - name: premium
+      annual_rate: 4
+      min_balance: 10000
+`), 0o600))
+	t.Setenv(EnvConfigFile, path)
+	t.Setenv(EnvInterestInterval, "15m")
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	require.Len(t, cfg.Interest.Plans, 2)
+	assert.Equal(t, "standard", cfg.Interest.DefaultPlan)
+	assert.Equal(t, 10000.0, cfg.Interest.Plans[1].MinBalance)
+	assert.Equal(t, 15*time.Minute, cfg.Interest.Interval)
+
+	cfg.Interest.DefaultPlan = "gold"
+	assert.ErrorContains(t, cfg.Validate(), `interest: default plan "gold" is not defined`)
+}
+
+func TestSchedulerLeaseMustOutlastPoll(t *testing.T) {
+	t.Setenv(EnvPostgresPassword, "secret")
+	t.Setenv(EnvSchedulerPollInterval, "10s")
+	t.Setenv(EnvSchedulerLeaseTTL, "5s")
+
+	_, err := Load()
+
+	assert.ErrorContains(t, err, EnvSchedulerLeaseTTL+" must exceed "+EnvSchedulerPollInterval)
+}
+
+func TestSchedulerMissedAfterMustOutlastLease(t *testing.T) {
+	t.Setenv(EnvPostgresPassword, "secret")
+	t.Setenv(EnvSchedulerMissedAfter, "20s")
+
+	_, err := Load()
+
+	assert.ErrorContains(t, err, EnvSchedulerMissedAfter+" must exceed "+EnvSchedulerLeaseTTL)
+}
+
+func TestLoadLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ledger.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+postgres:
+  password: secret
+limits:
+  - name: daily_withdrawals
+    window: 24h
+    max_count: 5
+  - name: daily_amount
+    account_type: savings
+    window: 24h
+    max_amount: 10000
+`), 0o600))
+	t.Setenv(EnvConfigFile, path)
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	require.Len(t, cfg.Limits, 2)
+	assert.Equal(t, 24*time.Hour, cfg.Limits[0].Window)
+	assert.Equal(t, 10000.0, cfg.Limits[1].MaxAmount)
+
+	cfg.Limits[0].Window = 0
+	assert.ErrorContains(t, cfg.Validate(), "velocity limits: limits[0]: window must be positive")
+}
+
+func TestLedgerLogsSource(t *testing.T) {
+	t.Setenv(EnvPostgresPassword, "secret")
+	t.Setenv(EnvLedgerLogsSource, "postgres")
+
+	cfg, err := Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", cfg.Ledger.LogsSource)
+
+	cfg.Ledger.LogsSource = "redis"
+	assert.ErrorContains(t, cfg.Validate(), EnvLedgerLogsSource+" must be postgres or mongo")
+}
@@ -1,13 +1,20 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 const (
+	EnvConfigFile = "CONFIG_FILE"
+
 	EnvPostgresUser     = "POSTGRES_USER"
 	EnvPostgresPassword = "POSTGRES_PASSWORD"
 	EnvPostgresDB       = "POSTGRES_DB"
@@ -19,47 +26,181 @@ const (
 	EnvMongoDB   = "MONGO_DB"
 
 	EnvKafkaBroker    = "KAFKA_BROKER"
-	EnvKafkaTopic     = "KAFKA_TOPIC"
 	EnvKafkaClusterID = "KAFKA_CLUSTER_ID"
-	EnvPort           = "PORT"
-)
 
-// Global variables populated during init
-var (
-	PostgresUser     string
-	PostgresPassword string
-	PostgresDB       string
-	PostgresHost     string
-	PostgresPort     string
-
-	MongoHost string
-	MongoPort string
-	MongoDB   string
-
-	KafkaBroker    string
-	KafkaTopic     string
-	KafkaClusterID string
-	Port           string
+	EnvKafkaSerializer    = "KAFKA_SERIALIZER"
+	EnvSchemaRegistryPath = "SCHEMA_REGISTRY_PATH"
+
+	EnvUnifiedCommandTopic    = "KAFKA_UNIFIED_COMMAND_TOPIC"
+	EnvCommandTopicPartitions = "KAFKA_COMMAND_TOPIC_PARTITIONS"
+
+	EnvPort     = "PORT"
+	EnvGRPCPort = "GRPC_PORT"
+
+	EnvShutdownTimeout    = "SHUTDOWN_TIMEOUT"
+	EnvShutdownDrainDelay = "SHUTDOWN_DRAIN_DELAY"
+
+	EnvWebhookTimeout         = "WEBHOOK_TIMEOUT"
+	EnvWebhookMaxAttempts     = "WEBHOOK_MAX_ATTEMPTS"
+	EnvWebhookRetryBackoff    = "WEBHOOK_RETRY_BACKOFF"
+	EnvWebhookMaxRetryBackoff = "WEBHOOK_MAX_RETRY_BACKOFF"
+	EnvWebhookAllowPrivate    = "WEBHOOK_ALLOW_PRIVATE_HOSTS"
+
+	EnvInterestDefaultPlan = "INTEREST_DEFAULT_PLAN"
+	EnvInterestInterval    = "INTEREST_INTERVAL"
+
+	EnvSchedulerPollInterval = "SCHEDULER_POLL_INTERVAL"
+	EnvSchedulerLeaseTTL     = "SCHEDULER_LEASE_TTL"
+	EnvSchedulerMissedAfter  = "SCHEDULER_MISSED_AFTER"
+
+	EnvLedgerLogsSource         = "LEDGER_LOGS_SOURCE"
+	EnvLedgerProjectionInterval = "LEDGER_PROJECTION_INTERVAL"
+	EnvLedgerProjectionLeaseTTL = "LEDGER_PROJECTION_LEASE_TTL"
 )
 
-func Initialize() {
-	err := godotenv.Load()
+// fileSuffix marks an environment variable whose value is a path to read the
+// real value from, e.g. POSTGRES_PASSWORD_FILE=/run/secrets/pg_password.
+const fileSuffix = "_FILE"
+
+// Load builds the configuration from defaults, the optional .env file, the
+// optional CONFIG_FILE and the environment, then validates it.
+func Load() (*Config, error) {
+	// .env is a local development convenience; containers set real env vars.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	cfg := Default()
+
+	path, err := lookupEnv(EnvConfigFile)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		return nil, err
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applyEnv overrides cfg with every variable that is set in the environment.
+// Parse errors are collected so they are reported together.
+func applyEnv(cfg *Config) error {
+	var problems []string
+
+	str := func(key string, dst *string) {
+		value, err := lookupEnv(key)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if value != "" {
+			*dst = value
+		}
+	}
+	num := func(key string, dst *int) {
+		var raw string
+		if str(key, &raw); raw == "" {
+			return
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be an integer, got %q", key, raw))
+			return
+		}
+		*dst = value
+	}
+	duration := func(key string, dst *time.Duration) {
+		var raw string
+		if str(key, &raw); raw == "" {
+			return
+		}
+		value, err := time.ParseDuration(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be a duration such as 30s, got %q", key, raw))
+			return
+		}
+		*dst = value
+	}
+
+	boolean := func(key string, dst *bool) {
+		var raw string
+		if str(key, &raw); raw == "" {
+			return
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be true or false, got %q", key, raw))
+			return
+		}
+		*dst = value
 	}
 
-	PostgresUser = os.Getenv(EnvPostgresUser)
-	PostgresPassword = os.Getenv(EnvPostgresPassword)
-	PostgresDB = os.Getenv(EnvPostgresDB)
-	PostgresHost = os.Getenv(EnvPostgresHost)
-	PostgresPort = os.Getenv(EnvPostgresPort)
+	num(EnvPort, &cfg.Port)
+	num(EnvGRPCPort, &cfg.GRPCPort)
+	duration(EnvShutdownTimeout, &cfg.ShutdownTimeout)
+	duration(EnvShutdownDrainDelay, &cfg.ShutdownDrainDelay)
+
+	str(EnvPostgresUser, &cfg.Postgres.User)
+	str(EnvPostgresPassword, &cfg.Postgres.Password)
+	str(EnvPostgresDB, &cfg.Postgres.DB)
+	str(EnvPostgresHost, &cfg.Postgres.Host)
+	num(EnvPostgresPort, &cfg.Postgres.Port)
+
+	str(EnvMongoHost, &cfg.Mongo.Host)
+	num(EnvMongoPort, &cfg.Mongo.Port)
+	str(EnvMongoDB, &cfg.Mongo.DB)
+
+	str(EnvKafkaBroker, &cfg.Kafka.Broker)
+	str(EnvKafkaClusterID, &cfg.Kafka.ClusterID)
+	str(EnvKafkaSerializer, &cfg.Kafka.Serializer)
+	str(EnvSchemaRegistryPath, &cfg.Kafka.SchemaRegistryPath)
+	boolean(EnvUnifiedCommandTopic, &cfg.Kafka.UnifiedCommandTopic)
+	num(EnvCommandTopicPartitions, &cfg.Kafka.CommandTopicPartitions)
+
+	duration(EnvWebhookTimeout, &cfg.Webhooks.Timeout)
+	num(EnvWebhookMaxAttempts, &cfg.Webhooks.MaxAttempts)
+	duration(EnvWebhookRetryBackoff, &cfg.Webhooks.RetryBackoff)
+	duration(EnvWebhookMaxRetryBackoff, &cfg.Webhooks.MaxRetryBackoff)
+	boolean(EnvWebhookAllowPrivate, &cfg.Webhooks.AllowPrivateHosts)
 
-	MongoHost = os.Getenv(EnvMongoHost)
-	MongoPort = os.Getenv(EnvMongoPort)
-	MongoDB = os.Getenv(EnvMongoDB)
+	str(EnvInterestDefaultPlan, &cfg.Interest.DefaultPlan)
+	duration(EnvInterestInterval, &cfg.Interest.Interval)
 
-	KafkaBroker = os.Getenv(EnvKafkaBroker)
-	KafkaTopic = os.Getenv(EnvKafkaTopic)
-	KafkaClusterID = os.Getenv(EnvKafkaClusterID)
-	Port = os.Getenv(EnvPort)
+	duration(EnvSchedulerPollInterval, &cfg.Scheduler.PollInterval)
+	duration(EnvSchedulerLeaseTTL, &cfg.Scheduler.LeaseTTL)
+	duration(EnvSchedulerMissedAfter, &cfg.Scheduler.MissedAfter)
+
+	str(EnvLedgerLogsSource, &cfg.Ledger.LogsSource)
+	duration(EnvLedgerProjectionInterval, &cfg.Ledger.ProjectionInterval)
+	duration(EnvLedgerProjectionLeaseTTL, &cfg.Ledger.ProjectionLeaseTTL)
+
+	if len(problems) > 0 {
+		return errors.New("invalid environment:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// lookupEnv returns the value of key, or the trimmed contents of the file
+// named by key_FILE. Setting both is an error.
+func lookupEnv(key string) (string, error) {
+	value := os.Getenv(key)
+	path := os.Getenv(key + fileSuffix)
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("only one of %s and %s%s may be set", key, key, fileSuffix)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s%s: %w", key, fileSuffix, err)
+	}
+	return strings.TrimSpace(string(data)), nil
 }
@@ -0,0 +1,144 @@
+// Package fees evaluates the fee schedule: rules keyed by operation and
+// account type that combine flat and percentage charges, optionally by
+// amount tier, capped by a minimum and maximum.
+package fees
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Operations are the command event types fees can be charged on.
+var Operations = []string{"DeductBalance"}
+
+// Rule prices one operation, optionally for one account type only. With
+// Tiers, the first tier whose UpTo covers the amount supplies Flat and
+// Percent instead of the rule's own. Min and Max, when set, bound the fee.
+type Rule struct {
+	Operation   string  `yaml:"operation" json:"operation"`
+	AccountType string  `yaml:"account_type" json:"account_type,omitempty"`
+	Flat        float64 `yaml:"flat" json:"flat,omitempty"`
+	Percent     float64 `yaml:"percent" json:"percent,omitempty"`
+	Tiers       []Tier  `yaml:"tiers" json:"tiers,omitempty"`
+	Min         float64 `yaml:"min" json:"min,omitempty"`
+	Max         float64 `yaml:"max" json:"max,omitempty"`
+}
+
+// Tier applies to amounts up to and including UpTo. A zero UpTo covers
+// every amount, so it belongs last.
+type Tier struct {
+	UpTo    float64 `yaml:"up_to" json:"up_to,omitempty"`
+	Flat    float64 `yaml:"flat" json:"flat,omitempty"`
+	Percent float64 `yaml:"percent" json:"percent,omitempty"`
+}
+
+// Schedule is the set of fee rules in force.
+type Schedule []Rule
+
+// Quote is the fee an operation would be charged.
+type Quote struct {
+	Operation   string  `json:"operation"`
+	AccountType string  `json:"account_type"`
+	Amount      float64 `json:"amount"`
+	Fee         float64 `json:"fee"`
+	// Total is what leaves the account: the amount plus the fee.
+	Total float64 `json:"total"`
+}
+
+// Rule returns the rule for operation on an account of accountType. A rule
+// for that exact type wins over one for every type.
+func (s Schedule) Rule(operation, accountType string) (Rule, bool) {
+	var fallback *Rule
+	for i, r := range s {
+		if r.Operation != operation {
+			continue
+		}
+		if r.AccountType == accountType {
+			return r, true
+		}
+		if r.AccountType == "" && fallback == nil {
+			fallback = &s[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Rule{}, false
+}
+
+// Quote prices operation for amount on an account of accountType. Without
+// a matching rule the fee is zero.
+func (s Schedule) Quote(operation, accountType string, amount float64) Quote {
+	q := Quote{Operation: operation, AccountType: accountType, Amount: amount, Total: amount}
+	if rule, ok := s.Rule(operation, accountType); ok {
+		q.Fee = rule.Fee(amount)
+		q.Total = round(amount + q.Fee)
+	}
+	return q
+}
+
+// Fee computes the rule's fee for amount, rounded to cents.
+func (r Rule) Fee(amount float64) float64 {
+	flat, percent := r.Flat, r.Percent
+	for _, t := range r.Tiers {
+		if t.UpTo == 0 || amount <= t.UpTo {
+			flat, percent = t.Flat, t.Percent
+			break
+		}
+	}
+
+	fee := flat + amount*percent/100
+	if r.Min > 0 {
+		fee = math.Max(fee, r.Min)
+	}
+	if r.Max > 0 {
+		fee = math.Min(fee, r.Max)
+	}
+	return round(fee)
+}
+
+// Validate reports every problem in the schedule at once.
+func (s Schedule) Validate() error {
+	var problems []string
+	seen := map[string]bool{}
+	for i, r := range s {
+		name := fmt.Sprintf("fees[%d]", i)
+		known := false
+		for _, op := range Operations {
+			known = known || op == r.Operation
+		}
+		if !known {
+			problems = append(problems, fmt.Sprintf("%s: operation must be one of %s", name, strings.Join(Operations, ", ")))
+		}
+		key := r.Operation + "/" + r.AccountType
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate rule for %s", name, key))
+		}
+		seen[key] = true
+
+		if r.Flat < 0 || r.Percent < 0 || r.Min < 0 || r.Max < 0 {
+			problems = append(problems, fmt.Sprintf("%s: amounts must not be negative", name))
+		}
+		if r.Max > 0 && r.Min > r.Max {
+			problems = append(problems, fmt.Sprintf("%s: min must not exceed max", name))
+		}
+		for j, t := range r.Tiers {
+			if t.Flat < 0 || t.Percent < 0 || t.UpTo < 0 {
+				problems = append(problems, fmt.Sprintf("%s.tiers[%d]: amounts must not be negative", name, j))
+			}
+			if j > 0 && (r.Tiers[j-1].UpTo == 0 || t.UpTo != 0 && t.UpTo <= r.Tiers[j-1].UpTo) {
+				problems = append(problems, fmt.Sprintf("%s.tiers[%d]: tiers must be in increasing up_to order, open-ended tier last", name, j))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,58 @@
+package fees
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleFee(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		amount float64
+		want   float64
+	}{
+		{"flat", Rule{Flat: 1.5}, 100, 1.5},
+		{"percentage", Rule{Percent: 2}, 250, 5},
+		{"flat plus percentage", Rule{Flat: 0.3, Percent: 2.9}, 100, 3.2},
+		{"min cap", Rule{Percent: 1, Min: 2}, 50, 2},
+		{"max cap", Rule{Percent: 1, Max: 10}, 5000, 10},
+		{"rounded to cents", Rule{Percent: 1.5}, 33.33, 0.5},
+		{"first tier", Rule{Tiers: []Tier{{UpTo: 100, Flat: 1}, {Percent: 1}}}, 100, 1},
+		{"open tier", Rule{Tiers: []Tier{{UpTo: 100, Flat: 1}, {Percent: 1}}}, 500, 5},
+		{"tier with caps", Rule{Tiers: []Tier{{UpTo: 100, Flat: 1}, {Percent: 1}}, Max: 3}, 500, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rule.Fee(tt.amount))
+		})
+	}
+}
+
+func TestScheduleQuote(t *testing.T) {
+	s := Schedule{
+		{Operation: "DeductBalance", Flat: 1},
+		{Operation: "DeductBalance", AccountType: "savings", Flat: 3},
+	}
+
+	assert.Equal(t, Quote{Operation: "DeductBalance", AccountType: "wallet", Amount: 10, Fee: 1, Total: 11},
+		s.Quote("DeductBalance", "wallet", 10))
+	assert.Equal(t, 3.0, s.Quote("DeductBalance", "savings", 10).Fee)
+	assert.Equal(t, 0.0, s.Quote("AddBalance", "wallet", 10).Fee)
+}
+
+func TestScheduleValidate(t *testing.T) {
+	assert.NoError(t, Schedule{{Operation: "DeductBalance", Percent: 1, Min: 1, Max: 5}}.Validate())
+
+	err := Schedule{
+		{Operation: "Refund"},
+		{Operation: "DeductBalance", Min: 5, Max: 1},
+		{Operation: "DeductBalance"},
+		{Operation: "DeductBalance", AccountType: "savings", Tiers: []Tier{{Percent: 1}, {UpTo: 10}}},
+	}.Validate()
+	assert.ErrorContains(t, err, "fees[0]: operation must be one of DeductBalance")
+	assert.ErrorContains(t, err, "fees[1]: min must not exceed max")
+	assert.ErrorContains(t, err, "fees[2]: duplicate rule")
+	assert.ErrorContains(t, err, "fees[3].tiers[1]")
+}
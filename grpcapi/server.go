@@ -0,0 +1,128 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"ledger/kafka"
+	"ledger/ledgerpb"
+	"ledger/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server implements ledgerpb.LedgerServiceServer on top of the service
+// layer, so gRPC and REST share the same business rules.
+type Server struct {
+	ledgerpb.UnimplementedLedgerServiceServer
+}
+
+// CorrelationIDMetadataKey is the request metadata key carrying the caller's
+// correlation ID.
+const CorrelationIDMetadataKey = "x-correlation-id"
+
+// NewGRPCServer returns a grpc.Server with LedgerService registered.
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(correlationInterceptor))
+	ledgerpb.RegisterLedgerServiceServer(server, &Server{})
+	return server
+}
+
+func (s *Server) CreateAccount(ctx context.Context, req *ledgerpb.CreateAccountRequest) (*ledgerpb.CreateAccountResponse, error) {
+	if err := service.CreateAccount(ctx, req.GetUserId(), req.GetInitialBalance()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ledgerpb.CreateAccountResponse{Accepted: true}, nil
+}
+
+func (s *Server) Deposit(ctx context.Context, req *ledgerpb.DepositRequest) (*ledgerpb.DepositResponse, error) {
+	if err := service.AddAmount(ctx, req.GetUserId(), req.GetAmount(), req.GetExpectedVersion()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ledgerpb.DepositResponse{Accepted: true}, nil
+}
+
+func (s *Server) Withdraw(ctx context.Context, req *ledgerpb.WithdrawRequest) (*ledgerpb.WithdrawResponse, error) {
+	if err := service.DeductAmount(ctx, req.GetUserId(), req.GetAmount(), req.GetExpectedVersion()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ledgerpb.WithdrawResponse{Accepted: true}, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *ledgerpb.GetBalanceRequest) (*ledgerpb.GetBalanceResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	balance, version, err := service.GetUserBalance(req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ledgerpb.GetBalanceResponse{UserId: req.GetUserId(), Balance: balance, Version: version}, nil
+}
+
+func (s *Server) ListEntries(req *ledgerpb.ListEntriesRequest, stream ledgerpb.LedgerService_ListEntriesServer) error {
+	if req.GetUserId() == "" {
+		return status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	records, err := service.GetUserLogs(req.GetUserId())
+	if err != nil {
+		return toStatus(err)
+	}
+	for _, rec := range records {
+		if err := stream.Context().Err(); err != nil {
+			return toStatus(err)
+		}
+		if err := stream.Send(&ledgerpb.LedgerEntry{
+			Id:            rec.ID.Hex(),
+			UserId:        rec.UserID,
+			Operation:     rec.Operation,
+			Amount:        rec.Amount,
+			Timestamp:     timestamppb.New(rec.Timestamp),
+			TransactionId: rec.TransactionID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// correlationInterceptor stores the caller's correlation ID in the context
+// so produced commands carry it.
+func correlationInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(CorrelationIDMetadataKey); len(ids) > 0 && ids[0] != "" {
+			ctx = kafka.WithCorrelationID(ctx, ids[0])
+		}
+	}
+	return handler(ctx, req)
+}
+
+// toStatus maps service errors onto gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrAccountNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrAccountFrozen), errors.Is(err, service.ErrAccountClosed),
+		errors.Is(err, service.ErrNonZeroBalance), errors.Is(err, service.ErrInvalidStatusTransition),
+		errors.Is(err, service.ErrCurrencyMismatch), errors.Is(err, service.ErrInvalidScheduleTransition),
+		errors.Is(err, service.ErrAlreadyReversed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrAccountExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrLimitExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
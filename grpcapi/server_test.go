@@ -0,0 +1,61 @@
+package grpcapi_test
+
+import (
+	"context"
+	"ledger/grpcapi"
+	"ledger/ledgerpb"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newClient serves LedgerService over an in-memory listener and returns a
+// client connected to it.
+func newClient(t *testing.T) ledgerpb.LedgerServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpcapi.NewGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return ledgerpb.NewLedgerServiceClient(conn)
+}
+
+func TestInvalidArgumentsMapToInvalidArgument(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	_, err := client.Deposit(ctx, &ledgerpb.DepositRequest{UserId: "user-1", Amount: -5})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Withdraw(ctx, &ledgerpb.WithdrawRequest{Amount: 5})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Withdraw(ctx, &ledgerpb.WithdrawRequest{UserId: "user-1", Amount: 5, ExpectedVersion: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.CreateAccount(ctx, &ledgerpb.CreateAccountRequest{UserId: "user-1", InitialBalance: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.GetBalance(ctx, &ledgerpb.GetBalanceRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.ListEntries(ctx, &ledgerpb.ListEntriesRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,45 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ledger/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("%w: amount must be positive", service.ErrInvalidArgument), codes.InvalidArgument},
+		{service.ErrNotFound, codes.NotFound},
+		{fmt.Errorf("account user-1: %w", service.ErrAccountNotFound), codes.NotFound},
+		{fmt.Errorf("account user-1: %w", service.ErrAccountExists), codes.AlreadyExists},
+		{service.ErrAccountFrozen, codes.FailedPrecondition},
+		{service.ErrAccountClosed, codes.FailedPrecondition},
+		{service.ErrNonZeroBalance, codes.FailedPrecondition},
+		{service.ErrInvalidStatusTransition, codes.FailedPrecondition},
+		{service.ErrCurrencyMismatch, codes.FailedPrecondition},
+		{service.ErrInvalidScheduleTransition, codes.FailedPrecondition},
+		{service.ErrAlreadyReversed, codes.FailedPrecondition},
+		{fmt.Errorf("daily debit limit: %w", service.ErrLimitExceeded), codes.ResourceExhausted},
+		{fmt.Errorf("expected version 3: %w", service.ErrVersionConflict), codes.Aborted},
+		{context.Canceled, codes.Canceled},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{errors.New("connection refused"), codes.Internal},
+	}
+	for _, c := range cases {
+		t.Run(c.err.Error(), func(t *testing.T) {
+			st, ok := status.FromError(toStatus(c.err))
+			assert.True(t, ok)
+			assert.Equal(t, c.want, st.Code())
+			assert.Equal(t, c.err.Error(), st.Message())
+		})
+	}
+}
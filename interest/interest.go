@@ -0,0 +1,106 @@
+// Package interest computes savings interest: rate plans, the daily accrual
+// on an end-of-day balance, and which days an accrual run has to cover.
+package interest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DaysInYear is the day count basis: each day accrues AnnualRate/365 of the
+// end-of-day balance (actual/365 fixed), leap years included.
+const DaysInYear = 365
+
+// Plan is a rate plan. AnnualRate is a percentage. Days ending below
+// MinBalance accrue nothing.
+type Plan struct {
+	Name       string  `yaml:"name" json:"name"`
+	AnnualRate float64 `yaml:"annual_rate" json:"annual_rate"`
+	MinBalance float64 `yaml:"min_balance" json:"min_balance,omitempty"`
+}
+
+// Plans is the set of rate plans on offer.
+type Plans []Plan
+
+// Find returns the plan called name.
+func (p Plans) Find(name string) (Plan, bool) {
+	for _, plan := range p {
+		if plan.Name == name {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
+// Accrue returns one day's interest on an end-of-day balance. It is not
+// rounded: accruals are summed and rounded to cents when posted.
+func (p Plan) Accrue(balance float64) float64 {
+	if balance <= 0 || balance < p.MinBalance {
+		return 0
+	}
+	return balance * p.AnnualRate / 100 / DaysInYear
+}
+
+// Validate reports every problem with the plans and the default plan name
+// at once. An empty default means accounts without a plan earn nothing.
+func (p Plans) Validate(defaultPlan string) error {
+	var problems []string
+	seen := map[string]bool{}
+	for i, plan := range p {
+		name := fmt.Sprintf("plans[%d]", i)
+		if plan.Name == "" {
+			problems = append(problems, fmt.Sprintf("%s: name is required", name))
+		} else if seen[plan.Name] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate plan %q", name, plan.Name))
+		}
+		seen[plan.Name] = true
+		if plan.AnnualRate < 0 || plan.MinBalance < 0 {
+			problems = append(problems, fmt.Sprintf("%s: rates and balances must not be negative", name))
+		}
+	}
+	if defaultPlan != "" && !seen[defaultPlan] {
+		problems = append(problems, fmt.Sprintf("default plan %q is not defined", defaultPlan))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Day truncates t to the start of its UTC day, which is how accrual dates
+// are kept.
+func Day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// MonthStart returns the first day of t's UTC month.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// DaysToAccrue returns the days an accrual run at now has to cover, oldest
+// first: every day after last up to and including yesterday, so days missed
+// during downtime are caught up. A day is only accrued once it has ended.
+// With no previous run (zero last) only yesterday is due.
+func DaysToAccrue(last, now time.Time) []time.Time {
+	yesterday := Day(now).AddDate(0, 0, -1)
+	first := yesterday
+	if !last.IsZero() {
+		first = Day(last).AddDate(0, 0, 1)
+	}
+	var days []time.Time
+	for day := first; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// Round rounds an amount to cents for posting.
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,60 @@
+package interest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPlanAccrue(t *testing.T) {
+	plan := Plan{Name: "standard", AnnualRate: 3.65}
+
+	assert.InDelta(t, 0.1, plan.Accrue(1000), 1e-9)
+	assert.Zero(t, plan.Accrue(0))
+	assert.Zero(t, plan.Accrue(-50))
+
+	plan.MinBalance = 500
+	assert.Zero(t, plan.Accrue(499.99))
+	assert.InDelta(t, 0.05, plan.Accrue(500), 1e-9)
+}
+
+func TestPlansValidate(t *testing.T) {
+	assert.NoError(t, Plans{{Name: "standard", AnnualRate: 2}}.Validate("standard"))
+	assert.NoError(t, Plans{}.Validate(""))
+
+	err := Plans{
+		{Name: "standard", AnnualRate: 2},
+		{Name: "standard", AnnualRate: 3},
+		{AnnualRate: -1},
+	}.Validate("premium")
+	assert.ErrorContains(t, err, `plans[1]: duplicate plan "standard"`)
+	assert.ErrorContains(t, err, "plans[2]: name is required")
+	assert.ErrorContains(t, err, "plans[2]: rates and balances must not be negative")
+	assert.ErrorContains(t, err, `default plan "premium" is not defined`)
+}
+
+func TestDaysToAccrue(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 0, 5, 0, 0, time.UTC)
+
+	// First run: only the day that just ended.
+	assert.Equal(t, []time.Time{date(2024, time.March, 1)}, DaysToAccrue(time.Time{}, now))
+
+	// Up to date: nothing to do.
+	assert.Empty(t, DaysToAccrue(date(2024, time.March, 1), now))
+
+	// Catch-up across a month end, leap day included.
+	assert.Equal(t, []time.Time{
+		date(2024, time.February, 28),
+		date(2024, time.February, 29),
+		date(2024, time.March, 1),
+	}, DaysToAccrue(date(2024, time.February, 27), now))
+}
+
+func TestMonthStart(t *testing.T) {
+	assert.Equal(t, date(2024, time.February, 1), MonthStart(time.Date(2024, time.February, 29, 23, 59, 0, 0, time.UTC)))
+}
@@ -3,10 +3,15 @@ package kafka
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
+// pollInterval bounds how long ReadMessage blocks so the consume loop can
+// notice context cancellation promptly.
+const pollInterval = 100 * time.Millisecond
+
 type ConsumerHandler struct {
 	MessageChannel   chan *kafka.Message
 	SubscribedTopics []string
@@ -30,26 +35,34 @@ func NewConsumerHandler(topics []string) *ConsumerHandler {
 	}
 }
 
+// StartConsuming subscribes to the topics and fans messages out to the
+// subscribed channels until ctx is cancelled. On cancellation it stops
+// reading and closes MessageChannel so the handler can drain what it
+// already received.
 func (h *ConsumerHandler) StartConsuming(ctx context.Context) {
 	if Consumer == nil {
 		log.Fatal("Kafka consumer is not initialized. Call InitKafka first.")
 	}
 
-	if err := Consumer.SubscribeTopics(Topics, nil); err != nil {
+	if err := Consumer.SubscribeTopics(h.SubscribedTopics, nil); err != nil {
 		log.Fatalf("Failed to subscribe to topics: %v", err)
 	}
 
 	log.Println("Kafka consumer started. Waiting for messages...")
 
 	go func(ctx context.Context) {
+		defer close(h.MessageChannel)
 		for {
 			select {
 			case <-ctx.Done():
 				log.Println("Kafka consumer context cancelled, stopping message loop")
 				return
 			default:
-				msg, err := Consumer.ReadMessage(-1)
+				msg, err := Consumer.ReadMessage(pollInterval)
 				if err != nil {
+					if kerr, ok := err.(kafka.Error); ok && kerr.Code() == kafka.ErrTimedOut {
+						continue
+					}
 					log.Printf("Consumer error: %v", err)
 					continue
 				}
@@ -57,14 +70,39 @@ func (h *ConsumerHandler) StartConsuming(ctx context.Context) {
 				log.Printf("Received message: %s", msg.Value)
 				var subscribedChannels = globalSubscribedChannels[*msg.TopicPartition.Topic]
 				for _, channel := range subscribedChannels {
+					// Block rather than drop: offsets are only stored once a
+					// message is handled, so a dropped message would be lost.
 					select {
 					case channel <- msg:
 						log.Printf("Message sent to channel for topic %s", *msg.TopicPartition.Topic)
-					default:
-						log.Printf("Channel for topic %s is full, dropping message", *msg.TopicPartition.Topic)
+					case <-ctx.Done():
+						log.Println("Kafka consumer context cancelled, stopping message loop")
+						return
 					}
 				}
 			}
 		}
 	}(ctx)
 }
+
+// MarkProcessed stores the message's offset so the next commit includes it.
+// Call it once the message has been fully handled.
+func MarkProcessed(msg *kafka.Message) {
+	if _, err := Consumer.StoreMessage(msg); err != nil {
+		log.Printf("Failed to store offset for %v: %v", msg.TopicPartition, err)
+	}
+}
+
+// CommitOffsets synchronously commits every offset stored by MarkProcessed.
+func CommitOffsets() error {
+	if Consumer == nil {
+		return nil
+	}
+	if _, err := Consumer.Commit(); err != nil {
+		if kerr, ok := err.(kafka.Error); ok && kerr.Code() == kafka.ErrNoOffset {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
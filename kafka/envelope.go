@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+)
+
+// Envelope headers. Together with the schema headers written by the
+// serializer they form the common envelope of every ledger message; the
+// payload is the message value.
+const (
+	HeaderEventID       = "event-id"
+	HeaderEventType     = "event-type"
+	HeaderOccurredAt    = "occurred-at"
+	HeaderCausationID   = "causation-id"
+	HeaderCorrelationID = "correlation-id"
+)
+
+// Command event types.
+const (
+	EventTypeCreateAccount = "CreateAccount"
+	EventTypeAddBalance    = "AddBalance"
+	EventTypeDeductBalance = "DeductBalance"
+	EventTypeApplyBatch    = "ApplyBatch"
+
+	EventTypeChangeAccountStatus = "ChangeAccountStatus"
+	EventTypePostJournalEntry    = "PostJournalEntry"
+)
+
+// Domain event types published on TopicLedgerEvents.
+const (
+	EventTypeAccountCreated       = "AccountCreated"
+	EventTypeBalanceCredited      = "BalanceCredited"
+	EventTypeBalanceDebited       = "BalanceDebited"
+	EventTypeAccountStatusChanged = "AccountStatusChanged"
+	EventTypeOperationRejected    = "OperationRejected"
+	EventTypeFeeCharged           = "FeeCharged"
+	EventTypeInterestCredited     = "InterestCredited"
+)
+
+// DomainEventTypes lists every event type published on TopicLedgerEvents.
+var DomainEventTypes = []string{
+	EventTypeAccountCreated,
+	EventTypeBalanceCredited,
+	EventTypeBalanceDebited,
+	EventTypeAccountStatusChanged,
+	EventTypeOperationRejected,
+	EventTypeFeeCharged,
+	EventTypeInterestCredited,
+}
+
+// legacyTopicEventTypes maps the per-operation topics to the event type of
+// every message on them, for messages produced before the envelope existed.
+var legacyTopicEventTypes = map[string]string{
+	TopicCreateAccount: EventTypeCreateAccount,
+	TopicAddBalance:    EventTypeAddBalance,
+	TopicDeductBalance: EventTypeDeductBalance,
+}
+
+// EventMeta is the envelope metadata shared by all ledger messages.
+type EventMeta struct {
+	EventID string
+	Type    string
+	// Version is the payload schema version, or 0 for unversioned JSON.
+	Version       int
+	OccurredAt    time.Time
+	CausationID   string
+	CorrelationID string
+}
+
+// NewEventMeta creates metadata for a new event of eventType. The
+// correlation ID is taken from ctx, or starts a new correlation chain.
+func NewEventMeta(ctx context.Context, eventType string) EventMeta {
+	meta := EventMeta{
+		EventID:       uuid.New().String(),
+		Type:          eventType,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: CorrelationID(ctx),
+	}
+	if meta.CorrelationID == "" {
+		meta.CorrelationID = meta.EventID
+	}
+	return meta
+}
+
+// CausedBy returns metadata for a new event of eventType triggered by the
+// event described by m, keeping its correlation chain.
+func (m EventMeta) CausedBy(eventType string) EventMeta {
+	next := NewEventMeta(context.Background(), eventType)
+	next.CausationID = m.EventID
+	next.CorrelationID = m.CorrelationID
+	return next
+}
+
+func (m EventMeta) headers() []kafka.Header {
+	headers := []kafka.Header{
+		{Key: HeaderEventID, Value: []byte(m.EventID)},
+		{Key: HeaderEventType, Value: []byte(m.Type)},
+		{Key: HeaderOccurredAt, Value: []byte(m.OccurredAt.Format(time.RFC3339Nano))},
+		{Key: HeaderCorrelationID, Value: []byte(m.CorrelationID)},
+	}
+	if m.CausationID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderCausationID, Value: []byte(m.CausationID)})
+	}
+	return headers
+}
+
+// ReadEventMeta extracts the envelope metadata of a consumed message.
+// Messages produced before the envelope existed get their type from the
+// topic and a deterministic ID from their position in the log.
+func ReadEventMeta(msg *kafka.Message) (EventMeta, error) {
+	topic := *msg.TopicPartition.Topic
+	meta := EventMeta{
+		EventID:       headerValue(msg, HeaderEventID),
+		Type:          headerValue(msg, HeaderEventType),
+		CausationID:   headerValue(msg, HeaderCausationID),
+		CorrelationID: headerValue(msg, HeaderCorrelationID),
+		OccurredAt:    msg.Timestamp,
+	}
+
+	if meta.Type == "" {
+		eventType, ok := legacyTopicEventTypes[topic]
+		if !ok {
+			return EventMeta{}, fmt.Errorf("message on %s has no %s header", topic, HeaderEventType)
+		}
+		meta.Type = eventType
+	}
+	if meta.EventID == "" {
+		meta.EventID = fmt.Sprintf("%s-%d-%d", topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset)
+	}
+	if meta.CorrelationID == "" {
+		meta.CorrelationID = meta.EventID
+	}
+	if raw := headerValue(msg, HeaderOccurredAt); raw != "" {
+		occurredAt, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return EventMeta{}, fmt.Errorf("invalid %s header: %w", HeaderOccurredAt, err)
+		}
+		meta.OccurredAt = occurredAt
+	}
+	if raw := headerValue(msg, HeaderSchemaVersion); raw != "" {
+		version, err := strconv.Atoi(raw)
+		if err != nil {
+			return EventMeta{}, fmt.Errorf("invalid %s header: %w", HeaderSchemaVersion, err)
+		}
+		meta.Version = version
+	}
+	return meta, nil
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context whose produced events carry id as
+// their correlation ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation ID stored in ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMetaRoundTripsThroughHeaders(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "req-42")
+	sent := NewEventMeta(ctx, EventTypeAddBalance)
+	topic := TopicLedgerCommands
+
+	got, err := ReadEventMeta(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Headers:        append(sent.headers(), kafka.Header{Key: HeaderSchemaVersion, Value: []byte("3")}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, sent.EventID, got.EventID)
+	assert.Equal(t, EventTypeAddBalance, got.Type)
+	assert.Equal(t, "req-42", got.CorrelationID)
+	assert.Equal(t, 3, got.Version)
+	assert.True(t, sent.OccurredAt.Equal(got.OccurredAt))
+}
+
+func TestCausedByKeepsCorrelationChain(t *testing.T) {
+	cause := NewEventMeta(context.Background(), EventTypeCreateAccount)
+
+	effect := cause.CausedBy(EventTypeAddBalance)
+
+	assert.Equal(t, cause.EventID, cause.CorrelationID, "a new chain is correlated to its first event")
+	assert.Equal(t, cause.EventID, effect.CausationID)
+	assert.Equal(t, cause.CorrelationID, effect.CorrelationID)
+	assert.NotEqual(t, cause.EventID, effect.EventID)
+}
+
+func TestReadEventMetaForLegacyMessages(t *testing.T) {
+	topic := TopicDeductBalance
+	produced := time.Date(2025, 5, 17, 13, 0, 0, 0, time.UTC)
+
+	meta, err := ReadEventMeta(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 17},
+		Timestamp:      produced,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, EventTypeDeductBalance, meta.Type)
+	assert.Equal(t, "deduct-balance-0-17", meta.EventID)
+	assert.Equal(t, produced, meta.OccurredAt)
+	assert.Equal(t, 0, meta.Version)
+}
+
+func TestReadEventMetaRequiresTypeOnUnifiedTopic(t *testing.T) {
+	topic := TopicLedgerCommands
+
+	_, err := ReadEventMeta(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}})
+
+	assert.Error(t, err)
+}
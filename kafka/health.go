@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PingProducer fetches cluster metadata through the producer to confirm the
+// brokers are reachable.
+func PingProducer(ctx context.Context) error {
+	if Producer == nil {
+		return errors.New("kafka producer is not initialized")
+	}
+	_, err := Producer.GetMetadata(nil, false, timeoutMs(ctx))
+	return err
+}
+
+// ConsumerStatus reports the consumer's subscription and how many partitions
+// are currently assigned to it. A replica with no assigned partitions is
+// still healthy; the group may simply have more members than partitions.
+func ConsumerStatus() (string, error) {
+	if Consumer == nil {
+		return "", errors.New("kafka consumer is not initialized")
+	}
+	topics, err := Consumer.Subscription()
+	if err != nil {
+		return "", fmt.Errorf("failed to read subscription: %w", err)
+	}
+	if len(topics) == 0 {
+		return "", errors.New("kafka consumer is not subscribed to any topic")
+	}
+	assigned, err := Consumer.Assignment()
+	if err != nil {
+		return "", fmt.Errorf("failed to read assignment: %w", err)
+	}
+	return fmt.Sprintf("%d partition(s) assigned", len(assigned)), nil
+}
+
+// timeoutMs converts the context deadline into the millisecond timeout the
+// librdkafka calls expect.
+func timeoutMs(ctx context.Context) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 5000
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		return 1
+	}
+	return int(remaining)
+}
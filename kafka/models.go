@@ -1,12 +1,32 @@
 package kafka
 
-import "time"
+import (
+	"ledger/ledgerpb"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 // Topic constants
 const (
 	TopicCreateAccount = "create-account"
 	TopicAddBalance    = "add-balance"
 	TopicDeductBalance = "deduct-balance"
+	TopicApplyBatch    = "apply-batch"
+	TopicAccountStatus = "account-status"
+	TopicJournalEntry  = "post-journal-entry"
+
+	// TopicLedgerCommands carries every command. Single-account commands
+	// are keyed by account, so they land on one partition in order.
+	// Journal entries and all-or-nothing batches span several accounts and
+	// are keyed by entry or batch ID instead, so they are not ordered
+	// against the single-account commands of the accounts they touch.
+	TopicLedgerCommands = "ledger-commands"
+
+	// TopicLedgerEvents carries the domain events published after commands
+	// are committed, keyed by account.
+	TopicLedgerEvents = "ledger-events"
 )
 
 // Base struct for all Kafka messages
@@ -15,26 +35,381 @@ type BaseMessage struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// CreateAccountMessage represents a new user account creation event
+// CreateAccountMessage represents a new user account creation event.
+// UserID is the account ID; OwnerID, when set, is the user holding it.
 type CreateAccountMessage struct {
 	BaseMessage
-	InitialBalance float64 `json:"initial_balance"`
+	InitialBalance float64           `json:"initial_balance"`
+	OwnerID        string            `json:"owner_id,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Type           string            `json:"type,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
 }
 
 // AddBalanceMessage represents an event where funds are added to a user's account
 type AddBalanceMessage struct {
 	BaseMessage
 	Amount float64 `json:"amount"`
+	// ExpectedVersion, when set, rejects the command unless the account is
+	// still at this version.
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
 }
 
 // DeductBalanceMessage represents an event where funds are deducted from a user's account
 type DeductBalanceMessage struct {
 	BaseMessage
 	Amount float64 `json:"amount"`
+	// ExpectedVersion, when set, rejects the command unless the account is
+	// still at this version.
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+}
+
+// ApplyBatchMessage asks for all of its items to be applied atomically.
+type ApplyBatchMessage struct {
+	BatchID   string      `json:"batch_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Items     []BatchItem `json:"items"`
+}
+
+// BatchItem is one operation of an ApplyBatchMessage. Operation is one of
+// the command event types; EventID identifies the item's result.
+type BatchItem struct {
+	EventID   string  `json:"event_id"`
+	Operation string  `json:"operation"`
+	UserID    string  `json:"user_id"`
+	Amount    float64 `json:"amount"`
+}
+
+// Journal leg directions.
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+// PostJournalEntryMessage asks for a balanced journal entry to be posted.
+// EntryID becomes the TransactionID of every leg's ledger record.
+type PostJournalEntryMessage struct {
+	EntryID     string       `json:"entry_id"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Description string       `json:"description"`
+	Legs        []JournalLeg `json:"legs"`
+	// Reverses is the EntryID of the entry this one compensates, if any.
+	Reverses string `json:"reverses,omitempty"`
+}
+
+// JournalLeg debits or credits one account. Amount is always positive.
+type JournalLeg struct {
+	UserID    string  `json:"user_id"`
+	Direction string  `json:"direction"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+}
+
+// Account status actions carried by ChangeAccountStatusMessage.
+const (
+	AccountActionFreeze   = "freeze"
+	AccountActionUnfreeze = "unfreeze"
+	AccountActionClose    = "close"
+)
+
+// ChangeAccountStatusMessage asks for an account to be frozen, unfrozen or
+// closed.
+type ChangeAccountStatusMessage struct {
+	BaseMessage
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// AccountCreatedEvent is published after an account is created.
+type AccountCreatedEvent struct {
+	UserID         string  `json:"user_id"`
+	InitialBalance float64 `json:"initial_balance"`
+	Balance        float64 `json:"balance"`
+	OwnerID        string  `json:"owner_id"`
+	Type           string  `json:"type"`
+}
+
+// BalanceCreditedEvent is published after funds are added to an account.
+type BalanceCreditedEvent struct {
+	UserID  string  `json:"user_id"`
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"`
+}
+
+// BalanceDebitedEvent is published after funds are deducted from an account.
+type BalanceDebitedEvent struct {
+	UserID  string  `json:"user_id"`
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"`
+}
+
+// AccountStatusChangedEvent is published after an account's status changes.
+type AccountStatusChangedEvent struct {
+	UserID         string `json:"user_id"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason"`
+}
+
+// OperationRejectedEvent is published when a command could not be applied.
+type OperationRejectedEvent struct {
+	UserID    string  `json:"user_id"`
+	Operation string  `json:"operation"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason"`
+}
+
+// FeeChargedEvent is published when a command is charged a fee.
+type FeeChargedEvent struct {
+	UserID    string  `json:"user_id"`
+	Operation string  `json:"operation"`
+	Fee       float64 `json:"fee"`
+	Balance   float64 `json:"balance"`
+}
+
+// InterestCreditedEvent is published when accrued interest is posted. The
+// accrual dates are formatted as YYYY-MM-DD.
+type InterestCreditedEvent struct {
+	UserID         string  `json:"user_id"`
+	Amount         float64 `json:"amount"`
+	Balance        float64 `json:"balance"`
+	AccruedFrom    string  `json:"accrued_from"`
+	AccruedThrough string  `json:"accrued_through"`
+}
+
+// Schemas lists every message type whose schema is registered at startup.
+var Schemas = []Message{
+	CreateAccountMessage{},
+	AddBalanceMessage{},
+	DeductBalanceMessage{},
+	ApplyBatchMessage{},
+	ChangeAccountStatusMessage{},
+	PostJournalEntryMessage{},
+	AccountCreatedEvent{},
+	BalanceCreditedEvent{},
+	BalanceDebitedEvent{},
+	AccountStatusChangedEvent{},
+	OperationRejectedEvent{},
+	FeeChargedEvent{},
+	InterestCreditedEvent{},
+}
+
+func (m CreateAccountMessage) ToProto() proto.Message {
+	return &ledgerpb.CreateAccountCommand{
+		UserId:         m.UserID,
+		Timestamp:      timestamppb.New(m.Timestamp),
+		InitialBalance: m.InitialBalance,
+		OwnerId:        m.OwnerID,
+		Name:           m.Name,
+		Type:           m.Type,
+		Labels:         m.Labels,
+	}
+}
+
+func (m *CreateAccountMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.CreateAccountCommand)
+	m.UserID = cmd.GetUserId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.InitialBalance = cmd.GetInitialBalance()
+	m.OwnerID = cmd.GetOwnerId()
+	m.Name = cmd.GetName()
+	m.Type = cmd.GetType()
+	m.Labels = cmd.GetLabels()
+}
+
+func (m AddBalanceMessage) ToProto() proto.Message {
+	return &ledgerpb.AddBalanceCommand{
+		UserId:          m.UserID,
+		Timestamp:       timestamppb.New(m.Timestamp),
+		Amount:          m.Amount,
+		ExpectedVersion: m.ExpectedVersion,
+	}
+}
+
+func (m *AddBalanceMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.AddBalanceCommand)
+	m.UserID = cmd.GetUserId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.Amount = cmd.GetAmount()
+	m.ExpectedVersion = cmd.GetExpectedVersion()
+}
+
+func (m DeductBalanceMessage) ToProto() proto.Message {
+	return &ledgerpb.DeductBalanceCommand{
+		UserId:          m.UserID,
+		Timestamp:       timestamppb.New(m.Timestamp),
+		Amount:          m.Amount,
+		ExpectedVersion: m.ExpectedVersion,
+	}
+}
+
+func (m *DeductBalanceMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.DeductBalanceCommand)
+	m.UserID = cmd.GetUserId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.Amount = cmd.GetAmount()
+	m.ExpectedVersion = cmd.GetExpectedVersion()
+}
+
+func (m ApplyBatchMessage) ToProto() proto.Message {
+	cmd := &ledgerpb.ApplyBatchCommand{
+		BatchId:   m.BatchID,
+		Timestamp: timestamppb.New(m.Timestamp),
+	}
+	for _, item := range m.Items {
+		cmd.Items = append(cmd.Items, &ledgerpb.BatchItem{
+			EventId:   item.EventID,
+			Operation: item.Operation,
+			UserId:    item.UserID,
+			Amount:    item.Amount,
+		})
+	}
+	return cmd
+}
+
+func (m *ApplyBatchMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.ApplyBatchCommand)
+	m.BatchID = cmd.GetBatchId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.Items = make([]BatchItem, 0, len(cmd.GetItems()))
+	for _, item := range cmd.GetItems() {
+		m.Items = append(m.Items, BatchItem{
+			EventID:   item.GetEventId(),
+			Operation: item.GetOperation(),
+			UserID:    item.GetUserId(),
+			Amount:    item.GetAmount(),
+		})
+	}
+}
+
+func (m PostJournalEntryMessage) ToProto() proto.Message {
+	cmd := &ledgerpb.PostJournalEntryCommand{
+		EntryId:     m.EntryID,
+		Timestamp:   timestamppb.New(m.Timestamp),
+		Description: m.Description,
+		Reverses:    m.Reverses,
+	}
+	for _, leg := range m.Legs {
+		cmd.Legs = append(cmd.Legs, &ledgerpb.JournalLeg{
+			UserId:    leg.UserID,
+			Direction: leg.Direction,
+			Amount:    leg.Amount,
+			Currency:  leg.Currency,
+		})
+	}
+	return cmd
+}
+
+func (m *PostJournalEntryMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.PostJournalEntryCommand)
+	m.EntryID = cmd.GetEntryId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.Description = cmd.GetDescription()
+	m.Reverses = cmd.GetReverses()
+	m.Legs = make([]JournalLeg, 0, len(cmd.GetLegs()))
+	for _, leg := range cmd.GetLegs() {
+		m.Legs = append(m.Legs, JournalLeg{
+			UserID:    leg.GetUserId(),
+			Direction: leg.GetDirection(),
+			Amount:    leg.GetAmount(),
+			Currency:  leg.GetCurrency(),
+		})
+	}
+}
+
+func (m ChangeAccountStatusMessage) ToProto() proto.Message {
+	return &ledgerpb.ChangeAccountStatusCommand{
+		UserId:    m.UserID,
+		Timestamp: timestamppb.New(m.Timestamp),
+		Action:    m.Action,
+		Reason:    m.Reason,
+	}
+}
+
+func (m *ChangeAccountStatusMessage) FromProto(p proto.Message) {
+	cmd := p.(*ledgerpb.ChangeAccountStatusCommand)
+	m.UserID = cmd.GetUserId()
+	m.Timestamp = cmd.GetTimestamp().AsTime()
+	m.Action = cmd.GetAction()
+	m.Reason = cmd.GetReason()
+}
+
+func (m AccountCreatedEvent) ToProto() proto.Message {
+	return &ledgerpb.AccountCreated{UserId: m.UserID, InitialBalance: m.InitialBalance, Balance: m.Balance, OwnerId: m.OwnerID, Type: m.Type}
+}
+
+func (m *AccountCreatedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.AccountCreated)
+	*m = AccountCreatedEvent{UserID: e.GetUserId(), InitialBalance: e.GetInitialBalance(), Balance: e.GetBalance(),
+		OwnerID: e.GetOwnerId(), Type: e.GetType()}
+}
+
+func (m BalanceCreditedEvent) ToProto() proto.Message {
+	return &ledgerpb.BalanceCredited{UserId: m.UserID, Amount: m.Amount, Balance: m.Balance}
 }
 
-var Topics = []string{
+func (m *BalanceCreditedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.BalanceCredited)
+	*m = BalanceCreditedEvent{UserID: e.GetUserId(), Amount: e.GetAmount(), Balance: e.GetBalance()}
+}
+
+func (m BalanceDebitedEvent) ToProto() proto.Message {
+	return &ledgerpb.BalanceDebited{UserId: m.UserID, Amount: m.Amount, Balance: m.Balance}
+}
+
+func (m *BalanceDebitedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.BalanceDebited)
+	*m = BalanceDebitedEvent{UserID: e.GetUserId(), Amount: e.GetAmount(), Balance: e.GetBalance()}
+}
+
+func (m AccountStatusChangedEvent) ToProto() proto.Message {
+	return &ledgerpb.AccountStatusChanged{UserId: m.UserID, PreviousStatus: m.PreviousStatus, Status: m.Status, Reason: m.Reason}
+}
+
+func (m *AccountStatusChangedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.AccountStatusChanged)
+	*m = AccountStatusChangedEvent{UserID: e.GetUserId(), PreviousStatus: e.GetPreviousStatus(), Status: e.GetStatus(), Reason: e.GetReason()}
+}
+
+func (m OperationRejectedEvent) ToProto() proto.Message {
+	return &ledgerpb.OperationRejected{UserId: m.UserID, Operation: m.Operation, Amount: m.Amount, Reason: m.Reason}
+}
+
+func (m *OperationRejectedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.OperationRejected)
+	*m = OperationRejectedEvent{UserID: e.GetUserId(), Operation: e.GetOperation(), Amount: e.GetAmount(), Reason: e.GetReason()}
+}
+
+func (m FeeChargedEvent) ToProto() proto.Message {
+	return &ledgerpb.FeeCharged{UserId: m.UserID, Operation: m.Operation, Fee: m.Fee, Balance: m.Balance}
+}
+
+func (m *FeeChargedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.FeeCharged)
+	*m = FeeChargedEvent{UserID: e.GetUserId(), Operation: e.GetOperation(), Fee: e.GetFee(), Balance: e.GetBalance()}
+}
+
+// CommandTopics are the topics the ledger consumes.
+var CommandTopics = []string{
 	TopicCreateAccount,
 	TopicAddBalance,
 	TopicDeductBalance,
+	TopicApplyBatch,
+	TopicAccountStatus,
+	TopicJournalEntry,
+	TopicLedgerCommands,
+}
+
+// Topics are all topics created at startup.
+var Topics = append(append([]string{}, CommandTopics...), TopicLedgerEvents)
+
+func (m InterestCreditedEvent) ToProto() proto.Message {
+	return &ledgerpb.InterestCredited{UserId: m.UserID, Amount: m.Amount, Balance: m.Balance,
+		AccruedFrom: m.AccruedFrom, AccruedThrough: m.AccruedThrough}
+}
+
+func (m *InterestCreditedEvent) FromProto(p proto.Message) {
+	e := p.(*ledgerpb.InterestCredited)
+	*m = InterestCreditedEvent{UserID: e.GetUserId(), Amount: e.GetAmount(), Balance: e.GetBalance(),
+		AccruedFrom: e.GetAccruedFrom(), AccruedThrough: e.GetAccruedThrough()}
 }
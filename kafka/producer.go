@@ -1,53 +1,99 @@
 package kafka
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-func SendCreateAccountMessage(msg CreateAccountMessage) error {
+func SendCreateAccountMessage(ctx context.Context, msg CreateAccountMessage) error {
 	msg.Timestamp = time.Now()
-	return sendMessage(TopicCreateAccount, msg.UserID, msg)
+	return sendMessage(CommandTopic(TopicCreateAccount), msg.UserID, NewEventMeta(ctx, EventTypeCreateAccount), msg)
 }
 
-func SendAddBalanceMessage(msg AddBalanceMessage) error {
+func SendAddBalanceMessage(ctx context.Context, msg AddBalanceMessage) error {
 	msg.Timestamp = time.Now()
-	return sendMessage(TopicAddBalance, msg.UserID, msg)
+	return sendMessage(CommandTopic(TopicAddBalance), msg.UserID, NewEventMeta(ctx, EventTypeAddBalance), msg)
 }
 
-func SendDeductBalanceMessage(msg DeductBalanceMessage) error {
+func SendDeductBalanceMessage(ctx context.Context, msg DeductBalanceMessage) error {
 	msg.Timestamp = time.Now()
-	return sendMessage(TopicDeductBalance, msg.UserID, msg)
+	return sendMessage(CommandTopic(TopicDeductBalance), msg.UserID, NewEventMeta(ctx, EventTypeDeductBalance), msg)
 }
 
-func sendMessage(topic, key string, msg interface{}) error {
-	deliveryChan := make(chan kafka.Event)
-	defer close(deliveryChan)
+func SendChangeAccountStatusMessage(ctx context.Context, msg ChangeAccountStatusMessage) error {
+	msg.Timestamp = time.Now()
+	return sendMessage(CommandTopic(TopicAccountStatus), msg.UserID, NewEventMeta(ctx, EventTypeChangeAccountStatus), msg)
+}
+
+// SendPostJournalEntryMessage produces a journal entry keyed by its entry
+// ID: its legs span several accounts, so no single account key applies,
+// and the entry may be applied before or after commands for those
+// accounts that were sent earlier.
+func SendPostJournalEntryMessage(ctx context.Context, msg PostJournalEntryMessage) error {
+	msg.Timestamp = time.Now()
+	return sendMessage(CommandTopic(TopicJournalEntry), msg.EntryID, NewEventMeta(ctx, EventTypePostJournalEntry), msg)
+}
 
-	value, err := json.Marshal(msg)
+// CommandTopic returns the topic a command is produced to: its own
+// per-operation topic, or TopicLedgerCommands when unified routing is on.
+func CommandTopic(topic string) string {
+	if unifiedCommandTopic {
+		return TopicLedgerCommands
+	}
+	return topic
+}
+
+func sendMessage(topic, key string, meta EventMeta, msg Message) error {
+	m, err := EncodeMessage(topic, key, meta, msg)
 	if err != nil {
 		return err
 	}
+	if err := PublishMessages([]*kafka.Message{m}); err != nil {
+		return err
+	}
 
-	err = Producer.Produce(&kafka.Message{
+	log.Printf("Message %s delivered to %s\n", meta.EventID, topic)
+	return nil
+}
+
+// EncodeMessage serializes msg with its envelope without producing it, for
+// callers that store messages before publishing them (see the outbox).
+func EncodeMessage(topic, key string, meta EventMeta, msg Message) (*kafka.Message, error) {
+	value, headers, err := MessageSerializer.Serialize(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
 		Key:            []byte(key),
 		Value:          value,
-	}, deliveryChan)
+		Headers:        append(meta.headers(), headers...),
+	}, nil
+}
 
-	if err != nil {
-		return err
-	}
+// PublishMessages produces already encoded messages and waits until every
+// one is acknowledged, returning the first delivery error.
+func PublishMessages(messages []*kafka.Message) error {
+	deliveryChan := make(chan kafka.Event, len(messages))
 
-	e := <-deliveryChan
-	m := e.(*kafka.Message)
-	if m.TopicPartition.Error != nil {
-		return m.TopicPartition.Error
+	produced := 0
+	var firstErr error
+	for _, m := range messages {
+		if err := Producer.Produce(m, deliveryChan); err != nil {
+			firstErr = err
+			break
+		}
+		produced++
 	}
 
-	log.Printf("Message delivered to %v\n", m.TopicPartition)
-	return nil
+	for i := 0; i < produced; i++ {
+		m := (<-deliveryChan).(*kafka.Message)
+		if m.TopicPartition.Error != nil && firstErr == nil {
+			firstErr = m.TopicPartition.Error
+		}
+	}
+	return firstErr
 }
@@ -0,0 +1,307 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrSchemaNotFound is returned when a subject or version is not registered.
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// ErrIncompatibleSchema is returned when registering a schema that would
+// break consumers of an earlier version.
+var ErrIncompatibleSchema = errors.New("incompatible schema")
+
+// SchemaRegistry stores versioned message schemas by subject. Subjects are
+// fully-qualified protobuf message names. Implementations may be local (see
+// FileRegistry) or a client for a remote registry.
+type SchemaRegistry interface {
+	// Register records schema under subject and returns its version. It is
+	// idempotent: registering an identical schema returns the existing
+	// version. It fails with ErrIncompatibleSchema if schema cannot read
+	// data written with the latest version, or vice versa.
+	Register(subject string, schema *descriptorpb.DescriptorProto) (int, error)
+	// Lookup returns the schema registered for subject at version.
+	Lookup(subject string, version int) (*descriptorpb.DescriptorProto, error)
+	// VersionOf returns the version registered for exactly schema, without
+	// registering anything. It fails with ErrSchemaNotFound if there is none.
+	VersionOf(subject string, schema *descriptorpb.DescriptorProto) (int, error)
+}
+
+// FileRegistry is a SchemaRegistry persisted as a single JSON file, so the
+// registered versions can be committed alongside the code.
+type FileRegistry struct {
+	path string
+
+	mu       sync.Mutex
+	subjects map[string][]registeredSchema
+}
+
+type registeredSchema struct {
+	Version     int             `json:"version"`
+	Fingerprint string          `json:"fingerprint"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+// NewFileRegistry loads the registry at path. A missing file is treated as
+// an empty registry and created on the first Register.
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	r := &FileRegistry{path: path, subjects: map[string][]registeredSchema{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.subjects); err != nil {
+		return nil, fmt.Errorf("failed to parse schema registry %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *FileRegistry) Register(subject string, schema *descriptorpb.DescriptorProto) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	encoded, err := protojson.MarshalOptions{Multiline: true}.Marshal(schema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	fingerprint, err := schemaFingerprint(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := r.subjects[subject]
+	for _, v := range versions {
+		if v.Fingerprint == fingerprint {
+			return v.Version, nil
+		}
+	}
+	if len(versions) > 0 {
+		latest, err := decodeSchema(versions[len(versions)-1].Schema)
+		if err != nil {
+			return 0, err
+		}
+		if err := CheckCompatible(latest, schema); err != nil {
+			return 0, fmt.Errorf("%s: %w", subject, err)
+		}
+	}
+
+	version := len(versions) + 1
+	r.subjects[subject] = append(versions, registeredSchema{
+		Version:     version,
+		Fingerprint: fingerprint,
+		Schema:      encoded,
+	})
+	if err := r.save(); err != nil {
+		r.subjects[subject] = versions
+		return 0, err
+	}
+	return version, nil
+}
+
+func (r *FileRegistry) Lookup(subject string, version int) (*descriptorpb.DescriptorProto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.subjects[subject] {
+		if v.Version == version {
+			return decodeSchema(v.Schema)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s version %d", ErrSchemaNotFound, subject, version)
+}
+
+func (r *FileRegistry) VersionOf(subject string, schema *descriptorpb.DescriptorProto) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fingerprint, err := schemaFingerprint(schema)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range r.subjects[subject] {
+		if v.Fingerprint == fingerprint {
+			return v.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: current %s is not registered", ErrSchemaNotFound, subject)
+}
+
+func (r *FileRegistry) save() error {
+	data, err := json.MarshalIndent(r.subjects, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema registry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create schema registry directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write schema registry: %w", err)
+	}
+	return nil
+}
+
+// DescriptorOf returns the schema of a message type. It includes the map
+// entries and message types declared inside it, but other message types
+// its fields refer to are only named; see SchemasOf.
+func DescriptorOf(msg proto.Message) *descriptorpb.DescriptorProto {
+	return protodesc.ToDescriptorProto(msg.ProtoReflect().Descriptor())
+}
+
+// Schema is the schema of one message type under its registry subject.
+type Schema struct {
+	Subject string
+	Schema  *descriptorpb.DescriptorProto
+}
+
+// SchemasOf returns the schema of every message type msg depends on,
+// directly or through other messages, followed by msg's own. A message's
+// schema only names the types of its message fields, so each is registered
+// and checked for compatibility under a subject of its own.
+func SchemasOf(msg proto.Message) []Schema {
+	var schemas []Schema
+	seen := map[protoreflect.FullName]bool{}
+	var walk func(md protoreflect.MessageDescriptor)
+	walk = func(md protoreflect.MessageDescriptor) {
+		if seen[md.FullName()] {
+			return
+		}
+		seen[md.FullName()] = true
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if dep := fields.Get(i).Message(); dep != nil {
+				walk(dep)
+			}
+		}
+		// Map entries are part of the schema of the message declaring them.
+		if !md.IsMapEntry() {
+			schemas = append(schemas, Schema{Subject: string(md.FullName()), Schema: protodesc.ToDescriptorProto(md)})
+		}
+	}
+	walk(msg.ProtoReflect().Descriptor())
+	return schemas
+}
+
+// RegisterSchemas registers the schemas of msg and every message type it
+// depends on with registry, and returns the version of msg's own.
+func RegisterSchemas(registry SchemaRegistry, msg proto.Message) (int, error) {
+	var version int
+	for _, s := range SchemasOf(msg) {
+		v, err := registry.Register(s.Subject, s.Schema)
+		if err != nil {
+			return 0, fmt.Errorf("failed to register schema %s: %w", s.Subject, err)
+		}
+		version = v
+	}
+	return version, nil
+}
+
+// SubjectOf returns the registry subject for a message type.
+func SubjectOf(msg proto.Message) string {
+	return string(msg.ProtoReflect().Descriptor().FullName())
+}
+
+func decodeSchema(raw json.RawMessage) (*descriptorpb.DescriptorProto, error) {
+	var schema descriptorpb.DescriptorProto
+	if err := protojson.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode registered schema: %w", err)
+	}
+	return &schema, nil
+}
+
+func schemaFingerprint(schema *descriptorpb.DescriptorProto) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(schema)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint schema: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CheckCompatible reports whether next can replace prev on the wire in both
+// directions. Field numbers still in use must keep their type and
+// cardinality, and removed field numbers must be reserved so they are never
+// reused with a different meaning. Message types declared inside both are
+// held to the same rules; message types declared elsewhere are checked
+// under their own subjects.
+func CheckCompatible(prev, next *descriptorpb.DescriptorProto) error {
+	if problems := compatibilityProblems(prev, next); len(problems) > 0 {
+		return fmt.Errorf("%w: %v", ErrIncompatibleSchema, errors.Join(problems...))
+	}
+	return nil
+}
+
+func compatibilityProblems(prev, next *descriptorpb.DescriptorProto) []error {
+	nextFields := make(map[int32]*descriptorpb.FieldDescriptorProto, len(next.GetField()))
+	for _, f := range next.GetField() {
+		nextFields[f.GetNumber()] = f
+	}
+
+	var problems []error
+	for _, old := range prev.GetField() {
+		cur, ok := nextFields[old.GetNumber()]
+		if !ok {
+			if !isReserved(next, old.GetNumber()) {
+				problems = append(problems, fmt.Errorf(
+					"field %d (%s) was removed without being reserved", old.GetNumber(), old.GetName()))
+			}
+			continue
+		}
+		if cur.GetType() != old.GetType() || cur.GetTypeName() != old.GetTypeName() {
+			problems = append(problems, fmt.Errorf(
+				"field %d changed type from %s to %s", old.GetNumber(), fieldType(old), fieldType(cur)))
+		}
+		if cur.GetLabel() != old.GetLabel() {
+			problems = append(problems, fmt.Errorf(
+				"field %d changed cardinality from %s to %s", old.GetNumber(), old.GetLabel(), cur.GetLabel()))
+		}
+	}
+	for _, f := range next.GetField() {
+		if isReserved(prev, f.GetNumber()) {
+			problems = append(problems, fmt.Errorf("field %d (%s) reuses a reserved number", f.GetNumber(), f.GetName()))
+		}
+	}
+	for _, old := range prev.GetNestedType() {
+		for _, cur := range next.GetNestedType() {
+			if cur.GetName() != old.GetName() {
+				continue
+			}
+			for _, err := range compatibilityProblems(old, cur) {
+				problems = append(problems, fmt.Errorf("%s: %w", old.GetName(), err))
+			}
+		}
+	}
+	return problems
+}
+
+func isReserved(msg *descriptorpb.DescriptorProto, number int32) bool {
+	for _, r := range msg.GetReservedRange() {
+		// Reserved range ends are exclusive.
+		if number >= r.GetStart() && number < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetTypeName() != "" {
+		return f.GetTypeName()
+	}
+	return protoreflect.Kind(f.GetType()).String()
+}
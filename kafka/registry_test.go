@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// committedRegistry is the registry checked into the repository.
+const committedRegistry = "schemas/registry.json"
+
+// TestSchemasAreRegistered fails when a message schema changes without its
+// new version being recorded with `ledger schemas register`, which is where
+// compatibility with earlier versions is enforced.
+func TestSchemasAreRegistered(t *testing.T) {
+	registry, err := NewFileRegistry(committedRegistry)
+	require.NoError(t, err)
+
+	for _, m := range Schemas {
+		for _, s := range SchemasOf(m.ToProto()) {
+			_, err := registry.VersionOf(s.Subject, s.Schema)
+			assert.NoError(t, err, "run `go run . schemas register` after changing %s", s.Subject)
+		}
+	}
+}
+
+// TestSchemasReadEveryRegisteredVersion checks the current schemas can
+// still decode messages written with any earlier registered version.
+func TestSchemasReadEveryRegisteredVersion(t *testing.T) {
+	registry, err := NewFileRegistry(committedRegistry)
+	require.NoError(t, err)
+
+	for _, m := range Schemas {
+		for _, s := range SchemasOf(m.ToProto()) {
+			for version := 1; ; version++ {
+				old, err := registry.Lookup(s.Subject, version)
+				if err != nil {
+					assert.ErrorIs(t, err, ErrSchemaNotFound)
+					break
+				}
+				assert.NoError(t, CheckCompatible(old, s.Schema), "%s version %d", s.Subject, version)
+			}
+		}
+	}
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func message(fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String("Msg"), Field: fields}
+}
+
+func TestCheckCompatible(t *testing.T) {
+	base := message(
+		field("user_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE),
+	)
+
+	added := message(append(base.Field, field("note", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING))...)
+	assert.NoError(t, CheckCompatible(base, added))
+
+	retyped := message(base.Field[0], field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	assert.ErrorIs(t, CheckCompatible(base, retyped), ErrIncompatibleSchema)
+
+	removed := message(base.Field[0])
+	assert.ErrorIs(t, CheckCompatible(base, removed), ErrIncompatibleSchema)
+
+	reserved := message(base.Field[0])
+	reserved.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{{Start: proto.Int32(2), End: proto.Int32(3)}}
+	assert.NoError(t, CheckCompatible(base, reserved))
+
+	reused := message(base.Field[0], field("fee", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE))
+	assert.ErrorIs(t, CheckCompatible(reserved, reused), ErrIncompatibleSchema)
+
+	entry := message(field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	entry.Name = proto.String("LabelsEntry")
+	withMap := message(base.Field...)
+	withMap.NestedType = []*descriptorpb.DescriptorProto{entry}
+	retypedEntry := message(field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64))
+	retypedEntry.Name = proto.String("LabelsEntry")
+	retypedMap := message(base.Field...)
+	retypedMap.NestedType = []*descriptorpb.DescriptorProto{retypedEntry}
+	assert.ErrorIs(t, CheckCompatible(withMap, retypedMap), ErrIncompatibleSchema)
+}
+
+func TestFileRegistryVersionsAndRejectsIncompatible(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := NewFileRegistry(path)
+	require.NoError(t, err)
+
+	v1 := message(field("amount", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE))
+	version, err := registry.Register("test.Msg", v1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	version, err = registry.Register("test.Msg", v1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version, "re-registering is idempotent")
+
+	v2 := message(v1.Field[0], field("note", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	version, err = registry.Register("test.Msg", v2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	bad := message(field("amount", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	_, err = registry.Register("test.Msg", bad)
+	assert.ErrorIs(t, err, ErrIncompatibleSchema)
+
+	reloaded, err := NewFileRegistry(path)
+	require.NoError(t, err)
+	got, err := reloaded.Lookup("test.Msg", 2)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(v2, got))
+}
+
+// batchSchema builds a Batch message with a repeated Item field, whose
+// amount field has the given type.
+func batchSchema(t *testing.T, amount descriptorpb.FieldDescriptorProto_Type) proto.Message {
+	t.Helper()
+	items := field("items", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	items.TypeName = proto.String(".test.Item")
+	items.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/batch.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Batch"), Field: []*descriptorpb.FieldDescriptorProto{items}},
+			{Name: proto.String("Item"), Field: []*descriptorpb.FieldDescriptorProto{field("amount", 1, amount)}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	return dynamicpb.NewMessage(file.Messages().ByName("Batch"))
+}
+
+func TestRegisterSchemasChecksNestedMessages(t *testing.T) {
+	registry, err := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	require.NoError(t, err)
+
+	v1 := batchSchema(t, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE)
+	subjects := []string{}
+	for _, s := range SchemasOf(v1) {
+		subjects = append(subjects, s.Subject)
+	}
+	assert.Equal(t, []string{"test.Item", "test.Batch"}, subjects)
+
+	version, err := RegisterSchemas(registry, v1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	// Batch's own schema is unchanged, but its items no longer decode.
+	retyped := batchSchema(t, descriptorpb.FieldDescriptorProto_TYPE_STRING)
+	_, err = RegisterSchemas(registry, retyped)
+	assert.ErrorIs(t, err, ErrIncompatibleSchema)
+	assert.ErrorContains(t, err, "test.Item")
+}
@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"google.golang.org/protobuf/proto"
+)
+
+// Headers stamped on every produced message so consumers can decode it
+// without guessing.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaSubject = "schema-subject"
+	HeaderSchemaVersion = "schema-version"
+
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+const (
+	SerializerJSON     = "json"
+	SerializerProtobuf = "protobuf"
+)
+
+// Message is implemented by every Kafka message type. ToProto converts the
+// message to its versioned protobuf schema; called on a zero value it yields
+// an empty instance of that schema.
+type Message interface {
+	ToProto() proto.Message
+}
+
+// DecodableMessage is implemented by pointers to Kafka message types.
+type DecodableMessage interface {
+	Message
+	FromProto(proto.Message)
+}
+
+// Serializer converts messages to and from their wire format.
+type Serializer interface {
+	Serialize(msg Message) ([]byte, []kafka.Header, error)
+	Deserialize(msg *kafka.Message, v DecodableMessage) error
+}
+
+// MessageSerializer is used by the producer and consumer. InitKafka replaces
+// it according to configuration.
+var MessageSerializer Serializer = JSONSerializer{}
+
+// Decode decodes a consumed message into v with MessageSerializer.
+func Decode(msg *kafka.Message, v DecodableMessage) error {
+	return MessageSerializer.Deserialize(msg, v)
+}
+
+// JSONSerializer writes the legacy unversioned JSON encoding.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(msg Message) ([]byte, []kafka.Header, error) {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, []kafka.Header{{Key: HeaderContentType, Value: []byte(ContentTypeJSON)}}, nil
+}
+
+func (JSONSerializer) Deserialize(msg *kafka.Message, v DecodableMessage) error {
+	if contentType := headerValue(msg, HeaderContentType); contentType != "" && contentType != ContentTypeJSON {
+		return fmt.Errorf("json serializer cannot decode %s", contentType)
+	}
+	return json.Unmarshal(msg.Value, v)
+}
+
+// ProtobufSerializer writes protobuf payloads tagged with their registry
+// subject and version. It still reads JSON messages without a protobuf
+// content type so topics can be migrated without draining them first.
+type ProtobufSerializer struct {
+	registry SchemaRegistry
+
+	mu       sync.Mutex
+	versions map[string]int
+	readable map[string]bool
+}
+
+// NewProtobufSerializer looks up the registered version of every message in
+// schemas and of the message types they depend on. It fails if any is not
+// registered, or if a later registered version could not be read with it.
+// It never registers anything: schemas are registered with `ledger schemas
+// register`, which enforces compatibility, and committed with the code.
+func NewProtobufSerializer(registry SchemaRegistry, schemas []Message) (*ProtobufSerializer, error) {
+	s := &ProtobufSerializer{
+		registry: registry,
+		versions: map[string]int{},
+		readable: map[string]bool{},
+	}
+	for _, m := range schemas {
+		for _, schema := range SchemasOf(m.ToProto()) {
+			version, err := registry.VersionOf(schema.Subject, schema.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("%w (run `ledger schemas register`)", err)
+			}
+			if err := checkLaterVersions(registry, schema, version); err != nil {
+				return nil, err
+			}
+			s.versions[schema.Subject] = version
+			s.readable[schemaKey(schema.Subject, version)] = true
+		}
+	}
+	return s, nil
+}
+
+// checkLaterVersions checks that messages written with any version of
+// schema's subject registered after version can be read with schema.
+func checkLaterVersions(registry SchemaRegistry, schema Schema, version int) error {
+	for v := version + 1; ; v++ {
+		later, err := registry.Lookup(schema.Subject, v)
+		if errors.Is(err, ErrSchemaNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := CheckCompatible(later, schema.Schema); err != nil {
+			return fmt.Errorf("%s version %d: %w", schema.Subject, v, err)
+		}
+	}
+}
+
+func (s *ProtobufSerializer) Serialize(msg Message) ([]byte, []kafka.Header, error) {
+	p := msg.ToProto()
+	subject := SubjectOf(p)
+
+	s.mu.Lock()
+	version, ok := s.versions[subject]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s was not registered", ErrSchemaNotFound, subject)
+	}
+
+	value, err := proto.Marshal(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, []kafka.Header{
+		{Key: HeaderContentType, Value: []byte(ContentTypeProtobuf)},
+		{Key: HeaderSchemaSubject, Value: []byte(subject)},
+		{Key: HeaderSchemaVersion, Value: []byte(strconv.Itoa(version))},
+	}, nil
+}
+
+func (s *ProtobufSerializer) Deserialize(msg *kafka.Message, v DecodableMessage) error {
+	if headerValue(msg, HeaderContentType) != ContentTypeProtobuf {
+		return JSONSerializer{}.Deserialize(msg, v)
+	}
+
+	p := v.ToProto()
+	subject := SubjectOf(p)
+	if got := headerValue(msg, HeaderSchemaSubject); got != subject {
+		return fmt.Errorf("message has schema %q, expected %q", got, subject)
+	}
+	version, err := strconv.Atoi(headerValue(msg, HeaderSchemaVersion))
+	if err != nil {
+		return fmt.Errorf("message has invalid %s header: %w", HeaderSchemaVersion, err)
+	}
+	if err := s.checkReadable(p, subject, version); err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(msg.Value, p); err != nil {
+		return err
+	}
+	v.FromProto(p)
+	return nil
+}
+
+// checkReadable confirms the writer's schema version is registered and
+// compatible with the schema this binary reads with.
+func (s *ProtobufSerializer) checkReadable(p proto.Message, subject string, version int) error {
+	key := schemaKey(subject, version)
+	s.mu.Lock()
+	ok := s.readable[key]
+	s.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	writer, err := s.registry.Lookup(subject, version)
+	if err != nil {
+		return err
+	}
+	if err := CheckCompatible(writer, DescriptorOf(p)); err != nil {
+		return fmt.Errorf("%s version %d: %w", subject, version, err)
+	}
+
+	s.mu.Lock()
+	s.readable[key] = true
+	s.mu.Unlock()
+	return nil
+}
+
+func schemaKey(subject string, version int) string {
+	return subject + "@" + strconv.Itoa(version)
+}
+
+func headerValue(msg *kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func newTestProtobufSerializer(t *testing.T) *ProtobufSerializer {
+	registry, err := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	require.NoError(t, err)
+	for _, m := range Schemas {
+		_, err := RegisterSchemas(registry, m.ToProto())
+		require.NoError(t, err)
+	}
+	s, err := NewProtobufSerializer(registry, Schemas)
+	require.NoError(t, err)
+	return s
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	s := newTestProtobufSerializer(t)
+	sent := AddBalanceMessage{
+		BaseMessage: BaseMessage{UserID: "user-1", Timestamp: time.Date(2025, 5, 17, 13, 0, 0, 0, time.UTC)},
+		Amount:      12.5,
+	}
+
+	value, headers, err := s.Serialize(sent)
+	require.NoError(t, err)
+
+	msg := &kafka.Message{Value: value, Headers: headers}
+	assert.Equal(t, ContentTypeProtobuf, headerValue(msg, HeaderContentType))
+	assert.Equal(t, "ledger.v1.AddBalanceCommand", headerValue(msg, HeaderSchemaSubject))
+	assert.Equal(t, "1", headerValue(msg, HeaderSchemaVersion))
+
+	var received AddBalanceMessage
+	require.NoError(t, s.Deserialize(msg, &received))
+	assert.Equal(t, sent, received)
+}
+
+func TestProtobufSerializerReadsLegacyJSON(t *testing.T) {
+	s := newTestProtobufSerializer(t)
+	msg := &kafka.Message{Value: []byte(`{"user_id":"user-2","amount":3}`)}
+
+	var received DeductBalanceMessage
+	require.NoError(t, s.Deserialize(msg, &received))
+	assert.Equal(t, "user-2", received.UserID)
+	assert.Equal(t, 3.0, received.Amount)
+}
+
+func TestProtobufSerializerRejectsWrongSubjectAndUnknownVersion(t *testing.T) {
+	s := newTestProtobufSerializer(t)
+	value, headers, err := s.Serialize(AddBalanceMessage{Amount: 1})
+	require.NoError(t, err)
+
+	var wrongType DeductBalanceMessage
+	assert.Error(t, s.Deserialize(&kafka.Message{Value: value, Headers: headers}, &wrongType))
+
+	headers[2].Value = []byte("99")
+	var received AddBalanceMessage
+	assert.ErrorIs(t, s.Deserialize(&kafka.Message{Value: value, Headers: headers}, &received), ErrSchemaNotFound)
+}
+
+func TestNewProtobufSerializerRefusesUnregisteredSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := NewFileRegistry(path)
+	require.NoError(t, err)
+
+	_, err = NewProtobufSerializer(registry, Schemas)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+	assert.NoFileExists(t, path, "startup must not register schemas")
+}
+
+func TestNewProtobufSerializerRefusesUnreadableLaterVersion(t *testing.T) {
+	registry, err := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	require.NoError(t, err)
+	_, err = RegisterSchemas(registry, AddBalanceMessage{}.ToProto())
+	require.NoError(t, err)
+
+	// A later version, registered by hand, that retypes a field.
+	subject := SubjectOf(AddBalanceMessage{}.ToProto())
+	later := DescriptorOf(AddBalanceMessage{}.ToProto())
+	later.Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	registry.subjects[subject] = append(registry.subjects[subject], registeredSchema{Version: 2, Schema: mustEncode(t, later)})
+
+	_, err = NewProtobufSerializer(registry, []Message{AddBalanceMessage{}})
+	assert.ErrorIs(t, err, ErrIncompatibleSchema)
+}
+
+func mustEncode(t *testing.T, schema *descriptorpb.DescriptorProto) json.RawMessage {
+	t.Helper()
+	data, err := protojson.Marshal(schema)
+	require.NoError(t, err)
+	return data
+}
@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"ledger/config"
 	"log"
 	"time"
 
@@ -11,16 +12,27 @@ import (
 var (
 	Producer *kafka.Producer
 	Consumer *kafka.Consumer
+
+	// unifiedCommandTopic routes every command through TopicLedgerCommands.
+	unifiedCommandTopic bool
 )
 
 // InitKafka sets up the Kafka producer and consumer
-func InitKafka(broker, groupID string) error {
+func InitKafka(cfg config.KafkaConfig) error {
 	var err error
 
+	MessageSerializer, err = NewSerializer(cfg)
+	if err != nil {
+		return err
+	}
+	unifiedCommandTopic = cfg.UnifiedCommandTopic
+
 	// Initialize Producer
 	Producer, err = kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": broker,
+		"bootstrap.servers": cfg.Broker,
 		"client.id":         "ledger-producer",
+		// Retries never duplicate or reorder messages within a partition.
+		"enable.idempotence": true,
 	})
 	if err != nil {
 		return err
@@ -28,9 +40,12 @@ func InitKafka(broker, groupID string) error {
 
 	// Initialize Consumer
 	Consumer, err = kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": broker,
-		"group.id":          groupID,
+		"bootstrap.servers": cfg.Broker,
+		"group.id":          cfg.ClusterID,
 		"auto.offset.reset": "earliest",
+		// Offsets are stored explicitly via MarkProcessed once a message is
+		// handled, so a shutdown never commits past in-flight work.
+		"enable.auto.offset.store": false,
 	})
 	if err != nil {
 		Producer.Close()
@@ -40,6 +55,18 @@ func InitKafka(broker, groupID string) error {
 	return nil
 }
 
+// NewSerializer builds the serializer selected by cfg.Serializer.
+func NewSerializer(cfg config.KafkaConfig) (Serializer, error) {
+	if cfg.Serializer == SerializerJSON {
+		return JSONSerializer{}, nil
+	}
+	registry, err := NewFileRegistry(cfg.SchemaRegistryPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewProtobufSerializer(registry, Schemas)
+}
+
 // CloseKafka closes both the producer and consumer connections
 func CloseKafka() {
 	if Producer != nil {
@@ -50,8 +77,19 @@ func CloseKafka() {
 	}
 }
 
-func CreateTopics(broker string) error {
-	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": broker})
+// FlushProducer waits for outstanding deliveries until ctx expires and
+// returns the number of messages still queued.
+func FlushProducer(ctx context.Context) int {
+	if Producer == nil {
+		return 0
+	}
+	return Producer.Flush(timeoutMs(ctx))
+}
+
+// CreateTopics creates every topic in Topics. TopicLedgerCommands gets
+// cfg.CommandTopicPartitions partitions; the per-operation topics keep one.
+func CreateTopics(cfg config.KafkaConfig) error {
+	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": cfg.Broker})
 	if err != nil {
 		return err
 	}
@@ -60,9 +98,13 @@ func CreateTopics(broker string) error {
 	// Prepare topic specifications
 	var topicSpecs []kafka.TopicSpecification
 	for _, topic := range Topics {
+		partitions := 1
+		if topic == TopicLedgerCommands {
+			partitions = cfg.CommandTopicPartitions
+		}
 		topicSpecs = append(topicSpecs, kafka.TopicSpecification{
 			Topic:             topic,
-			NumPartitions:     1,
+			NumPartitions:     partitions,
 			ReplicationFactor: 1,
 		})
 	}
@@ -0,0 +1,729 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: ledger/v1/commands.proto
+
+package ledgerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CreateAccountCommand struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// user_id is the account ID: the owner's user ID for accounts opened
+	// through POST /balance, otherwise a generated ID.
+	UserId         string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Timestamp      *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	InitialBalance float64                `protobuf:"fixed64,3,opt,name=initial_balance,json=initialBalance,proto3" json:"initial_balance,omitempty"`
+	// owner_id is the user holding the account; empty means user_id.
+	OwnerId string `protobuf:"bytes,4,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`
+	Name    string `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	// type is wallet, savings or escrow; empty means wallet.
+	Type          string            `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	Labels        map[string]string `protobuf:"bytes,7,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateAccountCommand) Reset() {
+	*x = CreateAccountCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateAccountCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateAccountCommand) ProtoMessage() {}
+
+func (x *CreateAccountCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateAccountCommand.ProtoReflect.Descriptor instead.
+func (*CreateAccountCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CreateAccountCommand) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *CreateAccountCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CreateAccountCommand) GetInitialBalance() float64 {
+	if x != nil {
+		return x.InitialBalance
+	}
+	return 0
+}
+
+func (x *CreateAccountCommand) GetOwnerId() string {
+	if x != nil {
+		return x.OwnerId
+	}
+	return ""
+}
+
+func (x *CreateAccountCommand) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateAccountCommand) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *CreateAccountCommand) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type AddBalanceCommand struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UserId    string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Amount    float64                `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	// expected_version, when set, rejects the command unless the account is
+	// still at this version.
+	ExpectedVersion int64 `protobuf:"varint,4,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *AddBalanceCommand) Reset() {
+	*x = AddBalanceCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddBalanceCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddBalanceCommand) ProtoMessage() {}
+
+func (x *AddBalanceCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddBalanceCommand.ProtoReflect.Descriptor instead.
+func (*AddBalanceCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AddBalanceCommand) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AddBalanceCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *AddBalanceCommand) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *AddBalanceCommand) GetExpectedVersion() int64 {
+	if x != nil {
+		return x.ExpectedVersion
+	}
+	return 0
+}
+
+type DeductBalanceCommand struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UserId    string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Amount    float64                `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	// expected_version, when set, rejects the command unless the account is
+	// still at this version.
+	ExpectedVersion int64 `protobuf:"varint,4,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *DeductBalanceCommand) Reset() {
+	*x = DeductBalanceCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeductBalanceCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeductBalanceCommand) ProtoMessage() {}
+
+func (x *DeductBalanceCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeductBalanceCommand.ProtoReflect.Descriptor instead.
+func (*DeductBalanceCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DeductBalanceCommand) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *DeductBalanceCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *DeductBalanceCommand) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *DeductBalanceCommand) GetExpectedVersion() int64 {
+	if x != nil {
+		return x.ExpectedVersion
+	}
+	return 0
+}
+
+// ApplyBatchCommand applies every item in one database transaction: all of
+// them take effect or none do.
+type ApplyBatchCommand struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BatchId       string                 `protobuf:"bytes,1,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Items         []*BatchItem           `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApplyBatchCommand) Reset() {
+	*x = ApplyBatchCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApplyBatchCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApplyBatchCommand) ProtoMessage() {}
+
+func (x *ApplyBatchCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApplyBatchCommand.ProtoReflect.Descriptor instead.
+func (*ApplyBatchCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ApplyBatchCommand) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *ApplyBatchCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ApplyBatchCommand) GetItems() []*BatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type BatchItem struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// event_id identifies the item's ledger record and result.
+	EventId string `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	// operation is CreateAccount, AddBalance or DeductBalance.
+	Operation     string  `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	UserId        string  `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Amount        float64 `protobuf:"fixed64,4,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchItem) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *BatchItem) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *BatchItem) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *BatchItem) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+// ChangeAccountStatusCommand freezes, unfreezes or closes an account.
+type ChangeAccountStatusCommand struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UserId    string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// action is freeze, unfreeze or close.
+	Action        string `protobuf:"bytes,3,opt,name=action,proto3" json:"action,omitempty"`
+	Reason        string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChangeAccountStatusCommand) Reset() {
+	*x = ChangeAccountStatusCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeAccountStatusCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeAccountStatusCommand) ProtoMessage() {}
+
+func (x *ChangeAccountStatusCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeAccountStatusCommand.ProtoReflect.Descriptor instead.
+func (*ChangeAccountStatusCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ChangeAccountStatusCommand) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ChangeAccountStatusCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ChangeAccountStatusCommand) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *ChangeAccountStatusCommand) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// PostJournalEntryCommand posts a journal entry whose legs balance per
+// currency. Every leg is applied in one database transaction.
+type PostJournalEntryCommand struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// entry_id is the TransactionID shared by the entry's ledger records.
+	EntryId     string                 `protobuf:"bytes,1,opt,name=entry_id,json=entryId,proto3" json:"entry_id,omitempty"`
+	Timestamp   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Description string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Legs        []*JournalLeg          `protobuf:"bytes,4,rep,name=legs,proto3" json:"legs,omitempty"`
+	// reverses is the entry_id of the entry this one compensates, if any.
+	Reverses      string `protobuf:"bytes,5,opt,name=reverses,proto3" json:"reverses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PostJournalEntryCommand) Reset() {
+	*x = PostJournalEntryCommand{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PostJournalEntryCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PostJournalEntryCommand) ProtoMessage() {}
+
+func (x *PostJournalEntryCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PostJournalEntryCommand.ProtoReflect.Descriptor instead.
+func (*PostJournalEntryCommand) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PostJournalEntryCommand) GetEntryId() string {
+	if x != nil {
+		return x.EntryId
+	}
+	return ""
+}
+
+func (x *PostJournalEntryCommand) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *PostJournalEntryCommand) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *PostJournalEntryCommand) GetLegs() []*JournalLeg {
+	if x != nil {
+		return x.Legs
+	}
+	return nil
+}
+
+func (x *PostJournalEntryCommand) GetReverses() string {
+	if x != nil {
+		return x.Reverses
+	}
+	return ""
+}
+
+type JournalLeg struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// direction is debit or credit.
+	Direction     string  `protobuf:"bytes,2,opt,name=direction,proto3" json:"direction,omitempty"`
+	Amount        float64 `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	Currency      string  `protobuf:"bytes,4,opt,name=currency,proto3" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JournalLeg) Reset() {
+	*x = JournalLeg{}
+	mi := &file_ledger_v1_commands_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JournalLeg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalLeg) ProtoMessage() {}
+
+func (x *JournalLeg) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_commands_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalLeg.ProtoReflect.Descriptor instead.
+func (*JournalLeg) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_commands_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *JournalLeg) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *JournalLeg) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *JournalLeg) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *JournalLeg) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+var File_ledger_v1_commands_proto protoreflect.FileDescriptor
+
+const file_ledger_v1_commands_proto_rawDesc = "" +
+	"\n" +
+	"\x18ledger/v1/commands.proto\x12\tledger.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd5\x02\n" +
+	"\x14CreateAccountCommand\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12'\n" +
+	"\x0finitial_balance\x18\x03 \x01(\x01R\x0einitialBalance\x12\x19\n" +
+	"\bowner_id\x18\x04 \x01(\tR\aownerId\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x06 \x01(\tR\x04type\x12C\n" +
+	"\x06labels\x18\a \x03(\v2+.ledger.v1.CreateAccountCommand.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa9\x01\n" +
+	"\x11AddBalanceCommand\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x01R\x06amount\x12)\n" +
+	"\x10expected_version\x18\x04 \x01(\x03R\x0fexpectedVersion\"\xac\x01\n" +
+	"\x14DeductBalanceCommand\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x01R\x06amount\x12)\n" +
+	"\x10expected_version\x18\x04 \x01(\x03R\x0fexpectedVersion\"\x94\x01\n" +
+	"\x11ApplyBatchCommand\x12\x19\n" +
+	"\bbatch_id\x18\x01 \x01(\tR\abatchId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12*\n" +
+	"\x05items\x18\x03 \x03(\v2\x14.ledger.v1.BatchItemR\x05items\"u\n" +
+	"\tBatchItem\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\x01R\x06amount\"\x9f\x01\n" +
+	"\x1aChangeAccountStatusCommand\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x16\n" +
+	"\x06action\x18\x03 \x01(\tR\x06action\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"\xd7\x01\n" +
+	"\x17PostJournalEntryCommand\x12\x19\n" +
+	"\bentry_id\x18\x01 \x01(\tR\aentryId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12 \n" +
+	"\vdescription\x18\x03 \x01(\tR\vdescription\x12)\n" +
+	"\x04legs\x18\x04 \x03(\v2\x15.ledger.v1.JournalLegR\x04legs\x12\x1a\n" +
+	"\breverses\x18\x05 \x01(\tR\breverses\"w\n" +
+	"\n" +
+	"JournalLeg\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1c\n" +
+	"\tdirection\x18\x02 \x01(\tR\tdirection\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x01R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x04 \x01(\tR\bcurrencyB\x11Z\x0fledger/ledgerpbb\x06proto3"
+
+var (
+	file_ledger_v1_commands_proto_rawDescOnce sync.Once
+	file_ledger_v1_commands_proto_rawDescData []byte
+)
+
+func file_ledger_v1_commands_proto_rawDescGZIP() []byte {
+	file_ledger_v1_commands_proto_rawDescOnce.Do(func() {
+		file_ledger_v1_commands_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ledger_v1_commands_proto_rawDesc), len(file_ledger_v1_commands_proto_rawDesc)))
+	})
+	return file_ledger_v1_commands_proto_rawDescData
+}
+
+var file_ledger_v1_commands_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_ledger_v1_commands_proto_goTypes = []any{
+	(*CreateAccountCommand)(nil),       // 0: ledger.v1.CreateAccountCommand
+	(*AddBalanceCommand)(nil),          // 1: ledger.v1.AddBalanceCommand
+	(*DeductBalanceCommand)(nil),       // 2: ledger.v1.DeductBalanceCommand
+	(*ApplyBatchCommand)(nil),          // 3: ledger.v1.ApplyBatchCommand
+	(*BatchItem)(nil),                  // 4: ledger.v1.BatchItem
+	(*ChangeAccountStatusCommand)(nil), // 5: ledger.v1.ChangeAccountStatusCommand
+	(*PostJournalEntryCommand)(nil),    // 6: ledger.v1.PostJournalEntryCommand
+	(*JournalLeg)(nil),                 // 7: ledger.v1.JournalLeg
+	nil,                                // 8: ledger.v1.CreateAccountCommand.LabelsEntry
+	(*timestamppb.Timestamp)(nil),      // 9: google.protobuf.Timestamp
+}
+var file_ledger_v1_commands_proto_depIdxs = []int32{
+	9, // 0: ledger.v1.CreateAccountCommand.timestamp:type_name -> google.protobuf.Timestamp
+	8, // 1: ledger.v1.CreateAccountCommand.labels:type_name -> ledger.v1.CreateAccountCommand.LabelsEntry
+	9, // 2: ledger.v1.AddBalanceCommand.timestamp:type_name -> google.protobuf.Timestamp
+	9, // 3: ledger.v1.DeductBalanceCommand.timestamp:type_name -> google.protobuf.Timestamp
+	9, // 4: ledger.v1.ApplyBatchCommand.timestamp:type_name -> google.protobuf.Timestamp
+	4, // 5: ledger.v1.ApplyBatchCommand.items:type_name -> ledger.v1.BatchItem
+	9, // 6: ledger.v1.ChangeAccountStatusCommand.timestamp:type_name -> google.protobuf.Timestamp
+	9, // 7: ledger.v1.PostJournalEntryCommand.timestamp:type_name -> google.protobuf.Timestamp
+	7, // 8: ledger.v1.PostJournalEntryCommand.legs:type_name -> ledger.v1.JournalLeg
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_ledger_v1_commands_proto_init() }
+func file_ledger_v1_commands_proto_init() {
+	if File_ledger_v1_commands_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ledger_v1_commands_proto_rawDesc), len(file_ledger_v1_commands_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ledger_v1_commands_proto_goTypes,
+		DependencyIndexes: file_ledger_v1_commands_proto_depIdxs,
+		MessageInfos:      file_ledger_v1_commands_proto_msgTypes,
+	}.Build()
+	File_ledger_v1_commands_proto = out.File
+	file_ledger_v1_commands_proto_goTypes = nil
+	file_ledger_v1_commands_proto_depIdxs = nil
+}
@@ -0,0 +1,10 @@
+// Package ledgerpb holds the generated protobuf types for the Kafka command
+// and event schemas and the gRPC client/server stubs for LedgerService. Other
+// services use NewLedgerServiceClient to call the ledger over gRPC.
+//
+// Regenerate after editing any file under proto/ledger/v1:
+//
+//	go generate ./ledgerpb
+package ledgerpb
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=ledger --go-grpc_out=.. --go-grpc_opt=module=ledger ledger/v1/ledger.proto ledger/v1/commands.proto ledger/v1/events.proto
@@ -0,0 +1,605 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: ledger/v1/events.proto
+
+package ledgerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AccountCreated struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	UserId         string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	InitialBalance float64                `protobuf:"fixed64,2,opt,name=initial_balance,json=initialBalance,proto3" json:"initial_balance,omitempty"`
+	Balance        float64                `protobuf:"fixed64,3,opt,name=balance,proto3" json:"balance,omitempty"`
+	OwnerId        string                 `protobuf:"bytes,4,opt,name=owner_id,json=ownerId,proto3" json:"owner_id,omitempty"`
+	Type           string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AccountCreated) Reset() {
+	*x = AccountCreated{}
+	mi := &file_ledger_v1_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountCreated) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountCreated) ProtoMessage() {}
+
+func (x *AccountCreated) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountCreated.ProtoReflect.Descriptor instead.
+func (*AccountCreated) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AccountCreated) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AccountCreated) GetInitialBalance() float64 {
+	if x != nil {
+		return x.InitialBalance
+	}
+	return 0
+}
+
+func (x *AccountCreated) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *AccountCreated) GetOwnerId() string {
+	if x != nil {
+		return x.OwnerId
+	}
+	return ""
+}
+
+func (x *AccountCreated) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+type BalanceCredited struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Amount float64                `protobuf:"fixed64,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	// Balance after the credit was applied.
+	Balance       float64 `protobuf:"fixed64,3,opt,name=balance,proto3" json:"balance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BalanceCredited) Reset() {
+	*x = BalanceCredited{}
+	mi := &file_ledger_v1_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BalanceCredited) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BalanceCredited) ProtoMessage() {}
+
+func (x *BalanceCredited) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BalanceCredited.ProtoReflect.Descriptor instead.
+func (*BalanceCredited) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BalanceCredited) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *BalanceCredited) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *BalanceCredited) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+type BalanceDebited struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Amount float64                `protobuf:"fixed64,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	// Balance after the debit was applied.
+	Balance       float64 `protobuf:"fixed64,3,opt,name=balance,proto3" json:"balance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BalanceDebited) Reset() {
+	*x = BalanceDebited{}
+	mi := &file_ledger_v1_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BalanceDebited) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BalanceDebited) ProtoMessage() {}
+
+func (x *BalanceDebited) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BalanceDebited.ProtoReflect.Descriptor instead.
+func (*BalanceDebited) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BalanceDebited) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *BalanceDebited) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *BalanceDebited) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+type OperationRejected struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Event type of the rejected command, e.g. "DeductBalance".
+	Operation     string  `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	Amount        float64 `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	Reason        string  `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OperationRejected) Reset() {
+	*x = OperationRejected{}
+	mi := &file_ledger_v1_events_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OperationRejected) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OperationRejected) ProtoMessage() {}
+
+func (x *OperationRejected) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OperationRejected.ProtoReflect.Descriptor instead.
+func (*OperationRejected) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *OperationRejected) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *OperationRejected) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *OperationRejected) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *OperationRejected) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type AccountStatusChanged struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	UserId         string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	PreviousStatus string                 `protobuf:"bytes,2,opt,name=previous_status,json=previousStatus,proto3" json:"previous_status,omitempty"`
+	Status         string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Reason         string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *AccountStatusChanged) Reset() {
+	*x = AccountStatusChanged{}
+	mi := &file_ledger_v1_events_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccountStatusChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccountStatusChanged) ProtoMessage() {}
+
+func (x *AccountStatusChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccountStatusChanged.ProtoReflect.Descriptor instead.
+func (*AccountStatusChanged) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AccountStatusChanged) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AccountStatusChanged) GetPreviousStatus() string {
+	if x != nil {
+		return x.PreviousStatus
+	}
+	return ""
+}
+
+func (x *AccountStatusChanged) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *AccountStatusChanged) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// FeeCharged is published when a command is charged a fee, in the same
+// transaction as the command.
+type FeeCharged struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Event type of the charged command, e.g. "DeductBalance".
+	Operation string  `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	Fee       float64 `protobuf:"fixed64,3,opt,name=fee,proto3" json:"fee,omitempty"`
+	// Balance after the fee was taken.
+	Balance       float64 `protobuf:"fixed64,4,opt,name=balance,proto3" json:"balance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FeeCharged) Reset() {
+	*x = FeeCharged{}
+	mi := &file_ledger_v1_events_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FeeCharged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeeCharged) ProtoMessage() {}
+
+func (x *FeeCharged) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeeCharged.ProtoReflect.Descriptor instead.
+func (*FeeCharged) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FeeCharged) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *FeeCharged) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *FeeCharged) GetFee() float64 {
+	if x != nil {
+		return x.Fee
+	}
+	return 0
+}
+
+func (x *FeeCharged) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+// InterestCredited is published when accrued savings interest is posted to
+// an account.
+type InterestCredited struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Amount float64                `protobuf:"fixed64,2,opt,name=amount,proto3" json:"amount,omitempty"`
+	// Balance after the interest was credited.
+	Balance float64 `protobuf:"fixed64,3,opt,name=balance,proto3" json:"balance,omitempty"`
+	// First and last accrual dates covered, as YYYY-MM-DD.
+	AccruedFrom    string `protobuf:"bytes,4,opt,name=accrued_from,json=accruedFrom,proto3" json:"accrued_from,omitempty"`
+	AccruedThrough string `protobuf:"bytes,5,opt,name=accrued_through,json=accruedThrough,proto3" json:"accrued_through,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *InterestCredited) Reset() {
+	*x = InterestCredited{}
+	mi := &file_ledger_v1_events_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InterestCredited) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InterestCredited) ProtoMessage() {}
+
+func (x *InterestCredited) ProtoReflect() protoreflect.Message {
+	mi := &file_ledger_v1_events_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InterestCredited.ProtoReflect.Descriptor instead.
+func (*InterestCredited) Descriptor() ([]byte, []int) {
+	return file_ledger_v1_events_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InterestCredited) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *InterestCredited) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *InterestCredited) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *InterestCredited) GetAccruedFrom() string {
+	if x != nil {
+		return x.AccruedFrom
+	}
+	return ""
+}
+
+func (x *InterestCredited) GetAccruedThrough() string {
+	if x != nil {
+		return x.AccruedThrough
+	}
+	return ""
+}
+
+var File_ledger_v1_events_proto protoreflect.FileDescriptor
+
+const file_ledger_v1_events_proto_rawDesc = "" +
+	"\n" +
+	"\x16ledger/v1/events.proto\x12\tledger.v1\"\x9b\x01\n" +
+	"\x0eAccountCreated\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12'\n" +
+	"\x0finitial_balance\x18\x02 \x01(\x01R\x0einitialBalance\x12\x18\n" +
+	"\abalance\x18\x03 \x01(\x01R\abalance\x12\x19\n" +
+	"\bowner_id\x18\x04 \x01(\tR\aownerId\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\"\\\n" +
+	"\x0fBalanceCredited\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x01R\x06amount\x12\x18\n" +
+	"\abalance\x18\x03 \x01(\x01R\abalance\"[\n" +
+	"\x0eBalanceDebited\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x01R\x06amount\x12\x18\n" +
+	"\abalance\x18\x03 \x01(\x01R\abalance\"z\n" +
+	"\x11OperationRejected\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x01R\x06amount\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"\x88\x01\n" +
+	"\x14AccountStatusChanged\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12'\n" +
+	"\x0fprevious_status\x18\x02 \x01(\tR\x0epreviousStatus\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"o\n" +
+	"\n" +
+	"FeeCharged\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x12\x10\n" +
+	"\x03fee\x18\x03 \x01(\x01R\x03fee\x12\x18\n" +
+	"\abalance\x18\x04 \x01(\x01R\abalance\"\xa9\x01\n" +
+	"\x10InterestCredited\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06amount\x18\x02 \x01(\x01R\x06amount\x12\x18\n" +
+	"\abalance\x18\x03 \x01(\x01R\abalance\x12!\n" +
+	"\faccrued_from\x18\x04 \x01(\tR\vaccruedFrom\x12'\n" +
+	"\x0faccrued_through\x18\x05 \x01(\tR\x0eaccruedThroughB\x11Z\x0fledger/ledgerpbb\x06proto3"
+
+var (
+	file_ledger_v1_events_proto_rawDescOnce sync.Once
+	file_ledger_v1_events_proto_rawDescData []byte
+)
+
+func file_ledger_v1_events_proto_rawDescGZIP() []byte {
+	file_ledger_v1_events_proto_rawDescOnce.Do(func() {
+		file_ledger_v1_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ledger_v1_events_proto_rawDesc), len(file_ledger_v1_events_proto_rawDesc)))
+	})
+	return file_ledger_v1_events_proto_rawDescData
+}
+
+var file_ledger_v1_events_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_ledger_v1_events_proto_goTypes = []any{
+	(*AccountCreated)(nil),       // 0: ledger.v1.AccountCreated
+	(*BalanceCredited)(nil),      // 1: ledger.v1.BalanceCredited
+	(*BalanceDebited)(nil),       // 2: ledger.v1.BalanceDebited
+	(*OperationRejected)(nil),    // 3: ledger.v1.OperationRejected
+	(*AccountStatusChanged)(nil), // 4: ledger.v1.AccountStatusChanged
+	(*FeeCharged)(nil),           // 5: ledger.v1.FeeCharged
+	(*InterestCredited)(nil),     // 6: ledger.v1.InterestCredited
+}
+var file_ledger_v1_events_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_ledger_v1_events_proto_init() }
+func file_ledger_v1_events_proto_init() {
+	if File_ledger_v1_events_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ledger_v1_events_proto_rawDesc), len(file_ledger_v1_events_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ledger_v1_events_proto_goTypes,
+		DependencyIndexes: file_ledger_v1_events_proto_depIdxs,
+		MessageInfos:      file_ledger_v1_events_proto_msgTypes,
+	}.Build()
+	File_ledger_v1_events_proto = out.File
+	file_ledger_v1_events_proto_goTypes = nil
+	file_ledger_v1_events_proto_depIdxs = nil
+}
@@ -0,0 +1,166 @@
+// Package limits evaluates velocity limits: rules capping how many debits,
+// and how much in total, an account may make within a rolling window.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrExceeded is wrapped by the error of a debit that would break a limit.
+var ErrExceeded = errors.New("velocity limit exceeded")
+
+// Rule caps the debits of the accounts it covers within every rolling
+// Window: at most MaxCount debits and MaxAmount debited, where set. A rule
+// with AccountID covers that account only, one with AccountType every
+// account of that type, and one with neither every account.
+type Rule struct {
+	Name        string        `yaml:"name" json:"name"`
+	AccountID   string        `yaml:"account_id" json:"account_id,omitempty"`
+	AccountType string        `yaml:"account_type" json:"account_type,omitempty"`
+	Window      time.Duration `yaml:"window" json:"-"`
+	MaxCount    int           `yaml:"max_count" json:"max_count,omitempty"`
+	MaxAmount   float64       `yaml:"max_amount" json:"max_amount,omitempty"`
+}
+
+// Rules is the set of limit rules in force.
+type Rules []Rule
+
+// Usage is what an account has debited within a rule's window.
+type Usage struct {
+	Count  int
+	Amount float64
+}
+
+// Status is a rule with an account's usage against it.
+type Status struct {
+	Rule
+	WindowText      string   `json:"window"`
+	UsedCount       int      `json:"used_count"`
+	UsedAmount      float64  `json:"used_amount"`
+	RemainingCount  *int     `json:"remaining_count,omitempty"`
+	RemainingAmount *float64 `json:"remaining_amount,omitempty"`
+}
+
+// For returns the rules covering an account, one per name: a rule for the
+// account itself wins over one for its type, which wins over one for every
+// account. That way an account's own rule can raise or lower a general
+// limit of the same name.
+func (rs Rules) For(accountID, accountType string) []Rule {
+	best := map[string]int{}
+	var names []string
+	for i, r := range rs {
+		rank := r.rank(accountID, accountType)
+		if rank < 0 {
+			continue
+		}
+		j, seen := best[r.Name]
+		if !seen {
+			names = append(names, r.Name)
+		}
+		if !seen || rank > rs[j].rank(accountID, accountType) {
+			best[r.Name] = i
+		}
+	}
+	rules := make([]Rule, 0, len(names))
+	for _, name := range names {
+		rules = append(rules, rs[best[name]])
+	}
+	return rules
+}
+
+// rank orders the rules covering an account by specificity, or is -1 for
+// a rule that does not cover it.
+func (r Rule) rank(accountID, accountType string) int {
+	switch {
+	case r.AccountID != "":
+		if r.AccountID == accountID {
+			return 2
+		}
+	case r.AccountType != "":
+		if r.AccountType == accountType {
+			return 1
+		}
+	default:
+		return 0
+	}
+	return -1
+}
+
+// MaxWindow returns the longest window of any rule, which is how long
+// debit counters must be kept.
+func (rs Rules) MaxWindow() time.Duration {
+	var longest time.Duration
+	for _, r := range rs {
+		longest = max(longest, r.Window)
+	}
+	return longest
+}
+
+// Check returns an error wrapping ErrExceeded if a debit of amount on top
+// of used would break the rule.
+func (r Rule) Check(used Usage, amount float64) error {
+	if r.MaxCount > 0 && used.Count+1 > r.MaxCount {
+		return fmt.Errorf("%w: %s allows %d debit(s) per %s, %d already made", ErrExceeded, r.Name, r.MaxCount, r.Window, used.Count)
+	}
+	// Compared in cents so float drift cannot break the limit.
+	if r.MaxAmount > 0 && cents(used.Amount+amount) > cents(r.MaxAmount) {
+		return fmt.Errorf("%w: %s allows %.2f debited per %s, %.2f already debited", ErrExceeded, r.Name, r.MaxAmount, r.Window, used.Amount)
+	}
+	return nil
+}
+
+// Status reports used against the rule.
+func (r Rule) Status(used Usage) Status {
+	s := Status{Rule: r, WindowText: r.Window.String(), UsedCount: used.Count, UsedAmount: used.Amount}
+	if r.MaxCount > 0 {
+		remaining := max(r.MaxCount-used.Count, 0)
+		s.RemainingCount = &remaining
+	}
+	if r.MaxAmount > 0 {
+		remaining := math.Max(float64(cents(r.MaxAmount)-cents(used.Amount))/100, 0)
+		s.RemainingAmount = &remaining
+	}
+	return s
+}
+
+// Validate reports every problem in the rules at once.
+func (rs Rules) Validate() error {
+	var problems []string
+	seen := map[string]bool{}
+	for i, r := range rs {
+		name := fmt.Sprintf("limits[%d]", i)
+		if strings.TrimSpace(r.Name) == "" {
+			problems = append(problems, name+": name is required")
+		}
+		if r.AccountID != "" && r.AccountType != "" {
+			problems = append(problems, name+": account_id and account_type are exclusive")
+		}
+		key := r.Name + "/" + r.AccountID + "/" + r.AccountType
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate rule %s", name, r.Name))
+		}
+		seen[key] = true
+
+		if r.Window <= 0 {
+			problems = append(problems, name+": window must be positive")
+		}
+		if r.MaxCount < 0 || r.MaxAmount < 0 {
+			problems = append(problems, name+": limits must not be negative")
+		}
+		if r.MaxCount == 0 && r.MaxAmount == 0 {
+			problems = append(problems, name+": max_count or max_amount is required")
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
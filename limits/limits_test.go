@@ -0,0 +1,73 @@
+package limits
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const day = 24 * time.Hour
+
+func TestRulesFor(t *testing.T) {
+	rules := Rules{
+		{Name: "daily_withdrawals", Window: day, MaxCount: 5},
+		{Name: "daily_amount", Window: day, MaxAmount: 10000},
+		{Name: "daily_amount", AccountType: "savings", Window: day, MaxAmount: 2000},
+		{Name: "daily_amount", AccountID: "acc_vip", Window: day, MaxAmount: 50000},
+		{Name: "hourly", AccountType: "business", Window: time.Hour, MaxCount: 100},
+	}
+
+	wallet := rules.For("acc_1", "wallet")
+	require.Len(t, wallet, 2)
+	assert.Equal(t, 10000.0, wallet[1].MaxAmount)
+
+	savings := rules.For("acc_2", "savings")
+	require.Len(t, savings, 2)
+	assert.Equal(t, 2000.0, savings[1].MaxAmount)
+
+	vip := rules.For("acc_vip", "savings")
+	require.Len(t, vip, 2)
+	assert.Equal(t, 50000.0, vip[1].MaxAmount, "an account's own rule wins over its type's")
+
+	assert.Equal(t, day, rules.MaxWindow())
+}
+
+func TestRuleCheck(t *testing.T) {
+	count := Rule{Name: "daily_withdrawals", Window: day, MaxCount: 5}
+	assert.NoError(t, count.Check(Usage{Count: 4}, 100))
+	assert.ErrorIs(t, count.Check(Usage{Count: 5}, 100), ErrExceeded)
+	assert.ErrorContains(t, count.Check(Usage{Count: 5}, 100), "daily_withdrawals allows 5 debit(s) per 24h0m0s, 5 already made")
+
+	amount := Rule{Name: "daily_amount", Window: day, MaxAmount: 10000}
+	assert.NoError(t, amount.Check(Usage{Amount: 9999.9}, 0.1))
+	assert.ErrorIs(t, amount.Check(Usage{Amount: 9999.9}, 0.11), ErrExceeded)
+}
+
+func TestRuleStatus(t *testing.T) {
+	s := Rule{Name: "both", Window: day, MaxCount: 5, MaxAmount: 100}.Status(Usage{Count: 7, Amount: 40.5})
+
+	assert.Equal(t, "24h0m0s", s.WindowText)
+	assert.Equal(t, 0, *s.RemainingCount)
+	assert.Equal(t, 59.5, *s.RemainingAmount)
+	assert.Nil(t, Rule{Name: "count", Window: day, MaxCount: 1}.Status(Usage{}).RemainingAmount)
+}
+
+func TestRulesValidate(t *testing.T) {
+	assert.NoError(t, Rules{{Name: "daily", Window: day, MaxCount: 5}}.Validate())
+
+	err := Rules{
+		{Name: "", Window: day, MaxCount: 1},
+		{Name: "both", AccountID: "acc_1", AccountType: "wallet", Window: day, MaxCount: 1},
+		{Name: "no_window", MaxCount: 1},
+		{Name: "no_limit", Window: day},
+		{Name: "dup", Window: day, MaxCount: 1},
+		{Name: "dup", Window: day, MaxCount: 2},
+	}.Validate()
+	assert.ErrorContains(t, err, "limits[0]: name is required")
+	assert.ErrorContains(t, err, "limits[1]: account_id and account_type are exclusive")
+	assert.ErrorContains(t, err, "limits[2]: window must be positive")
+	assert.ErrorContains(t, err, "limits[3]: max_count or max_amount is required")
+	assert.ErrorContains(t, err, "limits[5]: duplicate rule dup")
+}
@@ -2,59 +2,220 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"ledger/api"
 	"ledger/config"
+	"ledger/grpcapi"
 	"ledger/kafka"
 	"ledger/mongo"
 	"ledger/pg"
 	"ledger/service"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
-	config.Initialize()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		handled, err := runCommand(cfg, os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !handled {
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+		return
+	}
 
 	// Initialize the PostgreSQL connection
-	pg.InitPostgres()
-	defer pg.DB.Close()
+	pg.InitPostgres(cfg.Postgres)
+
+	// Refuse to serve against a schema this binary wasn't built for.
+	if err := pg.CheckSchemaCurrent(context.Background()); err != nil {
+		log.Fatalf("%v (run `ledger migrate up`)", err)
+	}
 
 	// Initialize the Redis connection
-	mongo.InitMongo()
-	defer mongo.MongoClient.Disconnect(context.Background())
+	mongo.InitMongo(cfg.Mongo)
 
 	// Initialize the Kafka producer
-	kafka.InitKafka(config.KafkaBroker, config.KafkaClusterID)
-	kafka.CreateTopics(config.KafkaBroker)
-	defer kafka.Producer.Close()
-
-	// setup...
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if err := kafka.InitKafka(cfg.Kafka); err != nil {
+		log.Fatalf("Failed to initialize Kafka: %v", err)
+	}
+	kafka.CreateTopics(cfg.Kafka)
 
 	// Graceful shutdown on Ctrl+C
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// The consumer gets its own context so it keeps running until HTTP and
+	// the producer have drained.
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+
+	service.SetWebhookConfig(cfg.Webhooks)
+	service.SetFeeSchedule(cfg.Fees)
+	if err := service.CheckFeeRevenueAccount(context.Background()); err != nil {
+		log.Fatalf("Fees are configured but cannot be charged: %v", err)
+	}
+	service.SetLimitRules(cfg.Limits)
+	service.SetInterestPlans(cfg.Interest)
+	service.SetLogsSource(cfg.Ledger.LogsSource)
+	service.Initialize(consumerCtx)
+
+	// Interest postings write outbox events too, so the scheduler stops
+	// before the relay.
+	interestCtx, stopInterest := context.WithCancel(context.Background())
+	defer stopInterest()
+	service.StartInterestScheduler(interestCtx, cfg.Interest)
+
+	// Fired schedules queue their commands in the outbox, so the payment
+	// scheduler also stops before the relay.
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	service.StartPaymentScheduler(schedulerCtx, cfg.Scheduler)
+
+	// The projector stops after the consumer so it can project the entries
+	// written by the last messages the consumer handles.
+	projectorCtx, stopProjector := context.WithCancel(context.Background())
+	defer stopProjector()
+	service.StartLedgerProjector(projectorCtx, cfg.Ledger)
+
+	// The outbox relay outlives the consumer so it can publish the events
+	// written by the last messages the consumer handles.
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	service.StartOutboxRelay(relayCtx)
+
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	defer stopWebhooks()
+	service.StartWebhookDispatcher(webhookCtx, cfg.Webhooks)
+
+	err = service.CreateAccount(context.Background(), "12", 10)
+	log.Printf("err: %v\n", err)
+
+	log.Print("Listening on : ", cfg.Port)
+	http.DefaultClient.Timeout = time.Second * 10
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: api.InitialiseRoutes(),
+	}
+	server.RegisterOnShutdown(api.CloseStreams)
 	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
-		log.Println("Shutdown signal received")
-		cancel()
-		if kafka.Consumer != nil {
-			kafka.Consumer.Close()
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
 		}
 	}()
 
-	service.Initialize(ctx)
+	log.Print("gRPC listening on : ", cfg.GRPCPort)
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %v", err)
+	}
+	grpcServer := grpcapi.NewGRPCServer()
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
 
-	err := service.CreateAccount("12", 10)
-	log.Printf("err: %v\n", err)
+	<-signalCtx.Done()
+	log.Println("Shutdown signal received")
+	shutdown(server, grpcServer, stopConsumer, stopInterest, stopScheduler, stopProjector, stopRelay, stopWebhooks, cfg.ShutdownDrainDelay, cfg.ShutdownTimeout)
+}
 
-	log.Print("Listening on : ", config.Port)
-	http.DefaultClient.Timeout = time.Second * 10
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", config.Port), api.InitialiseRoutes()))
+// shutdown drains the service in dependency order within timeout: readiness
+// first fails for drainDelay so load balancers stop sending traffic, then
+// HTTP and gRPC stop so no new commands are produced, then the consumer (finishing
+// in-flight messages and committing their offsets), the schedulers and the
+// ledger projector, then the outbox relay so their events and commands are published, then
+// the producer and the webhook dispatcher, and finally the databases.
+// Undelivered webhooks stay queued in Postgres for the next start.
+func shutdown(server *http.Server, grpcServer *grpc.Server, stopConsumer, stopInterest, stopScheduler, stopProjector, stopRelay, stopWebhooks context.CancelFunc, drainDelay, timeout time.Duration) {
+	service.SetDraining()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Printf("Reporting not ready for %s before closing listeners", drainDelay)
+	select {
+	case <-time.After(drainDelay):
+	case <-ctx.Done():
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	log.Println("HTTP server stopped")
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+	log.Println("gRPC server stopped")
+
+	stopConsumer()
+	if err := service.WaitForConsumers(ctx); err != nil {
+		log.Printf("Kafka consumer drain: %v", err)
+	}
+	if err := kafka.CommitOffsets(); err != nil {
+		log.Printf("Failed to commit consumer offsets: %v", err)
+	}
+	kafka.Consumer.Close()
+	log.Println("Kafka consumer closed")
+
+	stopInterest()
+	if err := service.WaitForInterestScheduler(ctx); err != nil {
+		log.Printf("Interest scheduler drain: %v", err)
+	}
+	stopScheduler()
+	if err := service.WaitForPaymentScheduler(ctx); err != nil {
+		log.Printf("Payment scheduler drain: %v", err)
+	}
+	stopProjector()
+	if err := service.WaitForLedgerProjector(ctx); err != nil {
+		log.Printf("Ledger projector drain: %v", err)
+	}
+
+	stopRelay()
+	if err := service.WaitForOutboxRelay(ctx); err != nil {
+		log.Printf("Outbox relay drain: %v", err)
+	}
+
+	if remaining := kafka.FlushProducer(ctx); remaining > 0 {
+		log.Printf("Kafka producer closed with %d undelivered message(s)", remaining)
+	}
+	kafka.Producer.Close()
+	log.Println("Kafka producer closed")
+
+	stopWebhooks()
+	if err := service.WaitForWebhookDispatcher(ctx); err != nil {
+		log.Printf("Webhook dispatcher drain: %v", err)
+	}
+
+	if err := pg.DB.Close(); err != nil {
+		log.Printf("Failed to close Postgres: %v", err)
+	}
+	if err := mongo.Disconnect(ctx); err != nil {
+		log.Printf("Failed to disconnect MongoDB: %v", err)
+	}
+	log.Println("Shutdown complete")
 }
@@ -0,0 +1,73 @@
+package mongo
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mutatingMethods are the driver calls that change or remove documents.
+var mutatingMethods = map[string]bool{
+	"UpdateOne": true, "UpdateMany": true, "UpdateByID": true, "ReplaceOne": true,
+	"DeleteOne": true, "DeleteMany": true, "FindOneAndUpdate": true,
+	"FindOneAndReplace": true, "FindOneAndDelete": true, "BulkWrite": true, "Drop": true,
+}
+
+// parsePackage returns the package's non-test files.
+func parsePackage(t *testing.T) []*ast.File {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+	}
+	require.NotEmpty(t, files)
+	return files
+}
+
+func TestPackageNeverMutatesDocuments(t *testing.T) {
+	for _, f := range parsePackage(t) {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				assert.False(t, mutatingMethods[sel.Sel.Name], "ledger records are append-only, but %s is called", sel.Sel.Name)
+			}
+			return true
+		})
+	}
+}
+
+func TestPackageExportsNoDriverHandles(t *testing.T) {
+	for _, f := range parsePackage(t) {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				star, ok := vs.Type.(*ast.StarExpr)
+				if !ok {
+					continue
+				}
+				sel, ok := star.X.(*ast.SelectorExpr)
+				if !ok || sel.X.(*ast.Ident).Name != "mongo" {
+					continue
+				}
+				for _, name := range vs.Names {
+					assert.False(t, name.IsExported(), "%s exposes *mongo.%s, which allows updates and deletes", name.Name, sel.Sel.Name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package mongo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chainIndexName is the unique index that stops two writers from giving
+// an account's records the same sequence number.
+const chainIndexName = "user_id_sequence_unique"
+
+// hashedRecord is the content a record's hash covers, in a fixed field
+// order so the encoding is canonical.
+type hashedRecord struct {
+	Sequence       int64   `json:"sequence"`
+	PrevHash       string  `json:"prev_hash"`
+	UserID         string  `json:"user_id"`
+	Operation      string  `json:"operation"`
+	Amount         float64 `json:"amount"`
+	Timestamp      string  `json:"timestamp"`
+	TransactionID  string  `json:"transaction_id"`
+	Status         string  `json:"status"`
+	CounterAccount string  `json:"counter_account"`
+	Direction      string  `json:"direction"`
+	Description    string  `json:"description"`
+	// Omitted when empty so records chained before it existed still
+	// verify.
+	Reverses string `json:"reverses,omitempty"`
+}
+
+// ComputeHash returns the hex SHA-256 of the record's content and
+// PrevHash. The timestamp is taken at the millisecond precision MongoDB
+// stores.
+func (r LedgerRecord) ComputeHash() string {
+	data, _ := json.Marshal(hashedRecord{
+		Sequence:       r.Sequence,
+		PrevHash:       r.PrevHash,
+		UserID:         r.UserID,
+		Operation:      r.Operation,
+		Amount:         r.Amount,
+		Timestamp:      r.Timestamp.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		TransactionID:  r.TransactionID,
+		Status:         r.Status,
+		CounterAccount: r.CounterAccount,
+		Direction:      r.Direction,
+		Description:    r.Description,
+		Reverses:       r.Reverses,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chain links rec onto head, the account's latest record.
+func chain(rec LedgerRecord, head LedgerRecord) LedgerRecord {
+	rec.Sequence = head.Sequence + 1
+	rec.PrevHash = head.Hash
+	rec.Hash = rec.ComputeHash()
+	return rec
+}
+
+// chainHead returns userID's latest chained record, or a zero record if
+// the account has none.
+func chainHead(ctx context.Context, userID string) (LedgerRecord, error) {
+	var head LedgerRecord
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+	err := ledgerCollection.FindOne(ctx, bson.M{"user_id": userID, "sequence": bson.M{"$exists": true}}, opts).Decode(&head)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return LedgerRecord{}, nil
+	}
+	if err != nil {
+		return LedgerRecord{}, fmt.Errorf("failed to read chain head of %s: %w", userID, err)
+	}
+	return head, nil
+}
+
+// isChainConflict reports whether err is another writer having taken the
+// sequence number a record was about to use.
+func isChainConflict(err error) bool {
+	var we mongo.WriteException
+	if !errors.As(err, &we) {
+		return false
+	}
+	for _, e := range we.WriteErrors {
+		if e.Code == 11000 && strings.Contains(e.Message, chainIndexName) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChainBreak is the first point where an account's chain fails to verify.
+type ChainBreak struct {
+	Sequence int64  `json:"sequence"`
+	RecordID string `json:"record_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// ChainReport is the result of verifying an account's chain.
+type ChainReport struct {
+	UserID string `json:"user_id"`
+	// Records is how many chained records were checked before the break,
+	// if any.
+	Records int64 `json:"records"`
+	// Unchained counts the account's records written before chaining,
+	// which cannot be verified.
+	Unchained int64 `json:"unchained"`
+	// Head is the hash of the last verified record.
+	Head  string      `json:"head,omitempty"`
+	Valid bool        `json:"valid"`
+	Break *ChainBreak `json:"break,omitempty"`
+}
+
+// chainVerifier checks records fed to it in sequence order.
+type chainVerifier struct {
+	report ChainReport
+}
+
+// next checks rec against the records before it and returns false once
+// the chain has broken.
+func (v *chainVerifier) next(rec LedgerRecord) bool {
+	want := v.report.Records + 1
+	var reason string
+	switch {
+	case rec.Sequence < want:
+		reason = fmt.Sprintf("sequence %d is repeated", rec.Sequence)
+	case rec.Sequence > want:
+		reason = fmt.Sprintf("records %d to %d are missing", want, rec.Sequence-1)
+	case rec.PrevHash != v.report.Head:
+		reason = "prev_hash does not match the previous record's hash"
+	case rec.Hash != rec.ComputeHash():
+		reason = "hash does not match the record's content"
+	}
+	if reason != "" {
+		v.report.Break = &ChainBreak{Sequence: want, RecordID: rec.ID.Hex(), Reason: reason}
+		return false
+	}
+	v.report.Records++
+	v.report.Head = rec.Hash
+	return true
+}
+
+// VerifyChain walks userID's chained records in sequence order and reports
+// the first one that is missing, out of place, or altered. Deleting an
+// account's latest records is only detectable against a head hash kept
+// elsewhere, such as a previous report.
+func VerifyChain(ctx context.Context, userID string) (ChainReport, error) {
+	v := chainVerifier{report: ChainReport{UserID: userID}}
+
+	unchained, err := ledgerCollection.CountDocuments(ctx, bson.M{"user_id": userID, "sequence": bson.M{"$exists": false}})
+	if err != nil {
+		return ChainReport{}, fmt.Errorf("failed to count unchained records: %w", err)
+	}
+	v.report.Unchained = unchained
+
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := ledgerCollection.Find(ctx, bson.M{"user_id": userID, "sequence": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return ChainReport{}, fmt.Errorf("failed to read ledger chain: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var rec LedgerRecord
+		if err := cursor.Decode(&rec); err != nil {
+			return ChainReport{}, fmt.Errorf("failed to decode ledger record: %w", err)
+		}
+		if !v.next(rec) {
+			return v.report, nil
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return ChainReport{}, fmt.Errorf("failed to read ledger chain: %w", err)
+	}
+	v.report.Valid = true
+	return v.report, nil
+}
+
+// LedgerAccounts returns every account with ledger records.
+func LedgerAccounts(ctx context.Context) ([]string, error) {
+	values, err := ledgerCollection.Distinct(ctx, "user_id", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger accounts: %w", err)
+	}
+	accounts := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			accounts = append(accounts, id)
+		}
+	}
+	return accounts, nil
+}
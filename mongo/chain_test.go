@@ -0,0 +1,99 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testChain(n int) []LedgerRecord {
+	var records []LedgerRecord
+	head := LedgerRecord{}
+	at := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		rec := chain(LedgerRecord{
+			ID:            primitive.NewObjectID(),
+			UserID:        "acc_1",
+			Operation:     "AddBalance",
+			Amount:        float64(10 * (i + 1)),
+			Timestamp:     at.Add(time.Duration(i) * time.Minute),
+			TransactionID: primitive.NewObjectID().Hex(),
+		}, head)
+		records = append(records, rec)
+		head = rec
+	}
+	return records
+}
+
+func verify(records []LedgerRecord) ChainReport {
+	v := chainVerifier{report: ChainReport{UserID: "acc_1"}}
+	for _, rec := range records {
+		if !v.next(rec) {
+			return v.report
+		}
+	}
+	v.report.Valid = true
+	return v.report
+}
+
+func TestChainLinksRecords(t *testing.T) {
+	records := testChain(3)
+
+	assert.Equal(t, int64(1), records[0].Sequence)
+	assert.Empty(t, records[0].PrevHash)
+	assert.Equal(t, records[0].Hash, records[1].PrevHash)
+	assert.Equal(t, int64(3), records[2].Sequence)
+	assert.Len(t, records[2].Hash, 64)
+
+	report := verify(records)
+	assert.True(t, report.Valid)
+	assert.Equal(t, int64(3), report.Records)
+	assert.Equal(t, records[2].Hash, report.Head)
+}
+
+func TestComputeHashIgnoresSubMillisecondTime(t *testing.T) {
+	rec := testChain(1)[0]
+	stored := rec
+	stored.Timestamp = rec.Timestamp.Add(400 * time.Microsecond)
+
+	assert.Equal(t, rec.ComputeHash(), stored.ComputeHash())
+}
+
+func TestVerifyChainReportsFirstBreak(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]LedgerRecord) []LedgerRecord
+		seq    int64
+		reason string
+	}{
+		{"edited amount", func(r []LedgerRecord) []LedgerRecord {
+			r[1].Amount = 1e6
+			return r
+		}, 2, "hash does not match"},
+		{"deleted record", func(r []LedgerRecord) []LedgerRecord {
+			return append(r[:1], r[2:]...)
+		}, 2, "records 2 to 2 are missing"},
+		{"rehashed edit", func(r []LedgerRecord) []LedgerRecord {
+			r[1].Amount = 1e6
+			r[1].Hash = r[1].ComputeHash()
+			return r
+		}, 3, "prev_hash does not match"},
+		{"repeated sequence", func(r []LedgerRecord) []LedgerRecord {
+			return append(r[:2], r[1:]...)
+		}, 3, "sequence 2 is repeated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := verify(tt.tamper(testChain(4)))
+
+			assert.False(t, report.Valid)
+			require.NotNil(t, report.Break)
+			assert.Equal(t, tt.seq, report.Break.Sequence)
+			assert.Contains(t, report.Break.Reason, tt.reason)
+			assert.Equal(t, tt.seq-1, report.Records)
+		})
+	}
+}
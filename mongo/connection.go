@@ -13,30 +13,44 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var MongoClient *mongo.Client
-var MongoDB *mongo.Database
-var LedgerCollection *mongo.Collection
+// The client, database and ledger collection stay unexported so that
+// ledger records can only be appended and read, through this package's
+// functions; nothing outside it can update or delete them.
+var (
+	client           *mongo.Client
+	database         *mongo.Database
+	ledgerCollection *mongo.Collection
+)
 
-// RecordTransaction inserts one or multiple ledger records in a MongoDB transaction.
-func InitMongo() {
+// InitMongo connects to MongoDB and ensures the ledger collection's schema.
+func InitMongo(cfg config.MongoConfig) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	mongoURI := fmt.Sprintf("mongodb://%s:%s", config.MongoHost, config.MongoPort)
+	mongoURI := fmt.Sprintf("mongodb://%s:%d", cfg.Host, cfg.Port)
 	clientOptions := options.Client().ApplyURI(mongoURI)
 
 	var err error
-	MongoClient, err = mongo.Connect(ctx, clientOptions)
+	client, err = mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
 	}
 
 	// Ping to confirm connection
-	if err := MongoClient.Ping(ctx, readpref.Primary()); err != nil {
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
 		log.Fatalf("❌ MongoDB ping failed: %v", err)
 	}
 
-	MongoDB = MongoClient.Database(config.MongoDB)
-	LedgerCollection = MongoDB.Collection("ledger_records")
-	log.Println("✅ Connected to MongoDB:", config.MongoDB)
+	database = client.Database(cfg.DB)
+	ledgerCollection = database.Collection(LedgerCollectionName)
+	log.Println("✅ Connected to MongoDB:", cfg.DB)
+
+	if err := EnsureSchema(ctx); err != nil {
+		log.Fatalf("❌ Failed to ensure MongoDB schema: %v", err)
+	}
+}
+
+// Disconnect closes the MongoDB connection.
+func Disconnect(ctx context.Context) error {
+	return client.Disconnect(ctx)
 }
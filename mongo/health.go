@@ -0,0 +1,16 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Ping checks that the Mongo client can reach the primary.
+func Ping(ctx context.Context) error {
+	if client == nil {
+		return errors.New("mongo is not initialized")
+	}
+	return client.Ping(ctx, readpref.Primary())
+}
@@ -9,8 +9,25 @@ import (
 type LedgerRecord struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty"`
 	UserID        string             `bson:"user_id"`
-	Operation     string             `bson:"operation"`      // e.g., "CreateAccount", "AddBalance", "DeductBalance"
-	Amount        float64            `bson:"amount"`         // positive or negative
-	Timestamp     time.Time          `bson:"timestamp"`      // when transaction happened
-	TransactionID string             `bson:"transaction_id"` // optional to correlate multiple ops in one transaction
+	Operation     string             `bson:"operation"`        // e.g., "CreateAccount", "AddBalance", "DeductBalance"
+	Amount        float64            `bson:"amount"`           // positive or negative
+	Timestamp     time.Time          `bson:"timestamp"`        // when transaction happened
+	TransactionID string             `bson:"transaction_id"`   // optional to correlate multiple ops in one transaction
+	Status        string             `bson:"status,omitempty"` // account status after a lifecycle operation
+	// CounterAccount is the system account holding the other side of the
+	// journal entry, e.g. cash-in clearing for deposits and withdrawals.
+	CounterAccount string `bson:"counter_account,omitempty"`
+	// Direction and Description are set on journal entry legs.
+	Direction   string `bson:"direction,omitempty"`
+	Description string `bson:"description,omitempty"`
+	// Reverses is the TransactionID of the entry this one compensates.
+	// Records are never changed; a mistake is corrected by a new entry.
+	Reverses string `bson:"reverses,omitempty"`
+	// Sequence numbers an account's records from 1 without gaps. Hash
+	// covers the record's content and PrevHash, the Hash of the account's
+	// previous record, so editing or deleting a record breaks the chain.
+	// Records written before chaining have neither.
+	Sequence int64  `bson:"sequence,omitempty"`
+	PrevHash string `bson:"prev_hash,omitempty"`
+	Hash     string `bson:"hash,omitempty"`
 }
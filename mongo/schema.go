@@ -0,0 +1,215 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LedgerCollectionName is the collection holding LedgerRecord documents.
+const LedgerCollectionName = "ledger_records"
+
+// IndexDefinition declares an index the ledger collection must have.
+type IndexDefinition struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// Partial, when set, limits the index to the documents it matches.
+	Partial bson.M
+}
+
+// LedgerIndexes are ensured on the ledger collection at startup.
+var LedgerIndexes = []IndexDefinition{
+	{
+		// GetUserLogs filters by user and returns records in time order.
+		Name: "user_id_timestamp",
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: 1}},
+	},
+	{
+		// A journal entry writes one record per account, and a charged
+		// command a fee line next to its own, all sharing a TransactionID.
+		Name: "transaction_id_user_id_operation_unique",
+		Keys: bson.D{
+			{Key: "transaction_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "operation", Value: 1},
+		},
+		Unique: true,
+	},
+	{
+		Name: "operation",
+		Keys: bson.D{{Key: "operation", Value: 1}},
+	},
+	{
+		// Numbers each account's hash chain; records written before
+		// chaining have no sequence and are left out.
+		Name:    chainIndexName,
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "sequence", Value: 1}},
+		Unique:  true,
+		Partial: bson.M{"sequence": bson.M{"$exists": true}},
+	},
+}
+
+// RetiredLedgerIndexes are dropped by EnsureSchema because a LedgerIndexes
+// entry replaced them.
+var RetiredLedgerIndexes = []string{"transaction_id_unique", "transaction_id_user_id_unique"}
+
+// LedgerValidator is the $jsonSchema validator applied to the ledger
+// collection so malformed records are rejected by the server.
+var LedgerValidator = bson.M{
+	"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": []string{"user_id", "operation", "amount", "timestamp", "transaction_id"},
+		"properties": bson.M{
+			"user_id":        bson.M{"bsonType": "string", "minLength": 1},
+			"operation":      bson.M{"bsonType": "string", "minLength": 1},
+			"amount":         bson.M{"bsonType": []string{"double", "int", "long", "decimal"}},
+			"timestamp":      bson.M{"bsonType": "date"},
+			"transaction_id": bson.M{"bsonType": "string", "minLength": 1},
+			"sequence":       bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+			"hash":           bson.M{"bsonType": "string", "minLength": 64, "maxLength": 64},
+		},
+	},
+}
+
+// EnsureSchema creates the ledger collection with its validator, or updates
+// the validator if the collection already exists, and creates any missing
+// indexes. It is idempotent.
+func EnsureSchema(ctx context.Context) error {
+	names, err := database.ListCollectionNames(ctx, bson.M{"name": LedgerCollectionName})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	if len(names) == 0 {
+		opts := options.CreateCollection().SetValidator(LedgerValidator)
+		if err := database.CreateCollection(ctx, LedgerCollectionName, opts); err != nil {
+			return fmt.Errorf("failed to create %s: %w", LedgerCollectionName, err)
+		}
+	} else {
+		cmd := bson.D{
+			{Key: "collMod", Value: LedgerCollectionName},
+			{Key: "validator", Value: LedgerValidator},
+		}
+		if err := database.RunCommand(ctx, cmd).Err(); err != nil {
+			return fmt.Errorf("failed to update %s validator: %w", LedgerCollectionName, err)
+		}
+	}
+
+	if err := dropRetiredIndexes(ctx); err != nil {
+		return err
+	}
+
+	models := make([]mongo.IndexModel, 0, len(LedgerIndexes))
+	for _, def := range LedgerIndexes {
+		opts := options.Index().SetName(def.Name).SetUnique(def.Unique)
+		if def.Partial != nil {
+			opts.SetPartialFilterExpression(def.Partial)
+		}
+		models = append(models, mongo.IndexModel{Keys: def.Keys, Options: opts})
+	}
+	if _, err := ledgerCollection.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("failed to create ledger indexes: %w", err)
+	}
+
+	log.Printf("✅ Ensured %d index(es) on %s", len(models), LedgerCollectionName)
+	return nil
+}
+
+func dropRetiredIndexes(ctx context.Context) error {
+	specs, err := ledgerCollection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list ledger indexes: %w", err)
+	}
+	for _, spec := range specs {
+		if !slices.Contains(RetiredLedgerIndexes, spec.Name) {
+			continue
+		}
+		if _, err := ledgerCollection.Indexes().DropOne(ctx, spec.Name); err != nil {
+			return fmt.Errorf("failed to drop retired index %s: %w", spec.Name, err)
+		}
+		log.Printf("Dropped retired index %s on %s", spec.Name, LedgerCollectionName)
+	}
+	return nil
+}
+
+// IndexDrift describes how the live indexes differ from LedgerIndexes.
+type IndexDrift struct {
+	Missing    []string `json:"missing,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+	Mismatched []string `json:"mismatched,omitempty"`
+}
+
+// HasDrift reports whether any difference was found.
+func (d IndexDrift) HasDrift() bool {
+	return len(d.Missing)+len(d.Unexpected)+len(d.Mismatched) > 0
+}
+
+// LedgerIndexDrift compares the ledger collection's indexes against
+// LedgerIndexes.
+func LedgerIndexDrift(ctx context.Context) (IndexDrift, error) {
+	specs, err := ledgerCollection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return IndexDrift{}, fmt.Errorf("failed to list ledger indexes: %w", err)
+	}
+	return diffIndexes(LedgerIndexes, specs), nil
+}
+
+func diffIndexes(defs []IndexDefinition, specs []*mongo.IndexSpecification) IndexDrift {
+	live := make(map[string]*mongo.IndexSpecification, len(specs))
+	for _, spec := range specs {
+		live[spec.Name] = spec
+	}
+
+	var drift IndexDrift
+	declared := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		declared[def.Name] = true
+		spec, ok := live[def.Name]
+		if !ok {
+			drift.Missing = append(drift.Missing, def.Name)
+			continue
+		}
+		want := keysString(def.Keys)
+		got := rawKeysString(spec.KeysDocument)
+		unique := spec.Unique != nil && *spec.Unique
+		if want != got || unique != def.Unique {
+			drift.Mismatched = append(drift.Mismatched, fmt.Sprintf(
+				"%s: want {%s} unique=%t, got {%s} unique=%t", def.Name, want, def.Unique, got, unique))
+		}
+	}
+	for _, spec := range specs {
+		if spec.Name != "_id_" && !declared[spec.Name] {
+			drift.Unexpected = append(drift.Unexpected, spec.Name)
+		}
+	}
+	return drift
+}
+
+func keysString(keys bson.D) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s:%v", k.Key, k.Value))
+	}
+	return strings.Join(parts, ",")
+}
+
+func rawKeysString(keys bson.Raw) string {
+	elems, err := keys.Elements()
+	if err != nil {
+		return "<invalid>"
+	}
+	parts := make([]string, 0, len(elems))
+	for _, e := range elems {
+		value := e.Value().String()
+		if n, ok := e.Value().AsInt64OK(); ok {
+			value = fmt.Sprint(n)
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s", e.Key(), value))
+	}
+	return strings.Join(parts, ",")
+}
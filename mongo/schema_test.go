@@ -0,0 +1,46 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func spec(t *testing.T, name string, keys bson.D, unique bool) *mongo.IndexSpecification {
+	raw, err := bson.Marshal(keys)
+	assert.NoError(t, err)
+	return &mongo.IndexSpecification{Name: name, KeysDocument: raw, Unique: &unique}
+}
+
+func TestDiffIndexesNoDrift(t *testing.T) {
+	specs := []*mongo.IndexSpecification{spec(t, "_id_", bson.D{{Key: "_id", Value: int32(1)}}, false)}
+	for _, def := range LedgerIndexes {
+		specs = append(specs, spec(t, def.Name, def.Keys, def.Unique))
+	}
+
+	drift := diffIndexes(LedgerIndexes, specs)
+
+	assert.False(t, drift.HasDrift(), "%+v", drift)
+}
+
+func TestDiffIndexesReportsDrift(t *testing.T) {
+	defs := []IndexDefinition{
+		{Name: "present", Keys: bson.D{{Key: "a", Value: 1}}},
+		{Name: "missing", Keys: bson.D{{Key: "b", Value: 1}}},
+		{Name: "not_unique", Keys: bson.D{{Key: "c", Value: 1}}, Unique: true},
+	}
+	specs := []*mongo.IndexSpecification{
+		spec(t, "present", bson.D{{Key: "a", Value: int32(1)}}, false),
+		spec(t, "not_unique", bson.D{{Key: "c", Value: int32(1)}}, false),
+		spec(t, "stray", bson.D{{Key: "d", Value: int32(-1)}}, false),
+	}
+
+	drift := diffIndexes(defs, specs)
+
+	assert.Equal(t, []string{"missing"}, drift.Missing)
+	assert.Equal(t, []string{"stray"}, drift.Unexpected)
+	assert.Len(t, drift.Mismatched, 1)
+	assert.Contains(t, drift.Mismatched[0], "not_unique")
+}
@@ -5,25 +5,66 @@ import (
 	"fmt"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// maxChainAttempts bounds how often RecordTransaction retries after losing
+// a race for an account's next sequence number.
+const maxChainAttempts = 5
+
 // Pass a slice of LedgerRecord, so you can record multiple ops atomically.
+// Each record is chained onto its account's latest record: it gets the
+// next sequence number, that record's hash as PrevHash, and its own Hash.
+// Records already present, by transaction, account and operation, are
+// skipped, so a transaction can be projected more than once. Records
+// without a Timestamp are stamped with the current time.
 func RecordTransaction(ctx context.Context, records []LedgerRecord) error {
-	session, err := MongoClient.StartSession()
+	for attempt := 1; ; attempt++ {
+		err := recordTransaction(ctx, records)
+		if err == nil || !isChainConflict(err) || attempt == maxChainAttempts {
+			return err
+		}
+	}
+}
+
+func recordTransaction(ctx context.Context, records []LedgerRecord) error {
+	session, err := client.StartSession()
 	if err != nil {
 		return fmt.Errorf("failed to start mongo session: %w", err)
 	}
 	defer session.EndSession(ctx)
 
 	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// MongoDB keeps milliseconds, so hash what will be read back.
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		heads := map[string]LedgerRecord{}
 		for _, rec := range records {
-			rec.Timestamp = time.Now().UTC() // Set timestamp if not set
+			if done, err := recorded(sessCtx, rec); err != nil || done {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			head, ok := heads[rec.UserID]
+			if !ok {
+				var err error
+				if head, err = chainHead(sessCtx, rec.UserID); err != nil {
+					return nil, err
+				}
+			}
+			if rec.Timestamp.IsZero() {
+				rec.Timestamp = now
+			}
+			rec.Timestamp = rec.Timestamp.UTC().Truncate(time.Millisecond)
+			rec = chain(rec, head)
 
-			_, err := LedgerCollection.InsertOne(sessCtx, rec)
+			_, err := ledgerCollection.InsertOne(sessCtx, rec)
 			if err != nil {
 				return nil, fmt.Errorf("failed to insert ledger record: %w", err)
 			}
+			heads[rec.UserID] = rec
 		}
 		return nil, nil
 	}
@@ -36,11 +77,30 @@ func RecordTransaction(ctx context.Context, records []LedgerRecord) error {
 	return nil
 }
 
+// recorded reports whether rec's transaction, account and operation are
+// already in the ledger.
+func recorded(ctx context.Context, rec LedgerRecord) (bool, error) {
+	n, err := ledgerCollection.CountDocuments(ctx, bson.M{
+		"transaction_id": rec.TransactionID,
+		"user_id":        rec.UserID,
+		"operation":      rec.Operation,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up ledger record: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetUserLogs returns userID's ledger records, oldest first: in chain
+// order, after any records written before chaining, which are ordered by
+// timestamp.
 func GetUserLogs(userID string) ([]LedgerRecord, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := LedgerCollection.Find(ctx, map[string]string{"user_id": userID})
+	// Records without a sequence sort first.
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}, {Key: "timestamp", Value: 1}})
+	cursor, err := ledgerCollection.Find(ctx, map[string]string{"user_id": userID}, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user logs: %w", err)
 	}
@@ -0,0 +1,109 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRecordNotFound is returned when a ledger record looked up by
+// transaction ID does not exist.
+var ErrRecordNotFound = errors.New("ledger record not found")
+
+// WatchUserRecords streams ledger records inserted for userID from the
+// moment it returns until ctx is cancelled, using a change stream on the
+// ledger collection so inserts made by any replica are seen. Change streams
+// need a replica set, which RecordTransaction already requires.
+//
+// The records channel is closed when the stream ends; if it ended because
+// of an error other than cancellation, that error is sent on the error
+// channel first.
+func WatchUserRecords(ctx context.Context, userID string) (<-chan LedgerRecord, <-chan error, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "operationType", Value: "insert"},
+			{Key: "fullDocument.user_id", Value: userID},
+		}}},
+	}
+	stream, err := ledgerCollection.Watch(ctx, pipeline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to watch ledger records: %w", err)
+	}
+
+	records := make(chan LedgerRecord)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(records)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			var change struct {
+				FullDocument LedgerRecord `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				errc <- fmt.Errorf("failed to decode ledger change: %w", err)
+				return
+			}
+			select {
+			case records <- change.FullDocument:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			errc <- fmt.Errorf("ledger change stream failed: %w", err)
+		}
+	}()
+	return records, errc, nil
+}
+
+// GetUserLogsAfter returns userID's ledger records chained after the one
+// with transactionID, oldest first. It returns ErrRecordNotFound if there
+// is no such record for the user.
+//
+// It resumes on the account's chain sequence, not on timestamps: records
+// take their timestamp from the Postgres transaction that wrote them, so a
+// record chained later can carry an earlier timestamp.
+func GetUserLogsAfter(ctx context.Context, userID, transactionID string) ([]LedgerRecord, error) {
+	var last LedgerRecord
+	// A transaction can post several records to the user; resume after the last.
+	lastOpts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	err := ledgerCollection.FindOne(ctx, bson.M{"user_id": userID, "transaction_id": transactionID}, lastOpts).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ledger record: %w", err)
+	}
+
+	filter := bson.M{"user_id": userID, "sequence": bson.M{"$gt": last.Sequence}}
+	if last.Sequence == 0 {
+		// Records written before chaining have no sequence and never
+		// change, so they are ordered by timestamp; every chained record
+		// comes after them.
+		filter = bson.M{
+			"user_id": userID,
+			"$or": bson.A{
+				bson.M{"sequence": bson.M{"$exists": true}},
+				bson.M{"timestamp": bson.M{"$gt": last.Timestamp}},
+				bson.M{"timestamp": last.Timestamp, "_id": bson.M{"$gt": last.ID}},
+			},
+		}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := ledgerCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user logs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []LedgerRecord
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode user logs: %w", err)
+	}
+	return records, nil
+}
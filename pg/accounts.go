@@ -0,0 +1,209 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// Account statuses.
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// Account types.
+const (
+	AccountWallet  = "wallet"
+	AccountSavings = "savings"
+	AccountEscrow  = "escrow"
+)
+
+// Account is a row of user_balances. ID is the user_id column, which every
+// command addresses; OwnerID is the user holding the account.
+type Account struct {
+	ID      string            `json:"id"`
+	OwnerID string            `json:"owner_id"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Labels  map[string]string `json:"labels"`
+	Balance float64           `json:"balance"`
+	// Version increases with every balance change.
+	Version  int64  `json:"version"`
+	Status   string `json:"status"`
+	Currency string `json:"currency"`
+	// LedgerCode is the chart of accounts code the account rolls up to.
+	LedgerCode string `json:"ledger_code"`
+	// InterestPlan is the rate plan a savings account earns under; empty
+	// means the default plan.
+	InterestPlan string    `json:"interest_plan,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AccountUpdate changes an account's metadata. Nil fields are left alone;
+// Labels are merged into the existing ones, and a nil value removes a label.
+type AccountUpdate struct {
+	Name         *string
+	Type         *string
+	Labels       map[string]*string
+	InterestPlan *string
+}
+
+const accountColumns = `user_id, owner_id, name, type, labels, balance, version, status, currency, ledger_code, interest_plan, created_at, updated_at`
+
+func scanAccount(row interface{ Scan(...any) error }) (Account, error) {
+	var a Account
+	var labels []byte
+	err := row.Scan(&a.ID, &a.OwnerID, &a.Name, &a.Type, &labels, &a.Balance, &a.Version, &a.Status, &a.Currency, &a.LedgerCode, &a.InterestPlan, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrAccountNotFound
+	}
+	if err != nil {
+		return a, fmt.Errorf("failed to scan account: %w", err)
+	}
+	if err := json.Unmarshal(labels, &a.Labels); err != nil {
+		return a, fmt.Errorf("failed to decode account labels: %w", err)
+	}
+	return a, nil
+}
+
+// InsertAccount creates an account, or returns ErrAccountExists if the ID is
+// taken.
+func InsertAccount(ctx context.Context, account Account, tx *sql.Tx) error {
+	if account.Labels == nil {
+		account.Labels = map[string]string{}
+	}
+	labels, err := json.Marshal(account.Labels)
+	if err != nil {
+		return fmt.Errorf("failed to encode account labels: %w", err)
+	}
+	_, err = conn(tx).ExecContext(ctx, `
+		INSERT INTO user_balances(user_id, owner_id, name, type, labels, balance)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, account.ID, account.OwnerID, account.Name, account.Type, labels, account.Balance)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == sqlStateUniqueViolation && pgErr.ConstraintName == "user_balances_pkey" {
+		return fmt.Errorf("account %s: %w", account.ID, ErrAccountExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create new account: %w", err)
+	}
+	return nil
+}
+
+// GetAccount returns an account, or ErrAccountNotFound.
+func GetAccount(ctx context.Context, id string, tx *sql.Tx) (Account, error) {
+	row := conn(tx).QueryRowContext(ctx, `SELECT `+accountColumns+` FROM user_balances WHERE user_id = $1`, id)
+	return scanAccount(row)
+}
+
+// ListAccountsByOwner returns a user's accounts, oldest first.
+func ListAccountsByOwner(ctx context.Context, ownerID string, tx *sql.Tx) ([]Account, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT `+accountColumns+` FROM user_balances
+		WHERE owner_id = $1
+		ORDER BY created_at, user_id
+	`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// UpdateAccount applies update and returns the updated account, or
+// ErrAccountNotFound.
+func UpdateAccount(ctx context.Context, id string, update AccountUpdate, tx *sql.Tx) (Account, error) {
+	labels := []byte("{}")
+	if len(update.Labels) > 0 {
+		var err error
+		if labels, err = json.Marshal(update.Labels); err != nil {
+			return Account{}, fmt.Errorf("failed to encode account labels: %w", err)
+		}
+	}
+	row := conn(tx).QueryRowContext(ctx, `
+		UPDATE user_balances
+		SET name = COALESCE($2, name),
+		    type = COALESCE($3, type),
+		    labels = jsonb_strip_nulls(labels || $4::jsonb),
+		    interest_plan = COALESCE($5, interest_plan),
+		    updated_at = now()
+		WHERE user_id = $1
+		RETURNING `+accountColumns,
+		id, update.Name, update.Type, labels, update.InterestPlan)
+	return scanAccount(row)
+}
+
+// LockAccount returns an account's balance, version and status and locks
+// its row until tx ends, so they cannot change underneath the caller. It
+// returns ErrAccountNotFound if there is no such account.
+func LockAccount(ctx context.Context, userID string, tx *sql.Tx) (Account, error) {
+	account := Account{ID: userID}
+	err := tx.QueryRowContext(ctx, `
+		SELECT balance, version, status FROM user_balances WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&account.Balance, &account.Version, &account.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, ErrAccountNotFound
+	}
+	if err != nil {
+		return account, fmt.Errorf("failed to lock account: %w", err)
+	}
+	return account, nil
+}
+
+// LockAccounts locks the rows of ids and returns them by ID; IDs with no
+// account are left out. Like LockBalances it locks in lockOrder, so
+// transactions touching several accounts cannot deadlock each other.
+func LockAccounts(ctx context.Context, ids []string, tx *sql.Tx) (map[string]Account, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, balance, status, currency, ledger_code FROM user_balances
+		WHERE user_id = ANY($1)
+		ORDER BY `+lockOrder+`
+		FOR UPDATE
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]Account, len(ids))
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.ID, &a.Balance, &a.Status, &a.Currency, &a.LedgerCode); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts[a.ID] = a
+	}
+	return accounts, rows.Err()
+}
+
+// SetAccountStatus changes an account's status.
+func SetAccountStatus(ctx context.Context, userID, status string, tx *sql.Tx) error {
+	result, err := conn(tx).ExecContext(ctx, `
+		UPDATE user_balances SET status = $2, updated_at = now() WHERE user_id = $1
+	`, userID, status)
+	if err != nil {
+		return fmt.Errorf("failed to set account status: %w", err)
+	}
+	err = requireRow(result)
+	if errors.Is(err, ErrNotFound) {
+		return ErrAccountNotFound
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Results of a command sent for a batch item or a scheduled payment run.
+const (
+	CommandQueued   = "queued"
+	CommandApplied  = "applied"
+	CommandRejected = "rejected"
+)
+
+// Batch is a bulk posting submitted as one request.
+type Batch struct {
+	ID           string
+	AllOrNothing bool
+	CreatedAt    time.Time
+}
+
+// BatchItem is one operation of a batch and its result.
+type BatchItem struct {
+	Index     int
+	EventID   string
+	Operation string
+	UserID    string
+	Amount    float64
+	Status    string
+	Error     string
+	UpdatedAt time.Time
+}
+
+// batchInsertChunk bounds rows per multi-row INSERT, keeping well under
+// Postgres' 65535 bind parameter limit.
+const batchInsertChunk = 500
+
+// CreateBatch stores a batch and its items, all queued.
+func CreateBatch(ctx context.Context, batch Batch, items []BatchItem, tx *sql.Tx) error {
+	_, err := conn(tx).ExecContext(ctx, `INSERT INTO batches(id, all_or_nothing) VALUES ($1, $2)`, batch.ID, batch.AllOrNothing)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	for start := 0; start < len(items); start += batchInsertChunk {
+		chunk := items[start:min(start+batchInsertChunk, len(items))]
+		values := make([]string, 0, len(chunk))
+		args := make([]any, 0, len(chunk)*6)
+		for i, item := range chunk {
+			n := i * 6
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6))
+			args = append(args, batch.ID, item.Index, item.EventID, item.Operation, item.UserID, item.Amount)
+		}
+		query := `INSERT INTO batch_items(batch_id, item_index, event_id, operation, user_id, amount) VALUES ` + strings.Join(values, ", ")
+		if _, err := conn(tx).ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to create batch items: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetBatch returns a batch and its items in submission order. It returns
+// ErrNotFound if the batch does not exist.
+func GetBatch(ctx context.Context, id string, tx *sql.Tx) (Batch, []BatchItem, error) {
+	batch := Batch{ID: id}
+	err := conn(tx).QueryRowContext(ctx, `SELECT all_or_nothing, created_at FROM batches WHERE id = $1`, id).
+		Scan(&batch.AllOrNothing, &batch.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return batch, nil, ErrNotFound
+	}
+	if err != nil {
+		return batch, nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT item_index, event_id, operation, user_id, amount, status, error, updated_at
+		FROM batch_items
+		WHERE batch_id = $1
+		ORDER BY item_index
+	`, id)
+	if err != nil {
+		return batch, nil, fmt.Errorf("failed to get batch items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []BatchItem{}
+	for rows.Next() {
+		var item BatchItem
+		if err := rows.Scan(&item.Index, &item.EventID, &item.Operation, &item.UserID, &item.Amount,
+			&item.Status, &item.Error, &item.UpdatedAt); err != nil {
+			return batch, nil, fmt.Errorf("failed to scan batch item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return batch, items, rows.Err()
+}
+
+// SetCommandResult records the outcome of the command with eventID on the
+// batch item or scheduled payment run that sent it. It is a no-op for other
+// commands, so handlers can call it for every command.
+func SetCommandResult(ctx context.Context, eventID, status, reason string, tx *sql.Tx) error {
+	_, err := conn(tx).ExecContext(ctx, `
+		WITH items AS (
+			UPDATE batch_items SET status = $2, error = $3, updated_at = now()
+			WHERE event_id = $1
+		)
+		UPDATE payment_schedule_runs SET status = $2, error = $3, updated_at = now()
+		WHERE event_id = $1
+	`, eventID, status, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record command result: %w", err)
+	}
+	return nil
+}
+
+// lockOrder is the order every multi-account transaction locks rows in:
+// customer accounts first, then system accounts, each by ID. Handlers that
+// post to one customer account update it before its system counter-account,
+// which is the same order.
+const lockOrder = `user_id LIKE 'sys:%', user_id`
+
+// LockBalances locks the balance rows of userIDs in lockOrder, so
+// transactions touching several accounts cannot deadlock each other.
+// Accounts that do not exist yet are skipped.
+func LockBalances(ctx context.Context, userIDs []string, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id FROM user_balances
+		WHERE user_id = ANY($1)
+		ORDER BY `+lockOrder+`
+		FOR UPDATE
+	`, userIDs)
+	if err != nil {
+		return fmt.Errorf("failed to lock balances: %w", err)
+	}
+	return rows.Close()
+}
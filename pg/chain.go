@@ -0,0 +1,193 @@
+package pg
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// chainKey is the unique index that stops two writers from giving an
+// account's entries the same sequence number.
+const chainKey = "ledger_entries_chain_key"
+
+// hashedEntry is the content an entry's hash covers, in a fixed field
+// order so the encoding is canonical. Amount and RecordedAt are encoded as
+// Postgres stores them, so a hash computed before the insert matches one
+// computed from the row read back.
+type hashedEntry struct {
+	Sequence       int64  `json:"sequence"`
+	PrevHash       string `json:"prev_hash"`
+	AccountID      string `json:"account_id"`
+	Operation      string `json:"operation"`
+	Amount         string `json:"amount"`
+	TransactionID  string `json:"transaction_id"`
+	CounterAccount string `json:"counter_account"`
+	Direction      string `json:"direction"`
+	Description    string `json:"description"`
+	Status         string `json:"status"`
+	Reverses       string `json:"reverses"`
+	RecordedAt     string `json:"recorded_at"`
+}
+
+// ComputeHash returns the hex SHA-256 of the entry's content and PrevHash.
+func (e LedgerEntry) ComputeHash() string {
+	data, _ := json.Marshal(hashedEntry{
+		Sequence:       e.Sequence,
+		PrevHash:       e.PrevHash,
+		AccountID:      e.AccountID,
+		Operation:      e.Operation,
+		Amount:         ledgerAmount(e.Amount),
+		TransactionID:  e.TransactionID,
+		CounterAccount: e.CounterAccount,
+		Direction:      e.Direction,
+		Description:    e.Description,
+		Status:         e.Status,
+		Reverses:       e.Reverses,
+		RecordedAt:     e.RecordedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ledgerAmount renders amount as the NUMERIC(20,4) ledger_entries stores.
+func ledgerAmount(amount float64) string {
+	rounded := math.Round(amount*1e4) / 1e4
+	if rounded == 0 {
+		rounded = 0 // not -0
+	}
+	return strconv.FormatFloat(rounded, 'f', 4, 64)
+}
+
+// chain links e onto head, the account's latest chained entry.
+func chain(e LedgerEntry, head LedgerEntry) LedgerEntry {
+	e.Sequence = head.Sequence + 1
+	e.PrevHash = head.Hash
+	e.Hash = e.ComputeHash()
+	return e
+}
+
+// chainHead returns accountID's latest chained entry, or a zero entry if
+// the account has none.
+func chainHead(ctx context.Context, accountID string, tx *sql.Tx) (LedgerEntry, error) {
+	var head LedgerEntry
+	err := conn(tx).QueryRowContext(ctx, `
+		SELECT sequence, hash FROM ledger_entries
+		WHERE account_id = $1 AND sequence IS NOT NULL
+		ORDER BY sequence DESC LIMIT 1
+	`, accountID).Scan(&head.Sequence, &head.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LedgerEntry{}, nil
+	}
+	if err != nil {
+		return LedgerEntry{}, fmt.Errorf("failed to read chain head of %s: %w", accountID, err)
+	}
+	return head, nil
+}
+
+// ChainBreak is the first point where an account's chain fails to verify.
+type ChainBreak struct {
+	Sequence int64  `json:"sequence"`
+	EntryID  int64  `json:"entry_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// ChainReport is the result of verifying an account's chain.
+type ChainReport struct {
+	AccountID string `json:"account_id"`
+	// Entries is how many chained entries were checked before the break,
+	// if any.
+	Entries int64 `json:"entries"`
+	// Unchained counts the account's entries written before chaining,
+	// which cannot be verified.
+	Unchained int64 `json:"unchained"`
+	// Head is the hash of the last verified entry.
+	Head  string      `json:"head,omitempty"`
+	Valid bool        `json:"valid"`
+	Break *ChainBreak `json:"break,omitempty"`
+}
+
+// chainVerifier checks entries fed to it in sequence order.
+type chainVerifier struct {
+	report ChainReport
+}
+
+// next checks e against the entries before it and returns false once the
+// chain has broken.
+func (v *chainVerifier) next(e LedgerEntry) bool {
+	want := v.report.Entries + 1
+	var reason string
+	switch {
+	case e.Sequence < want:
+		reason = fmt.Sprintf("sequence %d is repeated", e.Sequence)
+	case e.Sequence > want:
+		reason = fmt.Sprintf("entries %d to %d are missing", want, e.Sequence-1)
+	case e.PrevHash != v.report.Head:
+		reason = "prev_hash does not match the previous entry's hash"
+	case e.Hash != e.ComputeHash():
+		reason = "hash does not match the entry's content"
+	}
+	if reason != "" {
+		v.report.Break = &ChainBreak{Sequence: want, EntryID: e.ID, Reason: reason}
+		return false
+	}
+	v.report.Entries++
+	v.report.Head = e.Hash
+	return true
+}
+
+// VerifyChain walks accountID's chained entries in sequence order and
+// reports the first one that is missing, out of place, or altered.
+// Deleting an account's latest entries is only detectable against a head
+// hash kept elsewhere, such as a previous report.
+func VerifyChain(ctx context.Context, accountID string, tx *sql.Tx) (ChainReport, error) {
+	v := chainVerifier{report: ChainReport{AccountID: accountID}}
+
+	if err := conn(tx).QueryRowContext(ctx,
+		`SELECT count(*) FROM ledger_entries WHERE account_id = $1 AND sequence IS NULL`, accountID,
+	).Scan(&v.report.Unchained); err != nil {
+		return ChainReport{}, fmt.Errorf("failed to count unchained entries: %w", err)
+	}
+
+	rows, err := conn(tx).QueryContext(ctx,
+		`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE account_id = $1 AND sequence IS NOT NULL ORDER BY sequence`, accountID)
+	if err != nil {
+		return ChainReport{}, fmt.Errorf("failed to read ledger chain: %w", err)
+	}
+	entries, err := scanLedgerEntries(rows)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	for _, e := range entries {
+		if !v.next(e) {
+			return v.report, nil
+		}
+	}
+	v.report.Valid = true
+	return v.report, nil
+}
+
+// LedgerAccounts returns every account with ledger entries.
+func LedgerAccounts(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := conn(tx).QueryContext(ctx, `SELECT DISTINCT account_id FROM ledger_entries ORDER BY account_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ledger accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger account: %w", err)
+		}
+		accounts = append(accounts, id)
+	}
+	return accounts, rows.Err()
+}
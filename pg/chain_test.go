@@ -0,0 +1,135 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testChain(n int) []LedgerEntry {
+	var entries []LedgerEntry
+	head := LedgerEntry{}
+	at := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		e := chain(LedgerEntry{
+			ID:            int64(i + 1),
+			AccountID:     "acc_1",
+			Operation:     "AddBalance",
+			Amount:        float64(10 * (i + 1)),
+			TransactionID: fmt.Sprintf("txn-%d", i+1),
+			RecordedAt:    at.Add(time.Duration(i) * time.Minute),
+		}, head)
+		entries = append(entries, e)
+		head = e
+	}
+	return entries
+}
+
+func verify(entries []LedgerEntry) ChainReport {
+	v := chainVerifier{report: ChainReport{AccountID: "acc_1"}}
+	for _, e := range entries {
+		if !v.next(e) {
+			return v.report
+		}
+	}
+	v.report.Valid = true
+	return v.report
+}
+
+func TestChainLinksEntries(t *testing.T) {
+	entries := testChain(3)
+
+	assert.Equal(t, int64(1), entries[0].Sequence)
+	assert.Empty(t, entries[0].PrevHash)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Len(t, entries[2].Hash, 64)
+
+	report := verify(entries)
+	assert.True(t, report.Valid)
+	assert.Equal(t, int64(3), report.Entries)
+	assert.Equal(t, entries[2].Hash, report.Head)
+}
+
+func TestComputeHashMatchesStoredEntry(t *testing.T) {
+	e := testChain(1)[0]
+	stored := e
+	// NUMERIC(20,4) and TIMESTAMPTZ give back what was inserted, at their
+	// precision and in the session's time zone.
+	stored.Amount = 10.00001
+	stored.RecordedAt = e.RecordedAt.In(time.FixedZone("CET", 3600)).Add(400 * time.Nanosecond)
+
+	assert.Equal(t, e.ComputeHash(), stored.ComputeHash())
+}
+
+func TestLedgerAmount(t *testing.T) {
+	assert.Equal(t, "12.3400", ledgerAmount(12.34))
+	assert.Equal(t, "-0.7500", ledgerAmount(-0.75))
+	assert.Equal(t, "0.0000", ledgerAmount(-0.00001))
+	assert.Equal(t, "0.3333", ledgerAmount(1.0/3))
+}
+
+func TestVerifyChainReportsFirstBreak(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func([]LedgerEntry) []LedgerEntry
+		at     int64
+		reason string
+	}{
+		{"altered amount", func(es []LedgerEntry) []LedgerEntry {
+			es[1].Amount = 1000
+			return es
+		}, 2, "hash does not match the entry's content"},
+		{"deleted entry", func(es []LedgerEntry) []LedgerEntry {
+			return append(es[:1], es[2:]...)
+		}, 2, "entries 2 to 2 are missing"},
+		{"relinked entry", func(es []LedgerEntry) []LedgerEntry {
+			es[2].PrevHash = es[0].Hash
+			return es
+		}, 3, "prev_hash does not match the previous entry's hash"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			report := verify(c.tamper(testChain(4)))
+
+			assert.False(t, report.Valid)
+			require.NotNil(t, report.Break)
+			assert.Equal(t, c.at, report.Break.Sequence)
+			assert.Equal(t, c.reason, report.Break.Reason)
+			assert.Equal(t, c.at-1, report.Entries)
+		})
+	}
+}
+
+func TestInsertLedgerEntriesChainsEntries(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+
+	before, err := VerifyChain(ctx, CashClearingAccount, tx)
+	require.NoError(t, err)
+	require.True(t, before.Valid)
+
+	entries := []LedgerEntry{
+		{AccountID: CashClearingAccount, Operation: "AddBalance", Amount: 1.0 / 3, TransactionID: "chain-test-1"},
+		{AccountID: CashClearingAccount, Operation: "DeductBalance", Amount: -0.25, TransactionID: "chain-test-2"},
+	}
+	require.NoError(t, InsertLedgerEntries(ctx, entries, tx))
+
+	stored, err := ListTransactionEntries(ctx, "chain-test-2", tx)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, before.Entries+2, stored[0].Sequence)
+
+	report, err := VerifyChain(ctx, CashClearingAccount, tx)
+	require.NoError(t, err)
+	assert.True(t, report.Valid)
+	assert.Equal(t, before.Entries+2, report.Entries)
+	assert.Equal(t, stored[0].Hash, report.Head)
+}
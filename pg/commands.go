@@ -0,0 +1,27 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ClaimCommand records the command with eventID as handled and reports
+// whether this call recorded it. It returns false if the command was
+// already handled, by this or an earlier delivery. Call it first in the
+// transaction that applies the command, so the claim commits with it.
+func ClaimCommand(ctx context.Context, eventID, eventType string, tx *sql.Tx) (bool, error) {
+	res, err := conn(tx).ExecContext(ctx, `
+		INSERT INTO processed_commands (event_id, event_type)
+		VALUES ($1, $2)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim command %s: %w", eventID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim command %s: %w", eventID, err)
+	}
+	return n > 0, nil
+}
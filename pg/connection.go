@@ -1,6 +1,7 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -12,14 +13,14 @@ import (
 
 var DB *sql.DB
 
-func InitPostgres() {
+func InitPostgres(cfg config.PostgresConfig) {
 	dsn := fmt.Sprintf(
-		"user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
-		config.PostgresUser,
-		config.PostgresPassword,
-		config.PostgresDB,
-		config.PostgresHost,
-		config.PostgresPort,
+		"user=%s password=%s dbname=%s host=%s port=%d sslmode=disable",
+		cfg.User,
+		cfg.Password,
+		cfg.DB,
+		cfg.Host,
+		cfg.Port,
 	)
 
 	var err error
@@ -34,3 +35,19 @@ func InitPostgres() {
 
 	log.Println("✅ Connected to PostgreSQL")
 }
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn runs single statements in tx when one is given, otherwise directly
+// on DB.
+func conn(tx *sql.Tx) querier {
+	if tx != nil {
+		return tx
+	}
+	return DB
+}
@@ -0,0 +1,20 @@
+package pg
+
+import "errors"
+
+// ErrNotFound is returned when a row looked up by ID does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Errors returned when an account cannot take a balance change.
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountFrozen   = errors.New("account is frozen")
+	ErrAccountClosed   = errors.New("account is closed")
+)
+
+// ErrAccountExists is returned for creating an account whose ID is taken.
+var ErrAccountExists = errors.New("account already exists")
+
+// ErrAlreadyReversed is returned for recording a second reversal of a
+// transaction.
+var ErrAlreadyReversed = errors.New("journal entry already reversed")
@@ -0,0 +1,14 @@
+package pg
+
+import (
+	"context"
+	"errors"
+)
+
+// Ping checks that the Postgres connection pool can reach the database.
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("postgres is not initialized")
+	}
+	return DB.PingContext(ctx)
+}
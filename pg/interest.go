@@ -0,0 +1,174 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// dateLayout is how DATE columns are passed to Postgres.
+const dateLayout = "2006-01-02"
+
+// DayBalance is a savings account's balance at the end of a day.
+type DayBalance struct {
+	AccountID    string
+	InterestPlan string
+	Balance      float64
+}
+
+// InterestAccrual is one day's interest on an account.
+type InterestAccrual struct {
+	AccountID  string     `json:"account_id"`
+	Date       time.Time  `json:"date"`
+	Plan       string     `json:"plan"`
+	AnnualRate float64    `json:"annual_rate"`
+	Balance    float64    `json:"balance"`
+	Amount     float64    `json:"amount"`
+	PostingID  string     `json:"posting_id,omitempty"`
+	PostedAt   *time.Time `json:"posted_at,omitempty"`
+}
+
+// LastAccrualDate returns the latest accrued day, or the zero time if no
+// day has been accrued yet.
+func LastAccrualDate(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	var last sql.NullTime
+	err := conn(tx).QueryRowContext(ctx, `SELECT MAX(accrual_date) FROM interest_accrual_runs`).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read last accrual date: %w", err)
+	}
+	return last.Time, nil
+}
+
+// SavingsBalancesAt returns the balance every open savings account held
+// at end, read from balance_history. Accounts with no history before end
+// did not exist yet and are left out.
+func SavingsBalancesAt(ctx context.Context, end time.Time, tx *sql.Tx) ([]DayBalance, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT DISTINCT ON (h.account_id) h.account_id, b.interest_plan, h.balance
+		FROM balance_history h
+		JOIN user_balances b ON b.user_id = h.account_id
+		WHERE b.type = 'savings' AND b.status <> 'closed' AND h.changed_at < $1
+		ORDER BY h.account_id, h.changed_at DESC, h.id DESC
+	`, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read end-of-day balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []DayBalance
+	for rows.Next() {
+		var b DayBalance
+		if err := rows.Scan(&b.AccountID, &b.InterestPlan, &b.Balance); err != nil {
+			return nil, fmt.Errorf("failed to scan end-of-day balance: %w", err)
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// InsertAccrualRun marks day as accrued with its account count and total.
+// It returns false, inserting nothing, if the day was already accrued; the
+// caller must then roll back its accruals.
+func InsertAccrualRun(ctx context.Context, day time.Time, accounts int, total float64, tx *sql.Tx) (bool, error) {
+	result, err := conn(tx).ExecContext(ctx, `
+		INSERT INTO interest_accrual_runs (accrual_date, accounts, total)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (accrual_date) DO NOTHING
+	`, day.Format(dateLayout), accounts, total)
+	if err != nil {
+		return false, fmt.Errorf("failed to record accrual run: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return n == 1, nil
+}
+
+// InsertInterestAccruals stores a day's accruals.
+func InsertInterestAccruals(ctx context.Context, accruals []InterestAccrual, tx *sql.Tx) error {
+	for _, a := range accruals {
+		_, err := conn(tx).ExecContext(ctx, `
+			INSERT INTO interest_accruals (account_id, accrual_date, plan, annual_rate, balance, amount)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, a.AccountID, a.Date.Format(dateLayout), a.Plan, a.AnnualRate, a.Balance, a.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to insert interest accrual: %w", err)
+		}
+	}
+	return nil
+}
+
+// AccountsWithUnpostedInterest returns the open accounts with unposted
+// accruals dated before before.
+func AccountsWithUnpostedInterest(ctx context.Context, before time.Time, tx *sql.Tx) ([]string, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT DISTINCT a.account_id
+		FROM interest_accruals a
+		JOIN user_balances b ON b.user_id = a.account_id
+		WHERE a.posted_at IS NULL AND a.accrual_date < $1 AND b.status <> 'closed'
+		ORDER BY a.account_id
+	`, before.Format(dateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unposted interest: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan account ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ClaimUnpostedInterest marks an account's unposted accruals dated before
+// before as posted by postingID and returns their first and last dates and
+// total. A concurrent claim of the same rows waits for this one and then
+// finds nothing, so each accrual is posted once. It returns a zero total if
+// there was nothing to claim.
+func ClaimUnpostedInterest(ctx context.Context, accountID string, before time.Time, postingID string, tx *sql.Tx) (from, through time.Time, total float64, err error) {
+	var first, last sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		WITH claimed AS (
+			UPDATE interest_accruals
+			SET posting_id = $3, posted_at = now()
+			WHERE account_id = $1 AND accrual_date < $2 AND posted_at IS NULL
+			RETURNING accrual_date, amount
+		)
+		SELECT MIN(accrual_date), MAX(accrual_date), COALESCE(SUM(amount), 0) FROM claimed
+	`, accountID, before.Format(dateLayout), postingID).Scan(&first, &last, &total)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, fmt.Errorf("failed to claim interest accruals: %w", err)
+	}
+	return first.Time, last.Time, total, nil
+}
+
+// ListInterestAccruals returns an account's accruals dated from from up to
+// and including through, oldest first.
+func ListInterestAccruals(ctx context.Context, accountID string, from, through time.Time, tx *sql.Tx) ([]InterestAccrual, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT account_id, accrual_date, plan, annual_rate, balance, amount, COALESCE(posting_id, ''), posted_at
+		FROM interest_accruals
+		WHERE account_id = $1 AND accrual_date BETWEEN $2 AND $3
+		ORDER BY accrual_date
+	`, accountID, from.Format(dateLayout), through.Format(dateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interest accruals: %w", err)
+	}
+	defer rows.Close()
+
+	accruals := []InterestAccrual{}
+	for rows.Next() {
+		var a InterestAccrual
+		if err := rows.Scan(&a.AccountID, &a.Date, &a.Plan, &a.AnnualRate, &a.Balance, &a.Amount, &a.PostingID, &a.PostedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan interest accrual: %w", err)
+		}
+		accruals = append(accruals, a)
+	}
+	return accruals, rows.Err()
+}
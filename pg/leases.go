@@ -0,0 +1,40 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AcquireLease takes or renews the lease called name for owner until ttl
+// from now, by the database clock so replicas' clocks need not agree. It
+// returns false if another owner holds a lease that has not expired.
+func AcquireLease(ctx context.Context, name, owner string, ttl time.Duration, tx *sql.Tx) (bool, error) {
+	var holder string
+	err := conn(tx).QueryRowContext(ctx, `
+		INSERT INTO job_leases (name, owner, expires_at)
+		VALUES ($1, $2, now() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE job_leases.owner = EXCLUDED.owner OR job_leases.expires_at < now()
+		RETURNING owner
+	`, name, owner, ttl.Seconds()).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// ReleaseLease gives up owner's lease so another replica can take over
+// without waiting for it to expire.
+func ReleaseLease(ctx context.Context, name, owner string, tx *sql.Tx) error {
+	_, err := conn(tx).ExecContext(ctx, `DELETE FROM job_leases WHERE name = $1 AND owner = $2`, name, owner)
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Account classes of the chart of accounts. Assets and expenses carry
+// debit balances; liabilities, equity and revenue carry credit balances.
+const (
+	ClassAsset     = "asset"
+	ClassLiability = "liability"
+	ClassEquity    = "equity"
+	ClassRevenue   = "revenue"
+	ClassExpense   = "expense"
+)
+
+// System accounts, the counter-accounts of customer postings. Their IDs
+// share SystemAccountPrefix, which customer accounts cannot use.
+const (
+	SystemAccountPrefix    = "sys:"
+	CashClearingAccount    = "sys:cash_clearing"
+	FeeRevenueAccount      = "sys:fee_revenue"
+	SuspenseAccount        = "sys:suspense"
+	InterestExpenseAccount = "sys:interest_expense"
+)
+
+// AccountSystem is the type of system accounts.
+const AccountSystem = "system"
+
+// LedgerCode is an entry of the chart of accounts.
+type LedgerCode struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+// LedgerCodeBalance is the summed balance of every account under a code.
+// Balances are stored on each account's normal side, so a positive balance
+// is a debit for assets and expenses and a credit otherwise.
+type LedgerCodeBalance struct {
+	LedgerCode
+	Balance float64
+}
+
+// ListChartOfAccounts returns the chart of accounts ordered by code.
+func ListChartOfAccounts(ctx context.Context, tx *sql.Tx) ([]LedgerCode, error) {
+	rows, err := conn(tx).QueryContext(ctx, `SELECT code, name, class FROM chart_of_accounts ORDER BY code`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chart of accounts: %w", err)
+	}
+	defer rows.Close()
+
+	codes := []LedgerCode{}
+	for rows.Next() {
+		var c LedgerCode
+		if err := rows.Scan(&c.Code, &c.Name, &c.Class); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger code: %w", err)
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// LedgerCodeBalances sums account balances per ledger code, in one
+// snapshot so concurrent postings cannot unbalance the result.
+func LedgerCodeBalances(ctx context.Context, tx *sql.Tx) ([]LedgerCodeBalance, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT c.code, c.name, c.class, COALESCE(SUM(b.balance), 0)
+		FROM chart_of_accounts c
+		LEFT JOIN user_balances b ON b.ledger_code = c.code
+		GROUP BY c.code, c.name, c.class
+		ORDER BY c.code
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []LedgerCodeBalance{}
+	for rows.Next() {
+		var b LedgerCodeBalance
+		if err := rows.Scan(&b.Code, &b.Name, &b.Class, &b.Balance); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger balance: %w", err)
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
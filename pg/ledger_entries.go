@@ -0,0 +1,193 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// LedgerEntry is one append-only ledger line: a balance change of one
+// account, or an account lifecycle change with a zero amount.
+type LedgerEntry struct {
+	ID             int64     `json:"id"`
+	AccountID      string    `json:"account_id"`
+	Operation      string    `json:"operation"`
+	Amount         float64   `json:"amount"`
+	TransactionID  string    `json:"transaction_id"`
+	CounterAccount string    `json:"counter_account,omitempty"`
+	Direction      string    `json:"direction,omitempty"`
+	Description    string    `json:"description,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	Reverses       string    `json:"reverses,omitempty"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	// Sequence, PrevHash and Hash chain the entry to the account's
+	// previous one. Sequence is 0 for entries written before chaining.
+	Sequence int64  `json:"sequence,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+const ledgerEntryColumns = `id, account_id, operation, amount, transaction_id, counter_account, direction,
+	description, status, reverses, recorded_at, COALESCE(sequence, 0), prev_hash, hash`
+
+// InsertLedgerEntries appends entries and queues their transactions for
+// projection into MongoDB. An entry already recorded, by transaction,
+// account and operation, is skipped. A second reversal of a transaction
+// fails with ErrAlreadyReversed. Entries without RecordedAt are stamped with
+// the transaction's time.
+//
+// Each entry is chained onto its account's latest one. tx should be
+// serializable: two writers reading the same chain head then fail with a
+// serialization failure, or collide on the chain's unique index, and are
+// retried.
+func InsertLedgerEntries(ctx context.Context, entries []LedgerEntry, tx *sql.Tx) error {
+	var now time.Time
+	var queued []string
+	for _, e := range entries {
+		if e.RecordedAt.IsZero() {
+			if now.IsZero() {
+				if err := conn(tx).QueryRowContext(ctx, `SELECT now()`).Scan(&now); err != nil {
+					return fmt.Errorf("failed to read transaction time: %w", err)
+				}
+			}
+			e.RecordedAt = now
+		}
+		// Stored as Postgres stores them, so the hash reads back the same.
+		e.RecordedAt = e.RecordedAt.Truncate(time.Microsecond)
+		head, err := chainHead(ctx, e.AccountID, tx)
+		if err != nil {
+			return err
+		}
+		e = chain(e, head)
+
+		res, err := conn(tx).ExecContext(ctx, `
+			INSERT INTO ledger_entries (account_id, operation, amount, transaction_id, counter_account, direction, description, status, reverses, recorded_at,
+				sequence, prev_hash, hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (transaction_id, account_id, operation) DO NOTHING
+		`, e.AccountID, e.Operation, ledgerAmount(e.Amount), e.TransactionID, e.CounterAccount, e.Direction, e.Description, e.Status, e.Reverses, e.RecordedAt,
+			e.Sequence, e.PrevHash, e.Hash)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == sqlStateUniqueViolation && pgErr.ConstraintName == "ledger_entries_reverses_key" {
+			return fmt.Errorf("transaction %s: %w", e.Reverses, ErrAlreadyReversed)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to insert ledger entry: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 && !slices.Contains(queued, e.TransactionID) {
+			queued = append(queued, e.TransactionID)
+		}
+	}
+	for _, id := range queued {
+		if _, err := conn(tx).ExecContext(ctx,
+			`INSERT INTO ledger_projection_queue (transaction_id) VALUES ($1)`, id); err != nil {
+			return fmt.Errorf("failed to queue ledger projection: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListAccountEntries returns an account's entries, oldest first.
+func ListAccountEntries(ctx context.Context, accountID string, tx *sql.Tx) ([]LedgerEntry, error) {
+	rows, err := conn(tx).QueryContext(ctx,
+		`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE account_id = $1 ORDER BY recorded_at, id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger entries: %w", err)
+	}
+	return scanLedgerEntries(rows)
+}
+
+// ListTransactionEntries returns the entries of one transaction in the
+// order they were recorded.
+func ListTransactionEntries(ctx context.Context, transactionID string, tx *sql.Tx) ([]LedgerEntry, error) {
+	rows, err := conn(tx).QueryContext(ctx,
+		`SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE transaction_id = $1 ORDER BY id`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger entries: %w", err)
+	}
+	return scanLedgerEntries(rows)
+}
+
+// FindReversal returns the ID of the transaction that reverses
+// transactionID, if there is one.
+func FindReversal(ctx context.Context, transactionID string, tx *sql.Tx) (string, bool, error) {
+	var reversal string
+	err := conn(tx).QueryRowContext(ctx,
+		`SELECT transaction_id FROM ledger_entries WHERE reverses = $1 LIMIT 1`, transactionID).Scan(&reversal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up reversal: %w", err)
+	}
+	return reversal, true, nil
+}
+
+func scanLedgerEntries(rows *sql.Rows) ([]LedgerEntry, error) {
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.AccountID, &e.Operation, &e.Amount, &e.TransactionID, &e.CounterAccount,
+			&e.Direction, &e.Description, &e.Status, &e.Reverses, &e.RecordedAt,
+			&e.Sequence, &e.PrevHash, &e.Hash); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ProjectionItem is a transaction queued for projection into MongoDB.
+type ProjectionItem struct {
+	ID            int64
+	TransactionID string
+}
+
+// ListProjectionQueue returns up to limit queued transactions in the order
+// their entries were written.
+func ListProjectionQueue(ctx context.Context, limit int, tx *sql.Tx) ([]ProjectionItem, error) {
+	rows, err := conn(tx).QueryContext(ctx,
+		`SELECT id, transaction_id FROM ledger_projection_queue ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger projection queue: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ProjectionItem{}
+	for rows.Next() {
+		var item ProjectionItem
+		if err := rows.Scan(&item.ID, &item.TransactionID); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger projection: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// DeleteProjection removes a projected transaction from the queue.
+func DeleteProjection(ctx context.Context, id int64, tx *sql.Tx) error {
+	if _, err := conn(tx).ExecContext(ctx, `DELETE FROM ledger_projection_queue WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to dequeue ledger projection: %w", err)
+	}
+	return nil
+}
+
+// RequeueAllProjections queues every transaction in ledger_entries for
+// projection again, oldest first, and returns how many were queued.
+func RequeueAllProjections(ctx context.Context, tx *sql.Tx) (int64, error) {
+	res, err := conn(tx).ExecContext(ctx, `
+		INSERT INTO ledger_projection_queue (transaction_id)
+		SELECT transaction_id FROM ledger_entries GROUP BY transaction_id ORDER BY min(id)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue ledger projections: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,122 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB points DB at the Postgres named by LEDGER_TEST_POSTGRES_DSN
+// and migrates it, skipping the test when the variable is unset.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("LEDGER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LEDGER_TEST_POSTGRES_DSN is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	previous := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = previous
+		_ = db.Close()
+	})
+	_, err = MigrateUp(context.Background())
+	require.NoError(t, err)
+}
+
+func TestLedgerEntriesMigrationGuardsEveryMutation(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	var up string
+	for _, m := range migrations {
+		if m.Name == "create_ledger_entries" {
+			up = m.Up
+		}
+	}
+	require.NotEmpty(t, up)
+	for _, event := range []string{"BEFORE UPDATE ON ledger_entries", "BEFORE DELETE ON ledger_entries", "BEFORE TRUNCATE ON ledger_entries"} {
+		assert.Contains(t, up, event)
+	}
+}
+
+func TestLedgerEntriesRejectMutation(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+
+	entry := LedgerEntry{AccountID: CashClearingAccount, Operation: "AddBalance", Amount: 10, TransactionID: "append-only-test"}
+	require.NoError(t, InsertLedgerEntries(ctx, []LedgerEntry{entry}, tx))
+	// A replay of the same entry is skipped, not an error.
+	require.NoError(t, InsertLedgerEntries(ctx, []LedgerEntry{entry}, tx))
+
+	for _, stmt := range []string{
+		`UPDATE ledger_entries SET amount = 0 WHERE transaction_id = 'append-only-test'`,
+		`DELETE FROM ledger_entries WHERE transaction_id = 'append-only-test'`,
+		`TRUNCATE ledger_entries`,
+	} {
+		t.Run(strings.Fields(stmt)[0], func(t *testing.T) {
+			_, err := tx.ExecContext(ctx, `SAVEPOINT mutation`)
+			require.NoError(t, err)
+
+			_, err = tx.ExecContext(ctx, stmt)
+			assert.ErrorContains(t, err, "ledger_entries is append-only")
+
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT mutation`)
+			require.NoError(t, err)
+		})
+	}
+
+	entries, err := ListTransactionEntries(ctx, "append-only-test", tx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 10.0, entries[0].Amount)
+}
+
+func TestInsertLedgerEntriesQueuesProjectionOnce(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+
+	entries := []LedgerEntry{
+		{AccountID: CashClearingAccount, Operation: "PostJournalEntry", Amount: -5, TransactionID: "projection-test"},
+		{AccountID: FeeRevenueAccount, Operation: "PostJournalEntry", Amount: 5, TransactionID: "projection-test"},
+	}
+	require.NoError(t, InsertLedgerEntries(ctx, entries, tx))
+	require.NoError(t, InsertLedgerEntries(ctx, entries, tx))
+
+	var queued int
+	require.NoError(t, tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM ledger_projection_queue WHERE transaction_id = 'projection-test'`).Scan(&queued))
+	assert.Equal(t, 1, queued)
+}
+
+func TestInsertLedgerEntriesRefusesSecondReversal(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() { _ = tx.Rollback() }()
+
+	first := LedgerEntry{AccountID: CashClearingAccount, Operation: "PostJournalEntry", Amount: 5, TransactionID: "reversal-1", Reverses: "reversed-entry"}
+	require.NoError(t, InsertLedgerEntries(ctx, []LedgerEntry{first}, tx))
+
+	second := first
+	second.TransactionID = "reversal-2"
+	err = InsertLedgerEntries(ctx, []LedgerEntry{second}, tx)
+	assert.ErrorIs(t, err, ErrAlreadyReversed)
+}
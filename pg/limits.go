@@ -0,0 +1,44 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DebitUsage returns how many debits accountID made, and how much they
+// totalled, within window of now. Usage is counted by the minute, so the
+// window's start is rounded down to one.
+func DebitUsage(ctx context.Context, accountID string, window time.Duration, tx *sql.Tx) (count int, amount float64, err error) {
+	err = conn(tx).QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(debits), 0), COALESCE(SUM(amount), 0) FROM velocity_counters
+		WHERE account_id = $1 AND bucket >= date_trunc('minute', now() - make_interval(secs => $2))
+	`, accountID, window.Seconds()).Scan(&count, &amount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read debit usage: %w", err)
+	}
+	return count, amount, nil
+}
+
+// RecordDebit counts a debit of amount against accountID in the current
+// minute and drops the account's counters older than retention.
+func RecordDebit(ctx context.Context, accountID string, amount float64, retention time.Duration, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO velocity_counters (account_id, bucket, debits, amount)
+		VALUES ($1, date_trunc('minute', now()), 1, $2)
+		ON CONFLICT (account_id, bucket) DO UPDATE
+		SET debits = velocity_counters.debits + 1, amount = velocity_counters.amount + EXCLUDED.amount
+	`, accountID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to record debit: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM velocity_counters
+		WHERE account_id = $1 AND bucket < date_trunc('minute', now() - make_interval(secs => $2))
+	`, accountID, retention.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to prune debit counters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the pg_advisory_lock key held while migrating so
+// replicas starting together don't apply the same migration twice.
+const migrationLockKey int64 = 7_340_202_501
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with its rollback.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState pairs a migration with when it was applied, if at all.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// ErrSchemaOutOfDate is returned by CheckSchemaCurrent when migrations are
+// pending or the database is ahead of this binary.
+var ErrSchemaOutOfDate = errors.New("database schema is out of date")
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns how many were applied.
+func MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations(version, name) VALUES ($1, $2)`, m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s up failed: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %d_%s", m.Version, m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown rolls back the most recently applied steps migrations.
+func MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	reverted := 0
+	err = withMigrationLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(done))
+		for v := range done {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, v := range versions {
+			if reverted == steps {
+				break
+			}
+			m, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("applied migration %d is unknown to this binary", v)
+			}
+			if err := runMigration(ctx, conn, m.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s down failed: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Reverted migration %d_%s", m.Version, m.Name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists every known migration and whether it is applied.
+func MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if at, ok := done[m.Version]; ok {
+			at := at
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// CheckSchemaCurrent returns ErrSchemaOutOfDate unless exactly the embedded
+// migrations have been applied.
+func CheckSchemaCurrent(ctx context.Context) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	known := make(map[int64]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+		if _, ok := done[m.Version]; !ok {
+			return fmt.Errorf("%w: migration %d_%s is pending", ErrSchemaOutOfDate, m.Version, m.Name)
+		}
+	}
+	for v := range done {
+		if !known[v] {
+			return fmt.Errorf("%w: database has migration %d which this binary does not know", ErrSchemaOutOfDate, v)
+		}
+	}
+	return nil
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock. Session-level locks are tied to the connection, so the
+// same *sql.Conn must be used for locking, migrating and unlocking.
+func withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// runMigration executes script and the bookkeeping statement atomically.
+func runMigration(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// appliedVersions returns applied migration versions and when they ran. A
+// missing schema_migrations table means nothing has been applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx,
+		`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check schema_migrations: %w", err)
+	}
+	done := map[int64]time.Time{}
+	if !exists {
+		return done, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
@@ -0,0 +1,55 @@
+package pg
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := Migrations()
+
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(t, migrations[i-1].Version, migrations[i].Version)
+	}
+}
+
+func TestLoadMigrationsOrdersAndPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("up 2")},
+		"m/0002_second.down.sql": {Data: []byte("down 2")},
+		"m/0001_first.up.sql":    {Data: []byte("up 1")},
+		"m/0001_first.down.sql":  {Data: []byte("down 1")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "first", Up: "up 1", Down: "down 1"}, migrations[0])
+	assert.Equal(t, int64(2), migrations[1].Version)
+}
+
+func TestLoadMigrationsRejectsIncompletePairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0001_first.up.sql": {Data: []byte("up 1")},
+	}
+
+	_, err := loadMigrations(fsys, "m")
+
+	assert.ErrorContains(t, err, "must have both up and down files")
+}
+
+func TestLoadMigrationsRejectsBadNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/first.sql": {Data: []byte("up 1")},
+	}
+
+	_, err := loadMigrations(fsys, "m")
+
+	assert.ErrorContains(t, err, "unexpected migration file name")
+}
@@ -0,0 +1,14 @@
+-- Domain events are written here in the same transaction as the balance
+-- change that caused them, then relayed to Kafka.
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT NOT NULL UNIQUE,
+    topic TEXT NOT NULL,
+    message_key TEXT NOT NULL,
+    headers JSONB NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
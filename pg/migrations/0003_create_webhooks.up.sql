@@ -0,0 +1,48 @@
+-- Partner endpoints notified of domain events. An endpoint without an
+-- account_id receives events for every account.
+CREATE TABLE webhook_endpoints (
+    id BIGSERIAL PRIMARY KEY,
+    account_id TEXT,
+    client_id TEXT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    -- Subscribed event types; an empty array subscribes to all of them.
+    event_types JSONB NOT NULL DEFAULT '[]',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (account_id IS NOT NULL OR client_id IS NOT NULL)
+);
+
+CREATE INDEX webhook_endpoints_account_idx ON webhook_endpoints (account_id) WHERE active;
+
+-- One row per event per endpoint, enqueued in the same transaction as the
+-- event itself and updated as it is attempted.
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints (id),
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT NOT NULL DEFAULT '',
+    response_status INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ,
+    UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- Every attempt of every delivery, including those before a manual re-send.
+CREATE TABLE webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries (id),
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    response_status INT NOT NULL,
+    error TEXT NOT NULL,
+    duration_ms BIGINT NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id);
@@ -0,0 +1,21 @@
+-- Bulk postings submitted through POST /batches.
+CREATE TABLE batches (
+    id TEXT PRIMARY KEY,
+    all_or_nothing BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One row per batch item. event_id is the ID of the command the item was
+-- sent as, which the consumer uses to record the item's result.
+CREATE TABLE batch_items (
+    batch_id TEXT NOT NULL REFERENCES batches (id),
+    item_index INT NOT NULL,
+    event_id TEXT NOT NULL UNIQUE,
+    operation TEXT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    amount NUMERIC(20,4) NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'applied', 'rejected')),
+    error TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (batch_id, item_index)
+);
@@ -0,0 +1,5 @@
+-- Lifecycle status of an account. Only active accounts accept credits and
+-- debits; closed is final.
+ALTER TABLE user_balances
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'frozen', 'closed'));
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS user_balances_owner_id_idx;
+ALTER TABLE user_balances
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS labels,
+    DROP COLUMN IF EXISTS type,
+    DROP COLUMN IF EXISTS name,
+    DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,16 @@
+-- Account metadata. user_id is the account's ID: existing accounts keep
+-- their user ID, further accounts get generated IDs. owner_id is the user
+-- holding the account, so one user can hold several accounts.
+ALTER TABLE user_balances
+    ADD COLUMN owner_id VARCHAR(255),
+    ADD COLUMN name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN type TEXT NOT NULL DEFAULT 'wallet'
+        CHECK (type IN ('wallet', 'savings', 'escrow')),
+    ADD COLUMN labels JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE user_balances SET owner_id = user_id;
+ALTER TABLE user_balances ALTER COLUMN owner_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS user_balances_owner_id_idx ON user_balances(owner_id, created_at);
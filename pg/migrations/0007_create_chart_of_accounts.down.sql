@@ -0,0 +1,6 @@
+DELETE FROM user_balances WHERE type = 'system';
+ALTER TABLE user_balances DROP CONSTRAINT user_balances_type_check;
+ALTER TABLE user_balances ADD CONSTRAINT user_balances_type_check
+    CHECK (type IN ('wallet', 'savings', 'escrow'));
+ALTER TABLE user_balances DROP COLUMN IF EXISTS ledger_code;
+DROP TABLE IF EXISTS chart_of_accounts;
@@ -0,0 +1,31 @@
+-- General ledger codes. Every account rolls up to one code; customer
+-- accounts are liabilities (money the ledger owes its users).
+CREATE TABLE IF NOT EXISTS chart_of_accounts (
+    code  TEXT PRIMARY KEY,
+    name  TEXT NOT NULL,
+    class TEXT NOT NULL CHECK (class IN ('asset', 'liability', 'equity', 'revenue', 'expense'))
+);
+
+INSERT INTO chart_of_accounts(code, name, class) VALUES
+    ('1000', 'Cash-in clearing', 'asset'),
+    ('2000', 'Customer accounts', 'liability'),
+    ('2900', 'Suspense', 'liability'),
+    ('4000', 'Fee revenue', 'revenue'),
+    ('5000', 'Operating expenses', 'expense');
+
+ALTER TABLE user_balances
+    ADD COLUMN ledger_code TEXT NOT NULL DEFAULT '2000' REFERENCES chart_of_accounts(code);
+
+ALTER TABLE user_balances DROP CONSTRAINT user_balances_type_check;
+ALTER TABLE user_balances ADD CONSTRAINT user_balances_type_check
+    CHECK (type IN ('wallet', 'savings', 'escrow', 'system'));
+
+-- Existing customer balances were funded from outside the ledger; book
+-- them against cash-in clearing so the trial balance starts balanced.
+INSERT INTO user_balances(user_id, owner_id, name, type, ledger_code, balance)
+SELECT 'sys:cash_clearing', 'system', 'Cash-in clearing', 'system', '1000', COALESCE(SUM(balance), 0)
+FROM user_balances;
+
+INSERT INTO user_balances(user_id, owner_id, name, type, ledger_code, balance) VALUES
+    ('sys:suspense', 'system', 'Suspense', 'system', '2900', 0),
+    ('sys:fee_revenue', 'system', 'Fee revenue', 'system', '4000', 0);
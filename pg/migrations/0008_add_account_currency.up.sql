@@ -0,0 +1,4 @@
+-- ISO 4217 currency an account is held in. Journal entry legs must match
+-- it.
+ALTER TABLE user_balances
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS interest_accrual_runs;
+DROP TABLE IF EXISTS interest_accruals;
+DELETE FROM user_balances WHERE user_id = 'sys:interest_expense';
+DELETE FROM chart_of_accounts WHERE code = '5100';
+DROP TRIGGER IF EXISTS user_balances_history_update ON user_balances;
+DROP TRIGGER IF EXISTS user_balances_history_insert ON user_balances;
+DROP FUNCTION IF EXISTS record_balance_history();
+DROP TABLE IF EXISTS balance_history;
+ALTER TABLE user_balances DROP COLUMN IF EXISTS interest_plan;
@@ -0,0 +1,60 @@
+-- Rate plan an account earns interest under; empty means the configured
+-- default plan.
+ALTER TABLE user_balances ADD COLUMN interest_plan TEXT NOT NULL DEFAULT '';
+
+-- Every balance an account has held, so interest can accrue on the balance
+-- at the end of a day that has long passed, e.g. after downtime.
+CREATE TABLE balance_history (
+    id BIGSERIAL PRIMARY KEY,
+    account_id VARCHAR(255) NOT NULL,
+    balance NUMERIC(20,4) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+);
+CREATE INDEX balance_history_account_idx ON balance_history (account_id, changed_at);
+
+CREATE FUNCTION record_balance_history() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO balance_history (account_id, balance) VALUES (NEW.user_id, NEW.balance);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_balances_history_insert
+    AFTER INSERT ON user_balances
+    FOR EACH ROW EXECUTE FUNCTION record_balance_history();
+CREATE TRIGGER user_balances_history_update
+    AFTER UPDATE OF balance ON user_balances
+    FOR EACH ROW WHEN (OLD.balance IS DISTINCT FROM NEW.balance)
+    EXECUTE FUNCTION record_balance_history();
+
+-- History starts now: earlier days have no known end-of-day balance.
+INSERT INTO balance_history (account_id, balance) SELECT user_id, balance FROM user_balances;
+
+-- One row per account and day that accrued interest. Rows are posted in
+-- monthly InterestCredit postings; posting_id is the posting's event ID.
+CREATE TABLE interest_accruals (
+    account_id VARCHAR(255) NOT NULL REFERENCES user_balances (user_id),
+    accrual_date DATE NOT NULL,
+    plan TEXT NOT NULL,
+    annual_rate NUMERIC(9,4) NOT NULL,
+    balance NUMERIC(20,4) NOT NULL,
+    amount NUMERIC(24,10) NOT NULL,
+    posting_id TEXT,
+    posted_at TIMESTAMPTZ,
+    PRIMARY KEY (account_id, accrual_date)
+);
+CREATE INDEX interest_accruals_unposted_idx ON interest_accruals (accrual_date) WHERE posted_at IS NULL;
+
+-- Days that have been accrued. A day is accrued by whichever replica
+-- inserts its row first, in the same transaction as its accruals.
+CREATE TABLE interest_accrual_runs (
+    accrual_date DATE PRIMARY KEY,
+    accounts INT NOT NULL,
+    total NUMERIC(24,10) NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Interest is an expense of the ledger, credited to customer accounts.
+INSERT INTO chart_of_accounts(code, name, class) VALUES ('5100', 'Interest expense', 'expense');
+INSERT INTO user_balances(user_id, owner_id, name, type, ledger_code, balance)
+VALUES ('sys:interest_expense', 'system', 'Interest expense', 'system', '5100', 0);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_leases;
+DROP TABLE IF EXISTS payment_schedule_runs;
+DROP TABLE IF EXISTS payment_schedules;
@@ -0,0 +1,43 @@
+-- Standing orders: a deposit, withdrawal or transfer sent once at start_at or
+-- on every occurrence of a cron expression. next_run_at is the occurrence
+-- the scheduler fires next.
+CREATE TABLE payment_schedules (
+    id TEXT PRIMARY KEY,
+    account_id VARCHAR(255) NOT NULL REFERENCES user_balances (user_id),
+    kind TEXT NOT NULL CHECK (kind IN ('deposit', 'withdrawal', 'transfer')),
+    to_account_id VARCHAR(255) REFERENCES user_balances (user_id),
+    amount NUMERIC(20,4) NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    cron TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMPTZ NOT NULL,
+    end_at TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'paused', 'completed', 'cancelled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK ((kind = 'transfer') = (to_account_id IS NOT NULL))
+);
+CREATE INDEX payment_schedules_due_idx ON payment_schedules (next_run_at) WHERE status = 'active';
+CREATE INDEX payment_schedules_account_idx ON payment_schedules (account_id, created_at);
+
+-- One row per fired occurrence. event_id is the ID of the command it sent,
+-- which the consumer uses to record whether the command was applied.
+CREATE TABLE payment_schedule_runs (
+    id BIGSERIAL PRIMARY KEY,
+    schedule_id TEXT NOT NULL REFERENCES payment_schedules (id),
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    event_id TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'applied', 'rejected')),
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (schedule_id, scheduled_for)
+);
+
+-- Time-limited ownership of a background job, so only one replica runs it.
+CREATE TABLE job_leases (
+    name TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Debits per account per minute, summed over a rule's window to enforce
+-- velocity limits. Buckets older than the longest window are pruned as
+-- accounts make new debits.
+CREATE TABLE velocity_counters (
+    account_id VARCHAR(255) NOT NULL REFERENCES user_balances (user_id),
+    bucket TIMESTAMPTZ NOT NULL,
+    debits INTEGER NOT NULL,
+    amount NUMERIC(20,4) NOT NULL,
+    PRIMARY KEY (account_id, bucket)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS reject_ledger_mutation();
@@ -0,0 +1,36 @@
+-- Append-only mirror of the ledger records kept in MongoDB. Rows can only
+-- be inserted: a mistake is corrected by a new, compensating entry whose
+-- reverses column names the entry it undoes.
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    account_id VARCHAR(255) NOT NULL REFERENCES user_balances (user_id),
+    operation TEXT NOT NULL,
+    amount NUMERIC(20,4) NOT NULL,
+    transaction_id TEXT NOT NULL,
+    counter_account TEXT NOT NULL DEFAULT '',
+    direction TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT '',
+    reverses TEXT NOT NULL DEFAULT '',
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (transaction_id, account_id, operation)
+);
+CREATE INDEX ledger_entries_account_idx ON ledger_entries (account_id, id);
+CREATE INDEX ledger_entries_reverses_idx ON ledger_entries (reverses) WHERE reverses <> '';
+
+CREATE FUNCTION reject_ledger_mutation() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger_entries is append-only: % is not allowed', TG_OP
+        USING HINT = 'Post a compensating entry instead.';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_no_update
+    BEFORE UPDATE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_mutation();
+CREATE TRIGGER ledger_entries_no_delete
+    BEFORE DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_mutation();
+CREATE TRIGGER ledger_entries_no_truncate
+    BEFORE TRUNCATE ON ledger_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_ledger_mutation();
@@ -0,0 +1,8 @@
+-- Transactions whose ledger_entries are still to be projected into the
+-- MongoDB read model. Rows are added in the transaction that writes the
+-- entries and removed once the projector has written them.
+CREATE TABLE ledger_projection_queue (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id TEXT NOT NULL,
+    enqueued_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
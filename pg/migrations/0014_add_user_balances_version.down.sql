@@ -0,0 +1 @@
+ALTER TABLE user_balances DROP COLUMN IF EXISTS version;
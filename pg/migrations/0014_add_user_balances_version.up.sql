@@ -0,0 +1,3 @@
+-- version increases with every balance change, so clients can make a write
+-- conditional on the balance they read.
+ALTER TABLE user_balances ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,8 @@
+-- Commands the consumer has handled, keyed on their event ID. Handlers
+-- insert the row first in the transaction that applies the command, so a
+-- redelivered command finds it and is skipped.
+CREATE TABLE processed_commands (
+    event_id TEXT PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
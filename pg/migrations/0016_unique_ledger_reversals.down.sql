@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ledger_entries_reverses_key;
+CREATE INDEX ledger_entries_reverses_idx ON ledger_entries (reverses) WHERE reverses <> '';
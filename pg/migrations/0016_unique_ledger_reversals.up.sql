@@ -0,0 +1,4 @@
+-- A transaction can be reversed once: no account may carry two entries
+-- reversing the same transaction.
+DROP INDEX IF EXISTS ledger_entries_reverses_idx;
+CREATE UNIQUE INDEX ledger_entries_reverses_key ON ledger_entries (reverses, account_id) WHERE reverses <> '';
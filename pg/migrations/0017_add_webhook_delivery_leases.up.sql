@@ -0,0 +1,5 @@
+-- The dispatcher that leased a pending delivery. Leasing pushes
+-- next_attempt_at past the attempt's timeout, so the row is not locked
+-- while the endpoint is called; if the dispatcher dies, the delivery falls
+-- due again when the lease runs out.
+ALTER TABLE webhook_deliveries ADD COLUMN leased_by TEXT;
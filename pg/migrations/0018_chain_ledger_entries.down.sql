@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ledger_entries_chain_key;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS hash;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS sequence;
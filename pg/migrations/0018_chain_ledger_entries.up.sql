@@ -0,0 +1,7 @@
+-- Hash chain over each account's ledger entries, written in the posting
+-- transaction so edits and deletions made directly in the table can be
+-- detected. Entries written before chaining keep a NULL sequence.
+ALTER TABLE ledger_entries ADD COLUMN sequence BIGINT;
+ALTER TABLE ledger_entries ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE ledger_entries ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX ledger_entries_chain_key ON ledger_entries (account_id, sequence) WHERE sequence IS NOT NULL;
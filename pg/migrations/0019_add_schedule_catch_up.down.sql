@@ -0,0 +1,7 @@
+DELETE FROM payment_schedule_runs WHERE status = 'skipped';
+ALTER TABLE payment_schedule_runs DROP CONSTRAINT IF EXISTS payment_schedule_runs_event_check;
+ALTER TABLE payment_schedule_runs DROP CONSTRAINT IF EXISTS payment_schedule_runs_status_check;
+ALTER TABLE payment_schedule_runs ADD CONSTRAINT payment_schedule_runs_status_check
+    CHECK (status IN ('queued', 'applied', 'rejected'));
+ALTER TABLE payment_schedule_runs ALTER COLUMN event_id SET NOT NULL;
+ALTER TABLE payment_schedules DROP COLUMN IF EXISTS catch_up;
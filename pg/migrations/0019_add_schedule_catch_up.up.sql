@@ -0,0 +1,13 @@
+-- How a schedule catches up on occurrences missed while no scheduler was
+-- running: fire the latest one only, skip every missed one, or fire them
+-- all. Occurrences that are not fired are recorded as skipped runs, which
+-- send no command and so have no event_id.
+ALTER TABLE payment_schedules ADD COLUMN catch_up TEXT NOT NULL DEFAULT 'once'
+    CHECK (catch_up IN ('once', 'skip', 'all'));
+
+ALTER TABLE payment_schedule_runs ALTER COLUMN event_id DROP NOT NULL;
+ALTER TABLE payment_schedule_runs DROP CONSTRAINT payment_schedule_runs_status_check;
+ALTER TABLE payment_schedule_runs ADD CONSTRAINT payment_schedule_runs_status_check
+    CHECK (status IN ('queued', 'applied', 'rejected', 'skipped'));
+ALTER TABLE payment_schedule_runs ADD CONSTRAINT payment_schedule_runs_event_check
+    CHECK ((status = 'skipped') = (event_id IS NULL));
@@ -0,0 +1,128 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OutboxMessage is a serialized Kafka message waiting to be published.
+type OutboxMessage struct {
+	ID      int64
+	EventID string
+	Topic   string
+	Key     string
+	Headers map[string]string
+	Payload []byte
+}
+
+// InsertOutbox stores msg for publishing. Pass the transaction that made the
+// state change the message describes so both commit or neither does.
+func InsertOutbox(ctx context.Context, msg OutboxMessage, tx *sql.Tx) error {
+	var err error
+	internalTx := false
+
+	if tx == nil {
+		tx, err = DB.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		internalTx = true
+	}
+
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		if internalTx {
+			_ = tx.Rollback()
+		}
+		return fmt.Errorf("failed to encode outbox headers: %w", err)
+	}
+
+	query := `
+		INSERT INTO outbox(event_id, topic, message_key, headers, payload)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.ExecContext(ctx, query, msg.EventID, msg.Topic, msg.Key, headers, msg.Payload)
+	if err != nil {
+		if internalTx {
+			_ = tx.Rollback()
+		}
+		return fmt.Errorf("failed to insert outbox message: %w", err)
+	}
+
+	if internalTx {
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// InsertOutboxMessages stores many messages with multi-row inserts. tx is
+// required: a partially written set of messages is never wanted.
+func InsertOutboxMessages(ctx context.Context, msgs []OutboxMessage, tx *sql.Tx) error {
+	for start := 0; start < len(msgs); start += batchInsertChunk {
+		chunk := msgs[start:min(start+batchInsertChunk, len(msgs))]
+		values := make([]string, 0, len(chunk))
+		args := make([]any, 0, len(chunk)*5)
+		for i, msg := range chunk {
+			headers, err := json.Marshal(msg.Headers)
+			if err != nil {
+				return fmt.Errorf("failed to encode outbox headers: %w", err)
+			}
+			n := i * 5
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+			args = append(args, msg.EventID, msg.Topic, msg.Key, headers, msg.Payload)
+		}
+		query := `INSERT INTO outbox(event_id, topic, message_key, headers, payload) VALUES ` + strings.Join(values, ", ")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to insert outbox messages: %w", err)
+		}
+	}
+	return nil
+}
+
+// FetchUnpublished locks and returns up to limit unpublished messages in
+// insertion order. Only one relay may fetch at a time: two relaying
+// consecutive rows for the same key at once could publish them out of
+// order.
+func FetchUnpublished(ctx context.Context, limit int, tx *sql.Tx) ([]OutboxMessage, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, event_id, topic, message_key, headers, payload
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var headers []byte
+		if err := rows.Scan(&msg.ID, &msg.EventID, &msg.Topic, &msg.Key, &headers, &msg.Payload); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		if err := json.Unmarshal(headers, &msg.Headers); err != nil {
+			return nil, fmt.Errorf("failed to decode outbox headers: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// MarkPublished records that the given outbox messages reached Kafka.
+func MarkPublished(ctx context.Context, ids []int64, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox messages published: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Payment schedule kinds.
+const (
+	ScheduleDeposit    = "deposit"
+	ScheduleWithdrawal = "withdrawal"
+	ScheduleTransfer   = "transfer"
+)
+
+// Payment schedule statuses.
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCompleted = "completed"
+	ScheduleCancelled = "cancelled"
+)
+
+// Catch-up policies: what a recurring schedule does with the occurrences
+// that fell due while no scheduler was running.
+const (
+	// ScheduleCatchUpOnce fires the latest due occurrence and skips the
+	// earlier ones.
+	ScheduleCatchUpOnce = "once"
+	// ScheduleCatchUpSkip fires the latest due occurrence only if it is not
+	// late enough to count as missed, and skips the others.
+	ScheduleCatchUpSkip = "skip"
+	// ScheduleCatchUpAll fires every due occurrence, oldest first.
+	ScheduleCatchUpAll = "all"
+)
+
+// ScheduleRunSkipped is the status of an occurrence that was not fired
+// under the schedule's catch-up policy. It sends no command.
+const ScheduleRunSkipped = "skipped"
+
+// PaymentSchedule is a standing order. Without Cron it runs once, at
+// NextRunAt; with Cron it runs on every occurrence until EndAt, if set.
+type PaymentSchedule struct {
+	ID          string     `json:"id"`
+	AccountID   string     `json:"account_id"`
+	Kind        string     `json:"kind"`
+	ToAccountID string     `json:"to_account_id,omitempty"`
+	Amount      float64    `json:"amount"`
+	Currency    string     `json:"currency"`
+	Description string     `json:"description,omitempty"`
+	Cron        string     `json:"cron,omitempty"`
+	CatchUp     string     `json:"catch_up"`
+	NextRunAt   time.Time  `json:"next_run_at"`
+	EndAt       *time.Time `json:"end_at,omitempty"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ScheduleRun is one occurrence of a schedule. Status is a command result,
+// queued until the consumer applies or rejects the command, or
+// ScheduleRunSkipped for an occurrence that was not fired.
+type ScheduleRun struct {
+	ID           int64     `json:"id"`
+	ScheduleID   string    `json:"schedule_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	EventID      string    `json:"event_id,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const scheduleColumns = `id, account_id, kind, COALESCE(to_account_id, ''), amount, currency, description, cron,
+	catch_up, next_run_at, end_at, status, created_at, updated_at`
+
+func scanSchedule(row interface{ Scan(...any) error }) (PaymentSchedule, error) {
+	var s PaymentSchedule
+	err := row.Scan(&s.ID, &s.AccountID, &s.Kind, &s.ToAccountID, &s.Amount, &s.Currency, &s.Description, &s.Cron,
+		&s.CatchUp, &s.NextRunAt, &s.EndAt, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrNotFound
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to scan payment schedule: %w", err)
+	}
+	return s, nil
+}
+
+// InsertSchedule stores a new schedule and returns it as stored.
+func InsertSchedule(ctx context.Context, s PaymentSchedule, tx *sql.Tx) (PaymentSchedule, error) {
+	var toAccount sql.NullString
+	if s.ToAccountID != "" {
+		toAccount = sql.NullString{String: s.ToAccountID, Valid: true}
+	}
+	row := conn(tx).QueryRowContext(ctx, `
+		INSERT INTO payment_schedules (id, account_id, kind, to_account_id, amount, currency, description, cron, catch_up, next_run_at, end_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+scheduleColumns,
+		s.ID, s.AccountID, s.Kind, toAccount, s.Amount, s.Currency, s.Description, s.Cron, s.CatchUp, s.NextRunAt, s.EndAt)
+	return scanSchedule(row)
+}
+
+// GetSchedule returns a schedule, or ErrNotFound.
+func GetSchedule(ctx context.Context, id string, tx *sql.Tx) (PaymentSchedule, error) {
+	return scanSchedule(conn(tx).QueryRowContext(ctx, `SELECT `+scheduleColumns+` FROM payment_schedules WHERE id = $1`, id))
+}
+
+// LockSchedule returns a schedule and locks it until tx ends, or returns
+// ErrNotFound.
+func LockSchedule(ctx context.Context, id string, tx *sql.Tx) (PaymentSchedule, error) {
+	return scanSchedule(tx.QueryRowContext(ctx, `SELECT `+scheduleColumns+` FROM payment_schedules WHERE id = $1 FOR UPDATE`, id))
+}
+
+// ListSchedulesByAccount returns the schedules paying from an account,
+// oldest first.
+func ListSchedulesByAccount(ctx context.Context, accountID string, tx *sql.Tx) ([]PaymentSchedule, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT `+scheduleColumns+` FROM payment_schedules
+		WHERE account_id = $1
+		ORDER BY created_at, id
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payment schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []PaymentSchedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// UpdateSchedule sets a schedule's status and next occurrence.
+func UpdateSchedule(ctx context.Context, id, status string, nextRunAt time.Time, tx *sql.Tx) (PaymentSchedule, error) {
+	row := conn(tx).QueryRowContext(ctx, `
+		UPDATE payment_schedules SET status = $2, next_run_at = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING `+scheduleColumns,
+		id, status, nextRunAt)
+	return scanSchedule(row)
+}
+
+// ClaimDueSchedule locks the active schedule that has been due the longest
+// and returns it, or returns false if none is due. Schedules locked by
+// another transaction are skipped, so an occurrence is fired by one
+// transaction only.
+func ClaimDueSchedule(ctx context.Context, tx *sql.Tx) (PaymentSchedule, bool, error) {
+	s, err := scanSchedule(tx.QueryRowContext(ctx, `
+		SELECT `+scheduleColumns+` FROM payment_schedules
+		WHERE status = 'active' AND next_run_at <= now()
+		ORDER BY next_run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`))
+	if errors.Is(err, ErrNotFound) {
+		return s, false, nil
+	}
+	return s, err == nil, err
+}
+
+// InsertScheduleRun records an occurrence: a fired one as queued, or one
+// without EventID as skipped.
+func InsertScheduleRun(ctx context.Context, run ScheduleRun, tx *sql.Tx) error {
+	eventID := sql.NullString{String: run.EventID, Valid: run.EventID != ""}
+	status := CommandQueued
+	if !eventID.Valid {
+		status = ScheduleRunSkipped
+	}
+	_, err := conn(tx).ExecContext(ctx, `
+		INSERT INTO payment_schedule_runs (schedule_id, scheduled_for, event_id, status)
+		VALUES ($1, $2, $3, $4)
+	`, run.ScheduleID, run.ScheduledFor, eventID, status)
+	if err != nil {
+		return fmt.Errorf("failed to record schedule run: %w", err)
+	}
+	return nil
+}
+
+// ListScheduleRuns returns a schedule's most recent runs, newest first.
+func ListScheduleRuns(ctx context.Context, scheduleID string, limit int, tx *sql.Tx) ([]ScheduleRun, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT id, schedule_id, scheduled_for, COALESCE(event_id, ''), status, error, created_at, updated_at
+		FROM payment_schedule_runs
+		WHERE schedule_id = $1
+		ORDER BY scheduled_for DESC
+		LIMIT $2
+	`, scheduleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var r ScheduleRun
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.ScheduledFor, &r.EventID, &r.Status, &r.Error, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule run: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
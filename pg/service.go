@@ -7,8 +7,9 @@ import (
 	"fmt"
 )
 
-// UpdateBalance updates the user's balance if the user exists.
-// It errors if the user does not already exist.
+// UpdateBalance updates the user's balance if the account exists and is
+// active. Otherwise it returns ErrAccountNotFound, ErrAccountFrozen or
+// ErrAccountClosed.
 func UpdateBalance(ctx context.Context, userID string, amount float64, tx *sql.Tx) error {
 	var err error
 	internalTx := false
@@ -23,8 +24,8 @@ func UpdateBalance(ctx context.Context, userID string, amount float64, tx *sql.T
 
 	query := `
 		UPDATE user_balances
-		SET balance = balance + $2
-		WHERE user_id = $1
+		SET balance = balance + $2, version = version + 1, updated_at = now()
+		WHERE user_id = $1 AND status = 'active'
 	`
 	result, err := tx.ExecContext(ctx, query, userID, amount)
 	if err != nil {
@@ -43,45 +44,11 @@ func UpdateBalance(ctx context.Context, userID string, amount float64, tx *sql.T
 	}
 
 	if rowsAffected == 0 {
+		err = inactiveAccountError(ctx, userID, tx)
 		if internalTx {
 			_ = tx.Rollback()
 		}
-		return errors.New("no such user found to update balance")
-	}
-
-	if internalTx {
-		if err = tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit transaction: %w", err)
-		}
-	}
-
-	return nil
-}
-
-// CreateNewAccount inserts a new user balance.
-// It errors if the user already exists.
-func CreateNewAccount(ctx context.Context, userID string, amount float64, tx *sql.Tx) error {
-	var err error
-	internalTx := false
-
-	if tx == nil {
-		tx, err = DB.BeginTx(ctx, nil)
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction: %w", err)
-		}
-		internalTx = true
-	}
-
-	query := `
-		INSERT INTO user_balances(user_id, balance)
-		VALUES ($1, $2)
-	`
-	_, err = tx.ExecContext(ctx, query, userID, amount)
-	if err != nil {
-		if internalTx {
-			_ = tx.Rollback()
-		}
-		return fmt.Errorf("failed to create new account: %w", err)
+		return err
 	}
 
 	if internalTx {
@@ -112,3 +79,37 @@ func GetBalance(ctx context.Context, userID string, tx *sql.Tx) (float64, error)
 
 	return balance, nil
 }
+
+// GetBalanceVersion returns an account's balance and version, or zeros if
+// there is no such account.
+func GetBalanceVersion(ctx context.Context, userID string, tx *sql.Tx) (float64, int64, error) {
+	var balance float64
+	var version int64
+	err := conn(tx).QueryRowContext(ctx,
+		`SELECT balance, version FROM user_balances WHERE user_id = $1`, userID).Scan(&balance, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read balance: %w", err)
+	}
+	return balance, version, nil
+}
+
+// inactiveAccountError explains why an update matched no active account.
+func inactiveAccountError(ctx context.Context, userID string, tx *sql.Tx) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM user_balances WHERE user_id = $1`, userID).Scan(&status)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrAccountNotFound
+	case err != nil:
+		return fmt.Errorf("failed to read account status: %w", err)
+	case status == AccountFrozen:
+		return ErrAccountFrozen
+	case status == AccountClosed:
+		return ErrAccountClosed
+	default:
+		return fmt.Errorf("account %s has unexpected status %q", userID, status)
+	}
+}
@@ -0,0 +1,114 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// SQLSTATEs of transient failures that succeed when the whole transaction
+// is run again.
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// sqlStateUniqueViolation is raised by an insert that breaks a unique index.
+const sqlStateUniqueViolation = "23505"
+
+// RetryPolicy bounds how often InTx runs a unit of work and how long it
+// waits in between. The wait doubles after each failure, from BaseBackoff
+// up to MaxBackoff, and is jittered so colliding transactions spread out.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy suits short balance transactions.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: 10 * time.Millisecond,
+	MaxBackoff:  500 * time.Millisecond,
+}
+
+// IsRetryable reports whether err is a serialization failure, deadlock or
+// another writer having taken a ledger chain's next sequence number, after
+// which the transaction can be run again from the start.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	if pgErr.Code == sqlStateUniqueViolation && pgErr.ConstraintName == chainKey {
+		return true
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// InTx runs fn in a transaction at the given isolation level and commits
+// it, or rolls it back if fn fails. When fn or the commit fails with a
+// serialization failure or deadlock, the whole unit of work is run again
+// in a new transaction, as policy allows, so fn must not have side effects
+// outside tx. Any other error is returned as is.
+func InTx(ctx context.Context, isolation sql.IsolationLevel, policy RetryPolicy, fn func(tx *sql.Tx) error) error {
+	return retry(ctx, policy, func() error {
+		tx, err := DB.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// retryable, or policy runs out of attempts.
+func retry(ctx context.Context, policy RetryPolicy, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || !IsRetryable(err) {
+			return err
+		}
+		if n >= policy.MaxAttempts {
+			return fmt.Errorf("transaction failed after %d attempts: %w", n, err)
+		}
+
+		wait := policy.backoff(n)
+		log.Printf("Retrying transaction in %s after attempt %d: %v", wait, n, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction retry cancelled: %w", errors.Join(ctx.Err(), err))
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff returns how long to wait after the given failed attempt: a
+// random duration between half and all of BaseBackoff doubled per earlier
+// attempt, capped at MaxBackoff.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
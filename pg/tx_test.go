@@ -0,0 +1,209 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries keeps the tests quick while leaving room for contention.
+var fastRetries = RetryPolicy{MaxAttempts: 50, BaseBackoff: time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"wrapped", fmt.Errorf("failed to update balance: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"ledger chain collision", &pgconn.PgError{Code: "23505", ConstraintName: "ledger_entries_chain_key"}, true},
+		{"other error", errors.New("insufficient funds"), false},
+		{"nil", nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, IsRetryable(c.err))
+		})
+	}
+}
+
+func TestRetryRunsAgainOnRetryableError(t *testing.T) {
+	calls := 0
+	err := retry(context.Background(), fastRetries, func() error {
+		calls++
+		if calls < 3 {
+			return &pgconn.PgError{Code: "40P01"}
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetryReturnsOtherErrorsAtOnce(t *testing.T) {
+	calls := 0
+	cause := errors.New("insufficient funds")
+	err := retry(context.Background(), fastRetries, func() error {
+		calls++
+		return cause
+	})
+
+	assert.Same(t, cause, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	policy := RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	err := retry(context.Background(), policy, func() error {
+		calls++
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	assert.Equal(t, 3, calls)
+	assert.True(t, IsRetryable(err))
+	assert.ErrorContains(t, err, "after 3 attempts")
+}
+
+func TestRetryStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	policy := RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Hour, MaxBackoff: time.Hour}
+	err := retry(ctx, policy, func() error {
+		calls++
+		cancel()
+		return &pgconn.PgError{Code: "40001"}
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestBackoffStaysWithinBounds(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := min(policy.BaseBackoff<<(attempt-1), policy.MaxBackoff)
+		for range 20 {
+			d := policy.backoff(attempt)
+			assert.GreaterOrEqual(t, d, ceiling/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, d, ceiling, "attempt %d", attempt)
+		}
+	}
+}
+
+// createCounters creates a scratch table with n counters set to zero and
+// drops it when the test ends.
+func createCounters(t *testing.T, n int) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := DB.ExecContext(ctx, `DROP TABLE IF EXISTS tx_retry_counters`)
+	require.NoError(t, err)
+	_, err = DB.ExecContext(ctx, `CREATE TABLE tx_retry_counters (id INT PRIMARY KEY, n INT NOT NULL)`)
+	require.NoError(t, err)
+	_, err = DB.ExecContext(ctx, `INSERT INTO tx_retry_counters SELECT id, 0 FROM generate_series(1, $1) AS id`, n)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = DB.ExecContext(context.Background(), `DROP TABLE IF EXISTS tx_retry_counters`)
+	})
+}
+
+func counter(t *testing.T, id int) int {
+	t.Helper()
+	var n int
+	require.NoError(t, DB.QueryRow(`SELECT n FROM tx_retry_counters WHERE id = $1`, id).Scan(&n))
+	return n
+}
+
+// Concurrent read-modify-write increments would lose updates under read
+// committed; serializable retries make every one count.
+func TestInTxSerializableKeepsConcurrentIncrements(t *testing.T) {
+	openTestDB(t)
+	createCounters(t, 1)
+	ctx := context.Background()
+
+	const workers, increments = 8, 10
+	var attempts atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*increments)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				errs <- InTx(ctx, sql.LevelSerializable, fastRetries, func(tx *sql.Tx) error {
+					attempts.Add(1)
+					var n int
+					if err := tx.QueryRowContext(ctx, `SELECT n FROM tx_retry_counters WHERE id = 1`).Scan(&n); err != nil {
+						return err
+					}
+					_, err := tx.ExecContext(ctx, `UPDATE tx_retry_counters SET n = $1 WHERE id = 1`, n+1)
+					return err
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, workers*increments, counter(t, 1))
+	t.Logf("%d increments took %d attempts", workers*increments, attempts.Load())
+}
+
+// Two transactions locking the same rows in opposite orders deadlock; the
+// one Postgres aborts is run again and both succeed.
+func TestInTxRetriesDeadlock(t *testing.T) {
+	openTestDB(t)
+	createCounters(t, 2)
+	ctx := context.Background()
+
+	// Both first attempts hold their first row before either takes its
+	// second, so they are certain to deadlock.
+	var holding sync.WaitGroup
+	holding.Add(2)
+	var attempts atomic.Int64
+	lockInOrder := func(first, second int) error {
+		tries := 0
+		return InTx(ctx, sql.LevelSerializable, fastRetries, func(tx *sql.Tx) error {
+			attempts.Add(1)
+			tries++
+			if _, err := tx.ExecContext(ctx, `UPDATE tx_retry_counters SET n = n + 1 WHERE id = $1`, first); err != nil {
+				return err
+			}
+			if tries == 1 {
+				holding.Done()
+				holding.Wait()
+			}
+			_, err := tx.ExecContext(ctx, `UPDATE tx_retry_counters SET n = n + 1 WHERE id = $1`, second)
+			return err
+		})
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() { defer wg.Done(); errs[0] = lockInOrder(1, 2) }()
+	go func() { defer wg.Done(); errs[1] = lockInOrder(2, 1) }()
+	wg.Wait()
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.GreaterOrEqual(t, attempts.Load(), int64(3))
+	assert.Equal(t, 2, counter(t, 1))
+	assert.Equal(t, 2, counter(t, 2))
+}
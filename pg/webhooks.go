@@ -0,0 +1,328 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookSucceeded = "succeeded"
+	WebhookFailed    = "failed"
+)
+
+// WebhookEndpoint is a partner URL subscribed to domain events. An empty
+// AccountID subscribes to every account; empty EventTypes to every type.
+type WebhookEndpoint struct {
+	ID         int64     `json:"id"`
+	AccountID  string    `json:"account_id,omitempty"`
+	ClientID   string    `json:"client_id,omitempty"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for one endpoint.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int64           `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// DueWebhookDelivery is a pending delivery together with where to send it.
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// WebhookAttempt is the outcome of one delivery attempt.
+type WebhookAttempt struct {
+	AttemptedAt    time.Time `json:"attempted_at"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+}
+
+// CreateWebhookEndpoint stores ep and returns it with its ID and creation
+// time filled in.
+func CreateWebhookEndpoint(ctx context.Context, ep WebhookEndpoint, tx *sql.Tx) (WebhookEndpoint, error) {
+	if ep.EventTypes == nil {
+		ep.EventTypes = []string{}
+	}
+	eventTypes, err := json.Marshal(ep.EventTypes)
+	if err != nil {
+		return ep, fmt.Errorf("failed to encode event types: %w", err)
+	}
+
+	err = conn(tx).QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints(account_id, client_id, url, secret, event_types)
+		VALUES (NULLIF($1, ''), NULLIF($2, ''), $3, $4, $5)
+		RETURNING id, active, created_at
+	`, ep.AccountID, ep.ClientID, ep.URL, ep.Secret, eventTypes).Scan(&ep.ID, &ep.Active, &ep.CreatedAt)
+	if err != nil {
+		return ep, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+	return ep, nil
+}
+
+// ListWebhookEndpoints returns the active endpoints registered for
+// accountID and/or clientID; empty filters match everything. Secrets are
+// not returned.
+func ListWebhookEndpoints(ctx context.Context, accountID, clientID string, tx *sql.Tx) ([]WebhookEndpoint, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT id, COALESCE(account_id, ''), COALESCE(client_id, ''), url, event_types, active, created_at
+		FROM webhook_endpoints
+		WHERE active
+		  AND ($1 = '' OR account_id = $1)
+		  AND ($2 = '' OR client_id = $2)
+		ORDER BY id
+	`, accountID, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		var ep WebhookEndpoint
+		var eventTypes []byte
+		if err := rows.Scan(&ep.ID, &ep.AccountID, &ep.ClientID, &ep.URL, &eventTypes, &ep.Active, &ep.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook endpoint: %w", err)
+		}
+		if err := json.Unmarshal(eventTypes, &ep.EventTypes); err != nil {
+			return nil, fmt.Errorf("failed to decode event types: %w", err)
+		}
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints, rows.Err()
+}
+
+// DeactivateWebhookEndpoint stops deliveries to an endpoint. Its delivery
+// log is kept. It returns ErrNotFound if no active endpoint has that ID.
+func DeactivateWebhookEndpoint(ctx context.Context, id int64, tx *sql.Tx) error {
+	result, err := conn(tx).ExecContext(ctx, `UPDATE webhook_endpoints SET active = FALSE WHERE id = $1 AND active`, id)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate webhook endpoint: %w", err)
+	}
+	return requireRow(result)
+}
+
+// EnqueueWebhookDeliveries queues an event for every active endpoint
+// subscribed to it. Pass the transaction that records the event so
+// deliveries exist if and only if the event does.
+func EnqueueWebhookDeliveries(ctx context.Context, accountID, eventID, eventType string, payload []byte, tx *sql.Tx) error {
+	_, err := conn(tx).ExecContext(ctx, `
+		INSERT INTO webhook_deliveries(endpoint_id, event_id, event_type, payload)
+		SELECT id, $2, $3, $4
+		FROM webhook_endpoints
+		WHERE active
+		  AND (account_id IS NULL OR account_id = $1)
+		  AND (jsonb_array_length(event_types) = 0 OR event_types ? $3)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`, accountID, eventID, eventType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// LeaseDueWebhookDeliveries leases up to limit pending deliveries whose
+// next attempt is due to owner for ttl, and returns them. A leased delivery
+// is not due again until the lease runs out, so the lease commits at once
+// and no row stays locked while the endpoints are called. Rows another
+// dispatcher is leasing at the same moment are skipped.
+func LeaseDueWebhookDeliveries(ctx context.Context, limit int, owner string, ttl time.Duration, tx *sql.Tx) ([]DueWebhookDelivery, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET leased_by = $2, next_attempt_at = now() + make_interval(secs => $3)
+		FROM webhook_endpoints e
+		WHERE e.id = d.endpoint_id AND d.id IN (
+			SELECT d.id
+			FROM webhook_deliveries d
+			JOIN webhook_endpoints e ON e.id = d.endpoint_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND e.active
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status,
+		          d.attempts, d.next_attempt_at, d.created_at, e.url, e.secret
+	`, limit, owner, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt logs an attempt at a delivery leased to owner,
+// moves the delivery to status and ends the lease. nextAttemptAt is only
+// used while the delivery stays pending. It returns ErrNotFound, recording
+// nothing, if the delivery is no longer leased to owner: the lease ran out
+// and another dispatcher took the delivery, or it was re-sent.
+func RecordWebhookAttempt(ctx context.Context, deliveryID int64, owner string, attempt WebhookAttempt, status string, nextAttemptAt time.Time, tx *sql.Tx) error {
+	result, err := conn(tx).ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    status = $3,
+		    next_attempt_at = $4,
+		    last_error = $5,
+		    response_status = $6,
+		    delivered_at = CASE WHEN $3 = 'succeeded' THEN $7 END,
+		    leased_by = NULL
+		WHERE id = $1 AND leased_by = $2 AND status = 'pending'
+	`, deliveryID, owner, status, nextAttemptAt, attempt.Error, attempt.ResponseStatus, attempt.AttemptedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	if err := requireRow(result); err != nil {
+		return err
+	}
+
+	_, err = conn(tx).ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts(delivery_id, attempted_at, response_status, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)
+	`, deliveryID, attempt.AttemptedAt, attempt.ResponseStatus, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		return fmt.Errorf("failed to log webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the most recent deliveries to an endpoint,
+// newest first.
+func ListWebhookDeliveries(ctx context.Context, endpointID int64, limit int, tx *sql.Tx) ([]WebhookDelivery, error) {
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, endpointID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery returns a delivery and its attempt log, oldest attempt
+// first. It returns ErrNotFound if the delivery does not exist.
+func GetWebhookDelivery(ctx context.Context, id int64, tx *sql.Tx) (WebhookDelivery, []WebhookAttempt, error) {
+	d, err := scanDelivery(conn(tx).QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, nil, ErrNotFound
+	}
+	if err != nil {
+		return d, nil, err
+	}
+
+	rows, err := conn(tx).QueryContext(ctx, `
+		SELECT attempted_at, response_status, error, duration_ms
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return d, nil, fmt.Errorf("failed to list webhook attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.ResponseStatus, &a.Error, &a.DurationMs); err != nil {
+			return d, nil, fmt.Errorf("failed to scan webhook attempt: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return d, attempts, rows.Err()
+}
+
+// ResetWebhookDelivery makes a delivery due again with a fresh retry
+// budget. Earlier attempts stay in the log. It returns ErrNotFound if the
+// delivery does not exist.
+func ResetWebhookDelivery(ctx context.Context, id int64, tx *sql.Tx) error {
+	result, err := conn(tx).ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), leased_by = NULL
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to reset webhook delivery: %w", err)
+	}
+	return requireRow(result)
+}
+
+const deliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts,
+		       next_attempt_at, last_error, response_status, created_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	// JSONB scans into []byte but not into json.RawMessage.
+	var payload []byte
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastError, &d.ResponseStatus, &d.CreatedAt, &d.DeliveredAt)
+	d.Payload = payload
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, err
+	}
+	if err != nil {
+		return d, fmt.Errorf("failed to scan webhook delivery: %w", err)
+	}
+	return d, nil
+}
+
+// requireRow turns an update that matched nothing into ErrNotFound.
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
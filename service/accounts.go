@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ledger/kafka"
+	"ledger/pg"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Limits on account metadata.
+const (
+	maxAccountNameLength = 200
+	maxAccountLabels     = 50
+	maxLabelKeyLength    = 64
+	maxLabelValueLength  = 256
+)
+
+// accountTypes are the types an account can have.
+var accountTypes = []string{pg.AccountWallet, pg.AccountSavings, pg.AccountEscrow}
+
+// NewAccount describes an additional account opened for a user.
+type NewAccount struct {
+	Name           string
+	Type           string
+	Labels         map[string]string
+	InitialBalance float64
+}
+
+// OpenAccount queues a new account for userID and returns its generated ID.
+// The account exists once the create-account command has been consumed.
+func OpenAccount(ctx context.Context, userID string, account NewAccount) (string, error) {
+	if err := validateUserID(userID); err != nil {
+		return "", err
+	}
+	if account.Type == "" {
+		account.Type = pg.AccountWallet
+	}
+	if err := validateInitialBalance(account.InitialBalance); err != nil {
+		return "", err
+	}
+	if err := validateAccountName(account.Name); err != nil {
+		return "", err
+	}
+	if err := validateAccountType(account.Type); err != nil {
+		return "", err
+	}
+	labels := make(map[string]*string, len(account.Labels))
+	for k, v := range account.Labels {
+		labels[k] = &v
+	}
+	if err := validateLabels(labels); err != nil {
+		return "", err
+	}
+
+	id := "acc_" + uuid.New().String()
+	err := kafka.SendCreateAccountMessage(ctx, kafka.CreateAccountMessage{
+		BaseMessage: kafka.BaseMessage{
+			UserID:    id,
+			Timestamp: time.Now(),
+		},
+		InitialBalance: account.InitialBalance,
+		OwnerID:        userID,
+		Name:           account.Name,
+		Type:           account.Type,
+		Labels:         account.Labels,
+	})
+	if err != nil {
+		log.Printf("Error opening account for user %s: %v", userID, err)
+		return "", err
+	}
+	return id, nil
+}
+
+// GetAccount returns an account with its metadata.
+func GetAccount(ctx context.Context, id string) (pg.Account, error) {
+	if id == "" {
+		return pg.Account{}, fmt.Errorf("%w: account id is required", ErrInvalidArgument)
+	}
+	return pg.GetAccount(ctx, id, nil)
+}
+
+// ListUserAccounts returns every account userID holds, oldest first.
+func ListUserAccounts(ctx context.Context, userID string) ([]pg.Account, error) {
+	if err := validateUserID(userID); err != nil {
+		return nil, err
+	}
+	return pg.ListAccountsByOwner(ctx, userID, nil)
+}
+
+// UpdateAccount changes an account's name, type, labels or interest plan.
+func UpdateAccount(ctx context.Context, id string, update pg.AccountUpdate) (pg.Account, error) {
+	if err := validateUserID(id); err != nil {
+		return pg.Account{}, err
+	}
+	if update.Name != nil {
+		if err := validateAccountName(*update.Name); err != nil {
+			return pg.Account{}, err
+		}
+	}
+	if update.Type != nil {
+		if err := validateAccountType(*update.Type); err != nil {
+			return pg.Account{}, err
+		}
+	}
+	if err := validateLabels(update.Labels); err != nil {
+		return pg.Account{}, err
+	}
+	if update.InterestPlan != nil {
+		if err := validateInterestPlan(*update.InterestPlan); err != nil {
+			return pg.Account{}, err
+		}
+	}
+	return pg.UpdateAccount(ctx, id, update, nil)
+}
+
+func validateAccountName(name string) error {
+	if utf8.RuneCountInString(name) > maxAccountNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalidArgument, maxAccountNameLength)
+	}
+	return nil
+}
+
+func validateAccountType(accountType string) error {
+	for _, t := range accountTypes {
+		if accountType == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: type must be one of %s", ErrInvalidArgument, strings.Join(accountTypes, ", "))
+}
+
+func validateLabels(labels map[string]*string) error {
+	if len(labels) > maxAccountLabels {
+		return fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidArgument, maxAccountLabels)
+	}
+	for k, v := range labels {
+		if k == "" || utf8.RuneCountInString(k) > maxLabelKeyLength {
+			return fmt.Errorf("%w: label keys must be 1 to %d characters", ErrInvalidArgument, maxLabelKeyLength)
+		}
+		if v != nil && utf8.RuneCountInString(*v) > maxLabelValueLength {
+			return fmt.Errorf("%w: label %q must be at most %d characters", ErrInvalidArgument, k, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// accountActionOperations names the ledger record written for each action.
+var accountActionOperations = map[string]string{
+	kafka.AccountActionFreeze:   "FreezeAccount",
+	kafka.AccountActionUnfreeze: "UnfreezeAccount",
+	kafka.AccountActionClose:    "CloseAccount",
+}
+
+// FreezeAccount stops all credits and debits on an account until it is
+// unfrozen.
+func FreezeAccount(ctx context.Context, userID, reason string) error {
+	return changeAccountStatus(ctx, userID, kafka.AccountActionFreeze, reason)
+}
+
+// UnfreezeAccount makes a frozen account active again.
+func UnfreezeAccount(ctx context.Context, userID, reason string) error {
+	return changeAccountStatus(ctx, userID, kafka.AccountActionUnfreeze, reason)
+}
+
+// CloseAccount closes an account for good. The consumer rejects the command
+// unless the balance is zero.
+func CloseAccount(ctx context.Context, userID, reason string) error {
+	return changeAccountStatus(ctx, userID, kafka.AccountActionClose, reason)
+}
+
+func changeAccountStatus(ctx context.Context, userID, action, reason string) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+	err := kafka.SendChangeAccountStatusMessage(ctx, kafka.ChangeAccountStatusMessage{
+		BaseMessage: kafka.BaseMessage{
+			UserID:    userID,
+			Timestamp: time.Now(),
+		},
+		Action: action,
+		Reason: strings.TrimSpace(reason),
+	})
+	if err != nil {
+		log.Printf("Error sending %s for user %s: %v", action, userID, err)
+		return err
+	}
+	return nil
+}
+
+// nextAccountStatus applies the lifecycle rules: active and frozen swap
+// with freeze/unfreeze, either can be closed at zero balance, and closed is
+// final.
+func nextAccountStatus(account pg.Account, action string) (string, error) {
+	if account.Status == pg.AccountClosed {
+		return "", ErrAccountClosed
+	}
+	switch action {
+	case kafka.AccountActionFreeze:
+		if account.Status != pg.AccountActive {
+			return "", fmt.Errorf("%w: cannot freeze a %s account", ErrInvalidStatusTransition, account.Status)
+		}
+		return pg.AccountFrozen, nil
+	case kafka.AccountActionUnfreeze:
+		if account.Status != pg.AccountFrozen {
+			return "", fmt.Errorf("%w: cannot unfreeze a %s account", ErrInvalidStatusTransition, account.Status)
+		}
+		return pg.AccountActive, nil
+	case kafka.AccountActionClose:
+		if account.Balance != 0 {
+			return "", fmt.Errorf("%w: balance is %v", ErrNonZeroBalance, account.Balance)
+		}
+		return pg.AccountClosed, nil
+	default:
+		return "", fmt.Errorf("%w: unknown action %q", ErrInvalidStatusTransition, action)
+	}
+}
+
+// HandleChangeAccountStatus applies a freeze, unfreeze or close command and
+// records the change in the ledger. Disallowed changes are rejected with an
+// OperationRejected event.
+func HandleChangeAccountStatus(meta kafka.EventMeta, msg kafka.ChangeAccountStatusMessage) error {
+	ctx := context.Background()
+
+	var status string
+	applied, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		account, err := pg.LockAccount(ctx, msg.UserID, tx)
+		if err == nil {
+			status, err = nextAccountStatus(account, msg.Action)
+		}
+		if err != nil {
+			return reject(err)
+		}
+
+		if err = pg.SetAccountStatus(ctx, msg.UserID, status, tx); err != nil {
+			return err
+		}
+		event := kafka.AccountStatusChangedEvent{
+			UserID:         msg.UserID,
+			PreviousStatus: account.Status,
+			Status:         status,
+			Reason:         msg.Reason,
+		}
+		if err = recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeAccountStatusChanged), msg.UserID, event); err != nil {
+			return fmt.Errorf("failed to record account-status-changed event: %w", err)
+		}
+
+		entries := []pg.LedgerEntry{
+			{
+				AccountID:     msg.UserID,
+				Operation:     accountActionOperations[msg.Action],
+				Status:        status,
+				TransactionID: meta.EventID,
+			},
+		}
+		return pg.InsertLedgerEntries(ctx, entries, tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectOperation(ctx, meta, msg.UserID, 0, cause); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to %s account: %w", msg.Action, err)
+	}
+	if err != nil || !applied {
+		return err
+	}
+
+	log.Printf("Account %s is now %s\n", msg.UserID, status)
+	return nil
+}
@@ -0,0 +1,149 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"strings"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubAccount(p *gomonkey.Patches, account pg.Account) *string {
+	var status string
+	p.ApplyFunc(pg.LockAccount,
+		func(_ context.Context, _ string, _ *sql.Tx) (pg.Account, error) {
+			return account, nil
+		})
+	p.ApplyFunc(pg.SetAccountStatus,
+		func(_ context.Context, _ string, s string, _ *sql.Tx) error {
+			status = s
+			return nil
+		})
+	return &status
+}
+
+func TestHandleChangeAccountStatus_Freeze(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	status := stubAccount(patches, pg.Account{ID: "user-1", Balance: 40, Status: pg.AccountActive})
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			assert.Equal(t, "FreezeAccount", rec[0].Operation)
+			assert.Equal(t, pg.AccountFrozen, rec[0].Status)
+			return nil
+		})
+
+	msg := kafka.ChangeAccountStatusMessage{BaseMessage: kafka.BaseMessage{UserID: "user-1"}, Action: kafka.AccountActionFreeze, Reason: "fraud review"}
+	err := service.HandleChangeAccountStatus(kafka.EventMeta{EventID: "evt-1"}, msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, pg.AccountFrozen, *status)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "AccountStatusChanged", (*outbox)[0].Headers["event-type"])
+}
+
+func TestHandleChangeAccountStatus_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		account pg.Account
+		action  string
+		wantErr error
+	}{
+		{"close with balance", pg.Account{Balance: 10, Status: pg.AccountActive}, kafka.AccountActionClose, service.ErrNonZeroBalance},
+		{"freeze closed", pg.Account{Status: pg.AccountClosed}, kafka.AccountActionFreeze, service.ErrAccountClosed},
+		{"unfreeze active", pg.Account{Status: pg.AccountActive}, kafka.AccountActionUnfreeze, service.ErrInvalidStatusTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches := gomonkey.NewPatches()
+			defer patches.Reset()
+
+			noOpDB(patches)
+			outbox := stubOutbox(patches, 0)
+			status := stubAccount(patches, tt.account)
+
+			msg := kafka.ChangeAccountStatusMessage{BaseMessage: kafka.BaseMessage{UserID: "user-1"}, Action: tt.action}
+			err := service.HandleChangeAccountStatus(kafka.EventMeta{EventID: "evt-1"}, msg)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Empty(t, *status)
+			assert.Len(t, *outbox, 1)
+			assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+		})
+	}
+}
+
+func TestHandleAddBalance_FrozenAccount(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return pg.ErrAccountFrozen
+		})
+
+	msg := kafka.AddBalanceMessage{Amount: 5, BaseMessage: kafka.BaseMessage{UserID: "user-1"}}
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-1"}, msg)
+
+	assert.ErrorIs(t, err, service.ErrAccountFrozen)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
+
+func TestOpenAccount(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	var sent kafka.CreateAccountMessage
+	patches.ApplyFunc(kafka.SendCreateAccountMessage,
+		func(_ context.Context, msg kafka.CreateAccountMessage) error {
+			sent = msg
+			return nil
+		})
+
+	id, err := service.OpenAccount(context.Background(), "user-1", service.NewAccount{
+		Name:   "Holiday fund",
+		Type:   pg.AccountSavings,
+		Labels: map[string]string{"goal": "travel"},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(id, "acc_"))
+	assert.Equal(t, id, sent.UserID)
+	assert.Equal(t, "user-1", sent.OwnerID)
+	assert.Equal(t, pg.AccountSavings, sent.Type)
+	assert.Equal(t, "travel", sent.Labels["goal"])
+}
+
+func TestOpenAccount_InvalidType(t *testing.T) {
+	_, err := service.OpenAccount(context.Background(), "user-1", service.NewAccount{Type: "checking"})
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
+
+func TestUpdateAccount_Validation(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		name   string
+		update pg.AccountUpdate
+	}{
+		{"unknown type", pg.AccountUpdate{Type: new(string)}},
+		{"long name", pg.AccountUpdate{Name: func() *string { s := strings.Repeat("x", 201); return &s }()}},
+		{"empty label key", pg.AccountUpdate{Labels: map[string]*string{"": &empty}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.UpdateAccount(context.Background(), "acc-1", tt.update)
+			assert.ErrorIs(t, err, service.ErrInvalidArgument)
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ledger/kafka"
+	"ledger/pg"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxBatchItems bounds the size of one batch.
+const MaxBatchItems = 10000
+
+// Batch operations accepted by SubmitBatch.
+const (
+	BatchOpCreate = "create"
+	BatchOpAdd    = "add"
+	BatchOpDeduct = "deduct"
+)
+
+// batchOperations maps batch operations to the command each item is sent as.
+var batchOperations = map[string]string{
+	BatchOpCreate: kafka.EventTypeCreateAccount,
+	BatchOpAdd:    kafka.EventTypeAddBalance,
+	BatchOpDeduct: kafka.EventTypeDeductBalance,
+}
+
+// Batch statuses reported by GetBatch.
+const (
+	BatchProcessing       = "processing"
+	BatchCompleted        = "completed"
+	BatchPartiallyApplied = "partially_applied"
+	BatchFailed           = "failed"
+)
+
+// BatchItemRequest is one operation submitted in a batch.
+type BatchItemRequest struct {
+	Operation string
+	UserID    string
+	Amount    float64
+}
+
+// BatchItemError describes why one item of a batch is invalid.
+type BatchItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// BatchValidationError lists every invalid item of a rejected batch. It
+// wraps ErrInvalidArgument.
+type BatchValidationError struct {
+	Items []BatchItemError
+}
+
+func (e *BatchValidationError) Error() string {
+	return fmt.Sprintf("%s: %d invalid batch item(s)", ErrInvalidArgument, len(e.Items))
+}
+
+func (e *BatchValidationError) Unwrap() error { return ErrInvalidArgument }
+
+// BatchStatus is a batch with per-item results.
+type BatchStatus struct {
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	AllOrNothing bool              `json:"all_or_nothing"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Queued       int               `json:"queued"`
+	Applied      int               `json:"applied"`
+	Rejected     int               `json:"rejected"`
+	Items        []BatchItemResult `json:"items"`
+}
+
+// BatchItemResult is one item of a batch and its outcome.
+type BatchItemResult struct {
+	Index     int       `json:"index"`
+	EventID   string    `json:"event_id"`
+	Operation string    `json:"operation"`
+	UserID    string    `json:"user_id"`
+	Amount    float64   `json:"amount"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SubmitBatch validates every item, then stores the batch and queues its
+// commands in one transaction, returning the batch ID. Items are sent as
+// individual commands, or with allOrNothing as a single ApplyBatch command
+// that the consumer applies in one database transaction.
+func SubmitBatch(ctx context.Context, items []BatchItemRequest, allOrNothing bool) (string, error) {
+	if err := validateBatch(items); err != nil {
+		return "", err
+	}
+
+	batch := pg.Batch{ID: uuid.New().String(), AllOrNothing: allOrNothing}
+	now := time.Now()
+	rows := make([]pg.BatchItem, 0, len(items))
+	var outbox []pg.OutboxMessage
+	var batchCmd kafka.ApplyBatchMessage
+
+	for i, item := range items {
+		meta := kafka.NewEventMeta(ctx, batchOperations[item.Operation])
+		rows = append(rows, pg.BatchItem{
+			Index:     i,
+			EventID:   meta.EventID,
+			Operation: meta.Type,
+			UserID:    item.UserID,
+			Amount:    item.Amount,
+		})
+
+		if allOrNothing {
+			batchCmd.Items = append(batchCmd.Items, kafka.BatchItem{
+				EventID:   meta.EventID,
+				Operation: meta.Type,
+				UserID:    item.UserID,
+				Amount:    item.Amount,
+			})
+			continue
+		}
+		topic, msg := commandFor(item, now)
+		encoded, err := kafka.EncodeMessage(kafka.CommandTopic(topic), item.UserID, meta, msg)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode batch item %d: %w", i, err)
+		}
+		outbox = append(outbox, outboxMessage(meta, encoded))
+	}
+
+	if allOrNothing {
+		batchCmd.BatchID = batch.ID
+		batchCmd.Timestamp = now
+		meta := kafka.NewEventMeta(ctx, kafka.EventTypeApplyBatch)
+		// Keyed by batch, not account, so it is not ordered against other
+		// commands for the batch's accounts.
+		encoded, err := kafka.EncodeMessage(kafka.CommandTopic(kafka.TopicApplyBatch), batch.ID, meta, batchCmd)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode batch: %w", err)
+		}
+		outbox = append(outbox, outboxMessage(meta, encoded))
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := pg.CreateBatch(ctx, batch, rows, tx); err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+	if err := pg.InsertOutboxMessages(ctx, outbox, tx); err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Queued batch %s with %d item(s)\n", batch.ID, len(items))
+	return batch.ID, nil
+}
+
+// validateBatch checks every item so callers get all problems at once.
+func validateBatch(items []BatchItemRequest) error {
+	if len(items) == 0 {
+		return fmt.Errorf("%w: batch has no items", ErrInvalidArgument)
+	}
+	if len(items) > MaxBatchItems {
+		return fmt.Errorf("%w: batch has %d items, the limit is %d", ErrInvalidArgument, len(items), MaxBatchItems)
+	}
+
+	var problems []BatchItemError
+	for i, item := range items {
+		var err error
+		switch item.Operation {
+		case BatchOpCreate:
+			err = validateInitialBalance(item.Amount)
+		case BatchOpAdd, BatchOpDeduct:
+			err = validateAmount(item.Amount)
+		default:
+			err = fmt.Errorf("%w: operation must be create, add or deduct, got %q", ErrInvalidArgument, item.Operation)
+		}
+		if err == nil {
+			err = validateUserID(item.UserID)
+		}
+		if err != nil {
+			problems = append(problems, BatchItemError{Index: i, Error: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return &BatchValidationError{Items: problems}
+	}
+	return nil
+}
+
+// commandFor builds the command message for a single batch item.
+func commandFor(item BatchItemRequest, now time.Time) (string, kafka.Message) {
+	base := kafka.BaseMessage{UserID: item.UserID, Timestamp: now}
+	switch item.Operation {
+	case BatchOpCreate:
+		return kafka.TopicCreateAccount, kafka.CreateAccountMessage{BaseMessage: base, InitialBalance: item.Amount}
+	case BatchOpAdd:
+		return kafka.TopicAddBalance, kafka.AddBalanceMessage{BaseMessage: base, Amount: item.Amount}
+	default:
+		return kafka.TopicDeductBalance, kafka.DeductBalanceMessage{BaseMessage: base, Amount: item.Amount}
+	}
+}
+
+// GetBatch returns a batch's overall status and per-item results.
+func GetBatch(ctx context.Context, id string) (BatchStatus, error) {
+	batch, items, err := pg.GetBatch(ctx, id, nil)
+	if err != nil {
+		if errors.Is(err, pg.ErrNotFound) {
+			return BatchStatus{}, fmt.Errorf("%w: batch %s", ErrNotFound, id)
+		}
+		return BatchStatus{}, err
+	}
+
+	status := BatchStatus{
+		ID:           batch.ID,
+		AllOrNothing: batch.AllOrNothing,
+		CreatedAt:    batch.CreatedAt,
+		Items:        make([]BatchItemResult, 0, len(items)),
+	}
+	for _, item := range items {
+		switch item.Status {
+		case pg.CommandQueued:
+			status.Queued++
+		case pg.CommandApplied:
+			status.Applied++
+		case pg.CommandRejected:
+			status.Rejected++
+		}
+		status.Items = append(status.Items, BatchItemResult(item))
+	}
+
+	switch {
+	case status.Queued > 0:
+		status.Status = BatchProcessing
+	case status.Rejected == 0:
+		status.Status = BatchCompleted
+	case status.Applied == 0:
+		status.Status = BatchFailed
+	default:
+		status.Status = BatchPartiallyApplied
+	}
+	return status, nil
+}
+
+// HandleApplyBatch applies every item of an all-or-nothing batch in one
+// transaction. If any item fails, nothing is applied and every item is
+// rejected.
+func HandleApplyBatch(meta kafka.EventMeta, msg kafka.ApplyBatchMessage) error {
+	ctx := context.Background()
+
+	userIDs := make([]string, 0, len(msg.Items))
+	for _, item := range msg.Items {
+		userIDs = append(userIDs, item.UserID)
+	}
+	slices.Sort(userIDs)
+	userIDs = slices.Compact(userIDs)
+
+	// failed is the item that rejected the batch in the last attempt.
+	failed := 0
+	_, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		if err := pg.LockBalances(ctx, userIDs, tx); err != nil {
+			return err
+		}
+
+		entries := make([]pg.LedgerEntry, 0, len(msg.Items))
+		for i, item := range msg.Items {
+			// Each item is recorded as if it were its own command, so its
+			// events and ledger entries carry the item's event ID.
+			itemMeta := kafka.EventMeta{EventID: item.EventID, Type: item.Operation, CorrelationID: meta.CorrelationID}
+			itemEntries, err := applyBatchItem(ctx, itemMeta, item, tx)
+			if err != nil {
+				failed = i
+				return err
+			}
+			entries = append(entries, itemEntries...)
+		}
+		return pg.InsertLedgerEntries(ctx, entries, tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectBatch(ctx, meta, msg, failed, cause); err != nil {
+			return err
+		}
+		return fmt.Errorf("batch %s item %d: %w", msg.BatchID, failed, err)
+	}
+	return err
+}
+
+// applyBatchItem applies one item inside tx and returns its ledger entries:
+// the item's own and, for a charged deduction, its fee line. Errors that
+// reject the item are returned as rejected.
+func applyBatchItem(ctx context.Context, meta kafka.EventMeta, item kafka.BatchItem, tx *sql.Tx) ([]pg.LedgerEntry, error) {
+	entry := pg.LedgerEntry{AccountID: item.UserID, Operation: item.Operation, Amount: item.Amount,
+		TransactionID: item.EventID, CounterAccount: pg.CashClearingAccount}
+
+	var err error
+	switch item.Operation {
+	case kafka.EventTypeCreateAccount:
+		err = pg.InsertAccount(ctx, pg.Account{ID: item.UserID, OwnerID: item.UserID, Type: pg.AccountWallet, Balance: item.Amount}, tx)
+	case kafka.EventTypeAddBalance:
+		err = pg.UpdateBalance(ctx, item.UserID, item.Amount, tx)
+	case kafka.EventTypeDeductBalance:
+		entry.Amount = -item.Amount
+		err = pg.UpdateBalance(ctx, item.UserID, -item.Amount, tx)
+		if err == nil {
+			err = enforceLimits(ctx, item.UserID, item.Amount, tx)
+		}
+	default:
+		err = fmt.Errorf("%w: unknown batch operation %q", ErrInvalidArgument, item.Operation)
+	}
+	if err == nil {
+		err = postCounterEntry(ctx, entry.Amount, tx)
+	}
+	if err != nil {
+		return nil, reject(err)
+	}
+
+	balance, err := pg.GetBalance(ctx, item.UserID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance: %w", err)
+	}
+	var eventType string
+	var event kafka.Message
+	switch item.Operation {
+	case kafka.EventTypeCreateAccount:
+		eventType, event = kafka.EventTypeAccountCreated, kafka.AccountCreatedEvent{UserID: item.UserID, InitialBalance: item.Amount, Balance: balance}
+	case kafka.EventTypeAddBalance:
+		eventType, event = kafka.EventTypeBalanceCredited, kafka.BalanceCreditedEvent{UserID: item.UserID, Amount: item.Amount, Balance: balance}
+	default:
+		eventType, event = kafka.EventTypeBalanceDebited, kafka.BalanceDebitedEvent{UserID: item.UserID, Amount: item.Amount, Balance: balance}
+	}
+	if err := recordEvent(ctx, tx, meta.CausedBy(eventType), item.UserID, event); err != nil {
+		return nil, err
+	}
+	entries := []pg.LedgerEntry{entry}
+	if item.Operation == kafka.EventTypeDeductBalance {
+		feeEntry, err := chargeFee(ctx, meta, item.UserID, item.Operation, item.Amount, tx)
+		if err != nil {
+			return nil, err
+		}
+		if feeEntry != nil {
+			entries = append(entries, *feeEntry)
+		}
+	}
+	if err := pg.SetCommandResult(ctx, item.EventID, pg.CommandApplied, "", tx); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// rejectBatch records every item of a failed all-or-nothing batch as
+// rejected, with OperationRejected events, in a transaction of its own that
+// claims the batch command.
+func rejectBatch(ctx context.Context, meta kafka.EventMeta, msg kafka.ApplyBatchMessage, failed int, cause error) error {
+	_, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		for i, item := range msg.Items {
+			reason := fmt.Sprintf("batch rolled back: item %d failed", failed)
+			if i == failed {
+				reason = cause.Error()
+			}
+			itemMeta := kafka.EventMeta{EventID: item.EventID, Type: item.Operation, CorrelationID: meta.CorrelationID}
+			event := kafka.OperationRejectedEvent{UserID: item.UserID, Operation: item.Operation, Amount: item.Amount, Reason: reason}
+			if err := recordEvent(ctx, tx, itemMeta.CausedBy(kafka.EventTypeOperationRejected), item.UserID, event); err != nil {
+				return err
+			}
+			if err := pg.SetCommandResult(ctx, item.EventID, pg.CommandRejected, reason, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record rejection of batch %s: %w", msg.BatchID, err)
+	}
+	return nil
+}
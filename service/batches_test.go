@@ -0,0 +1,174 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitBatchValidatesEveryItem(t *testing.T) {
+	_, err := service.SubmitBatch(context.Background(), []service.BatchItemRequest{
+		{Operation: service.BatchOpAdd, UserID: "user-1", Amount: 10},
+		{Operation: "transfer", UserID: "user-2", Amount: 10},
+		{Operation: service.BatchOpDeduct, UserID: "", Amount: 10},
+		{Operation: service.BatchOpCreate, UserID: "user-3", Amount: -1},
+	}, false)
+
+	var invalid *service.BatchValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+	require.Len(t, invalid.Items, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{invalid.Items[0].Index, invalid.Items[1].Index, invalid.Items[2].Index})
+}
+
+// stubBatchStore captures the batch rows and outbox messages SubmitBatch
+// writes.
+func stubBatchStore(p *gomonkey.Patches) (*[]pg.BatchItem, *[]pg.OutboxMessage) {
+	var rows []pg.BatchItem
+	var outbox []pg.OutboxMessage
+	p.ApplyFunc(pg.CreateBatch,
+		func(_ context.Context, _ pg.Batch, items []pg.BatchItem, _ *sql.Tx) error {
+			rows = items
+			return nil
+		})
+	p.ApplyFunc(pg.InsertOutboxMessages,
+		func(_ context.Context, msgs []pg.OutboxMessage, _ *sql.Tx) error {
+			outbox = msgs
+			return nil
+		})
+	return &rows, &outbox
+}
+
+var payroll = []service.BatchItemRequest{
+	{Operation: service.BatchOpCreate, UserID: "user-1", Amount: 0},
+	{Operation: service.BatchOpAdd, UserID: "user-1", Amount: 100},
+	{Operation: service.BatchOpDeduct, UserID: "user-2", Amount: 5},
+}
+
+func TestSubmitBatchQueuesOneCommandPerItem(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	rows, outbox := stubBatchStore(patches)
+
+	id, err := service.SubmitBatch(context.Background(), payroll, false)
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+	require.Len(t, *rows, 3)
+	require.Len(t, *outbox, 3)
+	for i, msg := range *outbox {
+		assert.Equal(t, (*rows)[i].EventID, msg.EventID)
+		assert.Equal(t, (*rows)[i].Operation, msg.Headers[kafka.HeaderEventType])
+		assert.Equal(t, payroll[i].UserID, msg.Key)
+	}
+	assert.Equal(t, kafka.TopicCreateAccount, (*outbox)[0].Topic)
+	assert.Equal(t, kafka.TopicAddBalance, (*outbox)[1].Topic)
+	assert.Equal(t, kafka.TopicDeductBalance, (*outbox)[2].Topic)
+}
+
+func TestSubmitBatchAllOrNothingQueuesOneCommand(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	rows, outbox := stubBatchStore(patches)
+
+	id, err := service.SubmitBatch(context.Background(), payroll, true)
+
+	require.NoError(t, err)
+	require.Len(t, *rows, 3)
+	require.Len(t, *outbox, 1)
+	assert.Equal(t, kafka.TopicApplyBatch, (*outbox)[0].Topic)
+	assert.Equal(t, id, (*outbox)[0].Key)
+	assert.Equal(t, kafka.EventTypeApplyBatch, (*outbox)[0].Headers[kafka.HeaderEventType])
+}
+
+func TestHandleApplyBatchRejectsEveryItemOnFailure(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	stubOutbox(patches, 0)
+
+	results := map[string]string{}
+	patches.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, eventID, status, _ string, _ *sql.Tx) error {
+			results[eventID] = status
+			return nil
+		})
+	patches.ApplyFunc(pg.LockBalances,
+		func(_ context.Context, userIDs []string, _ *sql.Tx) error {
+			assert.Equal(t, []string{"user-1", "user-2"}, userIDs)
+			return nil
+		})
+	patches.ApplyFunc(pg.InsertAccount,
+		func(_ context.Context, _ pg.Account, _ *sql.Tx) error { return nil })
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, user string, _ float64, _ *sql.Tx) error {
+			if user == "user-2" {
+				return pg.ErrAccountNotFound
+			}
+			return nil
+		})
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, _ []pg.LedgerEntry, _ *sql.Tx) error {
+			t.Error("nothing should reach the ledger")
+			return nil
+		})
+
+	msg := kafka.ApplyBatchMessage{BatchID: "batch-1", Items: []kafka.BatchItem{
+		{EventID: "item-0", Operation: kafka.EventTypeCreateAccount, UserID: "user-1"},
+		{EventID: "item-1", Operation: kafka.EventTypeAddBalance, UserID: "user-1", Amount: 100},
+		{EventID: "item-2", Operation: kafka.EventTypeDeductBalance, UserID: "user-2", Amount: 5},
+	}}
+	err := service.HandleApplyBatch(kafka.EventMeta{EventID: "evt-batch"}, msg)
+
+	assert.ErrorContains(t, err, "item 2")
+	assert.Equal(t, map[string]string{
+		"item-0": pg.CommandRejected,
+		"item-1": pg.CommandRejected,
+		"item-2": pg.CommandRejected,
+	}, results)
+}
+
+func TestHandleApplyBatchRejectsFailedFee(t *testing.T) {
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	stubOutbox(patches, 75)
+	stubAccountType(patches, pg.AccountWallet)
+
+	results := map[string]string{}
+	patches.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, eventID, status, _ string, _ *sql.Tx) error {
+			results[eventID] = status
+			return nil
+		})
+	patches.ApplyFunc(pg.LockBalances,
+		func(_ context.Context, _ []string, _ *sql.Tx) error { return nil })
+	// The account is frozen between the deduction and its fee.
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, account string, delta float64, _ *sql.Tx) error {
+			if account == "user-1" && delta == -0.55 {
+				return pg.ErrAccountFrozen
+			}
+			return nil
+		})
+
+	msg := kafka.ApplyBatchMessage{BatchID: "batch-2", Items: []kafka.BatchItem{
+		{EventID: "item-0", Operation: kafka.EventTypeDeductBalance, UserID: "user-1", Amount: 5},
+	}}
+	err := service.HandleApplyBatch(kafka.EventMeta{EventID: "evt-batch-2"}, msg)
+
+	assert.ErrorContains(t, err, "item 0")
+	assert.Equal(t, map[string]string{"item-0": pg.CommandRejected}, results)
+}
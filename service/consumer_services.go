@@ -2,187 +2,372 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
 	"ledger/kafka"
-	"ledger/mongo"
 	"ledger/pg"
 	"log"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
+// consumersDone tracks the goroutines draining consumer channels so shutdown
+// can wait for in-flight messages to finish.
+var consumersDone sync.WaitGroup
+
+// Retry delays for a message that failed for a reason other than its
+// content, such as Postgres being unavailable.
+const (
+	consumerRetryBackoff    = 500 * time.Millisecond
+	maxConsumerRetryBackoff = 30 * time.Second
+)
+
+// errMalformed marks a command that can never be handled, so it is skipped
+// instead of retried.
+var errMalformed = errors.New("malformed command")
+
+// Initialize starts consuming the ledger topics. Cancelling ctx stops reading
+// new messages; messages already received are still handled and can be
+// waited for with WaitForConsumers.
+//
+// A message's offset is stored only once it is applied, rejected or found
+// malformed. Any other failure is retried until it succeeds, so a command is
+// never skipped; if ctx is cancelled first, the consumer stops without
+// storing that offset or any later one, and the messages are redelivered.
 func Initialize(ctx context.Context) {
 	// Create consumer handler for topics
-	handler := kafka.NewConsumerHandler([]string{
-		kafka.TopicCreateAccount,
-		kafka.TopicAddBalance,
-		kafka.TopicDeductBalance,
-	})
+	handler := kafka.NewConsumerHandler(kafka.CommandTopics)
 	handler.StartConsuming(ctx)
 
+	consumersDone.Add(1)
 	go func() {
+		defer consumersDone.Done()
 		for msg := range handler.MessageChannel {
-			log.Printf("Received message on topic %s: %s\n", *msg.TopicPartition.Topic, msg.Value)
-			switch *msg.TopicPartition.Topic {
-			case kafka.TopicAddBalance:
-				var addBalanceMsg kafka.AddBalanceMessage
-				if err := json.Unmarshal(msg.Value, &addBalanceMsg); err != nil {
-					log.Printf("Failed to unmarshal add-balance message: %v\n", err)
-					continue
-				}
-				err := HandleAddBalance(addBalanceMsg)
-				if err != nil {
-					log.Printf("Failed to handle add-balance message: %v\n", err)
-					continue
-				}
-				log.Printf("User %s added balance: %f\n", addBalanceMsg.UserID, addBalanceMsg.Amount)
-			case kafka.TopicDeductBalance:
-				var deductBalanceMsg kafka.DeductBalanceMessage
-				if err := json.Unmarshal(msg.Value, &deductBalanceMsg); err != nil {
-					log.Printf("Failed to unmarshal deduct-balance message: %v\n", err)
-					continue
+			if err := handleUntilSettled(ctx, msg); err != nil {
+				log.Printf("Stopped handling messages: %v\n", err)
+				// Drain without handling so the consume loop can exit.
+				for range handler.MessageChannel {
 				}
-				err := HandleDeductBalance(deductBalanceMsg)
-				if err != nil {
-					log.Printf("Failed to handle deduct-balance message: %v\n", err)
-					continue
-				}
-				log.Printf("User %s deducted balance: %f\n", deductBalanceMsg.UserID, deductBalanceMsg.Amount)
-			case kafka.TopicCreateAccount:
-				var createAccountMsg kafka.CreateAccountMessage
-				if err := json.Unmarshal(msg.Value, &createAccountMsg); err != nil {
-
-					log.Printf("Failed to unmarshal create-account message: %v\n", err)
-					continue
-				}
-				err := HandleCreateAccount(createAccountMsg)
-				if err != nil {
-					log.Printf("Failed to handle deduct-balance message: %v\n", err)
-					continue
-				}
-				log.Printf("User %s created account with initial balance: %f\n", createAccountMsg.UserID, createAccountMsg.InitialBalance)
-			default:
-				log.Printf("Unknown topic: %s\n", *msg.TopicPartition.Topic)
+				return
 			}
+			kafka.MarkProcessed(msg)
 		}
 	}()
 }
 
-func HandleCreateAccount(msg kafka.CreateAccountMessage) error {
-	ctx := context.Background()
-
-	tx, err := pg.DB.BeginTx(ctx, nil)
-	if err != nil {
-		log.Printf("Failed to begin transaction: %v\n", err)
-		return err
+// handleUntilSettled handles msg, retrying with backoff while it fails,
+// until it settles or ctx is cancelled.
+func handleUntilSettled(ctx context.Context, msg *confluent.Message) error {
+	wait := consumerRetryBackoff
+	for {
+		err := handleMessage(msg)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Retrying message %v in %s: %v\n", msg.TopicPartition, wait, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up on message %v: %w", msg.TopicPartition, err)
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, maxConsumerRetryBackoff)
 	}
+}
 
-	// Update balance synchronously inside transaction
-	err = pg.CreateNewAccount(ctx, msg.UserID, float64(msg.InitialBalance), tx)
-	if err != nil {
-		_ = tx.Rollback()
-		return fmt.Errorf("failed to update balance: %w", err)
-	}
+// WaitForConsumers blocks until every consumer goroutine has drained its
+// channel or ctx expires.
+func WaitForConsumers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		consumersDone.Wait()
+		close(done)
+	}()
 
-	// Commit the transaction before recording in Mongo
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for consumers to drain: %w", ctx.Err())
 	}
+}
 
-	records := []mongo.LedgerRecord{
-		{
-			UserID:        msg.UserID,
-			Operation:     "CreateAccount",
-			Amount:        msg.InitialBalance,
-			TransactionID: uuid.New().String(),
-		},
+// unsettled returns a handler's error if handling the message again could
+// succeed, and nil for a command that was rejected or is malformed.
+func unsettled(err error) error {
+	if rejection(err) != nil || errors.Is(err, errMalformed) {
+		return nil
 	}
+	return err
+}
 
-	err = mongo.RecordTransaction(ctx, records)
+// handleMessage dispatches a consumed command on its envelope event type, so
+// the same code serves the per-operation topics and the unified topic. It
+// returns an error only if the message should be handled again; malformed
+// messages are logged and skipped.
+func handleMessage(msg *confluent.Message) error {
+	meta, err := kafka.ReadEventMeta(msg)
 	if err != nil {
-		return fmt.Errorf("failed to record ledger transaction: %w", err)
+		log.Printf("Failed to read envelope on topic %s: %v\n", *msg.TopicPartition.Topic, err)
+		return nil
 	}
+	log.Printf("Received %s event %s on topic %s\n", meta.Type, meta.EventID, *msg.TopicPartition.Topic)
 
-	log.Printf("Handled account creation for user %s with initial balance %f\n", msg.UserID, msg.InitialBalance)
+	switch meta.Type {
+	case kafka.EventTypeAddBalance:
+		var addBalanceMsg kafka.AddBalanceMessage
+		if err := kafka.Decode(msg, &addBalanceMsg); err != nil {
+			log.Printf("Failed to decode add-balance message: %v\n", err)
+			return nil
+		}
+		err := HandleAddBalance(meta, addBalanceMsg)
+		if err != nil {
+			log.Printf("Failed to handle add-balance message: %v\n", err)
+			return unsettled(err)
+		}
+		log.Printf("User %s added balance: %f\n", addBalanceMsg.UserID, addBalanceMsg.Amount)
+	case kafka.EventTypeDeductBalance:
+		var deductBalanceMsg kafka.DeductBalanceMessage
+		if err := kafka.Decode(msg, &deductBalanceMsg); err != nil {
+			log.Printf("Failed to decode deduct-balance message: %v\n", err)
+			return nil
+		}
+		err := HandleDeductBalance(meta, deductBalanceMsg)
+		if err != nil {
+			log.Printf("Failed to handle deduct-balance message: %v\n", err)
+			return unsettled(err)
+		}
+		log.Printf("User %s deducted balance: %f\n", deductBalanceMsg.UserID, deductBalanceMsg.Amount)
+	case kafka.EventTypeCreateAccount:
+		var createAccountMsg kafka.CreateAccountMessage
+		if err := kafka.Decode(msg, &createAccountMsg); err != nil {
+			log.Printf("Failed to decode create-account message: %v\n", err)
+			return nil
+		}
+		err := HandleCreateAccount(meta, createAccountMsg)
+		if err != nil {
+			log.Printf("Failed to handle create-account message: %v\n", err)
+			return unsettled(err)
+		}
+		log.Printf("User %s created account with initial balance: %f\n", createAccountMsg.UserID, createAccountMsg.InitialBalance)
+	case kafka.EventTypeApplyBatch:
+		var batchMsg kafka.ApplyBatchMessage
+		if err := kafka.Decode(msg, &batchMsg); err != nil {
+			log.Printf("Failed to decode apply-batch message: %v\n", err)
+			return nil
+		}
+		if err := HandleApplyBatch(meta, batchMsg); err != nil {
+			log.Printf("Failed to handle apply-batch message: %v\n", err)
+			return unsettled(err)
+		}
+		log.Printf("Applied batch %s with %d item(s)\n", batchMsg.BatchID, len(batchMsg.Items))
+	case kafka.EventTypePostJournalEntry:
+		var entryMsg kafka.PostJournalEntryMessage
+		if err := kafka.Decode(msg, &entryMsg); err != nil {
+			log.Printf("Failed to decode journal entry message: %v\n", err)
+			return nil
+		}
+		if err := HandlePostJournalEntry(meta, entryMsg); err != nil {
+			log.Printf("Failed to handle journal entry message: %v\n", err)
+			return unsettled(err)
+		}
+	case kafka.EventTypeChangeAccountStatus:
+		var statusMsg kafka.ChangeAccountStatusMessage
+		if err := kafka.Decode(msg, &statusMsg); err != nil {
+			log.Printf("Failed to decode account-status message: %v\n", err)
+			return nil
+		}
+		if err := HandleChangeAccountStatus(meta, statusMsg); err != nil {
+			log.Printf("Failed to handle account-status message: %v\n", err)
+			return unsettled(err)
+		}
+	default:
+		log.Printf("Unknown event type %q on topic %s\n", meta.Type, *msg.TopicPartition.Topic)
+	}
 	return nil
 }
 
-func HandleAddBalance(msg kafka.AddBalanceMessage) error {
+// HandleCreateAccount applies a create-account command. The ledger record's
+// TransactionID is the command's event ID. Like the other handlers it
+// claims that ID first, so a redelivered command is skipped, and writes its
+// domain event to the outbox in the same serializable transaction, or an
+// OperationRejected event if the command fails, and runs the transaction
+// again if it loses a race.
+func HandleCreateAccount(meta kafka.EventMeta, msg kafka.CreateAccountMessage) error {
 	ctx := context.Background()
 
-	tx, err := pg.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	account := pg.Account{
+		ID:      msg.UserID,
+		OwnerID: msg.OwnerID,
+		Name:    msg.Name,
+		Type:    msg.Type,
+		Labels:  msg.Labels,
+		Balance: msg.InitialBalance,
 	}
-
-	err = pg.UpdateBalance(ctx, msg.UserID, float64(msg.Amount), tx)
-	if err != nil {
-		_ = tx.Rollback()
-		return fmt.Errorf("failed to update balance: %w", err)
+	if account.OwnerID == "" {
+		account.OwnerID = msg.UserID
 	}
-
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if account.Type == "" {
+		account.Type = pg.AccountWallet
 	}
 
-	records := []mongo.LedgerRecord{
-		{
-			UserID:        msg.UserID,
-			Operation:     "AddBalance",
-			Amount:        float64(msg.Amount),
-			TransactionID: uuid.New().String(),
-		},
-	}
+	applied, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		// Update balance synchronously inside transaction
+		err := pg.InsertAccount(ctx, account, tx)
+		if err == nil {
+			err = postCounterEntry(ctx, msg.InitialBalance, tx)
+		}
+		if err != nil {
+			return reject(err)
+		}
 
-	if err := mongo.RecordTransaction(ctx, records); err != nil {
-		return fmt.Errorf("failed to record ledger transaction: %w", err)
+		balance, err := pg.GetBalance(ctx, msg.UserID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read balance: %w", err)
+		}
+		event := kafka.AccountCreatedEvent{UserID: msg.UserID, InitialBalance: msg.InitialBalance, Balance: balance,
+			OwnerID: account.OwnerID, Type: account.Type}
+		if err = recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeAccountCreated), msg.UserID, event); err != nil {
+			return fmt.Errorf("failed to record account-created event: %w", err)
+		}
+		entries := []pg.LedgerEntry{
+			{
+				AccountID:      msg.UserID,
+				Operation:      "CreateAccount",
+				Amount:         msg.InitialBalance,
+				TransactionID:  meta.EventID,
+				CounterAccount: pg.CashClearingAccount,
+			},
+		}
+		if err = pg.InsertLedgerEntries(ctx, entries, tx); err != nil {
+			return err
+		}
+		return pg.SetCommandResult(ctx, meta.EventID, pg.CommandApplied, "", tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectOperation(ctx, meta, msg.UserID, msg.InitialBalance, cause); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	if err != nil || !applied {
+		return err
 	}
 
-	log.Printf("Handled balance addition for user %s with amount %f\n", msg.UserID, msg.Amount)
+	log.Printf("Handled account creation for user %s with initial balance %f\n", msg.UserID, msg.InitialBalance)
 	return nil
 }
 
-func HandleDeductBalance(msg kafka.DeductBalanceMessage) error {
+func HandleAddBalance(meta kafka.EventMeta, msg kafka.AddBalanceMessage) error {
 	ctx := context.Background()
 
-	tx, err := pg.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
+	applied, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		err := checkVersion(ctx, msg.UserID, msg.ExpectedVersion, tx)
+		if err == nil {
+			err = pg.UpdateBalance(ctx, msg.UserID, float64(msg.Amount), tx)
+		}
+		if err == nil {
+			err = postCounterEntry(ctx, msg.Amount, tx)
+		}
+		if err != nil {
+			return reject(err)
+		}
 
-	err = pg.UpdateBalance(ctx, msg.UserID, float64(-msg.Amount), tx)
-	if err != nil {
-		_ = tx.Rollback()
+		balance, err := pg.GetBalance(ctx, msg.UserID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read balance: %w", err)
+		}
+		event := kafka.BalanceCreditedEvent{UserID: msg.UserID, Amount: msg.Amount, Balance: balance}
+		if err = recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeBalanceCredited), msg.UserID, event); err != nil {
+			return fmt.Errorf("failed to record balance-credited event: %w", err)
+		}
+		entries := []pg.LedgerEntry{
+			{
+				AccountID:      msg.UserID,
+				Operation:      "AddBalance",
+				Amount:         float64(msg.Amount),
+				TransactionID:  meta.EventID,
+				CounterAccount: pg.CashClearingAccount,
+			},
+		}
+		if err = pg.InsertLedgerEntries(ctx, entries, tx); err != nil {
+			return err
+		}
+		return pg.SetCommandResult(ctx, meta.EventID, pg.CommandApplied, "", tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectOperation(ctx, meta, msg.UserID, msg.Amount, cause); err != nil {
+			return err
+		}
 		return fmt.Errorf("failed to update balance: %w", err)
 	}
-
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if err != nil || !applied {
+		return err
 	}
 
-	records := []mongo.LedgerRecord{
-		{
-			UserID:        msg.UserID,
-			Operation:     "DeductBalance",
-			Amount:        float64(-msg.Amount),
-			TransactionID: uuid.New().String(),
-		},
-	}
+	log.Printf("Handled balance addition for user %s with amount %f\n", msg.UserID, msg.Amount)
+	return nil
+}
+
+func HandleDeductBalance(meta kafka.EventMeta, msg kafka.DeductBalanceMessage) error {
+	ctx := context.Background()
+
+	applied, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		err := checkVersion(ctx, msg.UserID, msg.ExpectedVersion, tx)
+		if err == nil {
+			err = pg.UpdateBalance(ctx, msg.UserID, float64(-msg.Amount), tx)
+		}
+		if err == nil {
+			err = enforceLimits(ctx, msg.UserID, msg.Amount, tx)
+		}
+		if err == nil {
+			err = postCounterEntry(ctx, -msg.Amount, tx)
+		}
+		if err != nil {
+			return reject(err)
+		}
 
-	if err := mongo.RecordTransaction(ctx, records); err != nil {
-		return fmt.Errorf("failed to record ledger transaction: %w", err)
+		balance, err := pg.GetBalance(ctx, msg.UserID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read balance: %w", err)
+		}
+		event := kafka.BalanceDebitedEvent{UserID: msg.UserID, Amount: msg.Amount, Balance: balance}
+		if err = recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeBalanceDebited), msg.UserID, event); err != nil {
+			return fmt.Errorf("failed to record balance-debited event: %w", err)
+		}
+		feeEntry, err := chargeFee(ctx, meta, msg.UserID, kafka.EventTypeDeductBalance, msg.Amount, tx)
+		if err != nil {
+			return err
+		}
+		entries := []pg.LedgerEntry{
+			{
+				AccountID:      msg.UserID,
+				Operation:      "DeductBalance",
+				Amount:         float64(-msg.Amount),
+				TransactionID:  meta.EventID,
+				CounterAccount: pg.CashClearingAccount,
+			},
+		}
+		if feeEntry != nil {
+			entries = append(entries, *feeEntry)
+		}
+		if err = pg.InsertLedgerEntries(ctx, entries, tx); err != nil {
+			return err
+		}
+		return pg.SetCommandResult(ctx, meta.EventID, pg.CommandApplied, "", tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectOperation(ctx, meta, msg.UserID, msg.Amount, cause); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	if err != nil || !applied {
+		return err
 	}
 
 	log.Printf("Handled balance deduction for user %s with amount %f\n", msg.UserID, msg.Amount)
 	return nil
 }
-
-func GetUserLogs(userID string) ([]mongo.LedgerRecord, error) {
-	records, err := mongo.GetUserLogs(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user logs: %w", err)
-	}
-	return records, nil
-}
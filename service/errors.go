@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"ledger/limits"
+	"ledger/pg"
+	"math"
+	"strings"
+)
+
+// ErrInvalidArgument is wrapped by errors caused by bad caller input, so
+// transports can map it to 400 / InvalidArgument.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// ErrNotFound is wrapped by errors for resources that do not exist, so
+// transports can map it to 404 / NotFound.
+var ErrNotFound = errors.New("not found")
+
+// Account state errors. The consumer rejects commands that hit them with an
+// OperationRejected event carrying the error text. Transports map a missing
+// account to 404 / NotFound and the rest to 409 / FailedPrecondition.
+var (
+	ErrAccountNotFound         = pg.ErrAccountNotFound
+	ErrAccountFrozen           = pg.ErrAccountFrozen
+	ErrAccountClosed           = pg.ErrAccountClosed
+	ErrAccountExists           = pg.ErrAccountExists
+	ErrNonZeroBalance          = errors.New("account balance must be zero to close")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrCurrencyMismatch        = errors.New("leg currency does not match account currency")
+)
+
+// ErrLimitExceeded is wrapped by the error of a debit that would break a
+// velocity limit. The consumer rejects the command with an
+// OperationRejected event carrying the error text.
+var ErrLimitExceeded = limits.ErrExceeded
+
+// ErrInvalidScheduleTransition is returned for pausing, resuming or
+// cancelling a payment schedule whose status does not allow it. Transports
+// map it to 409 / FailedPrecondition.
+var ErrInvalidScheduleTransition = errors.New("invalid payment schedule status transition")
+
+// ErrAlreadyReversed is returned for reversing a journal entry that has
+// already been reversed. Transports map it to 409 / FailedPrecondition.
+var ErrAlreadyReversed = pg.ErrAlreadyReversed
+
+// ErrVersionConflict is wrapped by the error of a write whose expected
+// account version is no longer current. The consumer rejects such commands
+// with an OperationRejected event; transports map it to 412 / Aborted.
+var ErrVersionConflict = errors.New("account version conflict")
+
+func validateUserID(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidArgument)
+	}
+	if strings.HasPrefix(userID, pg.SystemAccountPrefix) {
+		return fmt.Errorf("%w: %s accounts are reserved for the ledger", ErrInvalidArgument, pg.SystemAccountPrefix)
+	}
+	return nil
+}
+
+func validateAmount(amount float64) error {
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: amount must be a positive number", ErrInvalidArgument)
+	}
+	return nil
+}
+
+func validateExpectedVersion(version int64) error {
+	if version < 0 {
+		return fmt.Errorf("%w: expected version must not be negative", ErrInvalidArgument)
+	}
+	return nil
+}
+
+func validateInitialBalance(amount float64) error {
+	if amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: initial balance must not be negative", ErrInvalidArgument)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/webhook"
+	"log"
+	"sync"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const (
+	outboxPollInterval = 500 * time.Millisecond
+	outboxBatchSize    = 100
+
+	outboxRelayLease = "outbox-relay"
+	// outboxRelayLeaseTTL lets another replica take over relaying this long
+	// after the relay holding the lease last renewed it.
+	outboxRelayLeaseTTL = 10 * time.Second
+)
+
+// recordEvent writes a domain event to the outbox and queues it for
+// subscribed webhooks inside tx, so it is published if and only if tx
+// commits. key is the account the event is about.
+func recordEvent(ctx context.Context, tx *sql.Tx, meta kafka.EventMeta, key string, event kafka.Message) error {
+	msg, err := kafka.EncodeMessage(kafka.TopicLedgerEvents, key, meta, event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", meta.Type, err)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s webhook payload: %w", meta.Type, err)
+	}
+	payload, err := json.Marshal(webhook.Payload{
+		EventID:    meta.EventID,
+		Type:       meta.Type,
+		OccurredAt: meta.OccurredAt,
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s webhook payload: %w", meta.Type, err)
+	}
+	if err := pg.EnqueueWebhookDeliveries(ctx, key, meta.EventID, meta.Type, payload, tx); err != nil {
+		return err
+	}
+
+	return pg.InsertOutbox(ctx, outboxMessage(meta, msg), tx)
+}
+
+// outboxMessage converts an encoded Kafka message into an outbox row.
+func outboxMessage(meta kafka.EventMeta, msg *confluent.Message) pg.OutboxMessage {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return pg.OutboxMessage{
+		EventID: meta.EventID,
+		Topic:   *msg.TopicPartition.Topic,
+		Key:     string(msg.Key),
+		Headers: headers,
+		Payload: msg.Value,
+	}
+}
+
+// serializable runs fn in a serializable transaction, running it again on
+// serialization failures and deadlocks. Consumer handlers read balances and
+// write them back, so weaker isolation could lose concurrent updates.
+func serializable(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return pg.InTx(ctx, sql.LevelSerializable, pg.DefaultRetryPolicy, fn)
+}
+
+// errDuplicateCommand rolls back the transaction of a command that was
+// already handled.
+var errDuplicateCommand = errors.New("command already handled")
+
+// applyCommand runs fn in a serializable transaction that first claims
+// meta's event ID, so a command delivered more than once is applied once.
+// It reports false, without calling fn, for a command already handled.
+func applyCommand(ctx context.Context, meta kafka.EventMeta, fn func(tx *sql.Tx) error) (bool, error) {
+	err := serializable(ctx, func(tx *sql.Tx) error {
+		claimed, err := pg.ClaimCommand(ctx, meta.EventID, meta.Type, tx)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return errDuplicateCommand
+		}
+		return fn(tx)
+	})
+	if errors.Is(err, errDuplicateCommand) {
+		log.Printf("Skipping %s event %s: already handled\n", meta.Type, meta.EventID)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// rejected marks an error that rejects the command being handled, as
+// opposed to one that fails to handle it. Handlers return it from their
+// transaction, through reject, and publish the rejection once the
+// transaction has rolled back. A serialization failure inside it is still
+// retried.
+type rejected struct{ err error }
+
+func (r *rejected) Error() string { return r.err.Error() }
+func (r *rejected) Unwrap() error { return r.err }
+
+// businessErrors are the errors that reject a command: handling it again
+// would fail the same way.
+var businessErrors = []error{
+	ErrInvalidArgument,
+	ErrAccountNotFound,
+	ErrAccountFrozen,
+	ErrAccountClosed,
+	ErrAccountExists,
+	ErrNonZeroBalance,
+	ErrInvalidStatusTransition,
+	ErrCurrencyMismatch,
+	ErrLimitExceeded,
+	ErrAlreadyReversed,
+	ErrVersionConflict,
+}
+
+// reject marks err as rejecting the command if it wraps one of
+// businessErrors. Any other error, such as a dropped connection or a
+// timeout, is returned as is so the consumer handles the command again.
+func reject(err error) error {
+	for _, target := range businessErrors {
+		if errors.Is(err, target) {
+			return &rejected{err}
+		}
+	}
+	return err
+}
+
+// rejection returns the cause wrapped in err if err rejects the command,
+// or nil if it doesn't. A serialization failure that outlasted the retries
+// does not reject the command: handling it again later can succeed.
+func rejection(err error) error {
+	var r *rejected
+	if errors.As(err, &r) && !pg.IsRetryable(r.err) {
+		return r.err
+	}
+	return nil
+}
+
+// rejectOperation publishes OperationRejected for a command that failed.
+// The command's own transaction has already rolled back, so the event is
+// written in a transaction of its own, which claims the command so a
+// redelivery is not applied after all.
+func rejectOperation(ctx context.Context, meta kafka.EventMeta, userID string, amount float64, cause error) error {
+	event := kafka.OperationRejectedEvent{
+		UserID:    userID,
+		Operation: meta.Type,
+		Amount:    amount,
+		Reason:    cause.Error(),
+	}
+	_, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		if err := recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeOperationRejected), userID, event); err != nil {
+			return err
+		}
+		return pg.SetCommandResult(ctx, meta.EventID, pg.CommandRejected, cause.Error(), tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record rejection of %s event %s: %w", meta.Type, meta.EventID, err)
+	}
+	return nil
+}
+
+var (
+	relayDone sync.WaitGroup
+	// outboxRelayOwner identifies this replica's outbox-relay lease.
+	outboxRelayOwner = newLeaseOwner()
+)
+
+// StartOutboxRelay publishes outbox rows to Kafka until ctx is cancelled,
+// then makes one final pass. Only the replica holding the outbox-relay
+// lease publishes, so rows for the same key reach Kafka in order.
+//
+// Delivery is at least once: a row is marked published only after Kafka
+// acknowledges it, and a crash in between republishes it. Consumers
+// deduplicate on the event ID; the ledger consumer applies a republished
+// command once, as it claims each event ID it handles.
+func StartOutboxRelay(ctx context.Context) {
+	relayDone.Add(1)
+	go func() {
+		defer relayDone.Done()
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				drainOutbox(context.Background())
+				if err := pg.ReleaseLease(context.Background(), outboxRelayLease, outboxRelayOwner, nil); err != nil {
+					log.Printf("Outbox relay: %v\n", err)
+				}
+				log.Println("Outbox relay stopped")
+				return
+			case <-ticker.C:
+				drainOutbox(ctx)
+			}
+		}
+	}()
+}
+
+// WaitForOutboxRelay blocks until the relay has made its final pass or ctx
+// expires.
+func WaitForOutboxRelay(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		relayDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for outbox relay: %w", ctx.Err())
+	}
+}
+
+// drainOutbox relays batches until the outbox is empty or a batch fails.
+func drainOutbox(ctx context.Context) {
+	for {
+		n, err := relayOutboxBatch(ctx)
+		if err != nil {
+			log.Printf("Outbox relay: %v\n", err)
+			return
+		}
+		if n < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// relayOutboxBatch publishes one batch of outbox rows if this replica holds
+// the outbox-relay lease. The lease is renewed in the batch's transaction,
+// so its row stays locked until the batch commits and no other replica can
+// take the lease over mid-batch, even if it runs out.
+func relayOutboxBatch(ctx context.Context) (int, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	held, err := pg.AcquireLease(ctx, outboxRelayLease, outboxRelayOwner, outboxRelayLeaseTTL, tx)
+	if err != nil || !held {
+		return 0, err
+	}
+
+	rows, err := pg.FetchUnpublished(ctx, outboxBatchSize, tx)
+	if err != nil {
+		return 0, err
+	}
+	// With nothing to publish, still commit to keep the lease.
+	if len(rows) > 0 {
+		if err := publishOutboxRows(ctx, rows, tx); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(rows), nil
+}
+
+// publishOutboxRows publishes rows and, once Kafka has acknowledged them
+// all, marks them published in tx.
+func publishOutboxRows(ctx context.Context, rows []pg.OutboxMessage, tx *sql.Tx) error {
+	messages := make([]*confluent.Message, 0, len(rows))
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		topic := row.Topic
+		msg := &confluent.Message{
+			TopicPartition: confluent.TopicPartition{Topic: &topic, Partition: confluent.PartitionAny},
+			Key:            []byte(row.Key),
+			Value:          row.Payload,
+		}
+		for k, v := range row.Headers {
+			msg.Headers = append(msg.Headers, confluent.Header{Key: k, Value: []byte(v)})
+		}
+		messages = append(messages, msg)
+		ids = append(ids, row.ID)
+	}
+
+	if err := kafka.PublishMessages(messages); err != nil {
+		return fmt.Errorf("failed to publish outbox batch: %w", err)
+	}
+	return pg.MarkPublished(ctx, ids, tx)
+}
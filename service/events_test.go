@@ -0,0 +1,54 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayOnce runs the outbox relay's final pass with one unpublished row
+// and returns how many messages it published.
+func relayOnce(t *testing.T, holdsLease bool) int {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	patches.ApplyFunc(pg.AcquireLease,
+		func(_ context.Context, _, _ string, _ time.Duration, _ *sql.Tx) (bool, error) {
+			return holdsLease, nil
+		})
+	patches.ApplyFunc(pg.ReleaseLease,
+		func(_ context.Context, _, _ string, _ *sql.Tx) error { return nil })
+	patches.ApplyFunc(pg.FetchUnpublished,
+		func(_ context.Context, _ int, _ *sql.Tx) ([]pg.OutboxMessage, error) {
+			return []pg.OutboxMessage{{ID: 1, EventID: "evt-1", Topic: kafka.TopicLedgerEvents, Key: "user-1"}}, nil
+		})
+	patches.ApplyFunc(pg.MarkPublished,
+		func(_ context.Context, _ []int64, _ *sql.Tx) error { return nil })
+	published := 0
+	patches.ApplyFunc(kafka.PublishMessages,
+		func(messages []*confluent.Message) error {
+			published += len(messages)
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.StartOutboxRelay(ctx)
+	require.NoError(t, service.WaitForOutboxRelay(context.Background()))
+	return published
+}
+
+func TestOutboxRelayPublishesOnlyWithLease(t *testing.T) {
+	assert.Equal(t, 1, relayOnce(t, true))
+	assert.Equal(t, 0, relayOnce(t, false), "another replica holds the outbox-relay lease")
+}
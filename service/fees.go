@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ledger/fees"
+	"ledger/kafka"
+	"ledger/pg"
+	"slices"
+	"strings"
+)
+
+// FeeOperation is the ledger record operation of fee lines.
+const FeeOperation = "Fee"
+
+// feeSchedule is charged by the consumer and quoted by the API.
+var feeSchedule fees.Schedule
+
+// SetFeeSchedule installs the fee schedule. Call it before Initialize.
+func SetFeeSchedule(schedule fees.Schedule) {
+	feeSchedule = schedule
+}
+
+// GetFeeSchedule returns the installed fee schedule.
+func GetFeeSchedule() fees.Schedule {
+	if feeSchedule == nil {
+		return fees.Schedule{}
+	}
+	return feeSchedule
+}
+
+// QuoteFee previews the fee operation would be charged for amount on
+// accountID, or on an account of accountType when accountID is empty.
+func QuoteFee(ctx context.Context, operation, accountID, accountType string, amount float64) (fees.Quote, error) {
+	if !slices.Contains(fees.Operations, operation) {
+		return fees.Quote{}, fmt.Errorf("%w: operation must be one of %s", ErrInvalidArgument, strings.Join(fees.Operations, ", "))
+	}
+	if err := validateAmount(amount); err != nil {
+		return fees.Quote{}, err
+	}
+	if accountID != "" {
+		account, err := pg.GetAccount(ctx, accountID, nil)
+		if err != nil {
+			return fees.Quote{}, err
+		}
+		accountType = account.Type
+	}
+	if accountType == "" {
+		accountType = pg.AccountWallet
+	}
+	if err := validateAccountType(accountType); err != nil {
+		return fees.Quote{}, err
+	}
+	return feeSchedule.Quote(operation, accountType, amount), nil
+}
+
+// CheckFeeRevenueAccount returns an error if fees are scheduled but the fee
+// revenue account is missing or not active. Call it at startup, after
+// SetFeeSchedule: every charged command would otherwise fail in the
+// consumer until the account is fixed.
+func CheckFeeRevenueAccount(ctx context.Context) error {
+	if len(feeSchedule) == 0 {
+		return nil
+	}
+	account, err := pg.GetAccount(ctx, pg.FeeRevenueAccount, nil)
+	if err != nil {
+		return fmt.Errorf("fee revenue account %s: %w", pg.FeeRevenueAccount, err)
+	}
+	if account.Status != pg.AccountActive {
+		return fmt.Errorf("fee revenue account %s is %s", pg.FeeRevenueAccount, account.Status)
+	}
+	return nil
+}
+
+// chargeFee charges the scheduled fee for an operation of amount on
+// accountID inside tx: it debits the account, credits fee revenue and
+// records FeeCharged. It returns the fee's ledger line, or nil if no fee
+// applies. Call it after the operation's own postings, so fee revenue is
+// locked after the account and cash-in clearing.
+//
+// Only a business error debiting the account rejects the command. A fee
+// revenue account that cannot take the posting is a setup error, which
+// CheckFeeRevenueAccount catches at startup; it and any other failure are
+// returned for the consumer to retry.
+func chargeFee(ctx context.Context, meta kafka.EventMeta, accountID, operation string, amount float64, tx *sql.Tx) (*pg.LedgerEntry, error) {
+	if len(feeSchedule) == 0 {
+		return nil, nil
+	}
+	account, err := pg.GetAccount(ctx, accountID, tx)
+	if err != nil {
+		return nil, err
+	}
+	fee := feeSchedule.Quote(operation, account.Type, amount).Fee
+	if fee == 0 {
+		return nil, nil
+	}
+
+	if err := pg.UpdateBalance(ctx, accountID, -fee, tx); err != nil {
+		return nil, reject(fmt.Errorf("failed to charge fee: %w", err))
+	}
+	if err := pg.UpdateBalance(ctx, pg.FeeRevenueAccount, fee, tx); err != nil {
+		return nil, fmt.Errorf("failed to post to %s: %w", pg.FeeRevenueAccount, err)
+	}
+
+	balance, err := pg.GetBalance(ctx, accountID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance: %w", err)
+	}
+	event := kafka.FeeChargedEvent{UserID: accountID, Operation: operation, Fee: fee, Balance: balance}
+	if err := recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeFeeCharged), accountID, event); err != nil {
+		return nil, fmt.Errorf("failed to record fee-charged event: %w", err)
+	}
+
+	return &pg.LedgerEntry{
+		AccountID:      accountID,
+		Operation:      FeeOperation,
+		Amount:         -fee,
+		TransactionID:  meta.EventID,
+		CounterAccount: pg.FeeRevenueAccount,
+	}, nil
+}
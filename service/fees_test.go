@@ -0,0 +1,202 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ledger/fees"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFeeSchedule = fees.Schedule{
+	{Operation: kafka.EventTypeDeductBalance, Flat: 0.5, Percent: 1},
+	{Operation: kafka.EventTypeDeductBalance, AccountType: pg.AccountSavings, Flat: 2},
+}
+
+func stubAccountType(p *gomonkey.Patches, accountType string) {
+	p.ApplyFunc(pg.GetAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			return pg.Account{ID: id, Type: accountType, Status: pg.AccountActive}, nil
+		})
+}
+
+func TestHandleDeductBalanceChargesFee(t *testing.T) {
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 73.75)
+	posted := stubPostings(patches)
+	stubAccountType(patches, pg.AccountWallet)
+
+	var recorded []pg.LedgerEntry
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			// Copy: the handler's slice may live on its stack.
+			recorded = append([]pg.LedgerEntry(nil), rec...)
+			return nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3"}, msg)
+	require.NoError(t, err)
+
+	// 0.50 flat + 1% of 25
+	assert.Equal(t, map[string]float64{"user-3": -25.75, pg.CashClearingAccount: -25, pg.FeeRevenueAccount: 0.75}, posted)
+
+	require.Len(t, *outbox, 2)
+	assert.Equal(t, "BalanceDebited", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, "FeeCharged", (*outbox)[1].Headers["event-type"])
+	assert.Equal(t, "evt-3", (*outbox)[1].Headers["causation-id"])
+
+	require.Len(t, recorded, 2)
+	assert.Equal(t, "DeductBalance", recorded[0].Operation)
+	assert.Equal(t, service.FeeOperation, recorded[1].Operation)
+	assert.Equal(t, -0.75, recorded[1].Amount)
+	assert.Equal(t, "evt-3", recorded[1].TransactionID)
+	assert.Equal(t, pg.FeeRevenueAccount, recorded[1].CounterAccount)
+}
+
+func TestHandleDeductBalanceRejectsFailedFee(t *testing.T) {
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 75)
+	stubAccountType(patches, pg.AccountWallet)
+	// The account is frozen between the deduction and its fee.
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, account string, delta float64, _ *sql.Tx) error {
+			if account == "user-3" && delta == -0.75 {
+				return pg.ErrAccountFrozen
+			}
+			return nil
+		})
+	var result string
+	patches.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, _, status, _ string, _ *sql.Tx) error {
+			result = status
+			return nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.ErrorIs(t, err, pg.ErrAccountFrozen)
+	assert.Equal(t, pg.CommandRejected, result)
+	// BalanceDebited was written in the transaction that rolled back.
+	require.Len(t, *outbox, 2)
+	assert.Equal(t, "OperationRejected", (*outbox)[1].Headers["event-type"])
+}
+
+func TestHandleDeductBalanceRetriesFeeRevenueFailure(t *testing.T) {
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 75)
+	stubAccountType(patches, pg.AccountWallet)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, account string, _ float64, _ *sql.Tx) error {
+			if account == pg.FeeRevenueAccount {
+				return pg.ErrAccountNotFound
+			}
+			return nil
+		})
+	patches.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, _, _, _ string, _ *sql.Tx) error {
+			t.Error("the command should stay pending so it is handled again")
+			return nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.ErrorContains(t, err, pg.FeeRevenueAccount)
+	// Only the BalanceDebited of the transaction that rolled back.
+	require.Len(t, *outbox, 1)
+	assert.Equal(t, "BalanceDebited", (*outbox)[0].Headers["event-type"])
+}
+
+func TestCheckFeeRevenueAccount(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	status := pg.AccountFrozen
+	patches.ApplyFunc(pg.GetAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			return pg.Account{ID: id, Type: "system", Status: status}, nil
+		})
+
+	assert.NoError(t, service.CheckFeeRevenueAccount(context.Background()), "no fees scheduled")
+
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+	assert.ErrorContains(t, service.CheckFeeRevenueAccount(context.Background()), "is frozen")
+
+	status = pg.AccountActive
+	assert.NoError(t, service.CheckFeeRevenueAccount(context.Background()))
+}
+
+func TestHandleDeductBalanceWithoutFeeRule(t *testing.T) {
+	service.SetFeeSchedule(fees.Schedule{{Operation: kafka.EventTypeDeductBalance, AccountType: pg.AccountSavings, Flat: 2}})
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 75)
+	posted := stubPostings(patches)
+	stubAccountType(patches, pg.AccountWallet)
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			assert.Len(t, rec, 1)
+			return nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	require.NoError(t, service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3"}, msg))
+
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, map[string]float64{"user-3": -25, pg.CashClearingAccount: -25}, posted)
+}
+
+func TestQuoteFee(t *testing.T) {
+	service.SetFeeSchedule(testFeeSchedule)
+	defer service.SetFeeSchedule(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	stubAccountType(patches, pg.AccountSavings)
+
+	quote, err := service.QuoteFee(context.Background(), kafka.EventTypeDeductBalance, "acc_1", "", 100)
+	require.NoError(t, err)
+	assert.Equal(t, pg.AccountSavings, quote.AccountType)
+	assert.Equal(t, 2.0, quote.Fee)
+	assert.Equal(t, 102.0, quote.Total)
+
+	quote, err = service.QuoteFee(context.Background(), kafka.EventTypeDeductBalance, "", "", 100)
+	require.NoError(t, err)
+	assert.Equal(t, pg.AccountWallet, quote.AccountType)
+	assert.Equal(t, 1.5, quote.Fee)
+
+	_, err = service.QuoteFee(context.Background(), "AddBalance", "", "", 100)
+	assert.True(t, errors.Is(err, service.ErrInvalidArgument))
+}
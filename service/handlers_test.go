@@ -3,14 +3,18 @@ package service_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"ledger/kafka"
-	"ledger/mongo"
 	"ledger/pg"
 	"ledger/service"
 	"reflect"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/jackc/pgconn"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,7 +22,8 @@ import (
 // helpers
 // ─────────────────────────────────────────────────────────────────────────────
 
-// noOpDB patches the parts of database/sql that the handlers touch.
+// noOpDB patches the parts of database/sql that the handlers touch and
+// treats every command as not yet handled.
 func noOpDB(p *gomonkey.Patches) {
 	// BeginTx returns a dummy *sql.Tx
 	p.ApplyMethod(reflect.TypeOf(&sql.DB{}), "BeginTx",
@@ -29,6 +34,52 @@ func noOpDB(p *gomonkey.Patches) {
 	// Commit / Rollback become no-ops
 	p.ApplyMethod(reflect.TypeOf(&sql.Tx{}), "Commit", func(_ *sql.Tx) error { return nil })
 	p.ApplyMethod(reflect.TypeOf(&sql.Tx{}), "Rollback", func(_ *sql.Tx) error { return nil })
+	// Rollback is small enough to be inlined, so stub the method it wraps too.
+	p.ApplyPrivateMethod(reflect.TypeOf(&sql.Tx{}), "rollback", func(_ *sql.Tx, _ bool) error { return nil })
+
+	// Every command is new.
+	p.ApplyFunc(pg.ClaimCommand, func(_ context.Context, _, _ string, _ *sql.Tx) (bool, error) { return true, nil })
+}
+
+// stubOutbox makes pg.GetBalance return balance and captures every outbox
+// message the handlers write. Webhook enqueues, batch item results and
+// ledger_entries mirror rows are accepted and dropped.
+func stubOutbox(p *gomonkey.Patches, balance float64) *[]pg.OutboxMessage {
+	var written []pg.OutboxMessage
+	p.ApplyFunc(pg.EnqueueWebhookDeliveries,
+		func(_ context.Context, _, _, _ string, _ []byte, _ *sql.Tx) error {
+			return nil
+		})
+	p.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, _, _, _ string, _ *sql.Tx) error {
+			return nil
+		})
+	p.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, _ []pg.LedgerEntry, _ *sql.Tx) error {
+			return nil
+		})
+	p.ApplyFunc(pg.GetBalance,
+		func(_ context.Context, _ string, _ *sql.Tx) (float64, error) {
+			return balance, nil
+		})
+	p.ApplyFunc(pg.InsertOutbox,
+		func(_ context.Context, msg pg.OutboxMessage, _ *sql.Tx) error {
+			written = append(written, msg)
+			return nil
+		})
+	return &written
+}
+
+// stubPostings makes pg.UpdateBalance succeed and sums the deltas posted to
+// each account.
+func stubPostings(p *gomonkey.Patches) map[string]float64 {
+	posted := map[string]float64{}
+	p.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, account string, delta float64, _ *sql.Tx) error {
+			posted[account] += delta
+			return nil
+		})
+	return posted
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -40,27 +91,37 @@ func TestHandleCreateAccount(t *testing.T) {
 	defer patches.Reset()
 
 	noOpDB(patches)
+	outbox := stubOutbox(patches, 100)
+	posted := stubPostings(patches)
 
-	// Stub pg.CreateNewAccount
-	patches.ApplyFunc(pg.CreateNewAccount,
-		func(_ context.Context, user string, amt float64, _ *sql.Tx) error {
-			assert.Equal(t, "user-1", user)
-			assert.Equal(t, 100.0, amt)
+	// Stub pg.InsertAccount
+	patches.ApplyFunc(pg.InsertAccount,
+		func(_ context.Context, account pg.Account, _ *sql.Tx) error {
+			assert.Equal(t, "user-1", account.ID)
+			assert.Equal(t, "user-1", account.OwnerID)
+			assert.Equal(t, pg.AccountWallet, account.Type)
+			assert.Equal(t, 100.0, account.Balance)
 			return nil
 		})
 
-	// Stub mongo.RecordTransaction
-	patches.ApplyFunc(mongo.RecordTransaction,
-		func(_ context.Context, rec []mongo.LedgerRecord) error {
+	// Stub pg.InsertLedgerEntries
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
 			assert.Len(t, rec, 1)
 			assert.Equal(t, "CreateAccount", rec[0].Operation)
+			assert.Equal(t, "evt-1", rec[0].TransactionID)
 			return nil
 		})
 
 	msg := kafka.CreateAccountMessage{InitialBalance: 100, BaseMessage: kafka.BaseMessage{UserID: "user-1"}}
-	err := service.HandleCreateAccount(msg)
+	err := service.HandleCreateAccount(kafka.EventMeta{EventID: "evt-1"}, msg)
 
 	assert.NoError(t, err)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, kafka.TopicLedgerEvents, (*outbox)[0].Topic)
+	assert.Equal(t, "AccountCreated", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, map[string]float64{pg.CashClearingAccount: 100}, posted)
+	assert.Equal(t, "evt-1", (*outbox)[0].Headers["causation-id"])
 }
 
 func TestHandleAddBalance(t *testing.T) {
@@ -68,26 +129,48 @@ func TestHandleAddBalance(t *testing.T) {
 	defer patches.Reset()
 
 	noOpDB(patches)
+	outbox := stubOutbox(patches, 150)
 
-	// Stub pg.UpdateBalance
-	patches.ApplyFunc(pg.UpdateBalance,
-		func(_ context.Context, user string, delta float64, _ *sql.Tx) error {
-			assert.Equal(t, "user-2", user)
-			assert.Equal(t, 50.0, delta)
-			return nil
-		})
+	posted := stubPostings(patches)
 
-	// Stub mongo.RecordTransaction
-	patches.ApplyFunc(mongo.RecordTransaction,
-		func(_ context.Context, rec []mongo.LedgerRecord) error {
+	// Stub pg.InsertLedgerEntries
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
 			assert.Equal(t, "AddBalance", rec[0].Operation)
+			assert.Equal(t, pg.CashClearingAccount, rec[0].CounterAccount)
 			return nil
 		})
 
 	msg := kafka.AddBalanceMessage{Amount: 50, BaseMessage: kafka.BaseMessage{UserID: "user-2"}}
-	err := service.HandleAddBalance(msg)
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-2"}, msg)
 
 	assert.NoError(t, err)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, kafka.TopicLedgerEvents, (*outbox)[0].Topic)
+	assert.Equal(t, "BalanceCredited", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, map[string]float64{"user-2": 50, pg.CashClearingAccount: 50}, posted)
+	assert.Equal(t, "evt-2", (*outbox)[0].Headers["causation-id"])
+}
+
+func TestHandleAddBalanceSkipsHandledCommand(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 150)
+	posted := stubPostings(patches)
+	patches.ApplyFunc(pg.ClaimCommand,
+		func(_ context.Context, eventID, _ string, _ *sql.Tx) (bool, error) {
+			assert.Equal(t, "evt-10", eventID)
+			return false, nil
+		})
+
+	msg := kafka.AddBalanceMessage{Amount: 50, BaseMessage: kafka.BaseMessage{UserID: "user-10"}}
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-10", Type: kafka.EventTypeAddBalance}, msg)
+
+	assert.NoError(t, err)
+	assert.Empty(t, posted)
+	assert.Empty(t, *outbox)
 }
 
 func TestHandleDeductBalance(t *testing.T) {
@@ -95,24 +178,316 @@ func TestHandleDeductBalance(t *testing.T) {
 	defer patches.Reset()
 
 	noOpDB(patches)
+	outbox := stubOutbox(patches, 75)
+
+	// Negative amounts are posted for withdrawals
+	posted := stubPostings(patches)
+
+	// Stub pg.InsertLedgerEntries
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			assert.Equal(t, "DeductBalance", rec[0].Operation)
+			return nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3"}, msg)
+
+	assert.NoError(t, err)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, kafka.TopicLedgerEvents, (*outbox)[0].Topic)
+	assert.Equal(t, "BalanceDebited", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, map[string]float64{"user-3": -25, pg.CashClearingAccount: -25}, posted)
+	assert.Equal(t, "evt-3", (*outbox)[0].Headers["causation-id"])
+}
+
+func TestHandleDeductBalanceRejected(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
 
-	// Stub pg.UpdateBalance (negative amount is passed in handler)
 	patches.ApplyFunc(pg.UpdateBalance,
-		func(_ context.Context, user string, delta float64, _ *sql.Tx) error {
-			assert.Equal(t, "user-3", user)
-			assert.Equal(t, -25.0, delta)
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return pg.ErrAccountFrozen
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-4"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-4", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.Error(t, err)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+
+	var event kafka.OperationRejectedEvent
+	decoded := &confluent.Message{Value: (*outbox)[0].Payload}
+	assert.NoError(t, kafka.Decode(decoded, &event))
+	assert.Equal(t, "user-4", event.UserID)
+	assert.Equal(t, "DeductBalance", event.Operation)
+	assert.Contains(t, event.Reason, pg.ErrAccountFrozen.Error())
+}
+
+func TestHandleDeductBalanceStaleVersion(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	posted := stubPostings(patches)
+	patches.ApplyFunc(pg.LockAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			return pg.Account{ID: id, Balance: 100, Version: 3, Status: pg.AccountActive}, nil
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, ExpectedVersion: 2, BaseMessage: kafka.BaseMessage{UserID: "user-5"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-5", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.ErrorIs(t, err, service.ErrVersionConflict)
+	assert.Empty(t, posted)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
+
+func TestHandleAddBalanceCurrentVersion(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 150)
+	posted := stubPostings(patches)
+	patches.ApplyFunc(pg.LockAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			return pg.Account{ID: id, Balance: 100, Version: 3, Status: pg.AccountActive}, nil
+		})
+
+	msg := kafka.AddBalanceMessage{Amount: 50, ExpectedVersion: 3, BaseMessage: kafka.BaseMessage{UserID: "user-6"}}
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-6"}, msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"user-6": 50, pg.CashClearingAccount: 50}, posted)
+	assert.Equal(t, "BalanceCredited", (*outbox)[0].Headers["event-type"])
+}
+
+func TestAddAmountStaleVersionFailsFast(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	patches.ApplyFunc(pg.GetBalanceVersion,
+		func(_ context.Context, _ string, _ *sql.Tx) (float64, int64, error) {
+			return 100, 4, nil
+		})
+	patches.ApplyFunc(kafka.SendAddBalanceMessage,
+		func(_ context.Context, _ kafka.AddBalanceMessage) error {
+			t.Error("a stale write should not be queued")
 			return nil
 		})
 
-	// Stub mongo.RecordTransaction
-	patches.ApplyFunc(mongo.RecordTransaction,
-		func(_ context.Context, rec []mongo.LedgerRecord) error {
-			assert.Equal(t, "DeductBalance", rec[0].Operation)
+	err := service.AddAmount(context.Background(), "user-7", 10, 3)
+
+	assert.ErrorIs(t, err, service.ErrVersionConflict)
+}
+
+func TestHandleAddBalanceRetriesSerializationFailure(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 150)
+
+	var isolation sql.IsolationLevel
+	patches.ApplyMethod(reflect.TypeOf(&sql.DB{}), "BeginTx",
+		func(_ *sql.DB, _ context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+			isolation = opts.Isolation
+			return &sql.Tx{}, nil
+		})
+	attempts := 0
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			attempts++
+			if attempts == 1 {
+				return &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+			}
 			return nil
 		})
 
-	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
-	err := service.HandleDeductBalance(msg)
+	msg := kafka.AddBalanceMessage{Amount: 50, BaseMessage: kafka.BaseMessage{UserID: "user-8"}}
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-8", Type: kafka.EventTypeAddBalance}, msg)
 
 	assert.NoError(t, err)
+	assert.Equal(t, sql.LevelSerializable, isolation)
+	// The failed posting, then the retry's account and counter postings.
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "BalanceCredited", (*outbox)[0].Headers["event-type"])
+}
+
+func TestHandleDeductBalanceBusinessErrorNotRetried(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+
+	attempts := 0
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			attempts++
+			return pg.ErrAccountFrozen
+		})
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-9"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-9", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
+
+// stubClaims keeps the event IDs claimed in committed transactions, so a
+// claim made in a transaction that rolls back does not count.
+func stubClaims(p *gomonkey.Patches) {
+	claimed := map[string]bool{}
+	var pending []string
+	p.ApplyFunc(pg.ClaimCommand,
+		func(_ context.Context, eventID, _ string, _ *sql.Tx) (bool, error) {
+			if claimed[eventID] {
+				return false, nil
+			}
+			pending = append(pending, eventID)
+			return true, nil
+		})
+	p.ApplyMethod(reflect.TypeOf(&sql.Tx{}), "Commit", func(_ *sql.Tx) error {
+		for _, id := range pending {
+			claimed[id] = true
+		}
+		pending = nil
+		return nil
+	})
+	p.ApplyPrivateMethod(reflect.TypeOf(&sql.Tx{}), "rollback", func(_ *sql.Tx, _ bool) error {
+		pending = nil
+		return nil
+	})
+	p.ApplyMethod(reflect.TypeOf(&sql.Tx{}), "Rollback", func(_ *sql.Tx) error {
+		pending = nil
+		return nil
+	})
+}
+
+func TestHandleAddBalanceAppliesRepublishedCommandOnce(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	stubClaims(patches)
+	outbox := stubOutbox(patches, 150)
+	posted := stubPostings(patches)
+
+	meta := kafka.EventMeta{EventID: "evt-11", Type: kafka.EventTypeAddBalance}
+	msg := kafka.AddBalanceMessage{Amount: 50, BaseMessage: kafka.BaseMessage{UserID: "user-11"}}
+	assert.NoError(t, service.HandleAddBalance(meta, msg))
+	// The relay crashed before marking the command published and sent it again.
+	assert.NoError(t, service.HandleAddBalance(meta, msg))
+
+	assert.Equal(t, map[string]float64{"user-11": 50, pg.CashClearingAccount: 50}, posted)
+	assert.Len(t, *outbox, 1)
+}
+
+func TestHandleDeductBalanceKeepsRepublishedRejection(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	stubClaims(patches)
+	outbox := stubOutbox(patches, 0)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return pg.ErrAccountFrozen
+		})
+
+	meta := kafka.EventMeta{EventID: "evt-12", Type: kafka.EventTypeDeductBalance}
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-12"}}
+	assert.Error(t, service.HandleDeductBalance(meta, msg))
+
+	// Funds arrive before the command is republished; it stays rejected.
+	posted := stubPostings(patches)
+	assert.NoError(t, service.HandleDeductBalance(meta, msg))
+
+	assert.Empty(t, posted)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
+
+func TestHandleAddBalanceDoesNotRejectOnExhaustedRetries(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 150)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+		})
+	patches.ApplyFunc(pg.SetCommandResult,
+		func(_ context.Context, _, _, _ string, _ *sql.Tx) error {
+			t.Error("the command should stay pending so it is handled again")
+			return nil
+		})
+
+	msg := kafka.AddBalanceMessage{Amount: 50, BaseMessage: kafka.BaseMessage{UserID: "user-13"}}
+	err := service.HandleAddBalance(kafka.EventMeta{EventID: "evt-13", Type: kafka.EventTypeAddBalance}, msg)
+
+	assert.True(t, pg.IsRetryable(err))
+	assert.Empty(t, *outbox)
+}
+
+func TestHandleDeductBalanceReturnsUnrecordedRejection(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	stubOutbox(patches, 0)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return pg.ErrAccountFrozen
+		})
+	outage := errors.New("connection refused")
+	patches.ApplyFunc(pg.InsertOutbox,
+		func(_ context.Context, _ pg.OutboxMessage, _ *sql.Tx) error { return outage })
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-14"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-14", Type: kafka.EventTypeDeductBalance}, msg)
+
+	// The rejection was not recorded, so the error is the outage's.
+	assert.ErrorIs(t, err, outage)
+	assert.NotContains(t, err.Error(), pg.ErrAccountFrozen.Error())
+}
+
+func TestHandleDeductBalanceRetriesDriverError(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	stubClaims(patches)
+	outbox := stubOutbox(patches, 75)
+	patches.ApplyFunc(pg.UpdateBalance,
+		func(_ context.Context, _ string, _ float64, _ *sql.Tx) error {
+			return fmt.Errorf("failed to update balance: %w", driver.ErrBadConn)
+		})
+
+	meta := kafka.EventMeta{EventID: "evt-15", Type: kafka.EventTypeDeductBalance}
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-15"}}
+	err := service.HandleDeductBalance(meta, msg)
+
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Empty(t, *outbox)
+
+	// The connection is back when the consumer handles the command again.
+	posted := stubPostings(patches)
+	assert.NoError(t, service.HandleDeductBalance(meta, msg))
+
+	assert.Equal(t, map[string]float64{"user-15": -25, pg.CashClearingAccount: -25}, posted)
+	assert.Len(t, *outbox, 1)
+	assert.Equal(t, "BalanceDebited", (*outbox)[0].Headers["event-type"])
 }
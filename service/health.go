@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"ledger/kafka"
+	"ledger/mongo"
+	"ledger/pg"
+	"sync/atomic"
+	"time"
+)
+
+// ComponentCheckTimeout bounds how long each dependency check may take.
+const ComponentCheckTimeout = 2 * time.Second
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusDraining = "draining"
+)
+
+// ComponentStatus is the result of checking one dependency.
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// ReadinessReport is the per-component readiness summary served on /readyz.
+type ReadinessReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ready reports whether the service should receive traffic.
+func (r ReadinessReport) Ready() bool {
+	return r.Status == StatusReady
+}
+
+var draining atomic.Bool
+
+// SetDraining marks the service as shutting down so readiness checks fail
+// and load balancers stop routing new requests to it.
+func SetDraining() {
+	draining.Store(true)
+}
+
+// IsDraining reports whether shutdown draining has started.
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// ComponentCheck probes one dependency. It returns an optional detail string
+// for the report, or an error when the dependency is unavailable.
+type ComponentCheck func(ctx context.Context) (string, error)
+
+// DefaultReadinessChecks are the dependencies the service needs to handle
+// traffic.
+var DefaultReadinessChecks = map[string]ComponentCheck{
+	"postgres": func(ctx context.Context) (string, error) {
+		return "", pg.Ping(ctx)
+	},
+	"mongo": func(ctx context.Context) (string, error) {
+		return "", mongo.Ping(ctx)
+	},
+	"kafka_producer": func(ctx context.Context) (string, error) {
+		return "", kafka.PingProducer(ctx)
+	},
+	"kafka_consumer": func(ctx context.Context) (string, error) {
+		return kafka.ConsumerStatus()
+	},
+}
+
+// CheckReadiness runs DefaultReadinessChecks and aggregates the results.
+func CheckReadiness(ctx context.Context) ReadinessReport {
+	return RunReadinessChecks(ctx, DefaultReadinessChecks)
+}
+
+// RunReadinessChecks runs the given checks concurrently, each bounded by
+// ComponentCheckTimeout. The report is not ready if any check fails or
+// shutdown draining has started.
+func RunReadinessChecks(ctx context.Context, checks map[string]ComponentCheck) ReadinessReport {
+	type result struct {
+		name   string
+		status ComponentStatus
+	}
+
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check ComponentCheck) {
+			checkCtx, cancel := context.WithTimeout(ctx, ComponentCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check(checkCtx)
+			status := ComponentStatus{
+				Status:    StatusUp,
+				Detail:    detail,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = StatusDown
+				status.Error = err.Error()
+			}
+			results <- result{name: name, status: status}
+		}(name, check)
+	}
+
+	report := ReadinessReport{
+		Status:     StatusReady,
+		Components: make(map[string]ComponentStatus, len(checks)),
+	}
+	for range checks {
+		r := <-results
+		report.Components[r.name] = r.status
+		if r.status.Status != StatusUp {
+			report.Status = StatusNotReady
+		}
+	}
+
+	if IsDraining() {
+		report.Status = StatusDraining
+	}
+	return report
+}
@@ -0,0 +1,58 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upCheck(detail string) service.ComponentCheck {
+	return func(_ context.Context) (string, error) { return detail, nil }
+}
+
+func TestRunReadinessChecksAllUp(t *testing.T) {
+	report := service.RunReadinessChecks(context.Background(), map[string]service.ComponentCheck{
+		"postgres":       upCheck(""),
+		"kafka_consumer": upCheck("1 partition(s) assigned"),
+	})
+
+	assert.True(t, report.Ready())
+	assert.Len(t, report.Components, 2)
+	assert.Equal(t, service.StatusUp, report.Components["postgres"].Status)
+	assert.Equal(t, "1 partition(s) assigned", report.Components["kafka_consumer"].Detail)
+}
+
+func TestRunReadinessChecksComponentDown(t *testing.T) {
+	report := service.RunReadinessChecks(context.Background(), map[string]service.ComponentCheck{
+		"postgres": upCheck(""),
+		"mongo": func(_ context.Context) (string, error) {
+			return "", errors.New("mongo unreachable")
+		},
+	})
+
+	assert.False(t, report.Ready())
+	assert.Equal(t, service.StatusNotReady, report.Status)
+	assert.Equal(t, service.StatusDown, report.Components["mongo"].Status)
+	assert.Equal(t, "mongo unreachable", report.Components["mongo"].Error)
+	assert.Equal(t, service.StatusUp, report.Components["postgres"].Status)
+}
+
+func TestRunReadinessChecksTimeout(t *testing.T) {
+	report := service.RunReadinessChecks(context.Background(), map[string]service.ComponentCheck{
+		"kafka_producer": func(ctx context.Context) (string, error) {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(time.Minute):
+				return "", nil
+			}
+		},
+	})
+
+	assert.False(t, report.Ready())
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components["kafka_producer"].Error)
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ledger/config"
+	"ledger/interest"
+	"ledger/kafka"
+	"ledger/pg"
+	"log"
+	"sync"
+	"time"
+)
+
+// InterestCreditOperation is the ledger record operation of interest
+// postings.
+const InterestCreditOperation = "InterestCredit"
+
+// maxAccrualListDays bounds the date range ListInterestAccruals returns.
+const maxAccrualListDays = 366
+
+var (
+	interestPlans         interest.Plans
+	defaultInterestPlan   string
+	interestSchedulerDone sync.WaitGroup
+)
+
+// SetInterestPlans installs the savings rate plans. Call it before
+// starting the interest scheduler.
+func SetInterestPlans(cfg config.InterestConfig) {
+	interestPlans = cfg.Plans
+	defaultInterestPlan = cfg.DefaultPlan
+}
+
+// GetInterestPlans returns the savings rate plans on offer.
+func GetInterestPlans() interest.Plans {
+	if interestPlans == nil {
+		return interest.Plans{}
+	}
+	return interestPlans
+}
+
+// planFor returns the plan an account with the given plan name accrues
+// under. Accounts without a plan, or whose plan was since removed from the
+// config, fall back to the default plan.
+func planFor(name string) (interest.Plan, bool) {
+	if name != "" {
+		if plan, ok := interestPlans.Find(name); ok {
+			return plan, true
+		}
+		log.Printf("Interest plan %q is not configured, using the default plan\n", name)
+	}
+	return interestPlans.Find(defaultInterestPlan)
+}
+
+func validateInterestPlan(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := interestPlans.Find(name); !ok {
+		return fmt.Errorf("%w: unknown interest plan %q", ErrInvalidArgument, name)
+	}
+	return nil
+}
+
+// AccrueInterest accrues every day that has ended since the last accrued
+// one, oldest first, and returns how many days it accrued. Days missed
+// while no replica was running are caught up on the balances the accounts
+// held at the end of those days.
+func AccrueInterest(ctx context.Context, now time.Time) (int, error) {
+	last, err := pg.LastAccrualDate(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	accrued := 0
+	for _, day := range interest.DaysToAccrue(last, now) {
+		ok, err := AccrueInterestDay(ctx, day)
+		if err != nil {
+			return accrued, fmt.Errorf("failed to accrue interest for %s: %w", day.Format(time.DateOnly), err)
+		}
+		if ok {
+			accrued++
+		}
+	}
+	return accrued, nil
+}
+
+// AccrueInterestDay accrues one day's interest on the end-of-day balance of
+// every savings account. It returns false if the day had already been
+// accrued, by this or another replica.
+func AccrueInterestDay(ctx context.Context, day time.Time) (bool, error) {
+	day = interest.Day(day)
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	balances, err := pg.SavingsBalancesAt(ctx, day.AddDate(0, 0, 1), tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	var accruals []pg.InterestAccrual
+	total := 0.0
+	for _, b := range balances {
+		plan, ok := planFor(b.InterestPlan)
+		if !ok {
+			continue
+		}
+		amount := plan.Accrue(b.Balance)
+		if amount == 0 {
+			continue
+		}
+		accruals = append(accruals, pg.InterestAccrual{
+			AccountID:  b.AccountID,
+			Date:       day,
+			Plan:       plan.Name,
+			AnnualRate: plan.AnnualRate,
+			Balance:    b.Balance,
+			Amount:     amount,
+		})
+		total += amount
+	}
+
+	// The run row goes first: a replica accruing the same day waits on it
+	// and then backs off.
+	claimed, err := pg.InsertAccrualRun(ctx, day, len(accruals), total, tx)
+	if err != nil || !claimed {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if err := pg.InsertInterestAccruals(ctx, accruals, tx); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Accrued interest for %s on %d account(s), total %f\n", day.Format(time.DateOnly), len(accruals), total)
+	return true, nil
+}
+
+// PostInterest credits every account with the interest it accrued before
+// the month of now, and returns how many accounts it credited. Accounts
+// that cannot take the credit, such as frozen ones, are logged and retried
+// on the next run.
+func PostInterest(ctx context.Context, now time.Time) (int, error) {
+	before := interest.MonthStart(now)
+	ids, err := pg.AccountsWithUnpostedInterest(ctx, before, nil)
+	if err != nil {
+		return 0, err
+	}
+	posted := 0
+	for _, id := range ids {
+		ok, err := postInterest(ctx, id, before)
+		if err != nil {
+			log.Printf("Failed to post interest to account %s: %v\n", id, err)
+			continue
+		}
+		if ok {
+			posted++
+		}
+	}
+	return posted, nil
+}
+
+// errNothingToPost rolls back a posting whose accruals round to zero.
+var errNothingToPost = errors.New("no interest to post")
+
+// postInterest credits one account with its unposted accruals dated before
+// before, as a balanced entry against interest expense. Totals under a
+// cent are left unposted to add up with later accruals.
+func postInterest(ctx context.Context, accountID string, before time.Time) (bool, error) {
+	meta := kafka.NewEventMeta(ctx, InterestCreditOperation)
+
+	var amount float64
+	var event kafka.InterestCreditedEvent
+	err := serializable(ctx, func(tx *sql.Tx) error {
+		from, through, total, err := pg.ClaimUnpostedInterest(ctx, accountID, before, meta.EventID, tx)
+		if err != nil {
+			return err
+		}
+		amount = interest.Round(total)
+		if amount == 0 {
+			// Roll back so the accruals stay unposted.
+			return errNothingToPost
+		}
+
+		err = pg.UpdateBalance(ctx, accountID, amount, tx)
+		if err == nil {
+			err = pg.UpdateBalance(ctx, pg.InterestExpenseAccount, amount, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update balance: %w", err)
+		}
+
+		balance, err := pg.GetBalance(ctx, accountID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read balance: %w", err)
+		}
+		event = kafka.InterestCreditedEvent{
+			UserID:         accountID,
+			Amount:         amount,
+			Balance:        balance,
+			AccruedFrom:    from.Format(time.DateOnly),
+			AccruedThrough: through.Format(time.DateOnly),
+		}
+		if err := recordEvent(ctx, tx, meta.CausedBy(kafka.EventTypeInterestCredited), accountID, event); err != nil {
+			return fmt.Errorf("failed to record interest-credited event: %w", err)
+		}
+		entries := []pg.LedgerEntry{
+			{
+				AccountID:      accountID,
+				Operation:      InterestCreditOperation,
+				Amount:         amount,
+				TransactionID:  meta.EventID,
+				CounterAccount: pg.InterestExpenseAccount,
+			},
+		}
+		return pg.InsertLedgerEntries(ctx, entries, tx)
+	})
+	if errors.Is(err, errNothingToPost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("Posted interest of %f to account %s for %s to %s\n", amount, accountID, event.AccruedFrom, event.AccruedThrough)
+	return true, nil
+}
+
+// ListInterestAccruals returns an account's daily accruals between from and
+// through, inclusive.
+func ListInterestAccruals(ctx context.Context, accountID string, from, through time.Time) ([]pg.InterestAccrual, error) {
+	if err := validateUserID(accountID); err != nil {
+		return nil, err
+	}
+	from, through = interest.Day(from), interest.Day(through)
+	if through.Before(from) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidArgument)
+	}
+	if through.Sub(from) > maxAccrualListDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: at most %d days can be listed at once", ErrInvalidArgument, maxAccrualListDays)
+	}
+	if _, err := pg.GetAccount(ctx, accountID, nil); err != nil {
+		return nil, err
+	}
+	return pg.ListInterestAccruals(ctx, accountID, from, through, nil)
+}
+
+// RunInterest accrues every ended day and posts every ended month, as the
+// scheduler does on each tick.
+func RunInterest(ctx context.Context, now time.Time) error {
+	if _, err := AccrueInterest(ctx, now); err != nil {
+		return err
+	}
+	_, err := PostInterest(ctx, now)
+	return err
+}
+
+// StartInterestScheduler accrues and posts interest every cfg.Interval
+// until ctx is cancelled, starting with a catch-up run. It does nothing if
+// no rate plans are configured.
+func StartInterestScheduler(ctx context.Context, cfg config.InterestConfig) {
+	if len(cfg.Plans) == 0 {
+		return
+	}
+	interestSchedulerDone.Add(1)
+	go func() {
+		defer interestSchedulerDone.Done()
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RunInterest(ctx, time.Now()); err != nil {
+				log.Printf("Interest scheduler: %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				log.Println("Interest scheduler stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// WaitForInterestScheduler blocks until the scheduler has stopped or ctx
+// expires.
+func WaitForInterestScheduler(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		interestSchedulerDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for interest scheduler: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,225 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ledger/config"
+	"ledger/interest"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setTestInterestPlans(t *testing.T) {
+	service.SetInterestPlans(config.InterestConfig{
+		DefaultPlan: "standard",
+		Plans: interest.Plans{
+			{Name: "standard", AnnualRate: 3.65},
+			{Name: "premium", AnnualRate: 7.3, MinBalance: 1000},
+		},
+	})
+	t.Cleanup(func() { service.SetInterestPlans(config.InterestConfig{}) })
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAccrueInterestDay(t *testing.T) {
+	setTestInterestPlans(t)
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	var balancesAt time.Time
+	patches.ApplyFunc(pg.SavingsBalancesAt,
+		func(_ context.Context, end time.Time, _ *sql.Tx) ([]pg.DayBalance, error) {
+			balancesAt = end
+			return []pg.DayBalance{
+				{AccountID: "acc_default", Balance: 1000},
+				{AccountID: "acc_premium", InterestPlan: "premium", Balance: 2000},
+				{AccountID: "acc_below_min", InterestPlan: "premium", Balance: 999},
+				{AccountID: "acc_empty", Balance: 0},
+			}, nil
+		})
+	var run struct {
+		accounts int
+		total    float64
+	}
+	patches.ApplyFunc(pg.InsertAccrualRun,
+		func(_ context.Context, _ time.Time, accounts int, total float64, _ *sql.Tx) (bool, error) {
+			run.accounts, run.total = accounts, total
+			return true, nil
+		})
+	var inserted []pg.InterestAccrual
+	patches.ApplyFunc(pg.InsertInterestAccruals,
+		func(_ context.Context, accruals []pg.InterestAccrual, _ *sql.Tx) error {
+			inserted = accruals
+			return nil
+		})
+
+	ok, err := service.AccrueInterestDay(context.Background(), day(2024, time.March, 1))
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// The day's balances are read as of its end.
+	assert.Equal(t, day(2024, time.March, 2), balancesAt)
+
+	require.Len(t, inserted, 2)
+	assert.Equal(t, "acc_default", inserted[0].AccountID)
+	assert.Equal(t, "standard", inserted[0].Plan)
+	assert.InDelta(t, 0.1, inserted[0].Amount, 1e-9)
+	assert.Equal(t, "acc_premium", inserted[1].AccountID)
+	assert.Equal(t, "premium", inserted[1].Plan)
+	assert.InDelta(t, 0.4, inserted[1].Amount, 1e-9)
+	assert.Equal(t, 2, run.accounts)
+	assert.InDelta(t, 0.5, run.total, 1e-9)
+}
+
+func TestAccrueInterestDayAlreadyAccrued(t *testing.T) {
+	setTestInterestPlans(t)
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	patches.ApplyFunc(pg.SavingsBalancesAt,
+		func(_ context.Context, _ time.Time, _ *sql.Tx) ([]pg.DayBalance, error) {
+			return []pg.DayBalance{{AccountID: "acc_1", Balance: 1000}}, nil
+		})
+	patches.ApplyFunc(pg.InsertAccrualRun,
+		func(_ context.Context, _ time.Time, _ int, _ float64, _ *sql.Tx) (bool, error) {
+			return false, nil
+		})
+	patches.ApplyFunc(pg.InsertInterestAccruals,
+		func(_ context.Context, _ []pg.InterestAccrual, _ *sql.Tx) error {
+			t.Fatal("accruals of a day another replica accrued must not be inserted")
+			return nil
+		})
+
+	ok, err := service.AccrueInterestDay(context.Background(), day(2024, time.March, 1))
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAccrueInterestCatchesUpMissedDays(t *testing.T) {
+	setTestInterestPlans(t)
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	patches.ApplyFunc(pg.LastAccrualDate,
+		func(_ context.Context, _ *sql.Tx) (time.Time, error) {
+			return day(2024, time.February, 27), nil
+		})
+	var ends []time.Time
+	patches.ApplyFunc(pg.SavingsBalancesAt,
+		func(_ context.Context, end time.Time, _ *sql.Tx) ([]pg.DayBalance, error) {
+			ends = append(ends, end)
+			return nil, nil
+		})
+	var accrued []time.Time
+	patches.ApplyFunc(pg.InsertAccrualRun,
+		func(_ context.Context, d time.Time, _ int, _ float64, _ *sql.Tx) (bool, error) {
+			accrued = append(accrued, d)
+			return true, nil
+		})
+	patches.ApplyFunc(pg.InsertInterestAccruals,
+		func(_ context.Context, _ []pg.InterestAccrual, _ *sql.Tx) error { return nil })
+
+	// Down from the 28th until the morning of March 2nd.
+	days, err := service.AccrueInterest(context.Background(), time.Date(2024, time.March, 2, 6, 0, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, days)
+	assert.Equal(t, []time.Time{day(2024, time.February, 28), day(2024, time.February, 29), day(2024, time.March, 1)}, accrued)
+	assert.Equal(t, []time.Time{day(2024, time.February, 29), day(2024, time.March, 1), day(2024, time.March, 2)}, ends)
+}
+
+func TestPostInterest(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 101.23)
+	posted := stubPostings(patches)
+
+	patches.ApplyFunc(pg.AccountsWithUnpostedInterest,
+		func(_ context.Context, before time.Time, _ *sql.Tx) ([]string, error) {
+			assert.Equal(t, day(2024, time.March, 1), before)
+			return []string{"acc_1"}, nil
+		})
+	var postingID string
+	patches.ApplyFunc(pg.ClaimUnpostedInterest,
+		func(_ context.Context, _ string, _ time.Time, id string, _ *sql.Tx) (time.Time, time.Time, float64, error) {
+			postingID = id
+			return day(2024, time.February, 1), day(2024, time.February, 29), 1.23456, nil
+		})
+	var recorded []pg.LedgerEntry
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			// Copy: the handler's slice may live on its stack.
+			recorded = append([]pg.LedgerEntry(nil), rec...)
+			return nil
+		})
+
+	n, err := service.PostInterest(context.Background(), time.Date(2024, time.March, 1, 0, 30, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]float64{"acc_1": 1.23, pg.InterestExpenseAccount: 1.23}, posted)
+
+	require.Len(t, *outbox, 1)
+	assert.Equal(t, "InterestCredited", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, postingID, (*outbox)[0].Headers["causation-id"])
+	var event kafka.InterestCreditedEvent
+	require.NoError(t, kafka.Decode(&confluent.Message{Value: (*outbox)[0].Payload}, &event))
+	assert.Equal(t, kafka.InterestCreditedEvent{UserID: "acc_1", Amount: 1.23, Balance: 101.23,
+		AccruedFrom: "2024-02-01", AccruedThrough: "2024-02-29"}, event)
+
+	require.Len(t, recorded, 1)
+	assert.Equal(t, service.InterestCreditOperation, recorded[0].Operation)
+	assert.Equal(t, 1.23, recorded[0].Amount)
+	assert.Equal(t, postingID, recorded[0].TransactionID)
+	assert.Equal(t, pg.InterestExpenseAccount, recorded[0].CounterAccount)
+}
+
+func TestPostInterestLeavesFractionsOfACent(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	posted := stubPostings(patches)
+
+	patches.ApplyFunc(pg.AccountsWithUnpostedInterest,
+		func(_ context.Context, _ time.Time, _ *sql.Tx) ([]string, error) {
+			return []string{"acc_1"}, nil
+		})
+	patches.ApplyFunc(pg.ClaimUnpostedInterest,
+		func(_ context.Context, _ string, _ time.Time, _ string, _ *sql.Tx) (time.Time, time.Time, float64, error) {
+			return day(2024, time.February, 1), day(2024, time.February, 29), 0.004, nil
+		})
+
+	n, err := service.PostInterest(context.Background(), time.Date(2024, time.March, 1, 0, 30, 0, 0, time.UTC))
+
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, posted)
+	assert.Empty(t, *outbox)
+}
+
+func TestUpdateAccountRejectsUnknownInterestPlan(t *testing.T) {
+	setTestInterestPlans(t)
+	plan := "gold"
+
+	_, err := service.UpdateAccount(context.Background(), "acc_1", pg.AccountUpdate{InterestPlan: &plan})
+
+	assert.True(t, errors.Is(err, service.ErrInvalidArgument))
+}
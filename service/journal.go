@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ledger/kafka"
+	"ledger/pg"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxJournalLegs bounds the legs of one journal entry.
+const MaxJournalLegs = 100
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// JournalLeg debits or credits one account by a positive amount.
+type JournalLeg struct {
+	AccountID string
+	Direction string
+	Amount    float64
+	Currency  string
+}
+
+// JournalEntry is a set of legs whose debits equal their credits in every
+// currency.
+type JournalEntry struct {
+	Description string
+	Legs        []JournalLeg
+}
+
+// PostJournalEntry validates entry and queues it, returning the entry ID
+// its ledger entries will share as TransactionID.
+func PostJournalEntry(ctx context.Context, entry JournalEntry) (string, error) {
+	if err := validateJournalEntry(entry); err != nil {
+		return "", err
+	}
+
+	msg := kafka.PostJournalEntryMessage{
+		EntryID:     uuid.New().String(),
+		Description: strings.TrimSpace(entry.Description),
+		Legs:        make([]kafka.JournalLeg, 0, len(entry.Legs)),
+	}
+	for _, leg := range entry.Legs {
+		msg.Legs = append(msg.Legs, kafka.JournalLeg{
+			UserID:    leg.AccountID,
+			Direction: leg.Direction,
+			Amount:    leg.Amount,
+			Currency:  leg.Currency,
+		})
+	}
+	if err := kafka.SendPostJournalEntryMessage(ctx, msg); err != nil {
+		log.Printf("Error sending journal entry %s: %v", msg.EntryID, err)
+		return "", err
+	}
+	return msg.EntryID, nil
+}
+
+// ReverseJournalEntry queues a compensating journal entry that undoes
+// entryID: every leg is posted again with its direction flipped, and the
+// new entry's ledger entries name entryID in Reverses. The original
+// entries are left as they are. It returns the new entry's ID.
+func ReverseJournalEntry(ctx context.Context, entryID string) (string, error) {
+	entries, err := pg.ListTransactionEntries(ctx, entryID, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("journal entry %s: %w", entryID, ErrNotFound)
+	}
+	if entries[0].Operation != kafka.EventTypePostJournalEntry {
+		return "", fmt.Errorf("%w: %s is a %s, not a journal entry", ErrInvalidArgument, entryID, entries[0].Operation)
+	}
+	if reversal, ok, err := pg.FindReversal(ctx, entryID, nil); err != nil {
+		return "", err
+	} else if ok {
+		return "", fmt.Errorf("journal entry %s was reversed by %s: %w", entryID, reversal, ErrAlreadyReversed)
+	}
+
+	msg := kafka.PostJournalEntryMessage{
+		EntryID:     uuid.New().String(),
+		Description: "Reversal of " + entryID,
+		Reverses:    entryID,
+		Legs:        make([]kafka.JournalLeg, 0, len(entries)),
+	}
+	for _, e := range entries {
+		account, err := pg.GetAccount(ctx, e.AccountID, nil)
+		if err != nil {
+			return "", err
+		}
+		direction := kafka.Debit
+		if e.Direction == kafka.Debit {
+			direction = kafka.Credit
+		}
+		msg.Legs = append(msg.Legs, kafka.JournalLeg{
+			UserID:    e.AccountID,
+			Direction: direction,
+			Amount:    math.Abs(e.Amount),
+			Currency:  account.Currency,
+		})
+	}
+	if err := kafka.SendPostJournalEntryMessage(ctx, msg); err != nil {
+		log.Printf("Error sending reversal of journal entry %s: %v", entryID, err)
+		return "", err
+	}
+	return msg.EntryID, nil
+}
+
+// validateJournalEntry checks every leg and that the entry balances per
+// currency. System accounts may take part, unlike in the single-account
+// operations.
+func validateJournalEntry(entry JournalEntry) error {
+	if len(entry.Legs) < 2 {
+		return fmt.Errorf("%w: a journal entry needs at least two legs", ErrInvalidArgument)
+	}
+	if len(entry.Legs) > MaxJournalLegs {
+		return fmt.Errorf("%w: a journal entry has at most %d legs", ErrInvalidArgument, MaxJournalLegs)
+	}
+
+	seen := make(map[string]bool, len(entry.Legs))
+	// Net debits per currency, in ten-thousandths to avoid float drift.
+	net := map[string]int64{}
+	for i, leg := range entry.Legs {
+		if leg.AccountID == "" {
+			return fmt.Errorf("%w: legs[%d]: account_id is required", ErrInvalidArgument, i)
+		}
+		if seen[leg.AccountID] {
+			return fmt.Errorf("%w: legs[%d]: account %s appears more than once", ErrInvalidArgument, i, leg.AccountID)
+		}
+		seen[leg.AccountID] = true
+		if leg.Direction != kafka.Debit && leg.Direction != kafka.Credit {
+			return fmt.Errorf("%w: legs[%d]: direction must be debit or credit", ErrInvalidArgument, i)
+		}
+		if err := validateAmount(leg.Amount); err != nil {
+			return fmt.Errorf("legs[%d]: %w", i, err)
+		}
+		if !currencyPattern.MatchString(leg.Currency) {
+			return fmt.Errorf("%w: legs[%d]: currency must be an ISO 4217 code", ErrInvalidArgument, i)
+		}
+
+		units := int64(math.Round(leg.Amount * 1e4))
+		if leg.Direction == kafka.Credit {
+			units = -units
+		}
+		net[leg.Currency] += units
+	}
+
+	currencies := make([]string, 0, len(net))
+	for currency, units := range net {
+		if units != 0 {
+			currencies = append(currencies, currency)
+		}
+	}
+	if len(currencies) > 0 {
+		sort.Strings(currencies)
+		return fmt.Errorf("%w: debits and credits differ in %s", ErrInvalidArgument, strings.Join(currencies, ", "))
+	}
+	return nil
+}
+
+// HandlePostJournalEntry applies every leg of a journal entry in one
+// serializable transaction. The accounts are locked up front in the shared lock order,
+// then each balance moves on its normal side: a debit raises an asset or
+// expense account and lowers any other. Each leg publishes BalanceCredited
+// or BalanceDebited by whether its balance rose or fell, and is recorded as
+// a ledger entry with the entry ID as TransactionID. Legs lowering a customer balance
+// count against the account's velocity limits.
+func HandlePostJournalEntry(meta kafka.EventMeta, msg kafka.PostJournalEntryMessage) error {
+	ctx := context.Background()
+	if len(msg.Legs) == 0 {
+		return fmt.Errorf("%w: journal entry %s has no legs", errMalformed, msg.EntryID)
+	}
+
+	applied, err := applyCommand(ctx, meta, func(tx *sql.Tx) error {
+		// Two reversals can both pass the check made when they were
+		// queued, so check again where only one can commit.
+		if msg.Reverses != "" {
+			reversal, ok, err := pg.FindReversal(ctx, msg.Reverses, tx)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return reject(fmt.Errorf("journal entry %s was reversed by %s: %w", msg.Reverses, reversal, ErrAlreadyReversed))
+			}
+		}
+
+		deltas, err := journalDeltas(ctx, msg, tx)
+		for i := 0; err == nil && i < len(msg.Legs); i++ {
+			err = pg.UpdateBalance(ctx, msg.Legs[i].UserID, deltas[i], tx)
+			if err == nil && deltas[i] < 0 {
+				err = enforceLimits(ctx, msg.Legs[i].UserID, msg.Legs[i].Amount, tx)
+			}
+			if err != nil {
+				err = fmt.Errorf("account %s: %w", msg.Legs[i].UserID, err)
+			}
+		}
+		if err != nil {
+			return reject(err)
+		}
+
+		entries := make([]pg.LedgerEntry, 0, len(msg.Legs))
+		for i, leg := range msg.Legs {
+			balance, err := pg.GetBalance(ctx, leg.UserID, tx)
+			if err != nil {
+				return fmt.Errorf("failed to read balance: %w", err)
+			}
+			eventType := kafka.EventTypeBalanceCredited
+			var event kafka.Message = kafka.BalanceCreditedEvent{UserID: leg.UserID, Amount: leg.Amount, Balance: balance}
+			if deltas[i] < 0 {
+				eventType = kafka.EventTypeBalanceDebited
+				event = kafka.BalanceDebitedEvent{UserID: leg.UserID, Amount: leg.Amount, Balance: balance}
+			}
+			if err := recordEvent(ctx, tx, meta.CausedBy(eventType), leg.UserID, event); err != nil {
+				return fmt.Errorf("failed to record %s event: %w", eventType, err)
+			}
+
+			entries = append(entries, pg.LedgerEntry{
+				AccountID:     leg.UserID,
+				Operation:     kafka.EventTypePostJournalEntry,
+				Amount:        deltas[i],
+				TransactionID: msg.EntryID,
+				Direction:     leg.Direction,
+				Description:   msg.Description,
+				Reverses:      msg.Reverses,
+			})
+		}
+		if err = pg.InsertLedgerEntries(ctx, entries, tx); err != nil {
+			return reject(err)
+		}
+		return pg.SetCommandResult(ctx, meta.EventID, pg.CommandApplied, "", tx)
+	})
+	if cause := rejection(err); cause != nil {
+		if err := rejectOperation(ctx, meta, msg.Legs[0].UserID, msg.Legs[0].Amount, cause); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to post journal entry %s: %w", msg.EntryID, err)
+	}
+	if err != nil || !applied {
+		return err
+	}
+
+	log.Printf("Posted journal entry %s with %d leg(s)\n", msg.EntryID, len(msg.Legs))
+	return nil
+}
+
+// journalDeltas locks the entry's accounts and returns the balance change
+// of each leg, checking that every account exists and is held in the leg's
+// currency.
+func journalDeltas(ctx context.Context, msg kafka.PostJournalEntryMessage, tx *sql.Tx) ([]float64, error) {
+	ids := make([]string, 0, len(msg.Legs))
+	for _, leg := range msg.Legs {
+		ids = append(ids, leg.UserID)
+	}
+	accounts, err := pg.LockAccounts(ctx, ids, tx)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := pg.ListChartOfAccounts(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	classes := make(map[string]string, len(codes))
+	for _, c := range codes {
+		classes[c.Code] = c.Class
+	}
+
+	deltas := make([]float64, len(msg.Legs))
+	for i, leg := range msg.Legs {
+		account, ok := accounts[leg.UserID]
+		if !ok {
+			return nil, fmt.Errorf("account %s: %w", leg.UserID, ErrAccountNotFound)
+		}
+		if account.Currency != leg.Currency {
+			return nil, fmt.Errorf("account %s is held in %s, not %s: %w", leg.UserID, account.Currency, leg.Currency, ErrCurrencyMismatch)
+		}
+		deltas[i] = leg.Amount
+		if debitNormal(classes[account.LedgerCode]) != (leg.Direction == kafka.Debit) {
+			deltas[i] = -leg.Amount
+		}
+	}
+	return deltas, nil
+}
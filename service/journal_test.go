@@ -0,0 +1,234 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubJournalAccounts(p *gomonkey.Patches, accounts ...pg.Account) {
+	p.ApplyFunc(pg.LockAccounts,
+		func(_ context.Context, ids []string, _ *sql.Tx) (map[string]pg.Account, error) {
+			found := map[string]pg.Account{}
+			for _, a := range accounts {
+				found[a.ID] = a
+			}
+			return found, nil
+		})
+	p.ApplyFunc(pg.ListChartOfAccounts,
+		func(_ context.Context, _ *sql.Tx) ([]pg.LedgerCode, error) {
+			return []pg.LedgerCode{
+				{Code: "1000", Class: pg.ClassAsset},
+				{Code: "2000", Class: pg.ClassLiability},
+				{Code: "4000", Class: pg.ClassRevenue},
+			}, nil
+		})
+}
+
+func leg(account, direction string, amount float64, currency string) service.JournalLeg {
+	return service.JournalLeg{AccountID: account, Direction: direction, Amount: amount, Currency: currency}
+}
+
+func TestPostJournalEntry_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		legs []service.JournalLeg
+	}{
+		{"single leg", []service.JournalLeg{leg("a", kafka.Debit, 10, "USD")}},
+		{"unbalanced", []service.JournalLeg{leg("a", kafka.Debit, 10, "USD"), leg("b", kafka.Credit, 9.99, "USD")}},
+		{"balanced across currencies only", []service.JournalLeg{
+			leg("a", kafka.Debit, 10, "USD"), leg("b", kafka.Credit, 10, "EUR"),
+		}},
+		{"duplicate account", []service.JournalLeg{leg("a", kafka.Debit, 10, "USD"), leg("a", kafka.Credit, 10, "USD")}},
+		{"bad direction", []service.JournalLeg{leg("a", "up", 10, "USD"), leg("b", kafka.Credit, 10, "USD")}},
+		{"bad currency", []service.JournalLeg{leg("a", kafka.Debit, 10, "usd"), leg("b", kafka.Credit, 10, "usd")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.PostJournalEntry(context.Background(), service.JournalEntry{Legs: tt.legs})
+			assert.ErrorIs(t, err, service.ErrInvalidArgument)
+		})
+	}
+}
+
+func TestPostJournalEntry(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	var sent kafka.PostJournalEntryMessage
+	patches.ApplyFunc(kafka.SendPostJournalEntryMessage,
+		func(_ context.Context, msg kafka.PostJournalEntryMessage) error {
+			sent = msg
+			return nil
+		})
+
+	id, err := service.PostJournalEntry(context.Background(), service.JournalEntry{
+		Description: "purchase",
+		Legs: []service.JournalLeg{
+			leg("buyer", kafka.Debit, 100, "USD"),
+			leg("merchant", kafka.Credit, 94.9, "USD"),
+			leg(pg.FeeRevenueAccount, kafka.Credit, 5.1, "USD"),
+		},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, id, sent.EntryID)
+	assert.Len(t, sent.Legs, 3)
+	assert.Equal(t, pg.FeeRevenueAccount, sent.Legs[2].UserID)
+}
+
+func TestHandlePostJournalEntry(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	posted := stubPostings(patches)
+	stubJournalAccounts(patches,
+		pg.Account{ID: "buyer", Currency: "USD", LedgerCode: "2000"},
+		pg.Account{ID: "merchant", Currency: "USD", LedgerCode: "2000"},
+		pg.Account{ID: pg.FeeRevenueAccount, Currency: "USD", LedgerCode: "4000"},
+	)
+	var records []pg.LedgerEntry
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, rec []pg.LedgerEntry, _ *sql.Tx) error {
+			// Copy: the handler's slice may live on its stack.
+			records = append([]pg.LedgerEntry(nil), rec...)
+			return nil
+		})
+
+	msg := kafka.PostJournalEntryMessage{EntryID: "entry-1", Legs: []kafka.JournalLeg{
+		{UserID: "buyer", Direction: kafka.Debit, Amount: 100, Currency: "USD"},
+		{UserID: "merchant", Direction: kafka.Credit, Amount: 95, Currency: "USD"},
+		{UserID: pg.FeeRevenueAccount, Direction: kafka.Credit, Amount: 5, Currency: "USD"},
+	}}
+	err := service.HandlePostJournalEntry(kafka.EventMeta{EventID: "evt-1"}, msg)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"buyer": -100, "merchant": 95, pg.FeeRevenueAccount: 5}, posted)
+	require.Len(t, records, 3)
+	for _, rec := range records {
+		assert.Equal(t, "entry-1", rec.TransactionID)
+	}
+	require.Len(t, *outbox, 3)
+	assert.Equal(t, "BalanceDebited", (*outbox)[0].Headers["event-type"])
+	assert.Equal(t, "BalanceCredited", (*outbox)[1].Headers["event-type"])
+}
+
+func TestHandlePostJournalEntry_CurrencyMismatch(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	posted := stubPostings(patches)
+	stubJournalAccounts(patches,
+		pg.Account{ID: "a", Currency: "USD", LedgerCode: "2000"},
+		pg.Account{ID: "b", Currency: "USD", LedgerCode: "2000"},
+	)
+
+	msg := kafka.PostJournalEntryMessage{EntryID: "entry-2", Legs: []kafka.JournalLeg{
+		{UserID: "a", Direction: kafka.Debit, Amount: 10, Currency: "EUR"},
+		{UserID: "b", Direction: kafka.Credit, Amount: 10, Currency: "EUR"},
+	}}
+	err := service.HandlePostJournalEntry(kafka.EventMeta{EventID: "evt-2", Type: kafka.EventTypePostJournalEntry}, msg)
+
+	assert.ErrorIs(t, err, service.ErrCurrencyMismatch)
+	assert.Empty(t, posted)
+	require.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
+
+func stubJournalEntries(p *gomonkey.Patches, reversedBy string, entries ...pg.LedgerEntry) {
+	p.ApplyFunc(pg.ListTransactionEntries,
+		func(_ context.Context, _ string, _ *sql.Tx) ([]pg.LedgerEntry, error) {
+			return entries, nil
+		})
+	p.ApplyFunc(pg.FindReversal,
+		func(_ context.Context, _ string, _ *sql.Tx) (string, bool, error) {
+			return reversedBy, reversedBy != "", nil
+		})
+	p.ApplyFunc(pg.GetAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			return pg.Account{ID: id, Currency: "USD"}, nil
+		})
+}
+
+func TestReverseJournalEntry(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	stubJournalEntries(patches, "",
+		pg.LedgerEntry{AccountID: "buyer", Operation: kafka.EventTypePostJournalEntry, Amount: -100, TransactionID: "entry-1", Direction: kafka.Debit},
+		pg.LedgerEntry{AccountID: "merchant", Operation: kafka.EventTypePostJournalEntry, Amount: 100, TransactionID: "entry-1", Direction: kafka.Credit},
+	)
+	var sent kafka.PostJournalEntryMessage
+	patches.ApplyFunc(kafka.SendPostJournalEntryMessage,
+		func(_ context.Context, msg kafka.PostJournalEntryMessage) error {
+			sent = msg
+			return nil
+		})
+
+	id, err := service.ReverseJournalEntry(context.Background(), "entry-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, id, sent.EntryID)
+	assert.Equal(t, "entry-1", sent.Reverses)
+	assert.Equal(t, []kafka.JournalLeg{
+		{UserID: "buyer", Direction: kafka.Credit, Amount: 100, Currency: "USD"},
+		{UserID: "merchant", Direction: kafka.Debit, Amount: 100, Currency: "USD"},
+	}, sent.Legs)
+}
+
+func TestReverseJournalEntry_Refused(t *testing.T) {
+	tests := []struct {
+		name       string
+		reversedBy string
+		entries    []pg.LedgerEntry
+		want       error
+	}{
+		{"unknown entry", "", nil, service.ErrNotFound},
+		{"not a journal entry", "", []pg.LedgerEntry{{AccountID: "a", Operation: kafka.EventTypeAddBalance, Amount: 5}}, service.ErrInvalidArgument},
+		{"already reversed", "entry-2", []pg.LedgerEntry{{AccountID: "a", Operation: kafka.EventTypePostJournalEntry, Amount: 5}}, service.ErrAlreadyReversed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches := gomonkey.NewPatches()
+			defer patches.Reset()
+			stubJournalEntries(patches, tt.reversedBy, tt.entries...)
+
+			_, err := service.ReverseJournalEntry(context.Background(), "entry-1")
+
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestHandlePostJournalEntry_AlreadyReversed(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+	posted := stubPostings(patches)
+	// Another reversal of entry-1 committed after this one was queued.
+	stubJournalEntries(patches, "entry-3")
+
+	msg := kafka.PostJournalEntryMessage{EntryID: "entry-4", Reverses: "entry-1", Legs: []kafka.JournalLeg{
+		{UserID: "buyer", Direction: kafka.Credit, Amount: 100, Currency: "USD"},
+		{UserID: "merchant", Direction: kafka.Debit, Amount: 100, Currency: "USD"},
+	}}
+	err := service.HandlePostJournalEntry(kafka.EventMeta{EventID: "evt-4", Type: kafka.EventTypePostJournalEntry}, msg)
+
+	assert.ErrorIs(t, err, service.ErrAlreadyReversed)
+	assert.Empty(t, posted)
+	require.Len(t, *outbox, 1)
+	assert.Equal(t, "OperationRejected", (*outbox)[0].Headers["event-type"])
+}
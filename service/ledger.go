@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ledger/pg"
+	"log"
+	"math"
+	"time"
+)
+
+// TrialBalanceLine is one ledger code of the trial balance, with its summed
+// balance in the debit or credit column.
+type TrialBalanceLine struct {
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	Class  string  `json:"class"`
+	Debit  float64 `json:"debit"`
+	Credit float64 `json:"credit"`
+}
+
+// TrialBalance lists every ledger code's balance. Balanced reports whether
+// total debits equal total credits, which holds as long as every posting
+// was a balanced journal entry.
+type TrialBalance struct {
+	Lines       []TrialBalanceLine `json:"lines"`
+	TotalDebit  float64            `json:"total_debit"`
+	TotalCredit float64            `json:"total_credit"`
+	Balanced    bool               `json:"balanced"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// postCounterEntry books the counter-leg of a deposit (positive amount) or
+// withdrawal (negative amount) on a customer account to cash-in clearing,
+// so the two postings form a balanced journal entry: a deposit debits
+// cash-in clearing and credits the customer. Balances are kept on each
+// account's normal side, so both move by amount.
+//
+// Call it after the customer account is updated: system accounts are
+// always locked last, so transactions cannot deadlock on them.
+func postCounterEntry(ctx context.Context, amount float64, tx *sql.Tx) error {
+	if amount == 0 {
+		return nil
+	}
+	if err := pg.UpdateBalance(ctx, pg.CashClearingAccount, amount, tx); err != nil {
+		return fmt.Errorf("failed to post to %s: %w", pg.CashClearingAccount, err)
+	}
+	return nil
+}
+
+// GetChartOfAccounts returns the ledger codes accounts roll up to.
+func GetChartOfAccounts(ctx context.Context) ([]pg.LedgerCode, error) {
+	return pg.ListChartOfAccounts(ctx, nil)
+}
+
+// GetTrialBalance sums the balances of every ledger code into debit and
+// credit columns.
+func GetTrialBalance(ctx context.Context) (TrialBalance, error) {
+	balances, err := pg.LedgerCodeBalances(ctx, nil)
+	if err != nil {
+		return TrialBalance{}, err
+	}
+
+	report := TrialBalance{Lines: make([]TrialBalanceLine, 0, len(balances)), GeneratedAt: time.Now().UTC()}
+	for _, b := range balances {
+		line := TrialBalanceLine{Code: b.Code, Name: b.Name, Class: b.Class}
+		// A negative balance sits in the opposite column.
+		if debitNormal(b.Class) == (b.Balance >= 0) {
+			line.Debit = math.Abs(b.Balance)
+		} else {
+			line.Credit = math.Abs(b.Balance)
+		}
+		report.TotalDebit += line.Debit
+		report.TotalCredit += line.Credit
+		report.Lines = append(report.Lines, line)
+	}
+	// Balances have four decimal places; compare at that precision.
+	report.TotalDebit = roundAmount(report.TotalDebit)
+	report.TotalCredit = roundAmount(report.TotalCredit)
+	report.Balanced = report.TotalDebit == report.TotalCredit
+	if !report.Balanced {
+		log.Printf("Trial balance is off: debits %.4f, credits %.4f\n", report.TotalDebit, report.TotalCredit)
+	}
+	return report, nil
+}
+
+// debitNormal reports whether accounts of class carry debit balances.
+func debitNormal(class string) bool {
+	return class == pg.ClassAsset || class == pg.ClassExpense
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*1e4) / 1e4
+}
+
+// VerifyLedgerChain walks an account's hash-chained entries in Postgres
+// and reports the first that was deleted, reordered or altered.
+func VerifyLedgerChain(ctx context.Context, accountID string) (pg.ChainReport, error) {
+	if accountID == "" {
+		return pg.ChainReport{}, fmt.Errorf("%w: account id is required", ErrInvalidArgument)
+	}
+	return pg.VerifyChain(ctx, accountID, nil)
+}
+
+// VerifyAllLedgerChains verifies the chain of every account with ledger
+// entries and returns the reports of the broken ones, plus how many
+// accounts were checked.
+func VerifyAllLedgerChains(ctx context.Context) ([]pg.ChainReport, int, error) {
+	accounts, err := pg.LedgerAccounts(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var broken []pg.ChainReport
+	for _, id := range accounts {
+		report, err := pg.VerifyChain(ctx, id, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !report.Valid {
+			broken = append(broken, report)
+		}
+	}
+	return broken, len(accounts), nil
+}
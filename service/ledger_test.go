@@ -0,0 +1,95 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubLedgerBalances(p *gomonkey.Patches, balances ...pg.LedgerCodeBalance) {
+	p.ApplyFunc(pg.LedgerCodeBalances,
+		func(_ context.Context, _ *sql.Tx) ([]pg.LedgerCodeBalance, error) {
+			return balances, nil
+		})
+}
+
+func codeBalance(code, class string, balance float64) pg.LedgerCodeBalance {
+	return pg.LedgerCodeBalance{LedgerCode: pg.LedgerCode{Code: code, Class: class}, Balance: balance}
+}
+
+func TestGetTrialBalance(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	stubLedgerBalances(patches,
+		codeBalance("1000", pg.ClassAsset, 150.25),
+		codeBalance("2000", pg.ClassLiability, 155.25),
+		codeBalance("2900", pg.ClassLiability, -5), // overdrawn: a debit
+		codeBalance("4000", pg.ClassRevenue, 0),
+	)
+
+	report, err := service.GetTrialBalance(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, report.Lines, 4)
+	assert.Equal(t, 150.25, report.Lines[0].Debit)
+	assert.Equal(t, 155.25, report.Lines[1].Credit)
+	assert.Equal(t, 5.0, report.Lines[2].Debit)
+	assert.Equal(t, 155.25, report.TotalDebit)
+	assert.Equal(t, 155.25, report.TotalCredit)
+	assert.True(t, report.Balanced)
+}
+
+func TestGetTrialBalance_Unbalanced(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	stubLedgerBalances(patches,
+		codeBalance("1000", pg.ClassAsset, 100),
+		codeBalance("2000", pg.ClassLiability, 90),
+	)
+
+	report, err := service.GetTrialBalance(context.Background())
+
+	require.NoError(t, err)
+	assert.False(t, report.Balanced)
+}
+
+func TestSystemAccountsAreReserved(t *testing.T) {
+	err := service.AddAmount(context.Background(), pg.CashClearingAccount, 10, 0)
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
+
+func TestVerifyAllLedgerChainsReturnsBrokenChains(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	patches.ApplyFunc(pg.LedgerAccounts,
+		func(_ context.Context, _ *sql.Tx) ([]string, error) {
+			return []string{"acc_ok", "acc_tampered"}, nil
+		})
+	patches.ApplyFunc(pg.VerifyChain,
+		func(_ context.Context, accountID string, _ *sql.Tx) (pg.ChainReport, error) {
+			if accountID == "acc_tampered" {
+				return pg.ChainReport{AccountID: accountID, Entries: 4, Break: &pg.ChainBreak{Sequence: 5, Reason: "hash does not match the entry's content"}}, nil
+			}
+			return pg.ChainReport{AccountID: accountID, Entries: 9, Valid: true}, nil
+		})
+
+	broken, checked, err := service.VerifyAllLedgerChains(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, checked)
+	require.Len(t, broken, 1)
+	assert.Equal(t, "acc_tampered", broken[0].AccountID)
+	assert.Equal(t, int64(5), broken[0].Break.Sequence)
+
+	_, err = service.VerifyLedgerChain(context.Background(), "")
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ledger/limits"
+	"ledger/pg"
+	"strings"
+)
+
+// limitRules is enforced by the consumer on every debit of a customer
+// account and reported by the API.
+var limitRules limits.Rules
+
+// SetLimitRules installs the velocity limit rules. Call it before
+// Initialize.
+func SetLimitRules(rules limits.Rules) {
+	limitRules = rules
+}
+
+// GetLimitUsage returns every limit covering an account with what the
+// account has used of it.
+func GetLimitUsage(ctx context.Context, accountID string) ([]limits.Status, error) {
+	if err := validateUserID(accountID); err != nil {
+		return nil, err
+	}
+	account, err := pg.GetAccount(ctx, accountID, nil)
+	if err != nil {
+		return nil, err
+	}
+	rules := limitRules.For(account.ID, account.Type)
+	statuses := make([]limits.Status, 0, len(rules))
+	for _, rule := range rules {
+		count, amount, err := pg.DebitUsage(ctx, account.ID, rule.Window, nil)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, rule.Status(limits.Usage{Count: count, Amount: amount}))
+	}
+	return statuses, nil
+}
+
+// enforceLimits checks a debit of amount from accountID against the limits
+// covering the account and counts it, inside tx. Call it after the debit's
+// balance update: the row lock that takes serializes the account's debits,
+// so no concurrent debit can slip past the limit between check and count.
+// System accounts have no limits.
+func enforceLimits(ctx context.Context, accountID string, amount float64, tx *sql.Tx) error {
+	if len(limitRules) == 0 || strings.HasPrefix(accountID, pg.SystemAccountPrefix) {
+		return nil
+	}
+	account, err := pg.GetAccount(ctx, accountID, tx)
+	if err != nil {
+		return err
+	}
+	rules := limitRules.For(account.ID, account.Type)
+	if len(rules) == 0 {
+		return nil
+	}
+	for _, rule := range rules {
+		count, used, err := pg.DebitUsage(ctx, account.ID, rule.Window, tx)
+		if err != nil {
+			return err
+		}
+		if err := rule.Check(limits.Usage{Count: count, Amount: used}, amount); err != nil {
+			return fmt.Errorf("account %s: %w", account.ID, err)
+		}
+	}
+	return pg.RecordDebit(ctx, account.ID, amount, limitRules.MaxWindow(), tx)
+}
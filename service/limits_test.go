@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/limits"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimitRules = limits.Rules{
+	{Name: "daily_withdrawals", Window: 24 * time.Hour, MaxCount: 5},
+	{Name: "daily_amount", Window: 24 * time.Hour, MaxAmount: 10000},
+	{Name: "daily_amount", AccountType: pg.AccountSavings, Window: 24 * time.Hour, MaxAmount: 500},
+}
+
+// stubDebitUsage makes pg.DebitUsage report usage and captures the debits
+// recorded against the limits.
+func stubDebitUsage(p *gomonkey.Patches, count int, amount float64) *[]float64 {
+	var recorded []float64
+	p.ApplyFunc(pg.DebitUsage,
+		func(_ context.Context, _ string, _ time.Duration, _ *sql.Tx) (int, float64, error) {
+			return count, amount, nil
+		})
+	p.ApplyFunc(pg.RecordDebit,
+		func(_ context.Context, _ string, amount float64, retention time.Duration, _ *sql.Tx) error {
+			recorded = append(recorded, amount)
+			return nil
+		})
+	return &recorded
+}
+
+func TestHandleDeductBalanceCountsAgainstLimits(t *testing.T) {
+	service.SetLimitRules(testLimitRules)
+	defer service.SetLimitRules(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	stubOutbox(patches, 75)
+	stubPostings(patches)
+	stubAccountType(patches, pg.AccountWallet)
+	recorded := stubDebitUsage(patches, 4, 9000)
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, _ []pg.LedgerEntry, _ *sql.Tx) error { return nil })
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-3"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-3"}, msg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []float64{25}, *recorded)
+}
+
+func TestHandleDeductBalanceRejectedOverLimit(t *testing.T) {
+	service.SetLimitRules(testLimitRules)
+	defer service.SetLimitRules(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 75)
+	stubPostings(patches)
+	stubAccountType(patches, pg.AccountSavings)
+	recorded := stubDebitUsage(patches, 1, 480)
+
+	msg := kafka.DeductBalanceMessage{Amount: 25, BaseMessage: kafka.BaseMessage{UserID: "user-4"}}
+	err := service.HandleDeductBalance(kafka.EventMeta{EventID: "evt-4", Type: kafka.EventTypeDeductBalance}, msg)
+
+	assert.ErrorIs(t, err, service.ErrLimitExceeded)
+	assert.Empty(t, *recorded)
+	require.Len(t, *outbox, 1)
+	var event kafka.OperationRejectedEvent
+	require.NoError(t, kafka.Decode(&confluent.Message{Value: (*outbox)[0].Payload}, &event))
+	assert.Contains(t, event.Reason, "daily_amount allows 500.00 debited per 24h0m0s, 480.00 already debited")
+}
+
+func TestHandlePostJournalEntryLimitsDebitedCustomers(t *testing.T) {
+	service.SetLimitRules(testLimitRules)
+	defer service.SetLimitRules(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	stubOutbox(patches, 0)
+	stubPostings(patches)
+	stubAccountType(patches, pg.AccountWallet)
+	recorded := stubDebitUsage(patches, 0, 0)
+	patches.ApplyFunc(pg.LockAccounts,
+		func(_ context.Context, ids []string, _ *sql.Tx) (map[string]pg.Account, error) {
+			accounts := map[string]pg.Account{}
+			for _, id := range ids {
+				accounts[id] = pg.Account{ID: id, Currency: "USD", LedgerCode: "2000"}
+			}
+			return accounts, nil
+		})
+	patches.ApplyFunc(pg.ListChartOfAccounts,
+		func(_ context.Context, _ *sql.Tx) ([]pg.LedgerCode, error) {
+			return []pg.LedgerCode{{Code: "2000", Class: "liability"}}, nil
+		})
+	patches.ApplyFunc(pg.InsertLedgerEntries,
+		func(_ context.Context, _ []pg.LedgerEntry, _ *sql.Tx) error { return nil })
+
+	err := service.HandlePostJournalEntry(kafka.EventMeta{EventID: "evt-5"}, kafka.PostJournalEntryMessage{
+		EntryID: "entry-1",
+		Legs: []kafka.JournalLeg{
+			{UserID: "acc_from", Direction: kafka.Debit, Amount: 40, Currency: "USD"},
+			{UserID: "acc_to", Direction: kafka.Credit, Amount: 40, Currency: "USD"},
+		},
+	})
+
+	require.NoError(t, err)
+	// Only the paying account's debit counts; the credit does not.
+	assert.Equal(t, []float64{40}, *recorded)
+}
+
+func TestGetLimitUsage(t *testing.T) {
+	service.SetLimitRules(testLimitRules)
+	defer service.SetLimitRules(nil)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	stubAccountType(patches, pg.AccountSavings)
+	stubDebitUsage(patches, 2, 120)
+
+	usage, err := service.GetLimitUsage(context.Background(), "acc_1")
+
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	assert.Equal(t, "daily_withdrawals", usage[0].Name)
+	assert.Equal(t, 3, *usage[0].RemainingCount)
+	assert.Equal(t, "daily_amount", usage[1].Name)
+	assert.Equal(t, 380.0, *usage[1].RemainingAmount)
+}
@@ -2,24 +2,69 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"ledger/kafka"
 	"ledger/pg"
 	"log"
 	"time"
 )
 
-func GetUserBalance(userID string) (float64, error) {
-	balance, err := pg.GetBalance(context.Background(), userID, nil)
+// GetUserBalance returns an account's balance and version, or zeros if
+// there is no such account.
+func GetUserBalance(userID string) (float64, int64, error) {
+	balance, version, err := pg.GetBalanceVersion(context.Background(), userID, nil)
 	if err != nil {
 		log.Printf("Error getting balance for user %s: %v", userID, err)
-		return 0.0, err
+		return 0.0, 0, err
 	}
-	return balance, nil
+	return balance, version, nil
 }
 
-func AddAmount(userID string, amount float64) error {
-	err := kafka.SendAddBalanceMessage(kafka.AddBalanceMessage{
-		Amount: amount,
+// checkVersion returns ErrVersionConflict unless userID's account is at
+// version expected; zero expects any version. Given tx, it locks the
+// account row first, so the version cannot change before the caller's
+// update.
+func checkVersion(ctx context.Context, userID string, expected int64, tx *sql.Tx) error {
+	if expected == 0 {
+		return nil
+	}
+	var version int64
+	if tx != nil {
+		account, err := pg.LockAccount(ctx, userID, tx)
+		if err != nil {
+			return err
+		}
+		version = account.Version
+	} else {
+		var err error
+		if _, version, err = pg.GetBalanceVersion(ctx, userID, nil); err != nil {
+			return err
+		}
+	}
+	if version != expected {
+		return fmt.Errorf("account %s is at version %d, not %d: %w", userID, version, expected, ErrVersionConflict)
+	}
+	return nil
+}
+
+func AddAmount(ctx context.Context, userID string, amount float64, expectedVersion int64) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+	if err := validateAmount(amount); err != nil {
+		return err
+	}
+	if err := validateExpectedVersion(expectedVersion); err != nil {
+		return err
+	}
+	// Fail fast on a stale version; the consumer checks again under lock.
+	if err := checkVersion(ctx, userID, expectedVersion, nil); err != nil {
+		return err
+	}
+	err := kafka.SendAddBalanceMessage(ctx, kafka.AddBalanceMessage{
+		Amount:          amount,
+		ExpectedVersion: expectedVersion,
 		BaseMessage: kafka.BaseMessage{
 			UserID:    userID,
 			Timestamp: time.Now(),
@@ -32,9 +77,23 @@ func AddAmount(userID string, amount float64) error {
 	return nil
 }
 
-func DeductAmount(userID string, amount float64) error {
-	err := kafka.SendDeductBalanceMessage(kafka.DeductBalanceMessage{
-		Amount: amount,
+func DeductAmount(ctx context.Context, userID string, amount float64, expectedVersion int64) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+	if err := validateAmount(amount); err != nil {
+		return err
+	}
+	if err := validateExpectedVersion(expectedVersion); err != nil {
+		return err
+	}
+	// Fail fast on a stale version; the consumer checks again under lock.
+	if err := checkVersion(ctx, userID, expectedVersion, nil); err != nil {
+		return err
+	}
+	err := kafka.SendDeductBalanceMessage(ctx, kafka.DeductBalanceMessage{
+		Amount:          amount,
+		ExpectedVersion: expectedVersion,
 		BaseMessage: kafka.BaseMessage{
 			UserID:    userID,
 			Timestamp: time.Now(),
@@ -47,8 +106,14 @@ func DeductAmount(userID string, amount float64) error {
 	return nil
 }
 
-func CreateAccount(userID string, initialBalance float64) error {
-	err := kafka.SendCreateAccountMessage(kafka.CreateAccountMessage{
+func CreateAccount(ctx context.Context, userID string, initialBalance float64) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+	if err := validateInitialBalance(initialBalance); err != nil {
+		return err
+	}
+	err := kafka.SendCreateAccountMessage(ctx, kafka.CreateAccountMessage{
 		InitialBalance: initialBalance,
 		BaseMessage: kafka.BaseMessage{
 			UserID:    userID,
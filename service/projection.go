@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"ledger/config"
+	"ledger/mongo"
+	"ledger/pg"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ledgerProjectorLease is the job_leases row held by the replica that
+	// projects ledger entries into MongoDB, so records are chained in the
+	// order their entries were written.
+	ledgerProjectorLease = "ledger-projector"
+	// projectionBatch bounds the transactions projected per poll, so a
+	// rebuild cannot starve the lease renewal.
+	projectionBatch = 200
+)
+
+// Log sources GET /logs can be served from.
+const (
+	LogsFromPostgres = "postgres"
+	LogsFromMongo    = "mongo"
+)
+
+// logsSource is the store GetUserLogs reads.
+var logsSource = LogsFromMongo
+
+var ledgerProjectorDone sync.WaitGroup
+
+// SetLogsSource chooses the store GetUserLogs reads: LogsFromPostgres or
+// LogsFromMongo. Call it before Initialize.
+func SetLogsSource(source string) {
+	logsSource = source
+}
+
+// GetUserLogs returns an account's ledger records, oldest first, from the
+// configured store. Records read from Postgres have no MongoDB ID or hash
+// chain fields.
+func GetUserLogs(userID string) ([]mongo.LedgerRecord, error) {
+	if logsSource == LogsFromPostgres {
+		entries, err := pg.ListAccountEntries(context.Background(), userID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user logs: %w", err)
+		}
+		records := make([]mongo.LedgerRecord, 0, len(entries))
+		for _, e := range entries {
+			records = append(records, entryRecord(e))
+		}
+		return records, nil
+	}
+
+	records, err := mongo.GetUserLogs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user logs: %w", err)
+	}
+	return records, nil
+}
+
+// ProjectLedger writes up to limit queued transactions from ledger_entries
+// into MongoDB, oldest first, and returns how many it projected. It stops
+// at the first failure, leaving that transaction queued, so later ones are
+// never chained ahead of it.
+func ProjectLedger(ctx context.Context, limit int) (int, error) {
+	items, err := pg.ListProjectionQueue(ctx, limit, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, item := range items {
+		entries, err := pg.ListTransactionEntries(ctx, item.TransactionID, nil)
+		if err != nil {
+			return i, err
+		}
+		records := make([]mongo.LedgerRecord, 0, len(entries))
+		for _, e := range entries {
+			records = append(records, entryRecord(e))
+		}
+		if len(records) > 0 {
+			if err := mongo.RecordTransaction(ctx, records); err != nil {
+				return i, fmt.Errorf("failed to project transaction %s: %w", item.TransactionID, err)
+			}
+		}
+		if err := pg.DeleteProjection(ctx, item.ID, nil); err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
+
+// RebuildLedgerProjection queues every transaction in ledger_entries to be
+// projected again. Records MongoDB already has are skipped, so point the
+// service at an empty database to rebuild the read model from scratch.
+func RebuildLedgerProjection(ctx context.Context) (int64, error) {
+	return pg.RequeueAllProjections(ctx, nil)
+}
+
+// BackfillLedgerEntries copies ledger records written to MongoDB before
+// ledger_entries existed into it, keeping their timestamps, and returns how
+// many records it read. Records already in ledger_entries are skipped.
+func BackfillLedgerEntries(ctx context.Context) (int, error) {
+	accounts, err := mongo.LedgerAccounts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	read := 0
+	for _, id := range accounts {
+		records, err := mongo.GetUserLogs(id)
+		if err != nil {
+			return read, err
+		}
+		entries := make([]pg.LedgerEntry, 0, len(records))
+		for _, r := range records {
+			entries = append(entries, pg.LedgerEntry{
+				AccountID:      r.UserID,
+				Operation:      r.Operation,
+				Amount:         r.Amount,
+				TransactionID:  r.TransactionID,
+				CounterAccount: r.CounterAccount,
+				Direction:      r.Direction,
+				Description:    r.Description,
+				Status:         r.Status,
+				Reverses:       r.Reverses,
+				RecordedAt:     r.Timestamp,
+			})
+		}
+		if err := pg.InsertLedgerEntries(ctx, entries, nil); err != nil {
+			return read, fmt.Errorf("account %s: %w", id, err)
+		}
+		read += len(records)
+	}
+	return read, nil
+}
+
+// entryRecord is the MongoDB read model of a ledger entry.
+func entryRecord(e pg.LedgerEntry) mongo.LedgerRecord {
+	return mongo.LedgerRecord{
+		UserID:         e.AccountID,
+		Operation:      e.Operation,
+		Amount:         e.Amount,
+		Timestamp:      e.RecordedAt,
+		TransactionID:  e.TransactionID,
+		Status:         e.Status,
+		CounterAccount: e.CounterAccount,
+		Direction:      e.Direction,
+		Description:    e.Description,
+		Reverses:       e.Reverses,
+	}
+}
+
+// StartLedgerProjector projects ledger entries into MongoDB every
+// cfg.ProjectionInterval until ctx is cancelled. Only the replica holding
+// the ledger-projector lease projects.
+func StartLedgerProjector(ctx context.Context, cfg config.LedgerConfig) {
+	host, _ := os.Hostname()
+	owner := host + "/" + uuid.New().String()
+
+	ledgerProjectorDone.Add(1)
+	go func() {
+		defer ledgerProjectorDone.Done()
+		ticker := time.NewTicker(cfg.ProjectionInterval)
+		defer ticker.Stop()
+
+		leader := false
+		for {
+			held, err := pg.AcquireLease(ctx, ledgerProjectorLease, owner, cfg.ProjectionLeaseTTL, nil)
+			if err != nil {
+				log.Printf("Ledger projector: %v\n", err)
+			}
+			if held != leader {
+				leader = held
+				log.Printf("Ledger projector lease held: %t\n", leader)
+			}
+			if held {
+				if _, err := ProjectLedger(ctx, projectionBatch); err != nil {
+					log.Printf("Ledger projector: %v\n", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				if leader {
+					// ctx is done, so release with a context of our own.
+					if err := pg.ReleaseLease(context.Background(), ledgerProjectorLease, owner, nil); err != nil {
+						log.Printf("Ledger projector: %v\n", err)
+					}
+				}
+				log.Println("Ledger projector stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// WaitForLedgerProjector blocks until the projector has stopped or ctx
+// expires.
+func WaitForLedgerProjector(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ledgerProjectorDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for ledger projector: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ledger/mongo"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProjectionQueue queues items and serves each transaction's entries
+// from entries. It returns the queue IDs deleted.
+func stubProjectionQueue(p *gomonkey.Patches, items []pg.ProjectionItem, entries map[string][]pg.LedgerEntry) *[]int64 {
+	var deleted []int64
+	p.ApplyFunc(pg.ListProjectionQueue,
+		func(_ context.Context, limit int, _ *sql.Tx) ([]pg.ProjectionItem, error) {
+			return items, nil
+		})
+	p.ApplyFunc(pg.ListTransactionEntries,
+		func(_ context.Context, id string, _ *sql.Tx) ([]pg.LedgerEntry, error) {
+			return entries[id], nil
+		})
+	p.ApplyFunc(pg.DeleteProjection,
+		func(_ context.Context, id int64, _ *sql.Tx) error {
+			deleted = append(deleted, id)
+			return nil
+		})
+	return &deleted
+}
+
+func TestProjectLedger(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	at := time.Date(2025, time.May, 17, 13, 11, 14, 0, time.UTC)
+	deleted := stubProjectionQueue(patches,
+		[]pg.ProjectionItem{{ID: 1, TransactionID: "evt-1"}, {ID: 2, TransactionID: "entry-1"}},
+		map[string][]pg.LedgerEntry{
+			"evt-1": {{AccountID: "user-1", Operation: "AddBalance", Amount: 50, TransactionID: "evt-1",
+				CounterAccount: pg.CashClearingAccount, RecordedAt: at}},
+			"entry-1": {
+				{AccountID: "a", Operation: "PostJournalEntry", Amount: -10, TransactionID: "entry-1", Direction: "debit", Reverses: "entry-0"},
+				{AccountID: "b", Operation: "PostJournalEntry", Amount: 10, TransactionID: "entry-1", Direction: "credit", Reverses: "entry-0"},
+			},
+		})
+	var projected [][]mongo.LedgerRecord
+	patches.ApplyFunc(mongo.RecordTransaction,
+		func(_ context.Context, records []mongo.LedgerRecord) error {
+			projected = append(projected, records)
+			return nil
+		})
+
+	n, err := service.ProjectLedger(context.Background(), 10)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1, 2}, *deleted)
+	require.Len(t, projected, 2)
+	assert.Equal(t, []mongo.LedgerRecord{{UserID: "user-1", Operation: "AddBalance", Amount: 50, TransactionID: "evt-1",
+		CounterAccount: pg.CashClearingAccount, Timestamp: at}}, projected[0])
+	require.Len(t, projected[1], 2)
+	assert.Equal(t, "entry-0", projected[1][1].Reverses)
+}
+
+func TestProjectLedgerStopsAtFailure(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	deleted := stubProjectionQueue(patches,
+		[]pg.ProjectionItem{{ID: 1, TransactionID: "evt-1"}, {ID: 2, TransactionID: "evt-2"}, {ID: 3, TransactionID: "evt-3"}},
+		map[string][]pg.LedgerEntry{
+			"evt-1": {{AccountID: "user-1", Operation: "AddBalance", Amount: 1, TransactionID: "evt-1"}},
+			"evt-2": {{AccountID: "user-1", Operation: "AddBalance", Amount: 2, TransactionID: "evt-2"}},
+			"evt-3": {{AccountID: "user-1", Operation: "AddBalance", Amount: 3, TransactionID: "evt-3"}},
+		})
+	patches.ApplyFunc(mongo.RecordTransaction,
+		func(_ context.Context, records []mongo.LedgerRecord) error {
+			if records[0].TransactionID == "evt-2" {
+				return errors.New("mongo unavailable")
+			}
+			return nil
+		})
+
+	n, err := service.ProjectLedger(context.Background(), 10)
+
+	assert.ErrorContains(t, err, "evt-2")
+	assert.Equal(t, 1, n)
+	// evt-2 stays queued, and evt-3 is not chained ahead of it.
+	assert.Equal(t, []int64{1}, *deleted)
+}
+
+func TestGetUserLogsFromPostgres(t *testing.T) {
+	service.SetLogsSource(service.LogsFromPostgres)
+	defer service.SetLogsSource(service.LogsFromMongo)
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	patches.ApplyFunc(pg.ListAccountEntries,
+		func(_ context.Context, id string, _ *sql.Tx) ([]pg.LedgerEntry, error) {
+			assert.Equal(t, "user-1", id)
+			return []pg.LedgerEntry{{ID: 7, AccountID: "user-1", Operation: "DeductBalance", Amount: -5, TransactionID: "evt-1"}}, nil
+		})
+	patches.ApplyFunc(mongo.GetUserLogs,
+		func(_ string) ([]mongo.LedgerRecord, error) {
+			t.Error("mongo should not be read")
+			return nil, nil
+		})
+
+	records, err := service.GetUserLogs("user-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, []mongo.LedgerRecord{{UserID: "user-1", Operation: "DeductBalance", Amount: -5, TransactionID: "evt-1"}}, records)
+}
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ledger/config"
+	"ledger/kafka"
+	"ledger/pg"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// paymentSchedulerLease is the job_leases row held by the replica that
+	// fires schedules.
+	paymentSchedulerLease = "payment-scheduler"
+	// scheduleFireBatch bounds the schedules fired per poll, so a backlog
+	// after downtime cannot starve the lease renewal.
+	scheduleFireBatch = 100
+	// scheduleCatchUpBatch bounds the missed occurrences of one schedule
+	// handled per transaction; a longer backlog is skipped over several.
+	scheduleCatchUpBatch = 1000
+	// scheduleRunLogLimit bounds the runs ListScheduleRuns returns.
+	scheduleRunLogLimit = 100
+	// maxScheduleDescription bounds a schedule's description.
+	maxScheduleDescription = 200
+)
+
+var paymentSchedulerDone sync.WaitGroup
+
+// ScheduleRequest describes a payment schedule to create. A schedule
+// without Cron runs once, at StartAt; with Cron, a standard five-field
+// cron expression evaluated in UTC, it runs on every occurrence after
+// StartAt (or now) until EndAt, if set. CatchUp is the catch-up policy,
+// pg.ScheduleCatchUpOnce by default.
+type ScheduleRequest struct {
+	AccountID   string
+	Kind        string
+	ToAccountID string
+	Amount      float64
+	Description string
+	StartAt     *time.Time
+	Cron        string
+	EndAt       *time.Time
+	CatchUp     string
+}
+
+// CreateSchedule validates req and stores it as an active schedule. The
+// currency is the paying account's; a transfer's accounts must share it.
+func CreateSchedule(ctx context.Context, req ScheduleRequest) (pg.PaymentSchedule, error) {
+	now := time.Now()
+	s := pg.PaymentSchedule{
+		ID:          uuid.New().String(),
+		AccountID:   req.AccountID,
+		Kind:        req.Kind,
+		ToAccountID: req.ToAccountID,
+		Amount:      req.Amount,
+		Description: strings.TrimSpace(req.Description),
+		Cron:        strings.TrimSpace(req.Cron),
+		EndAt:       req.EndAt,
+		CatchUp:     strings.TrimSpace(req.CatchUp),
+	}
+	if s.CatchUp == "" {
+		s.CatchUp = pg.ScheduleCatchUpOnce
+	}
+	if err := validateSchedule(s); err != nil {
+		return pg.PaymentSchedule{}, err
+	}
+
+	start := now
+	if req.StartAt != nil {
+		start = *req.StartAt
+	}
+	if s.Cron == "" {
+		if req.StartAt == nil {
+			return pg.PaymentSchedule{}, fmt.Errorf("%w: start_at is required for a one-off schedule", ErrInvalidArgument)
+		}
+		s.NextRunAt = start
+	} else {
+		// Validated above, so parsing cannot fail.
+		spec, _ := cron.ParseStandard(s.Cron)
+		s.NextRunAt = spec.Next(start.Add(-time.Second).UTC())
+	}
+	if s.EndAt != nil && !s.NextRunAt.Before(*s.EndAt) {
+		return pg.PaymentSchedule{}, fmt.Errorf("%w: end_at must be after the first run", ErrInvalidArgument)
+	}
+
+	account, err := pg.GetAccount(ctx, s.AccountID, nil)
+	if err != nil {
+		return pg.PaymentSchedule{}, err
+	}
+	if account.Status == pg.AccountClosed {
+		return pg.PaymentSchedule{}, fmt.Errorf("account %s: %w", account.ID, ErrAccountClosed)
+	}
+	s.Currency = account.Currency
+	if s.Kind == pg.ScheduleTransfer {
+		to, err := pg.GetAccount(ctx, s.ToAccountID, nil)
+		if err != nil {
+			return pg.PaymentSchedule{}, err
+		}
+		if to.Status == pg.AccountClosed {
+			return pg.PaymentSchedule{}, fmt.Errorf("account %s: %w", to.ID, ErrAccountClosed)
+		}
+		if to.Currency != account.Currency {
+			return pg.PaymentSchedule{}, fmt.Errorf("account %s is held in %s, not %s: %w", to.ID, to.Currency, account.Currency, ErrCurrencyMismatch)
+		}
+	}
+
+	created, err := pg.InsertSchedule(ctx, s, nil)
+	if err != nil {
+		return pg.PaymentSchedule{}, err
+	}
+	log.Printf("Created %s schedule %s for account %s, first run at %s\n", created.Kind, created.ID, created.AccountID, created.NextRunAt.Format(time.RFC3339))
+	return created, nil
+}
+
+func validateSchedule(s pg.PaymentSchedule) error {
+	if err := validateUserID(s.AccountID); err != nil {
+		return err
+	}
+	switch s.Kind {
+	case pg.ScheduleDeposit, pg.ScheduleWithdrawal:
+		if s.ToAccountID != "" {
+			return fmt.Errorf("%w: to_account_id is only allowed for transfers", ErrInvalidArgument)
+		}
+	case pg.ScheduleTransfer:
+		if err := validateUserID(s.ToAccountID); err != nil {
+			return fmt.Errorf("to_account_id: %w", err)
+		}
+		if s.ToAccountID == s.AccountID {
+			return fmt.Errorf("%w: a transfer needs two different accounts", ErrInvalidArgument)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be deposit, withdrawal or transfer, got %q", ErrInvalidArgument, s.Kind)
+	}
+	if err := validateAmount(s.Amount); err != nil {
+		return err
+	}
+	if len(s.Description) > maxScheduleDescription {
+		return fmt.Errorf("%w: description is longer than %d characters", ErrInvalidArgument, maxScheduleDescription)
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return fmt.Errorf("%w: cron: %v", ErrInvalidArgument, err)
+		}
+	}
+	switch s.CatchUp {
+	case pg.ScheduleCatchUpOnce, pg.ScheduleCatchUpSkip, pg.ScheduleCatchUpAll:
+	default:
+		return fmt.Errorf("%w: catch_up must be once, skip or all, got %q", ErrInvalidArgument, s.CatchUp)
+	}
+	return nil
+}
+
+// GetSchedule returns a payment schedule.
+func GetSchedule(ctx context.Context, id string) (pg.PaymentSchedule, error) {
+	s, err := pg.GetSchedule(ctx, id, nil)
+	return s, scheduleNotFound(err, id)
+}
+
+// ListAccountSchedules returns the schedules paying from an account,
+// oldest first.
+func ListAccountSchedules(ctx context.Context, accountID string) ([]pg.PaymentSchedule, error) {
+	if err := validateUserID(accountID); err != nil {
+		return nil, err
+	}
+	return pg.ListSchedulesByAccount(ctx, accountID, nil)
+}
+
+// ListScheduleRuns returns a schedule's most recent runs, newest first.
+func ListScheduleRuns(ctx context.Context, id string) ([]pg.ScheduleRun, error) {
+	if _, err := GetSchedule(ctx, id); err != nil {
+		return nil, err
+	}
+	return pg.ListScheduleRuns(ctx, id, scheduleRunLogLimit, nil)
+}
+
+// PauseSchedule stops an active schedule from firing until it is resumed.
+func PauseSchedule(ctx context.Context, id string) (pg.PaymentSchedule, error) {
+	return transitionSchedule(ctx, id, pg.SchedulePaused, func(s pg.PaymentSchedule) (time.Time, error) {
+		if s.Status != pg.ScheduleActive {
+			return time.Time{}, fmt.Errorf("%w: schedule %s is %s", ErrInvalidScheduleTransition, s.ID, s.Status)
+		}
+		return s.NextRunAt, nil
+	})
+}
+
+// ResumeSchedule reactivates a paused schedule. A recurring schedule skips
+// the occurrences that fell while it was paused; a one-off schedule whose
+// time has passed runs straight away.
+func ResumeSchedule(ctx context.Context, id string) (pg.PaymentSchedule, error) {
+	return transitionSchedule(ctx, id, pg.ScheduleActive, func(s pg.PaymentSchedule) (time.Time, error) {
+		if s.Status != pg.SchedulePaused {
+			return time.Time{}, fmt.Errorf("%w: schedule %s is %s", ErrInvalidScheduleTransition, s.ID, s.Status)
+		}
+		now := time.Now()
+		if s.Cron == "" || s.NextRunAt.After(now) {
+			return s.NextRunAt, nil
+		}
+		spec, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("schedule %s has an invalid cron expression: %w", s.ID, err)
+		}
+		next := spec.Next(now.UTC())
+		if s.EndAt != nil && !next.Before(*s.EndAt) {
+			return time.Time{}, fmt.Errorf("%w: schedule %s has no occurrences left", ErrInvalidScheduleTransition, s.ID)
+		}
+		return next, nil
+	})
+}
+
+// CancelSchedule stops an active or paused schedule for good. Runs already
+// fired are not affected.
+func CancelSchedule(ctx context.Context, id string) (pg.PaymentSchedule, error) {
+	return transitionSchedule(ctx, id, pg.ScheduleCancelled, func(s pg.PaymentSchedule) (time.Time, error) {
+		if s.Status != pg.ScheduleActive && s.Status != pg.SchedulePaused {
+			return time.Time{}, fmt.Errorf("%w: schedule %s is %s", ErrInvalidScheduleTransition, s.ID, s.Status)
+		}
+		return s.NextRunAt, nil
+	})
+}
+
+// transitionSchedule locks a schedule, so it cannot fire meanwhile, and
+// moves it to status at the next run time check returns.
+func transitionSchedule(ctx context.Context, id, status string, check func(pg.PaymentSchedule) (time.Time, error)) (pg.PaymentSchedule, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return pg.PaymentSchedule{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	s, err := pg.LockSchedule(ctx, id, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return pg.PaymentSchedule{}, scheduleNotFound(err, id)
+	}
+	next, err := check(s)
+	if err != nil {
+		_ = tx.Rollback()
+		return pg.PaymentSchedule{}, err
+	}
+	updated, err := pg.UpdateSchedule(ctx, id, status, next, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return pg.PaymentSchedule{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return pg.PaymentSchedule{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	log.Printf("Payment schedule %s is now %s\n", id, status)
+	return updated, nil
+}
+
+func scheduleNotFound(err error, id string) error {
+	if errors.Is(err, pg.ErrNotFound) {
+		return fmt.Errorf("%w: payment schedule %s", ErrNotFound, id)
+	}
+	return err
+}
+
+// FireDueSchedules handles up to limit due schedules and returns how many
+// occurrences it fired. Each schedule is handled in a transaction of its
+// own that queues the command of the occurrence it fires in the outbox,
+// records a run for every due occurrence and moves the schedule on to its
+// next occurrence, so an occurrence is sent at most once however often
+// this runs or crashes.
+//
+// Occurrences that fell due while no replica was running are caught up as
+// the schedule's policy says: ScheduleCatchUpOnce fires the latest and
+// skips the others, ScheduleCatchUpSkip does the same unless the latest is
+// more than missedAfter late, and ScheduleCatchUpAll fires them one by
+// one, oldest first.
+// Skipped occurrences are recorded as runs with ScheduleRunSkipped.
+func FireDueSchedules(ctx context.Context, limit int, missedAfter time.Duration) (int, error) {
+	fired := 0
+	for handled := 0; handled < limit; handled++ {
+		ok, n, err := fireDueSchedule(ctx, missedAfter)
+		fired += n
+		if err != nil {
+			return fired, err
+		}
+		if !ok {
+			break
+		}
+	}
+	return fired, nil
+}
+
+// fireDueSchedule handles the schedule due the longest, if any, and
+// returns how many occurrences it fired.
+func fireDueSchedule(ctx context.Context, missedAfter time.Duration) (bool, int, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	s, ok, err := pg.ClaimDueSchedule(ctx, tx)
+	if err != nil || !ok {
+		_ = tx.Rollback()
+		return false, 0, err
+	}
+
+	now := time.Now()
+	due, status, next := dueOccurrences(s, now)
+	fire := catchUp(s, due, status, next, now, missedAfter)
+	for _, at := range due {
+		if at.Equal(fire) {
+			continue
+		}
+		if err := pg.InsertScheduleRun(ctx, pg.ScheduleRun{ScheduleID: s.ID, ScheduledFor: at}, tx); err != nil {
+			_ = tx.Rollback()
+			return false, 0, err
+		}
+	}
+	if !fire.IsZero() {
+		if err := queueScheduleRun(ctx, s, fire, tx); err != nil {
+			_ = tx.Rollback()
+			return false, 0, err
+		}
+	}
+
+	if _, err := pg.UpdateSchedule(ctx, s.ID, status, next, tx); err != nil {
+		_ = tx.Rollback()
+		return false, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if fire.IsZero() {
+		log.Printf("Skipped %d missed occurrence(s) of payment schedule %s\n", len(due), s.ID)
+		return true, 0, nil
+	}
+	if skipped := len(due) - 1; skipped > 0 {
+		log.Printf("Skipped %d missed occurrence(s) of payment schedule %s\n", skipped, s.ID)
+	}
+	log.Printf("Fired payment schedule %s for %s\n", s.ID, fire.Format(time.RFC3339))
+	return true, 1, nil
+}
+
+// queueScheduleRun queues the command of s's occurrence at and records the
+// run.
+func queueScheduleRun(ctx context.Context, s pg.PaymentSchedule, at time.Time, tx *sql.Tx) error {
+	// The schedule ID correlates every run and the events they cause.
+	meta := kafka.NewEventMeta(kafka.WithCorrelationID(ctx, s.ID), scheduleOperation(s.Kind))
+	topic, key, msg := scheduleCommand(s, meta.OccurredAt)
+	encoded, err := kafka.EncodeMessage(kafka.CommandTopic(topic), key, meta, msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule %s command: %w", s.ID, err)
+	}
+	if err := pg.InsertOutbox(ctx, outboxMessage(meta, encoded), tx); err != nil {
+		return err
+	}
+	return pg.InsertScheduleRun(ctx, pg.ScheduleRun{ScheduleID: s.ID, ScheduledFor: at, EventID: meta.EventID}, tx)
+}
+
+// catchUp returns which of the due occurrences of s to fire under its
+// catch-up policy, or a zero time to skip them all. status and next are
+// what dueOccurrences returned: a schedule still due at next has more
+// missed occurrences than one transaction handles, so these are all
+// missed, and all skipped unless the policy fires every one.
+func catchUp(s pg.PaymentSchedule, due []time.Time, status string, next, now time.Time, missedAfter time.Duration) time.Time {
+	latest := due[len(due)-1]
+	backlog := status == pg.ScheduleActive && !next.After(now)
+	switch s.CatchUp {
+	case pg.ScheduleCatchUpAll:
+		return due[0]
+	case pg.ScheduleCatchUpSkip:
+		if backlog || now.Sub(latest) > missedAfter {
+			return time.Time{}
+		}
+		return latest
+	default:
+		if backlog {
+			return time.Time{}
+		}
+		return latest
+	}
+}
+
+// dueOccurrences returns the occurrences of s due by now, oldest first,
+// and the status and next run time that follow them: the first occurrence
+// after now for a recurring schedule, or completed once there is none
+// left. A schedule catching up on every occurrence takes them one at a
+// time, and any other at most scheduleCatchUpBatch at a time.
+func dueOccurrences(s pg.PaymentSchedule, now time.Time) ([]time.Time, string, time.Time) {
+	due := []time.Time{s.NextRunAt}
+	if s.Cron == "" {
+		return due, pg.ScheduleCompleted, s.NextRunAt
+	}
+	spec, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		log.Printf("Payment schedule %s has an invalid cron expression, completing it: %v\n", s.ID, err)
+		return due, pg.ScheduleCompleted, s.NextRunAt
+	}
+	limit := scheduleCatchUpBatch
+	if s.CatchUp == pg.ScheduleCatchUpAll {
+		limit = 1
+	}
+	last := s.NextRunAt
+	for {
+		next := spec.Next(last.UTC())
+		if next.IsZero() || (s.EndAt != nil && !next.Before(*s.EndAt)) {
+			return due, pg.ScheduleCompleted, last
+		}
+		if len(due) >= limit || next.After(now) {
+			return due, pg.ScheduleActive, next
+		}
+		due = append(due, next)
+		last = next
+	}
+}
+
+func scheduleOperation(kind string) string {
+	switch kind {
+	case pg.ScheduleDeposit:
+		return kafka.EventTypeAddBalance
+	case pg.ScheduleWithdrawal:
+		return kafka.EventTypeDeductBalance
+	default:
+		return kafka.EventTypePostJournalEntry
+	}
+}
+
+// scheduleCommand returns the command a schedule sends, with its topic and
+// key. Transfers go out as a two-leg journal entry debiting the paying
+// account and crediting the other.
+func scheduleCommand(s pg.PaymentSchedule, now time.Time) (string, string, kafka.Message) {
+	base := kafka.BaseMessage{UserID: s.AccountID, Timestamp: now}
+	switch s.Kind {
+	case pg.ScheduleDeposit:
+		return kafka.TopicAddBalance, s.AccountID, kafka.AddBalanceMessage{BaseMessage: base, Amount: s.Amount}
+	case pg.ScheduleWithdrawal:
+		return kafka.TopicDeductBalance, s.AccountID, kafka.DeductBalanceMessage{BaseMessage: base, Amount: s.Amount}
+	default:
+		entryID := uuid.New().String()
+		description := s.Description
+		if description == "" {
+			description = "Scheduled transfer " + s.ID
+		}
+		return kafka.TopicJournalEntry, entryID, kafka.PostJournalEntryMessage{
+			EntryID:     entryID,
+			Description: description,
+			Timestamp:   now,
+			Legs: []kafka.JournalLeg{
+				{UserID: s.AccountID, Direction: kafka.Debit, Amount: s.Amount, Currency: s.Currency},
+				{UserID: s.ToAccountID, Direction: kafka.Credit, Amount: s.Amount, Currency: s.Currency},
+			},
+		}
+	}
+}
+
+// StartPaymentScheduler fires due payment schedules every
+// cfg.PollInterval until ctx is cancelled. Only the replica holding the
+// scheduler lease fires; the others keep trying to take the lease over, so
+// one of them does within cfg.LeaseTTL of the holder stopping.
+func StartPaymentScheduler(ctx context.Context, cfg config.SchedulerConfig) {
+	host, _ := os.Hostname()
+	owner := host + "/" + uuid.New().String()
+
+	paymentSchedulerDone.Add(1)
+	go func() {
+		defer paymentSchedulerDone.Done()
+		ticker := time.NewTicker(cfg.PollInterval)
+		defer ticker.Stop()
+
+		leader := false
+		for {
+			held, err := pg.AcquireLease(ctx, paymentSchedulerLease, owner, cfg.LeaseTTL, nil)
+			if err != nil {
+				log.Printf("Payment scheduler: %v\n", err)
+			}
+			if held != leader {
+				leader = held
+				log.Printf("Payment scheduler lease held: %t\n", leader)
+			}
+			if held {
+				if _, err := FireDueSchedules(ctx, scheduleFireBatch, cfg.MissedAfter); err != nil {
+					log.Printf("Payment scheduler: %v\n", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				if leader {
+					// ctx is done, so release with a context of our own.
+					if err := pg.ReleaseLease(context.Background(), paymentSchedulerLease, owner, nil); err != nil {
+						log.Printf("Payment scheduler: %v\n", err)
+					}
+				}
+				log.Println("Payment scheduler stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// WaitForPaymentScheduler blocks until the scheduler has stopped or ctx
+// expires.
+func WaitForPaymentScheduler(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		paymentSchedulerDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for payment scheduler: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,326 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAccounts makes pg.GetAccount return the given accounts and
+// ErrAccountNotFound for any other.
+func stubAccounts(p *gomonkey.Patches, accounts ...pg.Account) {
+	p.ApplyFunc(pg.GetAccount,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.Account, error) {
+			for _, a := range accounts {
+				if a.ID == id {
+					return a, nil
+				}
+			}
+			return pg.Account{}, pg.ErrAccountNotFound
+		})
+}
+
+// stubFiring makes pg.ClaimDueSchedule hand out due, one at a time, and
+// captures the runs and schedule updates written when they fire.
+func stubFiring(p *gomonkey.Patches, due ...pg.PaymentSchedule) (*[]pg.ScheduleRun, *[]pg.PaymentSchedule) {
+	var runs []pg.ScheduleRun
+	var updates []pg.PaymentSchedule
+	p.ApplyFunc(pg.ClaimDueSchedule,
+		func(_ context.Context, _ *sql.Tx) (pg.PaymentSchedule, bool, error) {
+			if len(due) == 0 {
+				return pg.PaymentSchedule{}, false, nil
+			}
+			s := due[0]
+			due = due[1:]
+			return s, true, nil
+		})
+	p.ApplyFunc(pg.InsertScheduleRun,
+		func(_ context.Context, run pg.ScheduleRun, _ *sql.Tx) error {
+			runs = append(runs, run)
+			return nil
+		})
+	p.ApplyFunc(pg.UpdateSchedule,
+		func(_ context.Context, id, status string, next time.Time, _ *sql.Tx) (pg.PaymentSchedule, error) {
+			s := pg.PaymentSchedule{ID: id, Status: status, NextRunAt: next}
+			updates = append(updates, s)
+			return s, nil
+		})
+	return &runs, &updates
+}
+
+// missedAfter is the scheduler's default lateness for a missed occurrence.
+const missedAfter = 5 * time.Minute
+
+func TestCreateRecurringSchedule(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	stubAccounts(patches,
+		pg.Account{ID: "acc_1", Currency: "USD", Status: pg.AccountActive},
+		pg.Account{ID: "acc_2", Currency: "USD", Status: pg.AccountActive})
+
+	var stored pg.PaymentSchedule
+	patches.ApplyFunc(pg.InsertSchedule,
+		func(_ context.Context, s pg.PaymentSchedule, _ *sql.Tx) (pg.PaymentSchedule, error) {
+			stored = s
+			return s, nil
+		})
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	s, err := service.CreateSchedule(context.Background(), service.ScheduleRequest{
+		AccountID:   "acc_1",
+		Kind:        pg.ScheduleTransfer,
+		ToAccountID: "acc_2",
+		Amount:      50,
+		StartAt:     &start,
+		Cron:        "0 9 1 * *",
+	})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.ID)
+	assert.Equal(t, "USD", stored.Currency)
+	// The first occurrence at or after the start.
+	assert.Equal(t, time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC), stored.NextRunAt)
+	assert.Equal(t, pg.ScheduleCatchUpOnce, stored.CatchUp)
+}
+
+func TestCreateScheduleRejectsBadRequests(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	stubAccounts(patches,
+		pg.Account{ID: "acc_usd", Currency: "USD", Status: pg.AccountActive},
+		pg.Account{ID: "acc_eur", Currency: "EUR", Status: pg.AccountActive},
+		pg.Account{ID: "acc_closed", Currency: "USD", Status: pg.AccountClosed})
+	patches.ApplyFunc(pg.InsertSchedule,
+		func(_ context.Context, _ pg.PaymentSchedule, _ *sql.Tx) (pg.PaymentSchedule, error) {
+			t.Fatal("an invalid schedule must not be stored")
+			return pg.PaymentSchedule{}, nil
+		})
+
+	start := time.Now().Add(time.Hour)
+	before := start.Add(-time.Minute)
+	tests := []struct {
+		name string
+		req  service.ScheduleRequest
+		want error
+	}{
+		{"unknown kind", service.ScheduleRequest{AccountID: "acc_usd", Kind: "refund", Amount: 1, StartAt: &start}, service.ErrInvalidArgument},
+		{"bad cron", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleDeposit, Amount: 1, Cron: "every day"}, service.ErrInvalidArgument},
+		{"one-off without start", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleDeposit, Amount: 1}, service.ErrInvalidArgument},
+		{"ends before first run", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleDeposit, Amount: 1, StartAt: &start, EndAt: &before}, service.ErrInvalidArgument},
+		{"transfer to itself", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleTransfer, ToAccountID: "acc_usd", Amount: 1, StartAt: &start}, service.ErrInvalidArgument},
+		{"closed account", service.ScheduleRequest{AccountID: "acc_closed", Kind: pg.ScheduleWithdrawal, Amount: 1, StartAt: &start}, service.ErrAccountClosed},
+		{"currency mismatch", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleTransfer, ToAccountID: "acc_eur", Amount: 1, StartAt: &start}, service.ErrCurrencyMismatch},
+		{"unknown account", service.ScheduleRequest{AccountID: "acc_none", Kind: pg.ScheduleDeposit, Amount: 1, StartAt: &start}, service.ErrAccountNotFound},
+		{"unknown catch-up policy", service.ScheduleRequest{AccountID: "acc_usd", Kind: pg.ScheduleDeposit, Amount: 1, Cron: "0 9 * * *", CatchUp: "latest"}, service.ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateSchedule(context.Background(), tt.req)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestFireDueSchedules(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+
+	due := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	runs, updates := stubFiring(patches,
+		pg.PaymentSchedule{ID: "sch_once", AccountID: "acc_1", Kind: pg.ScheduleDeposit, Amount: 10, Currency: "USD", NextRunAt: due},
+		pg.PaymentSchedule{ID: "sch_monthly", AccountID: "acc_1", Kind: pg.ScheduleTransfer, ToAccountID: "acc_2", Amount: 25, Currency: "USD", Cron: "0 9 1 * *", CatchUp: pg.ScheduleCatchUpAll, NextRunAt: due, EndAt: &end},
+		pg.PaymentSchedule{ID: "sch_last", AccountID: "acc_1", Kind: pg.ScheduleWithdrawal, Amount: 5, Currency: "USD", Cron: "0 9 1 * *", NextRunAt: due.AddDate(0, 1, 0), EndAt: &end},
+	)
+
+	fired, err := service.FireDueSchedules(context.Background(), 10, missedAfter)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, fired)
+
+	require.Len(t, *outbox, 3)
+	assert.Equal(t, kafka.EventTypeAddBalance, (*outbox)[0].Headers[kafka.HeaderEventType])
+	assert.Equal(t, kafka.EventTypePostJournalEntry, (*outbox)[1].Headers[kafka.HeaderEventType])
+	assert.Equal(t, kafka.EventTypeDeductBalance, (*outbox)[2].Headers[kafka.HeaderEventType])
+	assert.Equal(t, "sch_monthly", (*outbox)[1].Headers[kafka.HeaderCorrelationID])
+
+	var entry kafka.PostJournalEntryMessage
+	require.NoError(t, kafka.Decode(&confluent.Message{Value: (*outbox)[1].Payload}, &entry))
+	require.Len(t, entry.Legs, 2)
+	assert.Equal(t, kafka.JournalLeg{UserID: "acc_1", Direction: kafka.Debit, Amount: 25, Currency: "USD"}, entry.Legs[0])
+	assert.Equal(t, kafka.JournalLeg{UserID: "acc_2", Direction: kafka.Credit, Amount: 25, Currency: "USD"}, entry.Legs[1])
+
+	require.Len(t, *runs, 3)
+	for i, run := range *runs {
+		assert.Equal(t, (*outbox)[i].EventID, run.EventID, "the run is tied to its command")
+	}
+	assert.Equal(t, due, (*runs)[0].ScheduledFor)
+
+	require.Len(t, *updates, 3)
+	assert.Equal(t, pg.ScheduleCompleted, (*updates)[0].Status)
+	assert.Equal(t, pg.ScheduleActive, (*updates)[1].Status)
+	assert.Equal(t, due.AddDate(0, 1, 0), (*updates)[1].NextRunAt)
+	// The occurrence after April's falls on the end date, so none is left.
+	assert.Equal(t, pg.ScheduleCompleted, (*updates)[2].Status)
+}
+
+func TestFireDueSchedulesStopsAtLimit(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	stubOutbox(patches, 0)
+
+	due := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	s := pg.PaymentSchedule{ID: "sch_1", AccountID: "acc_1", Kind: pg.ScheduleDeposit, Amount: 1, Currency: "USD", NextRunAt: due}
+	runs, _ := stubFiring(patches, s, s, s)
+
+	fired, err := service.FireDueSchedules(context.Background(), 2, missedAfter)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, fired)
+	assert.Len(t, *runs, 2)
+}
+
+func TestFireDueSchedulesCatchesUp(t *testing.T) {
+	now := time.Now().UTC()
+	latest := time.Date(now.Year(), now.Month(), now.Day(), 9, 0, 0, 0, time.UTC)
+	if latest.After(now) {
+		latest = latest.AddDate(0, 0, -1)
+	}
+	first := latest.AddDate(0, 0, -3)
+	daily := pg.PaymentSchedule{ID: "sch_daily", AccountID: "acc_1", Kind: pg.ScheduleDeposit, Amount: 1, Currency: "USD", Cron: "0 9 * * *", NextRunAt: first}
+	withPolicy := func(s pg.PaymentSchedule, policy string) pg.PaymentSchedule {
+		s.CatchUp = policy
+		return s
+	}
+	oneOff := func(at time.Time) pg.PaymentSchedule {
+		return pg.PaymentSchedule{ID: "sch_once", AccountID: "acc_1", Kind: pg.ScheduleDeposit, Amount: 1, Currency: "USD", CatchUp: pg.ScheduleCatchUpSkip, NextRunAt: at}
+	}
+	late, onTime := now.Add(-time.Hour), now.Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		schedule    pg.PaymentSchedule
+		missedAfter time.Duration
+		fired       []time.Time
+		skipped     []time.Time
+		status      string
+		next        time.Time
+	}{
+		{"once by default", daily, missedAfter,
+			[]time.Time{latest}, []time.Time{first, first.AddDate(0, 0, 1), first.AddDate(0, 0, 2)}, pg.ScheduleActive, latest.AddDate(0, 0, 1)},
+		{"all", withPolicy(daily, pg.ScheduleCatchUpAll), missedAfter,
+			[]time.Time{first}, nil, pg.ScheduleActive, first.AddDate(0, 0, 1)},
+		{"skip, latest in time", withPolicy(daily, pg.ScheduleCatchUpSkip), 48 * time.Hour,
+			[]time.Time{latest}, []time.Time{first, first.AddDate(0, 0, 1), first.AddDate(0, 0, 2)}, pg.ScheduleActive, latest.AddDate(0, 0, 1)},
+		{"skip, one-off missed", oneOff(late), missedAfter,
+			nil, []time.Time{late}, pg.ScheduleCompleted, late},
+		{"skip, one-off in time", oneOff(onTime), missedAfter,
+			[]time.Time{onTime}, nil, pg.ScheduleCompleted, onTime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches := gomonkey.NewPatches()
+			defer patches.Reset()
+			noOpDB(patches)
+			outbox := stubOutbox(patches, 0)
+			runs, updates := stubFiring(patches, tt.schedule)
+
+			fired, err := service.FireDueSchedules(context.Background(), 10, tt.missedAfter)
+
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.fired), fired)
+			assert.Len(t, *outbox, len(tt.fired))
+			var firedRuns, skippedRuns []time.Time
+			for _, run := range *runs {
+				if run.EventID == "" {
+					skippedRuns = append(skippedRuns, run.ScheduledFor)
+				} else {
+					firedRuns = append(firedRuns, run.ScheduledFor)
+				}
+			}
+			assert.Equal(t, tt.fired, firedRuns)
+			assert.Equal(t, tt.skipped, skippedRuns, "every occurrence not fired is recorded")
+			require.Len(t, *updates, 1)
+			assert.Equal(t, tt.status, (*updates)[0].Status)
+			assert.Equal(t, tt.next, (*updates)[0].NextRunAt)
+		})
+	}
+}
+
+func TestFireDueSchedulesSkipsLongBacklogInBatches(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+	outbox := stubOutbox(patches, 0)
+
+	first := time.Now().UTC().Truncate(time.Minute).Add(-3000 * time.Minute)
+	runs, updates := stubFiring(patches,
+		pg.PaymentSchedule{ID: "sch_minutely", AccountID: "acc_1", Kind: pg.ScheduleDeposit, Amount: 1, Currency: "USD", Cron: "* * * * *", CatchUp: pg.ScheduleCatchUpOnce, NextRunAt: first})
+
+	fired, err := service.FireDueSchedules(context.Background(), 1, missedAfter)
+
+	require.NoError(t, err)
+	// None of the first batch is the latest occurrence, so all are skipped
+	// and the schedule stays due.
+	assert.Equal(t, 0, fired)
+	assert.Empty(t, *outbox)
+	assert.Len(t, *runs, 1000)
+	require.Len(t, *updates, 1)
+	assert.Equal(t, pg.ScheduleActive, (*updates)[0].Status)
+	assert.Equal(t, first.Add(1000*time.Minute), (*updates)[0].NextRunAt)
+}
+
+func TestScheduleTransitions(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	current := pg.PaymentSchedule{ID: "sch_1", Cron: "0 9 * * *", Status: pg.ScheduleActive, NextRunAt: time.Now().Add(-48 * time.Hour)}
+	patches.ApplyFunc(pg.LockSchedule,
+		func(_ context.Context, id string, _ *sql.Tx) (pg.PaymentSchedule, error) {
+			if id != current.ID {
+				return pg.PaymentSchedule{}, pg.ErrNotFound
+			}
+			return current, nil
+		})
+	patches.ApplyFunc(pg.UpdateSchedule,
+		func(_ context.Context, _, status string, next time.Time, _ *sql.Tx) (pg.PaymentSchedule, error) {
+			current.Status, current.NextRunAt = status, next
+			return current, nil
+		})
+	ctx := context.Background()
+
+	_, err := service.ResumeSchedule(ctx, "sch_1")
+	assert.ErrorIs(t, err, service.ErrInvalidScheduleTransition)
+
+	s, err := service.PauseSchedule(ctx, "sch_1")
+	require.NoError(t, err)
+	assert.Equal(t, pg.SchedulePaused, s.Status)
+
+	s, err = service.ResumeSchedule(ctx, "sch_1")
+	require.NoError(t, err)
+	assert.Equal(t, pg.ScheduleActive, s.Status)
+	// Occurrences missed while paused are skipped.
+	assert.True(t, s.NextRunAt.After(time.Now()))
+
+	s, err = service.CancelSchedule(ctx, "sch_1")
+	require.NoError(t, err)
+	assert.Equal(t, pg.ScheduleCancelled, s.Status)
+
+	_, err = service.PauseSchedule(ctx, "sch_1")
+	assert.ErrorIs(t, err, service.ErrInvalidScheduleTransition)
+	_, err = service.CancelSchedule(ctx, "sch_missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"ledger/mongo"
+	"ledger/pg"
+	"log"
+	"time"
+)
+
+// Stream event types.
+const (
+	StreamEventBalance = "balance"
+	StreamEventEntry   = "entry"
+)
+
+// StreamEvent is one update pushed to an account stream. ID is the ledger
+// entry's TransactionID, which clients send back to resume; balance
+// snapshots have no ID.
+type StreamEvent struct {
+	ID   string
+	Type string
+	Data any
+}
+
+// BalanceSnapshot is an account's balance at the time it was read.
+type BalanceSnapshot struct {
+	UserID  string  `json:"user_id"`
+	Balance float64 `json:"balance"`
+}
+
+// LedgerEntryUpdate is a ledger entry as pushed to a stream. Balance is the
+// account balance just after the entry was seen, and is omitted for
+// entries replayed on resume.
+type LedgerEntryUpdate struct {
+	UserID        string    `json:"user_id"`
+	Operation     string    `json:"operation"`
+	Amount        float64   `json:"amount"`
+	Timestamp     time.Time `json:"timestamp"`
+	TransactionID string    `json:"transaction_id"`
+	Balance       *float64  `json:"balance,omitempty"`
+}
+
+// StreamAccount pushes userID's balance and new ledger entries to send
+// until ctx is cancelled or send fails. With a lastEventID it first
+// replays the entries written after that one; an unknown ID is ignored and
+// the stream starts from the current balance.
+func StreamAccount(ctx context.Context, userID, lastEventID string, send func(StreamEvent) error) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+
+	// Watch before reading history so nothing written in between is lost;
+	// entries both replayed and watched are sent once.
+	live, watchErr, err := mongo.WatchUserRecords(ctx, userID)
+	if err != nil {
+		return err
+	}
+	replayed := map[string]bool{}
+
+	if lastEventID != "" {
+		missed, err := mongo.GetUserLogsAfter(ctx, userID, lastEventID)
+		if err != nil && !errors.Is(err, mongo.ErrRecordNotFound) {
+			return err
+		}
+		if errors.Is(err, mongo.ErrRecordNotFound) {
+			log.Printf("Stream for user %s cannot resume after unknown event %s\n", userID, lastEventID)
+		}
+		for _, rec := range missed {
+			replayed[recordKey(rec)] = true
+			if err := send(entryEvent(rec, nil)); err != nil {
+				return err
+			}
+		}
+	}
+
+	balance, err := pg.GetBalance(ctx, userID, nil)
+	if err != nil {
+		return err
+	}
+	if err := send(StreamEvent{Type: StreamEventBalance, Data: BalanceSnapshot{UserID: userID, Balance: balance}}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watchErr:
+			return err
+		case rec, ok := <-live:
+			if !ok {
+				// The watcher reports its error before closing.
+				select {
+				case err := <-watchErr:
+					return err
+				default:
+					return nil
+				}
+			}
+			if replayed[recordKey(rec)] {
+				delete(replayed, recordKey(rec))
+				continue
+			}
+
+			balance, err := pg.GetBalance(ctx, userID, nil)
+			if err != nil {
+				return err
+			}
+			if err := send(entryEvent(rec, &balance)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// recordKey identifies a ledger record: one transaction can post several
+// records to an account, such as a deduction and its fee.
+func recordKey(rec mongo.LedgerRecord) string {
+	return rec.TransactionID + "/" + rec.Operation
+}
+
+func entryEvent(rec mongo.LedgerRecord, balance *float64) StreamEvent {
+	return StreamEvent{
+		ID:   rec.TransactionID,
+		Type: StreamEventEntry,
+		Data: LedgerEntryUpdate{
+			UserID:        rec.UserID,
+			Operation:     rec.Operation,
+			Amount:        rec.Amount,
+			Timestamp:     rec.Timestamp,
+			TransactionID: rec.TransactionID,
+			Balance:       balance,
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"ledger/mongo"
+	"ledger/pg"
+	"ledger/service"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamAccountResumesThenStreamsLive(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+
+	live := make(chan mongo.LedgerRecord, 2)
+	patches.ApplyFunc(mongo.WatchUserRecords,
+		func(_ context.Context, userID string) (<-chan mongo.LedgerRecord, <-chan error, error) {
+			assert.Equal(t, "user-1", userID)
+			return live, make(chan error), nil
+		})
+	patches.ApplyFunc(mongo.GetUserLogsAfter,
+		func(_ context.Context, _, transactionID string) ([]mongo.LedgerRecord, error) {
+			assert.Equal(t, "evt-1", transactionID)
+			return []mongo.LedgerRecord{{UserID: "user-1", Operation: "AddBalance", Amount: 5, TransactionID: "evt-2"}}, nil
+		})
+	patches.ApplyFunc(pg.GetBalance,
+		func(_ context.Context, _ string, _ *sql.Tx) (float64, error) {
+			return 95, nil
+		})
+
+	// evt-2 was both replayed and watched; only evt-3 is new.
+	live <- mongo.LedgerRecord{UserID: "user-1", Operation: "AddBalance", Amount: 5, TransactionID: "evt-2"}
+	live <- mongo.LedgerRecord{UserID: "user-1", Operation: "DeductBalance", Amount: -10, TransactionID: "evt-3"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var events []service.StreamEvent
+	err := service.StreamAccount(ctx, "user-1", "evt-1", func(e service.StreamEvent) error {
+		events = append(events, e)
+		if e.ID == "evt-3" {
+			cancel()
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	assert.Equal(t, "evt-2", events[0].ID)
+	assert.Equal(t, service.StreamEventEntry, events[0].Type)
+	assert.Nil(t, events[0].Data.(service.LedgerEntryUpdate).Balance)
+
+	assert.Equal(t, service.StreamEventBalance, events[1].Type)
+	assert.Empty(t, events[1].ID)
+	assert.Equal(t, service.BalanceSnapshot{UserID: "user-1", Balance: 95}, events[1].Data)
+
+	assert.Equal(t, "evt-3", events[2].ID)
+	update := events[2].Data.(service.LedgerEntryUpdate)
+	assert.Equal(t, -10.0, update.Amount)
+	require.NotNil(t, update.Balance)
+	assert.Equal(t, 95.0, *update.Balance)
+}
+
+func TestStreamAccountRequiresUser(t *testing.T) {
+	err := service.StreamAccount(context.Background(), "", "", func(service.StreamEvent) error { return nil })
+
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
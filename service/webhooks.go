@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"ledger/config"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/webhook"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webhookPollInterval     = time.Second
+	webhookBatchSize        = 10
+	webhookDeliveryLogLimit = 100
+	// webhookLeaseMargin is how long a delivery stays leased beyond its
+	// attempt's timeout, for recording the attempt.
+	webhookLeaseMargin = 30 * time.Second
+)
+
+// WebhookRegistration is a request to subscribe a URL to domain events for
+// one account (AccountID) or for every account of a client (ClientID only).
+type WebhookRegistration struct {
+	AccountID  string
+	ClientID   string
+	URL        string
+	EventTypes []string
+}
+
+// RegisterWebhook validates reg and stores a new endpoint with a generated
+// signing secret. The returned endpoint is the only place the secret is
+// shown.
+func RegisterWebhook(ctx context.Context, reg WebhookRegistration) (pg.WebhookEndpoint, error) {
+	if reg.AccountID == "" && reg.ClientID == "" {
+		return pg.WebhookEndpoint{}, fmt.Errorf("%w: account_id or client_id is required", ErrInvalidArgument)
+	}
+	u, err := url.Parse(reg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return pg.WebhookEndpoint{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidArgument)
+	}
+	for _, eventType := range reg.EventTypes {
+		if !slices.Contains(kafka.DomainEventTypes, eventType) {
+			return pg.WebhookEndpoint{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidArgument, eventType)
+		}
+	}
+	if !allowPrivateWebhookHosts {
+		if err := checkWebhookHost(ctx, u.Hostname()); err != nil {
+			return pg.WebhookEndpoint{}, err
+		}
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return pg.WebhookEndpoint{}, err
+	}
+	return pg.CreateWebhookEndpoint(ctx, pg.WebhookEndpoint{
+		AccountID:  reg.AccountID,
+		ClientID:   reg.ClientID,
+		URL:        reg.URL,
+		Secret:     secret,
+		EventTypes: reg.EventTypes,
+	}, nil)
+}
+
+// checkWebhookHost refuses a host that is, or resolves to, an internal
+// address, so the API cannot be used to make the ledger call its own
+// network. Deliveries check the address they dial again.
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve url host %s", ErrInvalidArgument, host)
+	}
+	for _, addr := range addrs {
+		if webhook.IsInternal(addr.IP) {
+			return fmt.Errorf("%w: url host %s is an internal address", ErrInvalidArgument, host)
+		}
+	}
+	return nil
+}
+
+// ListWebhooks returns the active endpoints for an account and/or client.
+func ListWebhooks(ctx context.Context, accountID, clientID string) ([]pg.WebhookEndpoint, error) {
+	if accountID == "" && clientID == "" {
+		return nil, fmt.Errorf("%w: account_id or client_id is required", ErrInvalidArgument)
+	}
+	return pg.ListWebhookEndpoints(ctx, accountID, clientID, nil)
+}
+
+// DeleteWebhook stops deliveries to an endpoint.
+func DeleteWebhook(ctx context.Context, id int64) error {
+	return notFound(pg.DeactivateWebhookEndpoint(ctx, id, nil), "webhook", id)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries to an endpoint.
+func ListWebhookDeliveries(ctx context.Context, endpointID int64) ([]pg.WebhookDelivery, error) {
+	return pg.ListWebhookDeliveries(ctx, endpointID, webhookDeliveryLogLimit, nil)
+}
+
+// GetWebhookDelivery returns a delivery with its attempt log.
+func GetWebhookDelivery(ctx context.Context, id int64) (pg.WebhookDelivery, []pg.WebhookAttempt, error) {
+	delivery, attempts, err := pg.GetWebhookDelivery(ctx, id, nil)
+	return delivery, attempts, notFound(err, "webhook delivery", id)
+}
+
+// ResendWebhookDelivery queues a delivery to be sent again now, whatever
+// its current status, with a fresh retry budget.
+func ResendWebhookDelivery(ctx context.Context, id int64) error {
+	return notFound(pg.ResetWebhookDelivery(ctx, id, nil), "webhook delivery", id)
+}
+
+// allowPrivateWebhookHosts lets endpoints be registered on internal
+// addresses.
+var allowPrivateWebhookHosts bool
+
+// SetWebhookConfig applies the webhook settings RegisterWebhook needs. Call
+// it before serving the API.
+func SetWebhookConfig(cfg config.WebhookConfig) {
+	allowPrivateWebhookHosts = cfg.AllowPrivateHosts
+}
+
+var (
+	webhookDispatcherDone sync.WaitGroup
+	// webhookClient refuses internal addresses; privateWebhookClient is used
+	// instead when they are allowed.
+	webhookClient        = webhook.NewPublicClient()
+	privateWebhookClient = &http.Client{}
+	// webhookLeaseOwner identifies this replica's leases on deliveries.
+	webhookLeaseOwner = newLeaseOwner()
+)
+
+func newLeaseOwner() string {
+	host, _ := os.Hostname()
+	return host + "/" + uuid.New().String()
+}
+
+// StartWebhookDispatcher delivers due webhooks until ctx is cancelled.
+func StartWebhookDispatcher(ctx context.Context, cfg config.WebhookConfig) {
+	webhookDispatcherDone.Add(1)
+	go func() {
+		defer webhookDispatcherDone.Done()
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Webhook dispatcher stopped")
+				return
+			case <-ticker.C:
+				for {
+					n, err := DispatchDueWebhooks(ctx, cfg)
+					if err != nil {
+						log.Printf("Webhook dispatcher: %v\n", err)
+					}
+					if err != nil || n < webhookBatchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+// WaitForWebhookDispatcher blocks until the dispatcher has stopped or ctx
+// expires.
+func WaitForWebhookDispatcher(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		webhookDispatcherDone.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for webhook dispatcher: %w", ctx.Err())
+	}
+}
+
+// DispatchDueWebhooks leases one batch of due deliveries, attempts them
+// concurrently outside any transaction and records each attempt in a short
+// transaction of its own. It returns how many deliveries it attempted. The
+// lease outlasts an attempt's timeout, so replicas never send the same
+// delivery concurrently; one that dies mid-batch leaves its deliveries to
+// be sent again once their leases run out.
+func DispatchDueWebhooks(ctx context.Context, cfg config.WebhookConfig) (int, error) {
+	deliveries, err := pg.LeaseDueWebhookDeliveries(ctx, webhookBatchSize, webhookLeaseOwner, cfg.Timeout+webhookLeaseMargin, nil)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt, status, next := attemptWebhook(ctx, cfg, d)
+			err := pg.InTx(ctx, sql.LevelDefault, pg.DefaultRetryPolicy, func(tx *sql.Tx) error {
+				return pg.RecordWebhookAttempt(ctx, d.ID, webhookLeaseOwner, attempt, status, next, tx)
+			})
+			if errors.Is(err, pg.ErrNotFound) {
+				log.Printf("Webhook delivery %d was taken over before its attempt was recorded\n", d.ID)
+				err = nil
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), errors.Join(errs...)
+}
+
+// attemptWebhook sends one delivery and decides what happens next: done on
+// success, retry with backoff on failure, or failed once attempts run out.
+func attemptWebhook(ctx context.Context, cfg config.WebhookConfig, d pg.DueWebhookDelivery) (pg.WebhookAttempt, string, time.Time) {
+	attemptCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	client := webhookClient
+	if cfg.AllowPrivateHosts {
+		client = privateWebhookClient
+	}
+	start := time.Now()
+	code, err := webhook.Deliver(attemptCtx, client, webhook.Request{
+		DeliveryID: d.ID,
+		URL:        d.URL,
+		Secret:     d.Secret,
+		EventID:    d.EventID,
+		EventType:  d.EventType,
+		Body:       d.Payload,
+	}, start)
+
+	attempt := pg.WebhookAttempt{
+		AttemptedAt:    start,
+		ResponseStatus: code,
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+	if err == nil {
+		return attempt, pg.WebhookSucceeded, start
+	}
+
+	attempt.Error = err.Error()
+	attempts := d.Attempts + 1
+	if attempts >= cfg.MaxAttempts {
+		log.Printf("Webhook delivery %d failed permanently after %d attempts: %v\n", d.ID, attempts, err)
+		return attempt, pg.WebhookFailed, start
+	}
+	return attempt, pg.WebhookPending, start.Add(webhook.Backoff(attempts, cfg.RetryBackoff, cfg.MaxRetryBackoff))
+}
+
+// notFound translates pg.ErrNotFound into ErrNotFound naming the missing
+// resource.
+func notFound(err error, resource string, id int64) error {
+	if errors.Is(err, pg.ErrNotFound) {
+		return fmt.Errorf("%w: %s %d", ErrNotFound, resource, id)
+	}
+	return err
+}
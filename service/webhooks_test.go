@@ -0,0 +1,233 @@
+package service_test
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"ledger/config"
+	"ledger/kafka"
+	"ledger/pg"
+	"ledger/service"
+	"ledger/webhook"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testWebhookConfig = config.WebhookConfig{
+	Timeout:         time.Second,
+	MaxAttempts:     3,
+	RetryBackoff:    time.Minute,
+	MaxRetryBackoff: time.Hour,
+	// The receivers in these tests listen on loopback.
+	AllowPrivateHosts: true,
+}
+
+type recordedAttempt struct {
+	id      int64
+	attempt pg.WebhookAttempt
+	status  string
+	next    time.Time
+}
+
+// stubDeliveries makes the dispatcher lease due and captures what it
+// records, ordered by delivery ID.
+func stubDeliveries(p *gomonkey.Patches, due ...pg.DueWebhookDelivery) *[]recordedAttempt {
+	var recorded []recordedAttempt
+	var mu sync.Mutex
+	p.ApplyFunc(pg.LeaseDueWebhookDeliveries,
+		func(_ context.Context, _ int, _ string, _ time.Duration, _ *sql.Tx) ([]pg.DueWebhookDelivery, error) {
+			return due, nil
+		})
+	p.ApplyFunc(pg.RecordWebhookAttempt,
+		func(_ context.Context, id int64, _ string, attempt pg.WebhookAttempt, status string, next time.Time, _ *sql.Tx) error {
+			mu.Lock()
+			defer mu.Unlock()
+			recorded = append(recorded, recordedAttempt{id, attempt, status, next})
+			slices.SortFunc(recorded, func(a, b recordedAttempt) int { return cmp.Compare(a.id, b.id) })
+			return nil
+		})
+	return &recorded
+}
+
+func dueDelivery(id int64, url string, attempts int) pg.DueWebhookDelivery {
+	return pg.DueWebhookDelivery{
+		WebhookDelivery: pg.WebhookDelivery{
+			ID:        id,
+			EventID:   "evt-" + strconv.FormatInt(id, 10),
+			EventType: kafka.EventTypeBalanceCredited,
+			Payload:   json.RawMessage(`{"type":"BalanceCredited"}`),
+			Attempts:  attempts,
+		},
+		URL:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestDispatchDueWebhooksDeliversSigned(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	verified := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		verified = webhook.Verify("whsec_test", timestamp, body, r.Header.Get(webhook.HeaderSignature))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	recorded := stubDeliveries(patches, dueDelivery(1, receiver.URL, 0))
+
+	n, err := service.DispatchDueWebhooks(context.Background(), testWebhookConfig)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, verified)
+	require.Len(t, *recorded, 1)
+	assert.Equal(t, pg.WebhookSucceeded, (*recorded)[0].status)
+	assert.Equal(t, http.StatusOK, (*recorded)[0].attempt.ResponseStatus)
+	assert.Empty(t, (*recorded)[0].attempt.Error)
+}
+
+func TestDispatchDueWebhooksRetriesThenGivesUp(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	recorded := stubDeliveries(patches,
+		dueDelivery(1, receiver.URL, 1),
+		dueDelivery(2, receiver.URL, testWebhookConfig.MaxAttempts-1),
+	)
+
+	_, err := service.DispatchDueWebhooks(context.Background(), testWebhookConfig)
+
+	require.NoError(t, err)
+	require.Len(t, *recorded, 2)
+
+	retry := (*recorded)[0]
+	assert.Equal(t, pg.WebhookPending, retry.status)
+	assert.Equal(t, http.StatusInternalServerError, retry.attempt.ResponseStatus)
+	assert.NotEmpty(t, retry.attempt.Error)
+	// Second failure: the initial backoff doubled.
+	assert.Equal(t, 2*time.Minute, retry.next.Sub(retry.attempt.AttemptedAt))
+
+	assert.Equal(t, pg.WebhookFailed, (*recorded)[1].status)
+}
+
+func TestRegisterWebhookValidates(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := service.RegisterWebhook(ctx, service.WebhookRegistration{URL: "https://example.com/hook"})
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+
+	_, err = service.RegisterWebhook(ctx, service.WebhookRegistration{AccountID: "user-1", URL: "ftp://example.com"})
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+
+	_, err = service.RegisterWebhook(ctx, service.WebhookRegistration{
+		AccountID:  "user-1",
+		URL:        "https://example.com/hook",
+		EventTypes: []string{"AddBalance"},
+	})
+	assert.ErrorIs(t, err, service.ErrInvalidArgument)
+}
+
+func TestDispatchDueWebhooksDoesNotWaitOnSlowEndpoint(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fast.Close()
+
+	stubDeliveries(patches, dueDelivery(1, slow.URL, 0), dueDelivery(2, fast.URL, 0))
+	var fastRecorded sync.WaitGroup
+	fastRecorded.Add(1)
+	patches.ApplyFunc(pg.RecordWebhookAttempt,
+		func(_ context.Context, id int64, _ string, attempt pg.WebhookAttempt, status string, next time.Time, _ *sql.Tx) error {
+			if id == 2 {
+				fastRecorded.Done()
+			}
+			return nil
+		})
+
+	done := make(chan error)
+	go func() {
+		_, err := service.DispatchDueWebhooks(context.Background(), testWebhookConfig)
+		done <- err
+	}()
+
+	// The fast endpoint's attempt is recorded while the slow one hangs.
+	fastRecorded.Wait()
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestDispatchDueWebhooksSkipsTakenOverDelivery(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	noOpDB(patches)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	stubDeliveries(patches, dueDelivery(1, receiver.URL, 0))
+	patches.ApplyFunc(pg.RecordWebhookAttempt,
+		func(_ context.Context, _ int64, _ string, _ pg.WebhookAttempt, _ string, _ time.Time, _ *sql.Tx) error {
+			return pg.ErrNotFound
+		})
+
+	n, err := service.DispatchDueWebhooks(context.Background(), testWebhookConfig)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRegisterWebhookRefusesInternalHosts(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	patches.ApplyFunc(pg.CreateWebhookEndpoint,
+		func(_ context.Context, ep pg.WebhookEndpoint, _ *sql.Tx) (pg.WebhookEndpoint, error) {
+			return ep, nil
+		})
+	ctx := context.Background()
+
+	for _, url := range []string{"http://127.0.0.1/hook", "http://localhost:8080/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest", "http://[::1]/hook"} {
+		_, err := service.RegisterWebhook(ctx, service.WebhookRegistration{AccountID: "user-1", URL: url})
+		assert.ErrorIs(t, err, service.ErrInvalidArgument, url)
+	}
+
+	_, err := service.RegisterWebhook(ctx, service.WebhookRegistration{AccountID: "user-1", URL: "https://93.184.216.34/hook"})
+	assert.NoError(t, err)
+
+	service.SetWebhookConfig(config.WebhookConfig{AllowPrivateHosts: true})
+	defer service.SetWebhookConfig(config.WebhookConfig{})
+	_, err = service.RegisterWebhook(ctx, service.WebhookRegistration{AccountID: "user-1", URL: "http://127.0.0.1/hook"})
+	assert.NoError(t, err)
+}
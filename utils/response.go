@@ -32,5 +32,5 @@ func RespondWithHTML(w http.ResponseWriter, code int, html string) {
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(code)
 	// json.NewEncoder(w).Encode(payload)
-	fmt.Fprintf(w, html)
+	fmt.Fprint(w, html)
 }
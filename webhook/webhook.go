@@ -0,0 +1,162 @@
+// Package webhook signs and delivers ledger event notifications to partner
+// HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery. Receivers verify HeaderSignature against
+// HeaderTimestamp and the raw body with Verify, and deduplicate on
+// HeaderEventID.
+const (
+	HeaderSignature  = "X-Ledger-Signature"
+	HeaderTimestamp  = "X-Ledger-Timestamp"
+	HeaderEventID    = "X-Ledger-Event-ID"
+	HeaderEventType  = "X-Ledger-Event-Type"
+	HeaderDeliveryID = "X-Ledger-Delivery-ID"
+)
+
+// signaturePrefix names the HMAC scheme so it can change without breaking
+// receivers that check it.
+const signaturePrefix = "sha256="
+
+// Payload is the JSON body posted to endpoints.
+type Payload struct {
+	EventID    string          `json:"event_id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Request is one delivery attempt of a payload to an endpoint.
+type Request struct {
+	DeliveryID int64
+	URL        string
+	Secret     string
+	EventID    string
+	EventType  string
+	Body       []byte
+}
+
+// NewSecret returns a random signing secret for a new endpoint.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the signature of body sent at timestamp (Unix seconds). The
+// timestamp is signed too so a captured request cannot be replayed later
+// with a fresh timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for body sent at timestamp.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Deliver posts req.Body to req.URL, signed at now. It returns the response
+// status code, and an error for transport failures and non-2xx responses.
+func Deliver(ctx context.Context, client *http.Client, req Request, now time.Time) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+
+	timestamp := now.Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(HeaderSignature, Sign(req.Secret, timestamp, req.Body))
+	httpReq.Header.Set(HeaderEventID, req.EventID)
+	httpReq.Header.Set(HeaderEventType, req.EventType)
+	httpReq.Header.Set(HeaderDeliveryID, strconv.FormatInt(req.DeliveryID, 10))
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain a bounded amount so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns how long to wait before retrying after the given number
+// of failed attempts: initial doubled per attempt, capped at max.
+func Backoff(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// ErrInternalAddress is returned for calling an address inside the
+// ledger's own network.
+var ErrInternalAddress = errors.New("webhook address is internal")
+
+// IsInternal reports whether ip is a loopback, link-local, private,
+// unspecified or multicast address, which partners must not be able to
+// make the ledger call.
+func IsInternal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// NewPublicClient returns an HTTP client that refuses to connect to
+// internal addresses. It checks the address actually dialled, so a host
+// name that resolves to an internal address after registration, or a
+// redirect to one, is refused too.
+func NewPublicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || IsInternal(ip) {
+				return fmt.Errorf("%w: %s", ErrInternalAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,114 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"ledger/webhook"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliverSignsRequest(t *testing.T) {
+	secret, err := webhook.NewSecret()
+	require.NoError(t, err)
+
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	now := time.Unix(1700000000, 0)
+	status, err := webhook.Deliver(context.Background(), receiver.Client(), webhook.Request{
+		DeliveryID: 7,
+		URL:        receiver.URL,
+		Secret:     secret,
+		EventID:    "evt-1",
+		EventType:  "BalanceCredited",
+		Body:       []byte(`{"event_id":"evt-1"}`),
+	}, now)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, `{"event_id":"evt-1"}`, string(body))
+	assert.Equal(t, "evt-1", received.Header.Get(webhook.HeaderEventID))
+	assert.Equal(t, "BalanceCredited", received.Header.Get(webhook.HeaderEventType))
+	assert.Equal(t, "7", received.Header.Get(webhook.HeaderDeliveryID))
+
+	timestamp, err := strconv.ParseInt(received.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, now.Unix(), timestamp)
+	signature := received.Header.Get(webhook.HeaderSignature)
+	assert.True(t, webhook.Verify(secret, timestamp, body, signature))
+	assert.False(t, webhook.Verify("other-secret", timestamp, body, signature))
+	assert.False(t, webhook.Verify(secret, timestamp+1, body, signature))
+}
+
+func TestDeliverFailsOnErrorStatus(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	status, err := webhook.Deliver(context.Background(), receiver.Client(), webhook.Request{
+		URL:  receiver.URL,
+		Body: []byte(`{}`),
+	}, time.Now())
+
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestDeliverFailsWhenUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	status, err := webhook.Deliver(context.Background(), http.DefaultClient, webhook.Request{
+		URL:  url,
+		Body: []byte(`{}`),
+	}, time.Now())
+
+	assert.Error(t, err)
+	assert.Zero(t, status)
+}
+
+func TestBackoff(t *testing.T) {
+	initial, max := 30*time.Second, 10*time.Minute
+
+	assert.Equal(t, 30*time.Second, webhook.Backoff(1, initial, max))
+	assert.Equal(t, time.Minute, webhook.Backoff(2, initial, max))
+	assert.Equal(t, 4*time.Minute, webhook.Backoff(4, initial, max))
+	assert.Equal(t, max, webhook.Backoff(6, initial, max))
+	assert.Equal(t, max, webhook.Backoff(60, initial, max))
+}
+
+func TestIsInternal(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0"} {
+		assert.True(t, webhook.IsInternal(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::1"} {
+		assert.False(t, webhook.IsInternal(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestPublicClientRefusesInternalAddress(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request should not reach a loopback endpoint")
+	}))
+	defer receiver.Close()
+
+	_, err := webhook.Deliver(context.Background(), webhook.NewPublicClient(), webhook.Request{URL: receiver.URL}, time.Now())
+
+	assert.ErrorIs(t, err, webhook.ErrInternalAddress)
+}